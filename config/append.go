@@ -29,6 +29,8 @@ func Append(c1, c2 *Config) (*Config, error) {
 		}
 	}
 
+	c.Terraform = mergeTerraform(c1.Terraform, c2.Terraform)
+
 	if len(c1.Modules) > 0 || len(c2.Modules) > 0 {
 		c.Modules = make(
 			[]*Module, 0, len(c1.Modules)+len(c2.Modules))
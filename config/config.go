@@ -20,6 +20,7 @@ type Config struct {
 	// any meaningful directory.
 	Dir string
 
+	Terraform       *Terraform
 	Modules         []*Module
 	ProviderConfigs []*ProviderConfig
 	Resources       []*Resource
@@ -31,6 +32,18 @@ type Config struct {
 	unknownKeys []string
 }
 
+// Terraform is the "terraform" block of a configuration, which declares
+// what the configuration requires of the environment it runs in.
+type Terraform struct {
+	// RequiredVersion is the version constraint that the version of
+	// Terraform must satisfy, such as ">= 0.3.0".
+	RequiredVersion string
+
+	// RequiredProviders maps the names of providers to the version
+	// constraints that they must satisfy.
+	RequiredProviders map[string]string
+}
+
 // Module is a module used within a configuration.
 //
 // This does not represent a module itself, this represents a module
@@ -71,16 +84,18 @@ type Provisioner struct {
 
 // Variable is a variable defined within the configuration.
 type Variable struct {
-	Name        string
-	Default     interface{}
-	Description string
+	Name         string
+	DeclaredType string
+	Default      interface{}
+	Description  string
 }
 
 // Output is an output defined within the configuration. An output is
 // resulting data that is highlighted by Terraform when finished.
 type Output struct {
-	Name      string
-	RawConfig *RawConfig
+	Name        string
+	Description string
+	RawConfig   *RawConfig
 }
 
 // VariableType is the type of value a variable is holding, and returned
@@ -359,6 +374,9 @@ func (o *Output) mergerMerge(m merger) merger {
 	result := *o
 	result.Name = o2.Name
 	result.RawConfig = result.RawConfig.merge(o2.RawConfig)
+	if o2.Description != "" {
+		result.Description = o2.Description
+	}
 
 	return &result
 }
@@ -430,6 +448,9 @@ func (v *Variable) Merge(v2 *Variable) *Variable {
 	// The names should be the same, but the second name always wins.
 	result.Name = v2.Name
 
+	if v2.DeclaredType != "" {
+		result.DeclaredType = v2.DeclaredType
+	}
 	if v2.Default != nil {
 		result.Default = v2.Default
 	}
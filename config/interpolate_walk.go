@@ -9,8 +9,10 @@ import (
 	"github.com/mitchellh/reflectwalk"
 )
 
-// interpRegexp is a regexp that matches interpolations such as ${foo.bar}
-var interpRegexp *regexp.Regexp = regexp.MustCompile(
+// InterpRegexp is a regexp that matches interpolations such as ${foo.bar}.
+// The first group is the dollar signs, of which an even number means the
+// interpolation is escaped, and the second is the expression.
+var InterpRegexp *regexp.Regexp = regexp.MustCompile(
 	`(?i)(\$+)\{([\s*-.,\\/\(\)a-z0-9_"]+)\}`)
 
 // interpolationWalker implements interfaces for the reflectwalk package
@@ -81,7 +83,7 @@ func (w *interpolationWalker) Primitive(v reflect.Value) error {
 	// XXX: This can be a lot more efficient if we used a real
 	// parser. A regexp is a hammer though that will get this working.
 
-	matches := interpRegexp.FindAllStringSubmatch(v.String(), -1)
+	matches := InterpRegexp.FindAllStringSubmatch(v.String(), -1)
 	if len(matches) == 0 {
 		return nil
 	}
@@ -32,6 +32,31 @@ func Load(path string) (*Config, error) {
 	return configTree.Flatten()
 }
 
+// LoadBytes is like Load, except that the contents of the file are given
+// rather than read from disk. The path is only used to determine the
+// format of the configuration and to describe it in errors.
+func LoadBytes(path string, data []byte) (*Config, error) {
+	if ext(path) == "" {
+		return nil, fmt.Errorf(
+			"%s: unknown configuration format. Use '.tf' or '.tf.json' extension",
+			path)
+	}
+
+	raw, err := loadBytesHcl(path, data)
+	if err != nil {
+		return nil, err
+	}
+
+	importTree := &importTree{Path: path, Raw: raw}
+	configTree, err := importTree.ConfigTree()
+	importTree.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return configTree.Flatten()
+}
+
 // LoadDir loads all the Terraform configuration files in a single
 // directory and appends them together.
 //
@@ -76,18 +101,12 @@ func LoadDir(root string) (*Config, error) {
 
 			// Only care about files that are valid to load
 			name := fi.Name()
-			extValue := ext(name)
-			if extValue == "" {
+			if ext(name) == "" {
 				continue
 			}
 
-			// Determine if we're dealing with an override
-			nameNoExt := name[:len(name)-len(extValue)]
-			override := nameNoExt == "override" ||
-				strings.HasSuffix(nameNoExt, "_override")
-
 			path := filepath.Join(root, name)
-			if override {
+			if isOverride(name) {
 				overrides = append(overrides, path)
 			} else {
 				files = append(files, path)
@@ -110,6 +129,70 @@ func LoadDir(root string) (*Config, error) {
 		return nil, err
 	}
 
+	result, err := loadFiles(files, overrides, Load)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mark the directory
+	result.Dir = rootAbs
+
+	return result, nil
+}
+
+// LoadFiles is like LoadDir, except that the files of the directory are
+// given rather than read from disk, for configurations that don't live
+// on disk at all. The files map the names of the files within dir to
+// their contents, and names that aren't Terraform configuration files
+// are ignored. The directory of the configuration is dir as it is given.
+func LoadFiles(dir string, files map[string][]byte) (*Config, error) {
+	var paths, overrides []string
+	contents := make(map[string][]byte)
+	for name, data := range files {
+		if ext(name) == "" {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		contents[path] = data
+		if isOverride(name) {
+			overrides = append(overrides, path)
+		} else {
+			paths = append(paths, path)
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf(
+			"No Terraform configuration files found in directory: %s",
+			dir)
+	}
+
+	result, err := loadFiles(paths, overrides, func(path string) (*Config, error) {
+		return LoadBytes(path, contents[path])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Dir = dir
+
+	return result, nil
+}
+
+// isOverride returns whether the configuration file with the given name
+// is an override file.
+func isOverride(name string) bool {
+	nameNoExt := name[:len(name)-len(ext(name))]
+	return nameNoExt == "override" ||
+		strings.HasSuffix(nameNoExt, "_override")
+}
+
+// loadFiles loads the files with load and appends them together, then
+// merges the overrides into the result.
+func loadFiles(
+	files, overrides []string,
+	load func(string) (*Config, error)) (*Config, error) {
 	var result *Config
 
 	// Sort the files and overrides so we have a deterministic order
@@ -118,7 +201,7 @@ func LoadDir(root string) (*Config, error) {
 
 	// Load all the regular files, append them to each other.
 	for _, f := range files {
-		c, err := Load(f)
+		c, err := load(f)
 		if err != nil {
 			return nil, err
 		}
@@ -135,7 +218,7 @@ func LoadDir(root string) (*Config, error) {
 
 	// Load all the overrides, and merge them into the config
 	for _, f := range overrides {
-		c, err := Load(f)
+		c, err := load(f)
 		if err != nil {
 			return nil, err
 		}
@@ -146,9 +229,6 @@ func LoadDir(root string) (*Config, error) {
 		}
 	}
 
-	// Mark the directory
-	result.Dir = rootAbs
-
 	return result, nil
 }
 
@@ -17,17 +17,19 @@ type hclConfigurable struct {
 
 func (t *hclConfigurable) Config() (*Config, error) {
 	validKeys := map[string]struct{}{
-		"module":   struct{}{},
-		"output":   struct{}{},
-		"provider": struct{}{},
-		"resource": struct{}{},
-		"variable": struct{}{},
+		"module":    struct{}{},
+		"output":    struct{}{},
+		"provider":  struct{}{},
+		"resource":  struct{}{},
+		"terraform": struct{}{},
+		"variable":  struct{}{},
 	}
 
 	type hclVariable struct {
-		Default     interface{}
-		Description string
-		Fields      []string `hcl:",decodedFields"`
+		DeclaredType string `hcl:"type"`
+		Default      interface{}
+		Description  string
+		Fields       []string `hcl:",decodedFields"`
 	}
 
 	var rawConfig struct {
@@ -61,15 +63,25 @@ func (t *hclConfigurable) Config() (*Config, error) {
 			}
 
 			newVar := &Variable{
-				Name:        k,
-				Default:     v.Default,
-				Description: v.Description,
+				Name:         k,
+				DeclaredType: v.DeclaredType,
+				Default:      v.Default,
+				Description:  v.Description,
 			}
 
 			config.Variables = append(config.Variables, newVar)
 		}
 	}
 
+	// Build the terraform block
+	if tf := t.Object.Get("terraform", false); tf != nil {
+		var err error
+		config.Terraform, err = loadTerraformHcl(tf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Build the modules
 	if modules := t.Object.Get("module", false); modules != nil {
 		var err error
@@ -122,8 +134,6 @@ func (t *hclConfigurable) Config() (*Config, error) {
 // loadFileHcl is a fileLoaderFunc that knows how to read HCL
 // files and turn them into hclConfigurables.
 func loadFileHcl(root string) (configurable, []string, error) {
-	var obj *hclobj.Object = nil
-
 	// Read the HCL file and prepare for parsing
 	d, err := ioutil.ReadFile(root)
 	if err != nil {
@@ -131,17 +141,9 @@ func loadFileHcl(root string) (configurable, []string, error) {
 			"Error reading %s: %s", root, err)
 	}
 
-	// Parse it
-	obj, err = hcl.Parse(string(d))
+	result, err := loadBytesHcl(root, d)
 	if err != nil {
-		return nil, nil, fmt.Errorf(
-			"Error parsing %s: %s", root, err)
-	}
-
-	// Start building the result
-	result := &hclConfigurable{
-		File:   root,
-		Object: obj,
+		return nil, nil, err
 	}
 
 	// Dive in, find the imports. This is disabled for now since
@@ -187,6 +189,61 @@ func loadFileHcl(root string) (configurable, []string, error) {
 	return result, nil, nil
 }
 
+// loadBytesHcl parses the contents of the HCL file at root.
+func loadBytesHcl(root string, d []byte) (*hclConfigurable, error) {
+	obj, err := hcl.Parse(string(d))
+	if err != nil {
+		return nil, fmt.Errorf(
+			"Error parsing %s: %s", root, err)
+	}
+
+	return &hclConfigurable{
+		File:   root,
+		Object: obj,
+	}, nil
+}
+
+// loadTerraformHcl turns the "terraform" blocks of the given HCL object
+// into a Terraform. The settings of later blocks override earlier ones.
+func loadTerraformHcl(os *hclobj.Object) (*Terraform, error) {
+	type hclTerraform struct {
+		RequiredVersion   string                   `hcl:"required_version"`
+		RequiredProviders []map[string]interface{} `hcl:"required_providers"`
+	}
+
+	result := new(Terraform)
+	for _, o := range os.Elem(false) {
+		var raw hclTerraform
+		if err := hcl.DecodeObject(&raw, o); err != nil {
+			return nil, fmt.Errorf(
+				"Error reading terraform block: %s", err)
+		}
+
+		if raw.RequiredVersion != "" {
+			result.RequiredVersion = raw.RequiredVersion
+		}
+
+		for _, m := range raw.RequiredProviders {
+			for k, v := range m {
+				s, ok := v.(string)
+				if !ok {
+					return nil, fmt.Errorf(
+						"Error reading terraform block: "+
+							"required provider %s must be a version constraint",
+						k)
+				}
+
+				if result.RequiredProviders == nil {
+					result.RequiredProviders = make(map[string]string)
+				}
+				result.RequiredProviders[k] = s
+			}
+		}
+	}
+
+	return result, nil
+}
+
 // Given a handle to a HCL object, this recurses into the structure
 // and pulls out a list of modules.
 //
@@ -282,6 +339,20 @@ func loadOutputsHcl(os *hclobj.Object) ([]*Output, error) {
 			return nil, err
 		}
 
+		// The description documents the output, it isn't part of the
+		// configuration.
+		var description string
+		if v, ok := config["description"]; ok {
+			description, ok = v.(string)
+			if !ok {
+				return nil, fmt.Errorf(
+					"Error reading config for output %s: "+
+						"description must be a string",
+					n)
+			}
+			delete(config, "description")
+		}
+
 		rawConfig, err := NewRawConfig(config)
 		if err != nil {
 			return nil, fmt.Errorf(
@@ -291,8 +362,9 @@ func loadOutputsHcl(os *hclobj.Object) ([]*Output, error) {
 		}
 
 		result = append(result, &Output{
-			Name:      n,
-			RawConfig: rawConfig,
+			Name:        n,
+			Description: description,
+			RawConfig:   rawConfig,
 		})
 	}
 
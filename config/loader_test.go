@@ -1,7 +1,9 @@
 package config
 
 import (
+	"io/ioutil"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -59,6 +61,28 @@ func TestLoadBasic_empty(t *testing.T) {
 	}
 }
 
+func TestLoadBasic_terraform(t *testing.T) {
+	c, err := Load(filepath.Join(fixtureDir, "terraform.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &Terraform{
+		RequiredVersion: ">= 0.3.0",
+		RequiredProviders: map[string]string{
+			"aws":    "~> 1.0",
+			"consul": ">= 0.1",
+		},
+	}
+	if !reflect.DeepEqual(c.Terraform, expected) {
+		t.Fatalf("bad: %#v", c.Terraform)
+	}
+
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
 func TestLoadBasic_import(t *testing.T) {
 	// Skip because we disabled importing
 	t.Skip()
@@ -162,6 +186,29 @@ func TestLoad_variables(t *testing.T) {
 	}
 }
 
+func TestLoad_outputs(t *testing.T) {
+	c, err := Load(filepath.Join(fixtureDir, "outputs.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	descriptions := make(map[string]string)
+	for _, o := range c.Outputs {
+		descriptions[o.Name] = o.Description
+		if _, ok := o.RawConfig.Raw["description"]; ok {
+			t.Fatalf("bad: %#v", o.RawConfig.Raw)
+		}
+	}
+	expected := map[string]string{"foo": "The foo", "bar": ""}
+	if !reflect.DeepEqual(descriptions, expected) {
+		t.Fatalf("bad: %#v", descriptions)
+	}
+
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
 func TestLoadDir_basic(t *testing.T) {
 	dir := filepath.Join(fixtureDir, "dir-basic")
 	c, err := LoadDir(dir)
@@ -262,6 +309,64 @@ func TestLoadDir_override(t *testing.T) {
 	}
 }
 
+func TestLoadFiles(t *testing.T) {
+	dir := filepath.Join(fixtureDir, "dir-override")
+	files := make(map[string][]byte)
+	for _, n := range []string{
+		"foo_override.tf.json", "one.tf", "override.tf.json", "two.tf",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, n))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		files[n] = data
+	}
+	files["README.md"] = []byte("not a configuration")
+
+	c, err := LoadFiles("/mem/foo", files)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c.Dir != "/mem/foo" {
+		t.Fatalf("bad: %#v", c.Dir)
+	}
+
+	actual := variablesStr(c.Variables)
+	if actual != strings.TrimSpace(dirOverrideVariablesStr) {
+		t.Fatalf("bad:\n%s", actual)
+	}
+
+	actual = resourcesStr(c.Resources)
+	if actual != strings.TrimSpace(dirOverrideResourcesStr) {
+		t.Fatalf("bad:\n%s", actual)
+	}
+
+	actual = outputsStr(c.Outputs)
+	if actual != strings.TrimSpace(dirOverrideOutputsStr) {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestLoadFiles_noConfigs(t *testing.T) {
+	_, err := LoadFiles("/mem/foo", map[string][]byte{
+		"README.md": []byte("not a configuration"),
+	})
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestLoadFiles_bad(t *testing.T) {
+	_, err := LoadFiles("/mem/foo", map[string][]byte{
+		"main.tf": []byte("resource {"),
+	})
+	if err == nil || !strings.Contains(err.Error(), "main.tf") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
 func TestLoad_provisioners(t *testing.T) {
 	c, err := Load(filepath.Join(fixtureDir, "provisioners.tf"))
 	if err != nil {
@@ -25,6 +25,8 @@ func Merge(c1, c2 *Config) (*Config, error) {
 		}
 	}
 
+	c.Terraform = mergeTerraform(c1.Terraform, c2.Terraform)
+
 	// NOTE: Everything below is pretty gross. Due to the lack of generics
 	// in Go, there is some hoop-jumping involved to make this merging a
 	// little more test-friendly and less repetitive. Ironically, making it
@@ -174,3 +176,30 @@ func mergeSlice(m1, m2 []merger) []merger {
 
 	return r
 }
+
+// mergeTerraform merges two terraform blocks, with the settings of t2
+// overriding those of t1. Either may be nil.
+func mergeTerraform(t1, t2 *Terraform) *Terraform {
+	if t1 == nil {
+		return t2
+	}
+	if t2 == nil {
+		return t1
+	}
+
+	result := &Terraform{RequiredVersion: t1.RequiredVersion}
+	if t2.RequiredVersion != "" {
+		result.RequiredVersion = t2.RequiredVersion
+	}
+
+	for _, t := range []*Terraform{t1, t2} {
+		for k, v := range t.RequiredProviders {
+			if result.RequiredProviders == nil {
+				result.RequiredProviders = make(map[string]string)
+			}
+			result.RequiredProviders[k] = v
+		}
+	}
+
+	return result
+}
@@ -144,6 +144,35 @@ func TestMerge(t *testing.T) {
 
 			false,
 		},
+
+		// Terraform blocks merge their settings, with c2 winning.
+		{
+			&Config{
+				Terraform: &Terraform{
+					RequiredVersion:   ">= 0.1",
+					RequiredProviders: map[string]string{"aws": "1.0"},
+				},
+			},
+
+			&Config{
+				Terraform: &Terraform{
+					RequiredVersion:   ">= 0.2",
+					RequiredProviders: map[string]string{"consul": "2.0"},
+				},
+			},
+
+			&Config{
+				Terraform: &Terraform{
+					RequiredVersion: ">= 0.2",
+					RequiredProviders: map[string]string{
+						"aws":    "1.0",
+						"consul": "2.0",
+					},
+				},
+			},
+
+			false,
+		},
 	}
 
 	for i, tc := range cases {
@@ -0,0 +1,22 @@
+package module
+
+import (
+	"fmt"
+)
+
+// resolveAlias expands src with aliases if it is an alias, and otherwise
+// returns src unchanged. An error is returned if the alias isn't known.
+// See LoadOptions.Aliases.
+func resolveAlias(src string, aliases map[string]string) (string, error) {
+	force, name := getForcedGetter(src)
+	if force != "alias" {
+		return src, nil
+	}
+
+	result, ok := aliases[name]
+	if !ok {
+		return "", fmt.Errorf("unknown source alias: %s", name)
+	}
+
+	return result, nil
+}
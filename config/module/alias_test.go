@@ -0,0 +1,32 @@
+package module
+
+import (
+	"testing"
+)
+
+func TestResolveAlias(t *testing.T) {
+	aliases := map[string]string{
+		"vpc": "github.com/hashicorp/vpc",
+	}
+
+	cases := []struct {
+		Input  string
+		Output string
+		Err    bool
+	}{
+		{"alias::vpc", "github.com/hashicorp/vpc", false},
+		{"alias::nope", "", true},
+		{"./foo", "./foo", false},
+		{"git::./foo", "git::./foo", false},
+	}
+
+	for i, tc := range cases {
+		output, err := resolveAlias(tc.Input, aliases)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%d: bad err: %s", i, err)
+		}
+		if output != tc.Output {
+			t.Fatalf("%d: bad output: %s", i, output)
+		}
+	}
+}
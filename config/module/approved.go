@@ -0,0 +1,107 @@
+package module
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// ApprovedModule is a single module version that is allowed by
+// LoadOptions.Approved.
+type ApprovedModule struct {
+	// Source is the source of the module without its version, in any
+	// syntax that a module source can have other than a relative path,
+	// example: "github.com/hashicorp/example".
+	Source string `json:"source"`
+
+	// Version is the value of the parameter that pins the source to a
+	// version: "ref" for git, "rev" for hg, and "ref", "rev", or "version"
+	// for HTTP and the registry. A blank version only allows the source
+	// when it isn't pinned.
+	Version string `json:"version"`
+}
+
+// LoadApprovedFile reads the approved modules from the JSON file at path.
+// The file must contain a list of objects with a "source" and "version",
+// example:
+//
+//	[
+//	    {"source": "github.com/hashicorp/example", "version": "v1.2.0"},
+//	    {"source": "git::https://example.com/subnets.git", "version": "v0.3.1"}
+//	]
+//
+// The result can be assigned to LoadOptions.Approved.
+func LoadApprovedFile(path string) ([]ApprovedModule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var result []ApprovedModule
+	if err := json.NewDecoder(f).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error reading approved file %s: %s", path, err)
+	}
+
+	return result, nil
+}
+
+// checkApproved returns an error if the detected source isn't allowed by
+// approved. See LoadOptions.Approved.
+func checkApproved(source string, approved []ApprovedModule) error {
+	if approved == nil || getScheme(source) == "file" {
+		return nil
+	}
+
+	source, version := sourceVersion(source)
+	for _, a := range approved {
+		detected, err := Detect(a.Source, "")
+		if err != nil {
+			return fmt.Errorf("invalid approved source %s: %s", a.Source, err)
+		}
+
+		if s, _ := sourceVersion(detected); s == source && a.Version == version {
+			return nil
+		}
+	}
+
+	if version == "" {
+		return fmt.Errorf("source %s is not approved without a version", source)
+	}
+
+	return fmt.Errorf("source %s version %s is not approved", source, version)
+}
+
+// sourceVersion splits the detected source into the source without its
+// version and the version it is pinned to, using the parameters from
+// lintPinParams. Any other parameters stay part of the source.
+func sourceVersion(source string) (string, string) {
+	params, ok := lintPinParams[getScheme(source)]
+	if !ok {
+		return source, ""
+	}
+
+	force, src := getForcedGetter(source)
+	u, err := url.Parse(src)
+	if err != nil {
+		return source, ""
+	}
+
+	var version string
+	q := u.Query()
+	for _, p := range params {
+		if v := q.Get(p); v != "" && version == "" {
+			version = v
+		}
+		q.Del(p)
+	}
+	u.RawQuery = q.Encode()
+
+	src = u.String()
+	if force != "" {
+		src = force + "::" + src
+	}
+
+	return src, version
+}
@@ -0,0 +1,112 @@
+package module
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadApprovedFile(t *testing.T) {
+	actual, err := LoadApprovedFile(filepath.Join(fixtureDir, "approved.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []ApprovedModule{
+		{Source: "github.com/hashicorp/foo", Version: "v1.0"},
+		{Source: "git::https://example.com/foo.git", Version: "v1.0"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestLoadApprovedFile_bad(t *testing.T) {
+	_, err := LoadApprovedFile(filepath.Join(fixtureDir, "pins.json"))
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestCheckApproved(t *testing.T) {
+	cases := []struct {
+		Approved []ApprovedModule
+		Source   string
+		Err      bool
+	}{
+		{nil, "git::https://example.com/foo.git", false},
+		{[]ApprovedModule{}, "git::https://example.com/foo.git", true},
+		{[]ApprovedModule{}, "file:///foo", false},
+		{
+			[]ApprovedModule{{"git::https://example.com/foo.git", "v1.0"}},
+			"git::https://example.com/foo.git?ref=v1.0",
+			false,
+		},
+		{
+			[]ApprovedModule{{"git::https://example.com/foo.git", "v1.0"}},
+			"git::https://example.com/foo.git?ref=v1.1",
+			true,
+		},
+		{
+			[]ApprovedModule{{"git::https://example.com/foo.git", "v1.0"}},
+			"git::https://example.com/foo.git",
+			true,
+		},
+		{
+			[]ApprovedModule{{"git::https://example.com/foo.git", ""}},
+			"git::https://example.com/foo.git",
+			false,
+		},
+		{
+			[]ApprovedModule{{"github.com/hashicorp/foo", "v1.0"}},
+			"git::https://github.com/hashicorp/foo.git?ref=v1.0",
+			false,
+		},
+		{
+			[]ApprovedModule{{"https://example.com/foo?a=b", "1.0"}},
+			"https://example.com/foo?version=1.0&a=b",
+			false,
+		},
+		{
+			[]ApprovedModule{{"./foo", "v1.0"}},
+			"git::https://example.com/foo.git?ref=v1.0",
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		err := checkApproved(tc.Source, tc.Approved)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%d: bad: %s", i, err)
+		}
+	}
+}
+
+func TestTreeLoad_approved(t *testing.T) {
+	tree := NewTree("", testConfig(t, "lint"))
+	err := tree.LoadWithOptions(testStorage(t), &LoadOptions{
+		Approved: []ApprovedModule{
+			{"git::https://example.com/foo.git", "v1.0"},
+		},
+	})
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	expected := "module git: source git::https://example.com/foo.git " +
+		"is not approved without a version"
+	if err.Error() != expected {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestTreeLoad_approvedLocal(t *testing.T) {
+	tree := NewTree("", testConfig(t, "basic"))
+	err := tree.LoadWithOptions(testStorage(t), &LoadOptions{
+		Mode:     GetModeGet,
+		Approved: []ApprovedModule{},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
@@ -0,0 +1,217 @@
+package module
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// DownloadBudgetError is the error when a load stopped because the modules
+// it downloaded went over LoadOptions.MaxDownloadBytes.
+//
+// Once the modules that were downloaded add up to more than the budget,
+// downloads that are in progress are canceled and cleaned up if the
+// storage supports it, and no more are started. Only modules that are
+// actually downloaded or updated count, as reported by storages that
+// implement ActionStorage, such as FolderStorage. Modules that were
+// already in the storage or came from its cache or mirror don't count,
+// and neither do local file modules.
+//
+// The size of a module is the size of its files. Storages that implement
+// OptionsStorage, such as FolderStorage, measure downloads while they are
+// written, so a download that goes over the budget, even a single module
+// that is bigger than all of it, is stopped and removed. With other
+// storages a module is only measured once it is downloaded, so the module
+// that goes over the budget is kept.
+type DownloadBudgetError struct {
+	// Max is the budget, and Used is the bytes that were downloaded once
+	// Source went over it.
+	Max    int64
+	Used   int64
+	Source string
+}
+
+func (e *DownloadBudgetError) Error() string {
+	return fmt.Sprintf(
+		"download budget of %d bytes exceeded: %d bytes were downloaded "+
+			"by the time %s was, so the load was stopped",
+		e.Max, e.Used, e.Source)
+}
+
+// downloadBudget tracks the bytes downloaded by a load against
+// LoadOptions.MaxDownloadBytes. A nil downloadBudget never runs out.
+type downloadBudget struct {
+	sync.Mutex
+
+	max      int64
+	used     int64
+	inflight map[string]int64
+	err      *DownloadBudgetError
+	exceeded chan struct{}
+}
+
+// newDownloadBudget returns a downloadBudget of max bytes, or nil if max
+// isn't positive.
+func newDownloadBudget(max int64) *downloadBudget {
+	if max <= 0 {
+		return nil
+	}
+
+	return &downloadBudget{
+		max:      max,
+		inflight: make(map[string]int64),
+		exceeded: make(chan struct{}),
+	}
+}
+
+// add records that downloading the source took n bytes.
+func (b *downloadBudget) add(source string, n int64) {
+	if b == nil {
+		return
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	b.used += n
+	b.check(source)
+}
+
+// progress returns the function that an OptionsStorage reports the bytes
+// written so far by the download of the source to, or nil if the source
+// doesn't count against the budget. The function returns the
+// DownloadBudgetError once the budget is exceeded. done must be called
+// once the download is over.
+func (b *downloadBudget) progress(source string) func(int64) error {
+	if b == nil || getScheme(source) == "file" {
+		return nil
+	}
+
+	return func(n int64) error {
+		b.Lock()
+		defer b.Unlock()
+		b.inflight[source] = n
+		b.check(source)
+		if b.err == nil {
+			return nil
+		}
+
+		return b.err
+	}
+}
+
+// done forgets the bytes reported for the download of the source, which
+// count adds once it is over.
+func (b *downloadBudget) done(source string) {
+	if b == nil {
+		return
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	delete(b.inflight, source)
+}
+
+// check records that the budget was exceeded by the source if the bytes
+// downloaded and being downloaded add up to more than it. The lock must be
+// held.
+func (b *downloadBudget) check(source string) {
+	used := b.used
+	for _, n := range b.inflight {
+		used += n
+	}
+
+	if used > b.max && b.err == nil {
+		b.err = &DownloadBudgetError{Max: b.max, Used: used, Source: source}
+		close(b.exceeded)
+	}
+}
+
+// count adds the size of the source to the budget if getting it from the
+// storage s did the given action, which only downloads count for.
+func (b *downloadBudget) count(s Storage, source string, action ModuleAction) error {
+	if b == nil || getScheme(source) == "file" {
+		return nil
+	}
+	if action != ModuleActionDownloaded && action != ModuleActionUpdated {
+		return nil
+	}
+
+	// The whole source is downloaded, not only its subdirectory
+	base, _ := getDirSubdir(source)
+	dir, ok, err := s.Dir(base)
+	if err != nil || !ok {
+		return err
+	}
+
+	n, err := fileSystemSize(storageFileSystem(s), dir)
+	if err != nil {
+		return fmt.Errorf("error measuring module %s: %s", source, err)
+	}
+
+	b.add(source, n)
+	return nil
+}
+
+// error returns the error for the budget being exceeded, or nil if it
+// wasn't.
+func (b *downloadBudget) error() error {
+	if b == nil {
+		return nil
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	if b.err == nil {
+		return nil
+	}
+
+	return b.err
+}
+
+// cancel returns a channel that is closed once either cancel is closed or
+// the budget is exceeded, for stopping downloads. The returned function
+// must be called once the channel is no longer needed.
+func (b *downloadBudget) cancel(cancel <-chan struct{}) (<-chan struct{}, func()) {
+	if b == nil {
+		return cancel, func() {}
+	}
+
+	result := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-cancel:
+		case <-b.exceeded:
+		case <-done:
+			return
+		}
+
+		close(result)
+	}()
+
+	return result, func() { close(done) }
+}
+
+// fileSystemSize returns the total size of the files within dir.
+func fileSystemSize(fs FileSystem, dir string) (int64, error) {
+	fis, err := fs.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var result int64
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			result += fi.Size()
+			continue
+		}
+
+		n, err := fileSystemSize(fs, filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return 0, err
+		}
+		result += n
+	}
+
+	return result, nil
+}
@@ -0,0 +1,145 @@
+package module
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTreeLoad_downloadBudget(t *testing.T) {
+	g := &testVersionGetter{Version: "1"}
+	Getters["budgettest"] = g
+	defer delete(Getters, "budgettest")
+
+	// Each module is 4 bytes, so the second one goes over
+	opts := &LoadOptions{Mode: GetModeGet, MaxDownloadBytes: 6, Concurrency: 1}
+	storage := testStorage(t)
+	tree := NewTree("", testConfig(t, "download-budget"))
+	err := tree.LoadWithOptions(storage, opts)
+	berr, ok := err.(*DownloadBudgetError)
+	if !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+	if berr.Max != 6 || berr.Used != 8 {
+		t.Fatalf("bad: %#v", berr)
+	}
+	if berr.Source != "budgettest::http://example.com/b" {
+		t.Fatalf("bad: %s", berr.Source)
+	}
+	if g.Calls != 2 {
+		t.Fatalf("bad: %d", g.Calls)
+	}
+
+	// Only the module that went over and the one never started aren't kept
+	var missing []string
+	for _, name := range []string{"a", "b", "c"} {
+		source := "budgettest::http://example.com/" + name
+		_, ok, err := storage.Dir(source)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !ok {
+			missing = append(missing, source)
+		}
+	}
+	if len(missing) != 2 || missing[0] != berr.Source {
+		t.Fatalf("bad: %#v", missing)
+	}
+
+	// What is already downloaded doesn't count again
+	opts.MaxDownloadBytes = 8
+	tree = NewTree("", testConfig(t, "download-budget"))
+	if err := tree.LoadWithOptions(storage, opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if g.Calls != 4 {
+		t.Fatalf("bad: %d", g.Calls)
+	}
+
+	// Updates download everything again
+	opts.Mode = GetModeUpdate
+	tree = NewTree("", testConfig(t, "download-budget"))
+	if _, ok := tree.LoadWithOptions(storage, opts).(*DownloadBudgetError); !ok {
+		t.Fatal("should error")
+	}
+}
+
+func TestTreeLoad_downloadBudgetDisabled(t *testing.T) {
+	g := &testVersionGetter{Version: "1"}
+	Getters["budgettest"] = g
+	defer delete(Getters, "budgettest")
+
+	tree := NewTree("", testConfig(t, "download-budget"))
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if g.Calls != 3 {
+		t.Fatalf("bad: %d", g.Calls)
+	}
+}
+
+func TestTreeLoad_downloadBudgetSingle(t *testing.T) {
+	g := &testLargeGetter{Size: 1024}
+	Getters["budgettest"] = g
+	defer delete(Getters, "budgettest")
+
+	// The first module alone is bigger than the whole budget, and is
+	// stopped while it is being written
+	opts := &LoadOptions{Mode: GetModeGet, MaxDownloadBytes: 100, Concurrency: 1}
+	storage := testStorage(t)
+	tree := NewTree("", testConfig(t, "download-budget"))
+	err := tree.LoadWithOptions(storage, opts)
+	berr, ok := err.(*DownloadBudgetError)
+	if !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+	if berr.Max != 100 || berr.Used < 1024 {
+		t.Fatalf("bad: %#v", berr)
+	}
+	if !g.Canceled {
+		t.Fatal("should be canceled")
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		source := "budgettest::http://example.com/" + name
+		if _, ok, err := storage.Dir(source); err != nil || ok {
+			t.Fatalf("%s: bad: %v %s", name, ok, err)
+		}
+	}
+}
+
+// testLargeGetter is an OptionsGetter that writes Size bytes and then
+// waits to be canceled, like a download that is too big to finish.
+type testLargeGetter struct {
+	testGetter
+
+	Size     int
+	Canceled bool
+}
+
+func (g *testLargeGetter) GetWithOptions(dst string, opts *GetOptions) error {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	path := filepath.Join(dst, "main.tf")
+	if err := ioutil.WriteFile(path, make([]byte, g.Size), 0644); err != nil {
+		return err
+	}
+
+	select {
+	case <-opts.Cancel:
+		g.Canceled = true
+		return fmt.Errorf("canceled")
+	case <-time.After(5 * time.Second):
+		return fmt.Errorf("not canceled")
+	}
+}
+
+func (g *testLargeGetter) Get(dst string, u *url.URL) error {
+	return g.GetWithOptions(dst, &GetOptions{URL: u})
+}
@@ -0,0 +1,165 @@
+package module
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CacheURLEnvVar is the name of the environment variable that can be set
+// to the URL of an HttpCache for FolderStorage to use when it has no Cache
+// configured.
+const CacheURLEnvVar = "TF_MODULE_CACHE_URL"
+
+// Cache is a read-through cache of downloaded modules. FolderStorage
+// consults the cache before getting a module from its source, and stores
+// modules that it gets from their source in the cache.
+type Cache interface {
+	// Get copies the module with the given key into the directory dst,
+	// which doesn't exist yet. It returns false if the module isn't in the
+	// cache.
+	Get(dst, key string) (bool, error)
+
+	// Put stores the module in the directory src in the cache as key.
+	Put(key, src string) error
+}
+
+// HttpCache is a Cache that stores modules as tar archives on an HTTP
+// server, such as an artifact cache running next to the build. A module
+// is fetched with a GET request to the URL followed by the key, and
+// stored with a PUT request to the same URL. The server must respond with
+// a 404 for modules that it doesn't have.
+type HttpCache struct {
+	URL string
+
+	// Client is the HTTP client used to talk to the cache. If nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+}
+
+func (c *HttpCache) Get(dst, key string) (bool, error) {
+	resp, err := c.client().Get(c.url(key))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false, fmt.Errorf("bad response code: %d", resp.StatusCode)
+	}
+
+	f, err := newTempFile(dst, ".tf-cache")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(f.Name())
+	_, err = io.Copy(f, resp.Body)
+	f.Close()
+	if err != nil {
+		return false, err
+	}
+
+	if err := new(TarDecompressor).Decompress(dst, f.Name()); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (c *HttpCache) Put(key, src string) error {
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(tarDir(w, src))
+	}()
+	defer r.Close()
+
+	req, err := http.NewRequest("PUT", c.url(key), r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-tar")
+
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("bad response code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (c *HttpCache) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+
+	return http.DefaultClient
+}
+
+func (c *HttpCache) url(key string) string {
+	return strings.TrimRight(c.URL, "/") + "/" + key
+}
+
+// tarDir writes the contents of the directory src to w as a tar archive
+// that TarDecompressor can unpack. Only directories and regular files can
+// be archived.
+func tarDir(w io.Writer, src string) error {
+	tarW := tar.NewWriter(w)
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return fmt.Errorf("can't archive %s: not a regular file", rel)
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tarW.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tarW, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tarW.Close()
+}
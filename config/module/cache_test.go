@@ -0,0 +1,166 @@
+package module
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestHttpCache_impl(t *testing.T) {
+	var _ Cache = new(HttpCache)
+}
+
+func TestHttpCache(t *testing.T) {
+	server := testCacheServer()
+	defer server.Close()
+
+	c := &HttpCache{URL: server.URL + "/modules/"}
+	dst := filepath.Join(tempDir(t), "module")
+
+	// Nothing is cached at first
+	ok, err := c.Get(dst, "foo")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ok {
+		t.Fatal("should not be cached")
+	}
+
+	if err := c.Put("foo", filepath.Join(fixtureDir, "basic")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ok, err = c.Get(dst, "foo")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ok {
+		t.Fatal("should be cached")
+	}
+
+	for _, name := range []string{"main.tf", "foo/main.tf"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func TestFolderStorage_cache(t *testing.T) {
+	g := new(testCacheGetter)
+	Getters["cachetest"] = g
+	defer delete(Getters, "cachetest")
+
+	server := testCacheServer()
+	defer server.Close()
+
+	cache := &HttpCache{URL: server.URL}
+	module := "cachetest://foo"
+
+	// The first storage gets the source and fills the cache
+	s := &FolderStorage{StorageDir: tempDir(t), Cache: cache}
+	if err := s.Get(module, false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if g.Calls != 1 {
+		t.Fatalf("bad: %d", g.Calls)
+	}
+
+	// Another storage gets it from the cache
+	s = &FolderStorage{StorageDir: tempDir(t), Cache: cache}
+	if err := s.Get(module, false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if g.Calls != 1 {
+		t.Fatalf("bad: %d", g.Calls)
+	}
+	dir, ok, err := s.Dir(module)
+	if err != nil || !ok {
+		t.Fatalf("bad: %v %s", ok, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "main.tf")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Updates always go to the source
+	if err := s.Get(module, true); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if g.Calls != 2 {
+		t.Fatalf("bad: %d", g.Calls)
+	}
+}
+
+func TestFolderStorage_cacheError(t *testing.T) {
+	g := new(testCacheGetter)
+	Getters["cachetest"] = g
+	defer delete(Getters, "cachetest")
+
+	// A cache that isn't reachable is skipped
+	s := &FolderStorage{
+		StorageDir: tempDir(t),
+		Cache:      &HttpCache{URL: "http://127.0.0.1:1"},
+	}
+	if err := s.Get("cachetest://foo", false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if g.Calls != 1 {
+		t.Fatalf("bad: %d", g.Calls)
+	}
+}
+
+// testCacheServer starts an HTTP server that stores whatever is PUT to it.
+func testCacheServer() *httptest.Server {
+	var lock sync.Mutex
+	data := make(map[string][]byte)
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+
+			switch r.Method {
+			case "GET":
+				v, ok := data[r.URL.Path]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+
+				w.Write(v)
+			case "PUT":
+				v, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				data[r.URL.Path] = v
+				w.WriteHeader(http.StatusCreated)
+			default:
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		}))
+}
+
+// testCacheGetter is a Getter that writes a module and counts how many
+// times it was called.
+type testCacheGetter struct {
+	testGetter
+
+	Calls int
+}
+
+func (g *testCacheGetter) Get(dst string, u *url.URL) error {
+	g.Calls++
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(
+		filepath.Join(dst, "main.tf"), []byte("# Hello\n"), 0644)
+}
@@ -0,0 +1,165 @@
+package module
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/terraform/helper/multierror"
+)
+
+// HostDownError is the error when the modules from a host weren't all
+// tried because getting the others failed too many times in a row, which
+// means the host is most likely down rather than the modules being bad.
+// This is only done for loads with LoadOptions.CircuitBreakerFailures.
+type HostDownError struct {
+	// Host is the host that is down.
+	Host string
+
+	// Failures is the number of consecutive failures that gave up on the
+	// host, and Err is the last of them.
+	Failures int
+	Err      error
+
+	// Skipped are the sources from the host that weren't tried.
+	Skipped []string
+}
+
+func (e *HostDownError) Error() string {
+	return fmt.Sprintf(
+		"host %s appears to be down: getting modules from it failed %d "+
+			"times in a row, so %d more were skipped. The last error: %s",
+		e.Host, e.Failures, len(e.Skipped), e.Err)
+}
+
+// hostBreaker tracks the consecutive failures of each host for
+// LoadOptions.CircuitBreakerFailures. There is one for the whole load, so
+// the failures of a host count across the levels of the tree. A nil
+// hostBreaker allows every source.
+type hostBreaker struct {
+	sync.Mutex
+
+	threshold int
+	failures  map[string]int
+	last      map[string]error
+	skipped   map[string][]string
+}
+
+// newHostBreaker returns a hostBreaker that opens the circuit of a host
+// after threshold consecutive failures, or nil if threshold isn't
+// positive.
+func newHostBreaker(threshold int) *hostBreaker {
+	if threshold < 1 {
+		return nil
+	}
+
+	return &hostBreaker{
+		threshold: threshold,
+		failures:  make(map[string]int),
+		last:      make(map[string]error),
+		skipped:   make(map[string][]string),
+	}
+}
+
+// allow returns whether the source should be tried, which is unless the
+// circuit of its host is open. Sources that aren't allowed are recorded
+// as skipped.
+func (b *hostBreaker) allow(source string) bool {
+	if b == nil {
+		return true
+	}
+
+	host := sourceHost(source)
+	if host == "" {
+		return true
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	if b.failures[host] < b.threshold {
+		return true
+	}
+
+	b.skipped[host] = append(b.skipped[host], source)
+	return false
+}
+
+// done records whether trying the source failed.
+func (b *hostBreaker) done(source string, err error) {
+	if b == nil {
+		return
+	}
+
+	host := sourceHost(source)
+	if host == "" {
+		return
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	if err == nil {
+		if b.failures[host] < b.threshold {
+			b.failures[host] = 0
+		}
+
+		return
+	}
+
+	b.failures[host]++
+	b.last[host] = err
+}
+
+// err returns a HostDownError for each host with skipped sources, or nil
+// if nothing was skipped.
+func (b *hostBreaker) err() error {
+	if b == nil {
+		return nil
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	hosts := make([]string, 0, len(b.skipped))
+	for host := range b.skipped {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	var result []error
+	for _, host := range hosts {
+		skipped := make([]string, len(b.skipped[host]))
+		copy(skipped, b.skipped[host])
+		sort.Strings(skipped)
+
+		result = append(result, &HostDownError{
+			Host:     host,
+			Failures: b.threshold,
+			Err:      b.last[host],
+			Skipped:  skipped,
+		})
+	}
+
+	switch len(result) {
+	case 0:
+		return nil
+	case 1:
+		return result[0]
+	default:
+		return &multierror.Error{Errors: result}
+	}
+}
+
+// sourceHost returns the host that the source is gotten from, or a blank
+// string if it doesn't have one, such as a local file.
+func sourceHost(source string) string {
+	_, source = getForcedGetter(source)
+	source, _ = getDirSubdir(source)
+
+	u, err := url.Parse(source)
+	if err != nil {
+		return ""
+	}
+
+	return u.Host
+}
@@ -0,0 +1,178 @@
+package module
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTreeLoad_circuitBreaker(t *testing.T) {
+	g := new(testDownGetter)
+	Getters["breakertest"] = g
+	defer delete(Getters, "breakertest")
+
+	tree := NewTree("", testConfig(t, "circuit-breaker"))
+	err := tree.LoadWithOptions(testStorage(t), &LoadOptions{
+		Mode:                   GetModeGet,
+		CircuitBreakerFailures: 2,
+		Concurrency:            1,
+	})
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	herr, ok := err.(*HostDownError)
+	if !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+	if herr.Host != "down.example.com" || herr.Failures != 2 {
+		t.Fatalf("bad: %#v", herr)
+	}
+	if len(herr.Skipped) != 2 {
+		t.Fatalf("bad: %#v", herr.Skipped)
+	}
+	if n := atomic.LoadInt32(&g.Down); n != 2 {
+		t.Fatalf("bad: %d", n)
+	}
+	if n := atomic.LoadInt32(&g.Up); n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestTreeLoad_circuitBreakerDisabled(t *testing.T) {
+	g := new(testDownGetter)
+	Getters["breakertest"] = g
+	defer delete(Getters, "breakertest")
+
+	tree := NewTree("", testConfig(t, "circuit-breaker"))
+	err := tree.Load(testStorage(t), GetModeGet)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if _, ok := err.(*HostDownError); ok {
+		t.Fatalf("bad: %s", err)
+	}
+	if n := atomic.LoadInt32(&g.Down); n != 4 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestGetSources_circuitBreakerLevels(t *testing.T) {
+	g := new(testDownGetter)
+	Getters["breakertest"] = g
+	defer delete(Getters, "breakertest")
+
+	// Each call is a level of the same load, sharing its breaker
+	s := testStorage(t)
+	breaker := newHostBreaker(2)
+	get := func(names ...string) error {
+		var modules []*Module
+		sources := make(map[string]string)
+		for _, n := range names {
+			modules = append(modules, &Module{Name: n})
+			sources[n] = "breakertest::http://down.example.com/" + n
+		}
+
+		l := &loadState{LoadOptions: &LoadOptions{Concurrency: 1}, breaker: breaker}
+		_, err := getSources(s, l, modules, sources, nil)
+		return err
+	}
+
+	if err := get("a"); err == nil {
+		t.Fatal("should error")
+	}
+	err := get("b", "c", "d")
+	herr, ok := err.(*HostDownError)
+	if !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+	if len(herr.Skipped) != 2 {
+		t.Fatalf("bad: %#v", herr.Skipped)
+	}
+	if n := atomic.LoadInt32(&g.Down); n != 2 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestHostBreaker(t *testing.T) {
+	b := newHostBreaker(2)
+	down := "git::https://down.example.com/foo.git//modules/a?ref=v1"
+
+	// Successes reset the failures
+	b.done(down, fmt.Errorf("timeout"))
+	b.done(down, nil)
+	b.done(down, fmt.Errorf("timeout"))
+	if !b.allow(down) {
+		t.Fatal("should allow")
+	}
+
+	b.done(down, fmt.Errorf("timeout"))
+	if b.allow(down) {
+		t.Fatal("should not allow")
+	}
+	if !b.allow("https://up.example.com/foo") {
+		t.Fatal("should allow")
+	}
+
+	// Sources without a host are always allowed
+	b.done("file:///foo", fmt.Errorf("missing"))
+	b.done("file:///foo", fmt.Errorf("missing"))
+	if !b.allow("file:///foo") {
+		t.Fatal("should allow")
+	}
+
+	err, ok := b.err().(*HostDownError)
+	if !ok {
+		t.Fatalf("bad: %#v", b.err())
+	}
+	if err.Host != "down.example.com" {
+		t.Fatalf("bad: %#v", err)
+	}
+	if !reflect.DeepEqual(err.Skipped, []string{down}) {
+		t.Fatalf("bad: %#v", err.Skipped)
+	}
+	if err.Err.Error() != "timeout" {
+		t.Fatalf("bad: %s", err.Err)
+	}
+
+	// A nil breaker allows everything
+	b = newHostBreaker(0)
+	b.done(down, fmt.Errorf("timeout"))
+	if !b.allow(down) || b.err() != nil {
+		t.Fatal("should allow")
+	}
+}
+
+// testDownGetter is a Getter that fails for down.example.com and writes a
+// configuration for every other host, counting both.
+type testDownGetter struct {
+	Down int32
+	Up   int32
+}
+
+func (g *testDownGetter) Get(dst string, u *url.URL) error {
+	if u.Host == "down.example.com" {
+		atomic.AddInt32(&g.Down, 1)
+		return fmt.Errorf("connection timed out")
+	}
+
+	atomic.AddInt32(&g.Up, 1)
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dst, "main.tf"), nil, 0644)
+}
+
+func (g *testDownGetter) UpdateAvailable(string, *url.URL) (bool, error) {
+	return true, nil
+}
+
+func (g *testDownGetter) Check(*url.URL) error {
+	return nil
+}
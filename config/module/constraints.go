@@ -0,0 +1,126 @@
+package module
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+)
+
+// LoadConstraintsFile reads the constraints from the JSON file at path.
+// The file must contain an object that maps sources to constraints,
+// example:
+//
+//	{
+//	    "github.com/hashicorp/example": "~> 1.2",
+//	    "registry.example.com/hashicorp/vpc/aws": ">= 2.0, < 3.0"
+//	}
+//
+// The result can be assigned to LoadOptions.Constraints.
+func LoadConstraintsFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var result map[string]string
+	if err := json.NewDecoder(f).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error reading constraints file %s: %s", path, err)
+	}
+
+	return result, nil
+}
+
+// applyConstraints applies the constraints to the detected source,
+// returning the source to get. Registry sources have the constraints added
+// to their version, and other sources are checked against them. See
+// LoadOptions.Constraints.
+func applyConstraints(
+	source string, constraints map[string]string) (string, error) {
+	if len(constraints) == 0 {
+		return source, nil
+	}
+	if _, ok := lintPinParams[getScheme(source)]; !ok {
+		return source, nil
+	}
+
+	// Sorted so that the first failing constraint is the same every time
+	keys := make([]string, 0, len(constraints))
+	for k := range constraints {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	base, v := sourceVersion(source)
+	registry := getScheme(source) == "registry"
+	matched := false
+	for _, k := range keys {
+		detected, err := Detect(k, "")
+		if err != nil {
+			return "", fmt.Errorf("invalid constrained source %s: %s", k, err)
+		}
+		if s, _ := sourceVersion(detected); s != base {
+			continue
+		}
+
+		c := constraints[k]
+		constraint, err := parseVersionConstraint(c)
+		if err != nil {
+			return "", fmt.Errorf("constraint for %s: %s", k, err)
+		}
+
+		if registry {
+			if v != "" {
+				c = v + ", " + c
+			}
+
+			v = c
+			matched = true
+			continue
+		}
+
+		if v == "" {
+			return "", fmt.Errorf(
+				"source %s must be pinned to a version matching %s", base, c)
+		}
+		parsed, err := parseVersion(v)
+		if err != nil {
+			return "", fmt.Errorf(
+				"source %s is pinned to %s, which isn't a version matching %s",
+				base, v, c)
+		}
+		if !constraint.Check(parsed) {
+			return "", fmt.Errorf(
+				"source %s version %s doesn't satisfy constraint %s", base, v, c)
+		}
+	}
+
+	if !matched {
+		return source, nil
+	}
+
+	return sourceWithVersion(source, v)
+}
+
+// sourceWithVersion sets the "version" parameter of the detected source
+// to v.
+func sourceWithVersion(source, v string) (string, error) {
+	force, src := getForcedGetter(source)
+	u, err := url.Parse(src)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("version", v)
+	u.RawQuery = q.Encode()
+
+	src = u.String()
+	if force != "" {
+		src = force + "::" + src
+	}
+
+	return src, nil
+}
@@ -0,0 +1,132 @@
+package module
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadConstraintsFile(t *testing.T) {
+	actual, err := LoadConstraintsFile(filepath.Join(fixtureDir, "constraints.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]string{
+		"github.com/hashicorp/foo":               "~> 1.2",
+		"registry.example.com/hashicorp/vpc/aws": ">= 2.0, < 3.0",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestLoadConstraintsFile_bad(t *testing.T) {
+	_, err := LoadConstraintsFile(filepath.Join(fixtureDir, "approved.json"))
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestApplyConstraints(t *testing.T) {
+	constraints := map[string]string{
+		"github.com/hashicorp/foo":               "~> 1.2",
+		"registry.example.com/hashicorp/vpc/aws": ">= 2.0, < 3.0",
+	}
+
+	cases := []struct {
+		Constraints map[string]string
+		Input       string
+		Output      string
+		Err         bool
+	}{
+		{
+			nil,
+			"git::https://github.com/hashicorp/foo.git",
+			"git::https://github.com/hashicorp/foo.git",
+			false,
+		},
+		{
+			constraints,
+			"git::https://github.com/hashicorp/foo.git?ref=v1.3.0",
+			"git::https://github.com/hashicorp/foo.git?ref=v1.3.0",
+			false,
+		},
+		{
+			constraints,
+			"git::https://github.com/hashicorp/foo.git?ref=v2.0.0",
+			"",
+			true,
+		},
+		{
+			constraints,
+			"git::https://github.com/hashicorp/foo.git?ref=master",
+			"",
+			true,
+		},
+		{
+			constraints,
+			"git::https://github.com/hashicorp/foo.git",
+			"",
+			true,
+		},
+		{
+			constraints,
+			"git::https://github.com/hashicorp/bar.git",
+			"git::https://github.com/hashicorp/bar.git",
+			false,
+		},
+		{
+			constraints,
+			"file:///foo",
+			"file:///foo",
+			false,
+		},
+		{
+			constraints,
+			"registry::https://registry.example.com/hashicorp/vpc/aws",
+			"registry::https://registry.example.com/hashicorp/vpc/aws?version=%3E%3D+2.0%2C+%3C+3.0",
+			false,
+		},
+		{
+			constraints,
+			"registry::https://registry.example.com/hashicorp/vpc/aws?version=~>2.1",
+			"registry::https://registry.example.com/hashicorp/vpc/aws?version=~%3E2.1%2C+%3E%3D+2.0%2C+%3C+3.0",
+			false,
+		},
+		{
+			map[string]string{"github.com/hashicorp/foo": "nope"},
+			"git::https://github.com/hashicorp/foo.git?ref=v1.3.0",
+			"",
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		output, err := applyConstraints(tc.Input, tc.Constraints)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if output != tc.Output {
+			t.Fatalf("%d: bad: %s", i, output)
+		}
+	}
+}
+
+func TestTreeLoad_constraints(t *testing.T) {
+	tree := NewTree("", testConfig(t, "lint"))
+	err := tree.LoadWithOptions(testStorage(t), &LoadOptions{
+		Constraints: map[string]string{
+			"git::https://example.com/foo.git": "~> 1.0",
+		},
+	})
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	expected := "module git: source git::https://example.com/foo.git " +
+		"must be pinned to a version matching ~> 1.0"
+	if err.Error() != expected {
+		t.Fatalf("bad: %s", err)
+	}
+}
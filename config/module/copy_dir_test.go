@@ -0,0 +1,81 @@
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyDir(t *testing.T) {
+	dst := tempDir(t)
+	if err := copyDir(dst, filepath.Join(fixtureDir, "basic")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Verify the files exist
+	for _, p := range []string{"main.tf", "foo/main.tf"} {
+		if _, err := os.Stat(filepath.Join(dst, p)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func TestCopyDir_mode(t *testing.T) {
+	src := tempDir(t)
+	if err := os.MkdirAll(filepath.Join(src, "scripts"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testWriteFile(t, filepath.Join(src, "main.tf"), "")
+	script := filepath.Join(src, "scripts", "setup.sh")
+	testWriteFile(t, script, "#!/bin/sh\n")
+	if err := os.Chmod(script, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dst := tempDir(t)
+	if err := copyDir(dst, src); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	testFileExecutable(t, filepath.Join(dst, "scripts", "setup.sh"), true)
+	testFileExecutable(t, filepath.Join(dst, "main.tf"), false)
+}
+
+func TestCopyDir_symlink(t *testing.T) {
+	src := tempDir(t)
+	target, err := filepath.Abs(filepath.Join(fixtureDir, "basic"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Symlink(target, src); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(src)
+
+	dst := tempDir(t)
+	if err := copyDir(dst, src); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The symlink itself is copied
+	actual, err := os.Readlink(dst)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual != target {
+		t.Fatalf("bad: %s", actual)
+	}
+}
+
+// testFileExecutable checks whether the file at path is executable by its
+// owner.
+func testFileExecutable(t *testing.T, path string, expected bool) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if actual := fi.Mode()&0100 != 0; actual != expected {
+		t.Fatalf("%s: bad mode: %s", path, fi.Mode())
+	}
+}
@@ -0,0 +1,320 @@
+package module
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+// ValidateDataFlow checks that values don't flow between the modules of
+// the tree in a cycle. Modules can't import each other in a cycle, but
+// sibling modules can still be wired so that each one's output is computed
+// from the other's: module "a" is given "${module.b.out}", and the output
+// "out" of module "b" is computed from a variable that is given
+// "${module.a.out}". Neither output can ever be known.
+//
+// Values flow from the variables, resources, and module outputs that are
+// referenced into the module parameters, outputs, and resources that
+// reference them, following the configurations of the modules within the
+// tree. Cycles between the resources of a single module are left to
+// Terraform, and only cycles that pass through more than one module are
+// reported, as a TreeError for the innermost module that contains the
+// whole cycle.
+//
+// Load must be called prior to calling ValidateDataFlow or an error will
+// be returned.
+func (t *Tree) ValidateDataFlow() error {
+	if !t.Loaded() {
+		return fmt.Errorf("tree must be loaded before calling ValidateDataFlow")
+	}
+
+	graph := make(map[flowNode][]flowNode)
+	t.dataFlowGraph(nil, graph)
+
+	cycle := flowCycle(graph)
+	if cycle == nil {
+		return nil
+	}
+
+	// The cycle belongs to the deepest module with all of it inside
+	prefix := strings.Split(cycle[0].Path, ".")
+	steps := make([]string, len(cycle))
+	for i, n := range cycle {
+		steps[i] = n.String()
+
+		path := strings.Split(n.Path, ".")
+		j := 0
+		for j < len(prefix) && j < len(path) && prefix[j] == path[j] {
+			j++
+		}
+		prefix = prefix[:j]
+	}
+
+	name := []string{t.Name()}
+	for _, n := range prefix {
+		if n != "" {
+			name = append([]string{n}, name...)
+		}
+	}
+
+	return &TreeError{
+		Name: name,
+		Err: fmt.Errorf(
+			"values flow between modules in a cycle: %s",
+			strings.Join(steps, " -> ")),
+	}
+}
+
+// flowNode is a value within a tree: a variable, output, or resource of
+// the module at Path, which is the module names from the tree joined by ".".
+type flowNode struct {
+	Path string
+	Kind string
+	Name string
+}
+
+func (n flowNode) String() string {
+	var prefix string
+	if n.Path != "" {
+		prefix = "module." + strings.Replace(n.Path, ".", ".module.", -1) + "."
+	}
+
+	switch n.Kind {
+	case "resource":
+		return prefix + n.Name
+	default:
+		return prefix + n.Kind + "." + n.Name
+	}
+}
+
+// dataFlowGraph adds the flow of values within the tree, whose module is
+// at path, and its loaded children to graph, which maps each value to the
+// values that are computed from it.
+func (t *Tree) dataFlowGraph(path []string, graph map[flowNode][]flowNode) {
+	key := strings.Join(path, ".")
+	add := func(to flowNode, raw *config.RawConfig) {
+		if raw == nil {
+			return
+		}
+
+		for _, v := range raw.Variables {
+			if from, ok := flowReference(path, v); ok {
+				graph[from] = append(graph[from], to)
+			}
+		}
+	}
+
+	children := t.Children()
+	for _, m := range t.config.Modules {
+		childPath := append(path[:len(path):len(path)], m.Name)
+		if m.RawConfig != nil {
+			// Each parameter is the variable of the same name in the module
+			for k, v := range m.RawConfig.Raw {
+				raw, err := config.NewRawConfig(map[string]interface{}{k: v})
+				if err != nil {
+					continue
+				}
+
+				add(flowNode{strings.Join(childPath, "."), "var", k}, raw)
+			}
+		}
+
+		if c, ok := children[m.Name]; ok {
+			c.dataFlowGraph(childPath, graph)
+		}
+	}
+
+	for _, o := range t.config.Outputs {
+		add(flowNode{key, "output", o.Name}, o.RawConfig)
+	}
+
+	for _, r := range t.config.Resources {
+		to := flowNode{key, "resource", r.Id()}
+		add(to, r.RawConfig)
+		for _, p := range r.Provisioners {
+			add(to, p.RawConfig)
+			add(to, p.ConnInfo)
+		}
+		for _, d := range r.DependsOn {
+			from := flowNode{key, "resource", d}
+			graph[from] = append(graph[from], to)
+		}
+	}
+}
+
+// flowReference returns the value that the interpolated variable within
+// the module at path refers to, if it refers to one that flows.
+func flowReference(path []string, v config.InterpolatedVariable) (flowNode, bool) {
+	key := strings.Join(path, ".")
+	switch v := v.(type) {
+	case *config.UserVariable:
+		return flowNode{key, "var", v.Name}, true
+	case *config.ResourceVariable:
+		return flowNode{key, "resource", v.ResourceId()}, true
+	case *config.ModuleVariable:
+		module := strings.Join(append(path[:len(path):len(path)], v.Name), ".")
+		return flowNode{module, "output", v.Field}, true
+	default:
+		return flowNode{}, false
+	}
+}
+
+// flowCycle returns a cycle in the graph that passes through more than one
+// module, starting and ending with the same value, or nil if there isn't
+// one. The same cycle is returned every time for the same graph.
+func flowCycle(graph map[flowNode][]flowNode) []flowNode {
+	for _, scc := range flowComponents(graph) {
+		in := make(map[flowNode]struct{})
+		for _, n := range scc {
+			in[n] = struct{}{}
+		}
+
+		// A cycle through more than one module has an edge between two
+		// modules, and the rest of it leads back within the component.
+		for _, from := range scc {
+			for _, to := range flowSorted(graph[from]) {
+				if _, ok := in[to]; !ok || to.Path == from.Path {
+					continue
+				}
+
+				back := flowPath(graph, in, to, from)
+				return append([]flowNode{from}, back...)
+			}
+		}
+	}
+
+	return nil
+}
+
+// flowComponents returns the strongly connected components of the graph
+// that have more than one value, each sorted, in order.
+func flowComponents(graph map[flowNode][]flowNode) [][]flowNode {
+	var nodes []flowNode
+	for n := range graph {
+		nodes = append(nodes, n)
+	}
+	nodes = flowSorted(nodes)
+
+	// Tarjan's algorithm
+	index := make(map[flowNode]int)
+	low := make(map[flowNode]int)
+	onStack := make(map[flowNode]bool)
+	var stack []flowNode
+	var result [][]flowNode
+	var visit func(n flowNode)
+	visit = func(n flowNode) {
+		index[n] = len(index)
+		low[n] = index[n]
+		stack = append(stack, n)
+		onStack[n] = true
+
+		for _, next := range flowSorted(graph[n]) {
+			if _, ok := index[next]; !ok {
+				visit(next)
+				if low[next] < low[n] {
+					low[n] = low[next]
+				}
+			} else if onStack[next] && index[next] < low[n] {
+				low[n] = index[next]
+			}
+		}
+
+		if low[n] != index[n] {
+			return
+		}
+
+		var scc []flowNode
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			scc = append(scc, top)
+			if top == n {
+				break
+			}
+		}
+		if len(scc) > 1 {
+			result = append(result, flowSorted(scc))
+		}
+	}
+	for _, n := range nodes {
+		if _, ok := index[n]; !ok {
+			visit(n)
+		}
+	}
+
+	sort.Sort(flowComponentSort(result))
+	return result
+}
+
+// flowPath returns the shortest path from start to end in the graph,
+// using only the values in nodes, not including start.
+func flowPath(
+	graph map[flowNode][]flowNode, nodes map[flowNode]struct{},
+	start, end flowNode) []flowNode {
+	prev := map[flowNode]flowNode{start: start}
+	queue := []flowNode{start}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if n == end {
+			break
+		}
+
+		for _, next := range flowSorted(graph[n]) {
+			if _, ok := nodes[next]; !ok {
+				continue
+			}
+			if _, ok := prev[next]; ok {
+				continue
+			}
+
+			prev[next] = n
+			queue = append(queue, next)
+		}
+	}
+
+	result := []flowNode{end}
+	for n := end; n != start; n = prev[n] {
+		result = append([]flowNode{prev[n]}, result...)
+	}
+
+	return result
+}
+
+// flowSorted returns a sorted copy of the values.
+func flowSorted(nodes []flowNode) []flowNode {
+	result := make([]flowNode, len(nodes))
+	copy(result, nodes)
+	sort.Sort(flowNodeSort(result))
+	return result
+}
+
+// flowNodeSort implements sort.Interface to sort values by path, kind,
+// and name.
+type flowNodeSort []flowNode
+
+func (s flowNodeSort) Len() int      { return len(s) }
+func (s flowNodeSort) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s flowNodeSort) Less(i, j int) bool {
+	if s[i].Path != s[j].Path {
+		return s[i].Path < s[j].Path
+	}
+	if s[i].Kind != s[j].Kind {
+		return s[i].Kind < s[j].Kind
+	}
+
+	return s[i].Name < s[j].Name
+}
+
+// flowComponentSort implements sort.Interface to sort sorted components
+// by their first value.
+type flowComponentSort [][]flowNode
+
+func (s flowComponentSort) Len() int      { return len(s) }
+func (s flowComponentSort) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s flowComponentSort) Less(i, j int) bool {
+	return flowNodeSort{s[i][0], s[j][0]}.Less(0, 1)
+}
@@ -0,0 +1,67 @@
+package module
+
+import (
+	"testing"
+)
+
+func TestTreeValidateDataFlow(t *testing.T) {
+	cases := []struct {
+		Fixture string
+		Name    []string
+		Err     string
+	}{
+		{"basic", nil, ""},
+		{"dataflow-ok", nil, ""},
+		{
+			"dataflow-cycle",
+			[]string{"<root>"},
+			"module <root>: values flow between modules in a cycle: " +
+				"module.a.output.out -> module.b.var.in -> " +
+				"module.b.output.out -> module.a.var.in -> " +
+				"module.a.output.out",
+		},
+		{
+			"dataflow-nested",
+			[]string{"parent", "<root>"},
+			"module parent.<root>: values flow between modules in a cycle: " +
+				"module.parent.module.a.output.out -> " +
+				"module.parent.module.b.var.in -> " +
+				"module.parent.module.b.output.out -> " +
+				"module.parent.module.a.var.in -> " +
+				"module.parent.module.a.output.out",
+		},
+	}
+
+	for _, tc := range cases {
+		tree := NewTree("", testConfig(t, tc.Fixture))
+		if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+			t.Fatalf("%s: err: %s", tc.Fixture, err)
+		}
+
+		err := tree.ValidateDataFlow()
+		if tc.Err == "" {
+			if err != nil {
+				t.Fatalf("%s: err: %s", tc.Fixture, err)
+			}
+			continue
+		}
+
+		verr, ok := err.(*TreeError)
+		if !ok {
+			t.Fatalf("%s: bad: %#v", tc.Fixture, err)
+		}
+		if len(verr.Name) != len(tc.Name) || verr.Name[0] != tc.Name[0] {
+			t.Fatalf("%s: bad: %#v", tc.Fixture, verr.Name)
+		}
+		if verr.Error() != tc.Err {
+			t.Fatalf("%s: bad: %s", tc.Fixture, verr)
+		}
+	}
+}
+
+func TestTreeValidateDataFlow_notLoaded(t *testing.T) {
+	tree := NewTree("", testConfig(t, "dataflow-cycle"))
+	if err := tree.ValidateDataFlow(); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -0,0 +1,107 @@
+package module
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+// DependenciesFile is the name of the file in the directory of a module
+// that declares the other modules it needs, beyond the ones it imports
+// with module blocks, for modules that are extended with plugin modules.
+// It is only read by loads with LoadOptions.DeclaredDependencies. The
+// file must contain a single object mapping names to sources, just like a
+// pins file, example:
+//
+//	{
+//	    "logging": "github.com/hashicorp/logging?ref=v1.0.0",
+//	    "metrics": "./plugins/metrics"
+//	}
+//
+// Each dependency is imported as if the module had a module block with
+// that name and source and no parameters, so it is downloaded, loaded,
+// and validated like any other module, and can't have required variables.
+// Relative sources are relative to the module. A name that is also used
+// by a module block must have the same source, and is only imported once.
+const DependenciesFile = "module-dependencies.json"
+
+// addDeclaredDependencies adds the dependencies declared in the
+// DependenciesFile of the tree to its configuration as modules, if enabled
+// is true. The configuration that the tree was created with may be shared,
+// so it is never changed: the dependencies are added to a copy of it, which
+// is made again every time the tree is loaded.
+func (t *Tree) addDeclaredDependencies(enabled bool) error {
+	if t.base == nil {
+		t.base = t.config
+	}
+	t.config = t.base
+	if !enabled || t.config.Dir == "" {
+		return nil
+	}
+
+	fs := t.fs
+	if fs == nil {
+		fs = DiskFileSystem
+	}
+
+	path := filepath.Join(t.config.Dir, DependenciesFile)
+	data, err := fs.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	var deps map[string]string
+	if err := json.Unmarshal(data, &deps); err != nil {
+		return fmt.Errorf("error reading dependencies file %s: %s", path, err)
+	}
+
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c := *t.base
+	c.Modules = make([]*config.Module, len(t.base.Modules), len(t.base.Modules)+len(names))
+	copy(c.Modules, t.base.Modules)
+	for _, name := range names {
+		var existing *config.Module
+		for _, m := range c.Modules {
+			if m.Name == name {
+				existing = m
+				break
+			}
+		}
+		if existing != nil {
+			if existing.Source != deps[name] {
+				return fmt.Errorf(
+					"module %s: declared in %s with source %s, but "+
+						"imported with source %s",
+					name, path, deps[name], existing.Source)
+			}
+
+			continue
+		}
+
+		raw, err := config.NewRawConfig(make(map[string]interface{}))
+		if err != nil {
+			return err
+		}
+		c.Modules = append(c.Modules, &config.Module{
+			Name:      name,
+			Source:    deps[name],
+			RawConfig: raw,
+		})
+	}
+	t.config = &c
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package module
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestTreeLoad_declaredDependencies(t *testing.T) {
+	// Ignored unless enabled
+	storage := testStorage(t)
+	tree := NewTree("", testConfig(t, "declared-dependencies"))
+	if err := tree.Load(storage, GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual := testTreeChildren(tree); !reflect.DeepEqual(actual, []string{"a"}) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	opts := &LoadOptions{Mode: GetModeGet, DeclaredDependencies: true}
+	c := testConfig(t, "declared-dependencies")
+	tree = NewTree("", c)
+	for i := 0; i < 2; i++ {
+		// Loading again doesn't add the dependencies twice
+		if err := tree.LoadWithOptions(storage, opts); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if len(tree.config.Modules) != 2 {
+			t.Fatalf("bad: %#v", tree.config.Modules)
+		}
+
+		actual := testTreeChildren(tree)
+		if !reflect.DeepEqual(actual, []string{"a", "b"}) {
+			t.Fatalf("bad: %#v", actual)
+		}
+		actual = testTreeChildren(tree.Children()["a"])
+		if !reflect.DeepEqual(actual, []string{"c"}) {
+			t.Fatalf("bad: %#v", actual)
+		}
+	}
+
+	if err := tree.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The configuration the tree was created with isn't changed, so it
+	// can be shared with another tree
+	if len(c.Modules) != 1 {
+		t.Fatalf("bad: %#v", c.Modules)
+	}
+	other := NewTree("", c)
+	if err := other.LoadWithOptions(storage, opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual := testTreeChildren(other); !reflect.DeepEqual(actual, []string{"a", "b"}) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Nor is it once they're no longer imported
+	if err := tree.Load(storage, GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual := testTreeChildren(tree); !reflect.DeepEqual(actual, []string{"a"}) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestTreeLoad_declaredDependenciesConflict(t *testing.T) {
+	tree := NewTree("", testConfig(t, "declared-dependencies-conflict"))
+	err := tree.LoadWithOptions(testStorage(t), &LoadOptions{
+		Mode:                 GetModeGet,
+		DeclaredDependencies: true,
+	})
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "module a: declared in") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+// testTreeChildren returns the sorted names of the children of the tree.
+func testTreeChildren(tree *Tree) []string {
+	var result []string
+	for name := range tree.Children() {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+
+	return result
+}
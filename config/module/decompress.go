@@ -0,0 +1,348 @@
+package module
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Decompressor defines the interface that must be implemented to add
+// support for unpacking a type of archive into a module directory.
+type Decompressor interface {
+	// Decompress should unpack the archive at src into the directory dst.
+	// The directory dst may not exist yet, and should be created if it
+	// doesn't.
+	Decompress(dst, src string) error
+}
+
+// Decompressors is the mapping of archive extension (without the leading
+// ".") to the Decompressor implementation that will unpack it.
+var Decompressors map[string]Decompressor
+
+func init() {
+	tgz := new(TarGzipDecompressor)
+
+	Decompressors = map[string]Decompressor{
+		"tar":    new(TarDecompressor),
+		"tar.gz": tgz,
+		"tgz":    tgz,
+		"zip":    new(ZipDecompressor),
+	}
+
+	DecompressorContentTypes = map[string]string{
+		"application/gzip":             "tar.gz",
+		"application/x-gzip":           "tar.gz",
+		"application/x-compressed-tar": "tar.gz",
+		"application/x-tar":            "tar",
+		"application/x-zip-compressed": "zip",
+		"application/zip":              "zip",
+	}
+}
+
+// DecompressorContentTypes is the mapping of the media types of archives
+// to the extension of the Decompressor in Decompressors that unpacks them.
+// This is used for archives that are served over HTTP, where the URL might
+// not say what kind of archive it is.
+var DecompressorContentTypes map[string]string
+
+// getDecompressor returns the Decompressor for the given file path based
+// on its extension, or nil if the path isn't a known archive. The longest
+// matching extension wins, so "tar.gz" is preferred over "gz".
+func getDecompressor(path string) Decompressor {
+	var match string
+	for ext, _ := range Decompressors {
+		if strings.HasSuffix(path, "."+ext) && len(ext) > len(match) {
+			match = ext
+		}
+	}
+	if match == "" {
+		return nil
+	}
+
+	return Decompressors[match]
+}
+
+// getContentTypeDecompressor returns the Decompressor for the given
+// Content-Type header, or nil if it isn't a known archive.
+func getContentTypeDecompressor(contentType string) Decompressor {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+
+	ext, ok := DecompressorContentTypes[mediaType]
+	if !ok {
+		return nil
+	}
+
+	return Decompressors[ext]
+}
+
+// getArchive unpacks the archive at src into dst as the options say.
+func getArchive(dst, src string, d Decompressor, opts *archiveOptions) error {
+	// The destination was created by unpacking a previous version of the
+	// archive (or is a symlink to a directory source), so it is replaced
+	// rather than merged, which would leave behind deleted files.
+	if _, err := os.Lstat(dst); err == nil {
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := decompressArchive(d, dst, src, opts); err != nil {
+		return err
+	}
+	if opts.NormalizeMode {
+		return normalizeModes(dst)
+	}
+
+	return nil
+}
+
+// archiveFileMode returns the mode to create a file from an archive with,
+// given the mode that the archive has for it. Only the permissions are
+// kept, and archives that don't record any get the usual mode.
+func archiveFileMode(mode os.FileMode) os.FileMode {
+	if mode.Perm() == 0 {
+		return 0644
+	}
+
+	return mode.Perm()
+}
+
+// normalizeModes sets the permissions of everything within dir to the
+// usual ones: 0755 for directories and executable files, and 0644 for
+// every other file. Symlinks are left alone.
+func normalizeModes(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		mode := info.Mode()
+		switch {
+		case mode&os.ModeSymlink != 0:
+			return nil
+		case info.IsDir(), mode&0111 != 0:
+			return os.Chmod(path, 0755)
+		default:
+			return os.Chmod(path, 0644)
+		}
+	})
+}
+
+// archiveOptions are the options for unpacking an archive, from the query
+// parameters of its URL:
+//
+//   - "archive_strip" - The number of leading path components to strip
+//     from the files in the archive. This is like the --strip-components
+//     flag of tar, and is for archives that wrap the module in extra
+//     directories.
+//   - "archive_include" - Comma separated glob patterns, as in path.Match,
+//     of the files to unpack, such as "*.tf,modules". If set, only the
+//     matching files are unpacked.
+//   - "archive_exclude" - Comma separated glob patterns of the files not
+//     to unpack, such as "examples,docs". These win over archive_include.
+//   - "archive_mode" - How the permissions of the unpacked files are set.
+//     By default they are preserved from the archive, so that scripts
+//     within it stay executable. "normalize" instead sets them to 0644,
+//     or 0755 for directories and files that are executable by anyone,
+//     for archives built with odd permissions such as world writable.
+//
+// Patterns are matched against the slash separated path of each file
+// after stripping, and a pattern that matches a directory matches every
+// file within it. Filtering must leave at least one Terraform
+// configuration file, so that trimming archives of their documentation
+// and examples can't accidentally remove the module itself.
+type archiveOptions struct {
+	Strip         int
+	Include       []string
+	Exclude       []string
+	NormalizeMode bool
+}
+
+// getArchiveOptions parses the archiveOptions from the query parameters of
+// the URL.
+func getArchiveOptions(u *url.URL) (*archiveOptions, error) {
+	q := u.Query()
+	opts := new(archiveOptions)
+	if v := q.Get("archive_strip"); v != "" {
+		strip, err := strconv.Atoi(v)
+		if err != nil || strip < 0 {
+			return nil, fmt.Errorf(
+				"archive_strip must be a number of path components: %s", v)
+		}
+
+		opts.Strip = strip
+	}
+
+	switch v := q.Get("archive_mode"); v {
+	case "", "preserve":
+	case "normalize":
+		opts.NormalizeMode = true
+	default:
+		return nil, fmt.Errorf(
+			"archive_mode must be preserve or normalize: %s", v)
+	}
+
+	for _, p := range []struct {
+		Name   string
+		Result *[]string
+	}{
+		{"archive_include", &opts.Include},
+		{"archive_exclude", &opts.Exclude},
+	} {
+		for _, v := range q[p.Name] {
+			for _, pattern := range strings.Split(v, ",") {
+				pattern = strings.Trim(strings.TrimSpace(pattern), "/")
+				if pattern == "" {
+					continue
+				}
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf(
+						"%s has an invalid pattern %q: %s", p.Name, pattern, err)
+				}
+
+				*p.Result = append(*p.Result, pattern)
+			}
+		}
+	}
+
+	return opts, nil
+}
+
+// filtered returns whether only some of the files are unpacked.
+func (o *archiveOptions) filtered() bool {
+	return len(o.Include) > 0 || len(o.Exclude) > 0
+}
+
+// included returns whether the file at the slash separated path rel, after
+// stripping, is unpacked.
+func (o *archiveOptions) included(rel string) bool {
+	if archiveMatch(o.Exclude, rel) {
+		return false
+	}
+
+	return len(o.Include) == 0 || archiveMatch(o.Include, rel)
+}
+
+// archiveMatch returns whether any of the patterns match the slash
+// separated path rel or any of the directories that contain it.
+func archiveMatch(patterns []string, rel string) bool {
+	for p := rel; p != "." && p != "/"; p = path.Dir(p) {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// decompressArchive unpacks the archive at src into dst with d, removing
+// the first Strip components of the path of every file in it and leaving
+// out the files that aren't included. It is an error if stripping removes
+// the whole path of a file, or if two files end up at the same path.
+func decompressArchive(d Decompressor, dst, src string, opts *archiveOptions) error {
+	if opts.Strip == 0 && !opts.filtered() {
+		return d.Decompress(dst, src)
+	}
+
+	td, err := newTempDir(dst, ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(td)
+
+	unpacked := filepath.Join(td, "archive")
+	if err := d.Decompress(unpacked, src); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	strip := opts.Strip
+	seen := make(map[string]string)
+	configs := false
+	err = filepath.Walk(unpacked, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(unpacked, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		parts := strings.Split(rel, "/")
+		if len(parts) <= strip {
+			// Directories that are stripped away are fine, files aren't
+			if info.IsDir() {
+				return nil
+			}
+
+			return fmt.Errorf(
+				"archive_strip=%d removes the whole path of %s", strip, rel)
+		}
+
+		stripped := strings.Join(parts[strip:], "/")
+		target := filepath.Join(dst, filepath.FromSlash(stripped))
+		if info.IsDir() {
+			// Directories are created for the files that are included
+			// when filtering, so that no empty directories are left
+			if archiveMatch(opts.Exclude, stripped) {
+				return filepath.SkipDir
+			}
+			if opts.filtered() {
+				return nil
+			}
+
+			return os.MkdirAll(target, 0755)
+		}
+		if !opts.included(stripped) {
+			return nil
+		}
+
+		if other, ok := seen[target]; ok {
+			return fmt.Errorf(
+				"archive_strip=%d puts both %s and %s at the same path",
+				strip, other, rel)
+		}
+		seen[target] = rel
+
+		if strings.HasSuffix(stripped, ".tf") || strings.HasSuffix(stripped, ".tf.json") {
+			configs = true
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		return moveDir(target, path)
+	})
+	if err != nil {
+		return err
+	}
+
+	if opts.filtered() && !configs {
+		return fmt.Errorf(
+			"archive_include and archive_exclude leave no Terraform " +
+				"configuration files in the archive")
+	}
+
+	return nil
+}
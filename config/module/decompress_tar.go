@@ -0,0 +1,84 @@
+package module
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TarDecompressor is an implementation of Decompressor that can
+// unpack tar files.
+type TarDecompressor struct{}
+
+func (d *TarDecompressor) Decompress(dst, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return untar(dst, f)
+}
+
+// untar unpacks the tar archive read from r into the directory dst.
+func untar(dst string, r io.Reader) error {
+	// Clean the destination so we can verify every file stays inside it
+	dst = filepath.Clean(dst)
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	tarR := tar.NewReader(r)
+	for {
+		hdr, err := tarR.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dst, hdr.Name)
+		if path != dst && !strings.HasPrefix(path, dst+string(filepath.Separator)) {
+			return fmt.Errorf("illegal file path in archive: %s", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			// Archives don't always have entries for parent directories
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+
+			if err := untarFile(path, tarR, hdr.FileInfo().Mode()); err != nil {
+				return err
+			}
+		case tar.TypeXGlobalHeader:
+			// Metadata only, nothing to unpack
+		default:
+			return fmt.Errorf(
+				"unsupported file type in archive: %s", hdr.Name)
+		}
+	}
+}
+
+// untarFile writes the contents of r to the file dst, keeping the
+// permissions of mode so executable scripts stay executable.
+func untarFile(dst string, r io.Reader, mode os.FileMode) error {
+	dstF, err := os.OpenFile(
+		dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, archiveFileMode(mode))
+	if err != nil {
+		return err
+	}
+	defer dstF.Close()
+
+	_, err = io.Copy(dstF, r)
+	return err
+}
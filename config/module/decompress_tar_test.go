@@ -0,0 +1,51 @@
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarDecompressor_impl(t *testing.T) {
+	var _ Decompressor = new(TarDecompressor)
+}
+
+func TestTarDecompressor(t *testing.T) {
+	d := new(TarDecompressor)
+	dst := tempDir(t)
+
+	src := filepath.Join(fixtureDir, "archive.tar")
+	if err := d.Decompress(dst, src); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Verify the files exist
+	for _, p := range []string{"main.tf", "foo/main.tf"} {
+		if _, err := os.Stat(filepath.Join(dst, p)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func TestTarDecompressor_mode(t *testing.T) {
+	d := new(TarDecompressor)
+	dst := tempDir(t)
+
+	src := filepath.Join(fixtureDir, "archive-exec.tar")
+	if err := d.Decompress(dst, src); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	testFileExecutable(t, filepath.Join(dst, "scripts", "setup.sh"), true)
+	testFileExecutable(t, filepath.Join(dst, "main.tf"), false)
+}
+
+func TestTarDecompressor_illegalPath(t *testing.T) {
+	d := new(TarDecompressor)
+	dst := tempDir(t)
+
+	src := filepath.Join(fixtureDir, "archive-bad.tar")
+	if err := d.Decompress(dst, src); err == nil {
+		t.Fatal("should error")
+	}
+}
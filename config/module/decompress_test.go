@@ -0,0 +1,48 @@
+package module
+
+import (
+	"testing"
+)
+
+func TestGetDecompressor(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output Decompressor
+	}{
+		{"foo.zip", Decompressors["zip"]},
+		{"/foo/bar.zip", Decompressors["zip"]},
+		{"foo.tar", Decompressors["tar"]},
+		{"foo.tar.gz", Decompressors["tar.gz"]},
+		{"foo.tgz", Decompressors["tgz"]},
+		{"foo.tf", nil},
+		{"foozip", nil},
+	}
+
+	for i, tc := range cases {
+		output := getDecompressor(tc.Input)
+		if output != tc.Output {
+			t.Fatalf("%d: bad: %#v", i, output)
+		}
+	}
+}
+
+func TestGetContentTypeDecompressor(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output Decompressor
+	}{
+		{"application/zip", Decompressors["zip"]},
+		{"application/x-tar", Decompressors["tar"]},
+		{"application/gzip", Decompressors["tar.gz"]},
+		{"Application/X-Gzip; charset=binary", Decompressors["tar.gz"]},
+		{"text/html; charset=utf-8", nil},
+		{"", nil},
+	}
+
+	for i, tc := range cases {
+		output := getContentTypeDecompressor(tc.Input)
+		if output != tc.Output {
+			t.Fatalf("%d: bad: %#v", i, output)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package module
+
+import (
+	"compress/gzip"
+	"os"
+)
+
+// TarGzipDecompressor is an implementation of Decompressor that can
+// unpack gzipped tar files.
+type TarGzipDecompressor struct{}
+
+func (d *TarGzipDecompressor) Decompress(dst, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gzipR, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gzipR.Close()
+
+	return untar(dst, gzipR)
+}
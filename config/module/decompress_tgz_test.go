@@ -0,0 +1,38 @@
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarGzipDecompressor_impl(t *testing.T) {
+	var _ Decompressor = new(TarGzipDecompressor)
+}
+
+func TestTarGzipDecompressor(t *testing.T) {
+	d := new(TarGzipDecompressor)
+	dst := tempDir(t)
+
+	src := filepath.Join(fixtureDir, "archive.tar.gz")
+	if err := d.Decompress(dst, src); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Verify the files exist
+	for _, p := range []string{"main.tf", "foo/main.tf"} {
+		if _, err := os.Stat(filepath.Join(dst, p)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func TestTarGzipDecompressor_notGzip(t *testing.T) {
+	d := new(TarGzipDecompressor)
+	dst := tempDir(t)
+
+	src := filepath.Join(fixtureDir, "archive.tar")
+	if err := d.Decompress(dst, src); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -0,0 +1,72 @@
+package module
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ZipDecompressor is an implementation of Decompressor that can
+// unpack zip files.
+type ZipDecompressor struct{}
+
+func (d *ZipDecompressor) Decompress(dst, src string) error {
+	// Clean the destination so we can verify every file stays inside it
+	dst = filepath.Clean(dst)
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	zipR, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zipR.Close()
+
+	for _, f := range zipR.File {
+		path := filepath.Join(dst, f.Name)
+		if !strings.HasPrefix(path, dst+string(filepath.Separator)) {
+			return fmt.Errorf("illegal file path in archive: %s", f.Name)
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// Archives don't always have entries for parent directories
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		if err := d.copyFile(path, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *ZipDecompressor) copyFile(dst string, f *zip.File) error {
+	srcF, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer srcF.Close()
+
+	dstF, err := os.OpenFile(
+		dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, archiveFileMode(f.Mode()))
+	if err != nil {
+		return err
+	}
+	defer dstF.Close()
+
+	_, err = io.Copy(dstF, srcF)
+	return err
+}
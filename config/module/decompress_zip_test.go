@@ -0,0 +1,51 @@
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestZipDecompressor_impl(t *testing.T) {
+	var _ Decompressor = new(ZipDecompressor)
+}
+
+func TestZipDecompressor(t *testing.T) {
+	d := new(ZipDecompressor)
+	dst := tempDir(t)
+
+	src := filepath.Join(fixtureDir, "archive.zip")
+	if err := d.Decompress(dst, src); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Verify the files exist
+	for _, p := range []string{"main.tf", "foo/main.tf"} {
+		if _, err := os.Stat(filepath.Join(dst, p)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func TestZipDecompressor_mode(t *testing.T) {
+	d := new(ZipDecompressor)
+	dst := tempDir(t)
+
+	src := filepath.Join(fixtureDir, "archive-exec.zip")
+	if err := d.Decompress(dst, src); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	testFileExecutable(t, filepath.Join(dst, "scripts", "setup.sh"), true)
+	testFileExecutable(t, filepath.Join(dst, "main.tf"), false)
+}
+
+func TestZipDecompressor_illegalPath(t *testing.T) {
+	d := new(ZipDecompressor)
+	dst := tempDir(t)
+
+	src := filepath.Join(fixtureDir, "archive-bad.zip")
+	if err := d.Decompress(dst, src); err == nil {
+		t.Fatal("should error")
+	}
+}
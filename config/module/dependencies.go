@@ -0,0 +1,129 @@
+package module
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+// Dependencies returns the full paths of every module that the module at
+// the given path depends on, directly or transitively. A module depends on
+// the modules it imports, and on the sibling modules whose outputs are
+// used as its parameters. This is everything that can change the module.
+//
+// Paths are the module names from this tree joined by ".", and are
+// sorted. Load must be called prior to calling Dependencies or an error
+// will be returned.
+func (t *Tree) Dependencies(path []string) ([]string, error) {
+	if !t.Loaded() {
+		return nil, fmt.Errorf("tree must be loaded before calling Dependencies")
+	}
+
+	deps, _, err := t.dependencyGraph(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return reachable(deps, strings.Join(path, ".")), nil
+}
+
+// Dependents is the inverse of Dependencies: it returns the full paths of
+// every module that depends on the module at the given path, directly or
+// transitively. This is everything that can be affected by a change to
+// the module.
+//
+// Load must be called prior to calling Dependents or an error will be
+// returned.
+func (t *Tree) Dependents(path []string) ([]string, error) {
+	if !t.Loaded() {
+		return nil, fmt.Errorf("tree must be loaded before calling Dependents")
+	}
+
+	_, dependents, err := t.dependencyGraph(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return reachable(dependents, strings.Join(path, ".")), nil
+}
+
+// dependencyGraph returns the direct dependencies of every module in the
+// tree and the direct dependents of every module, keyed by full path. It
+// is an error if there is no module at path.
+func (t *Tree) dependencyGraph(
+	path []string) (map[string][]string, map[string][]string, error) {
+	deps := make(map[string][]string)
+	dependents := make(map[string][]string)
+	add := func(from, to string) {
+		deps[from] = append(deps[from], to)
+		dependents[to] = append(dependents[to], from)
+	}
+
+	key := strings.Join(path, ".")
+	found := false
+	t.walkModules(func(p []string, parent *Tree, m *Module) error {
+		name := strings.Join(p, ".")
+		if name == key {
+			found = true
+		}
+
+		// The module that imports this one depends on it. The root isn't
+		// a module, so it isn't part of the graph.
+		if len(p) > 1 {
+			add(strings.Join(p[:len(p)-1], "."), name)
+		}
+
+		// Modules also depend on the siblings whose outputs they use
+		var raw *config.RawConfig
+		for _, cm := range parent.config.Modules {
+			if cm.Name == m.Name {
+				raw = cm.RawConfig
+				break
+			}
+		}
+		if raw == nil {
+			return nil
+		}
+		for _, v := range raw.Variables {
+			if mv, ok := v.(*config.ModuleVariable); ok {
+				sibling := append(p[:len(p)-1:len(p)-1], mv.Name)
+				add(name, strings.Join(sibling, "."))
+			}
+		}
+
+		return nil
+	})
+
+	if !found {
+		return nil, nil, fmt.Errorf("module %s: not found", key)
+	}
+
+	return deps, dependents, nil
+}
+
+// reachable returns every node that can be reached from start in the
+// graph, not including start itself, sorted.
+func reachable(graph map[string][]string, start string) []string {
+	seen := map[string]struct{}{start: struct{}{}}
+	queue := []string{start}
+	var result []string
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+
+		for _, next := range graph[n] {
+			if _, ok := seen[next]; ok {
+				continue
+			}
+			seen[next] = struct{}{}
+
+			result = append(result, next)
+			queue = append(queue, next)
+		}
+	}
+	sort.Strings(result)
+
+	return result
+}
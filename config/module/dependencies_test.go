@@ -0,0 +1,59 @@
+package module
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTreeDependencies(t *testing.T) {
+	tree := NewTree("", testConfig(t, "dependencies"))
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Path       []string
+		Deps       []string
+		Dependents []string
+	}{
+		{[]string{"a"}, []string{"a.x"}, []string{"b"}},
+		{[]string{"a", "x"}, nil, []string{"a", "b"}},
+		{[]string{"b"}, []string{"a", "a.x"}, nil},
+		{[]string{"c"}, nil, nil},
+	}
+
+	for _, tc := range cases {
+		deps, err := tree.Dependencies(tc.Path)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Path, err)
+		}
+		if !reflect.DeepEqual(deps, tc.Deps) {
+			t.Fatalf("%s: bad dependencies: %#v", tc.Path, deps)
+		}
+
+		dependents, err := tree.Dependents(tc.Path)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Path, err)
+		}
+		if !reflect.DeepEqual(dependents, tc.Dependents) {
+			t.Fatalf("%s: bad dependents: %#v", tc.Path, dependents)
+		}
+	}
+}
+
+func TestTreeDependencies_bad(t *testing.T) {
+	tree := NewTree("", testConfig(t, "dependencies"))
+	if _, err := tree.Dependencies([]string{"a"}); err == nil {
+		t.Fatal("should error when not loaded")
+	}
+
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := tree.Dependencies([]string{"nope"}); err == nil {
+		t.Fatal("should error")
+	}
+	if _, err := tree.Dependents([]string{"a", "nope"}); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -22,21 +22,84 @@ func init() {
 	Detectors = []Detector{
 		new(GitHubDetector),
 		new(BitBucketDetector),
+		new(CodeCommitDetector),
+		new(IPFSDetector),
+		new(RegistryDetector),
 		new(FileDetector),
 	}
 }
 
+// forcingDetector is implemented by Detectors of sources that force a
+// getter of their own, such as "discover::name", rather than one in
+// Getters. They're given the whole source.
+type forcingDetector interface {
+	Detector
+	forcedGetter() string
+}
+
+// forcingDetectorFor returns the Detector for the sources that force the
+// getter, or nil if there isn't one.
+func forcingDetectorFor(force string) Detector {
+	if force == "" {
+		return nil
+	}
+
+	for _, d := range Detectors {
+		if fd, ok := d.(forcingDetector); ok && fd.forcedGetter() == force {
+			return d
+		}
+	}
+
+	return nil
+}
+
 // Detect turns a source string into another source string if it is
 // detected to be of a known pattern.
 //
 // This is safe to be called with an already valid source string: Detect
-// will just return it.
+// will just return it. Sources that force both the getter and the scheme
+// (see Get) are turned into a source that only forces the getter.
 func Detect(src string, pwd string) (string, error) {
+	src, err := getForcedScheme(src, pwd)
+	if err != nil {
+		return "", err
+	}
+
 	getForce, getSrc := getForcedGetter(src)
 
+	// Sources that force the getter of a detector, such as "discover::",
+	// are detected by that detector, and what it detects is detected again.
+	if d := forcingDetectorFor(getForce); d != nil {
+		result, _, err := d.Detect(src, pwd)
+		if err != nil {
+			return "", err
+		}
+		if force, _ := getForcedGetter(result); force == getForce {
+			return "", fmt.Errorf(
+				"source %s was detected as %s, which can't be detected "+
+					"the same way again", src, result)
+		}
+
+		// What they find comes from a remote server, such as a discovery
+		// service, so it can't be a source only the configuration can use
+		result, err = Detect(result, pwd)
+		if err != nil {
+			return "", err
+		}
+		if err := checkRemoteSource(result); err != nil {
+			return "", err
+		}
+
+		return result, nil
+	}
+
 	u, err := url.Parse(getSrc)
 	if err == nil && u.Scheme != "" {
 		// Valid URL
+		if err := checkVendored(src); err != nil {
+			return "", err
+		}
+
 		return src, nil
 	}
 
@@ -61,6 +124,10 @@ func Detect(src string, pwd string) (string, error) {
 			result = fmt.Sprintf("%s::%s", detectForce, result)
 		}
 
+		if err := checkVendored(result); err != nil {
+			return "", err
+		}
+
 		return result, nil
 	}
 
@@ -25,6 +25,11 @@ func (d *BitBucketDetector) Detect(src, _ string) (string, bool, error) {
 }
 
 func (d *BitBucketDetector) detectHTTP(src string) (string, bool, error) {
+	// Detecting requires the BitBucket API, which isn't allowed offline
+	if Vendored {
+		return "", true, vendoredError(src)
+	}
+
 	u, err := url.Parse("https://" + src)
 	if err != nil {
 		return "", true, fmt.Errorf("error parsing BitBucket URL: %s", err)
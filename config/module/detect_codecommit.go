@@ -0,0 +1,57 @@
+package module
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// codeCommitHostRegexp matches the hosts of the HTTPS endpoints of AWS
+// CodeCommit, in every region, including the FIPS endpoints and those in
+// China.
+var codeCommitHostRegexp = regexp.MustCompile(
+	`^git-codecommit(-fips)?\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// codeCommitHost returns whether the host is a CodeCommit endpoint.
+func codeCommitHost(host string) bool {
+	return codeCommitHostRegexp.MatchString(strings.ToLower(host))
+}
+
+// CodeCommitDetector implements Detector to detect AWS CodeCommit URLs,
+// such as "git-codecommit.us-east-1.amazonaws.com/v1/repos/vpc", and turn
+// them into URLs that the Git Getter can understand. The Git Getter gets
+// the credentials for them from the AWS credential helper.
+type CodeCommitDetector struct{}
+
+func (d *CodeCommitDetector) Detect(src, _ string) (string, bool, error) {
+	idx := strings.Index(src, "/")
+	if idx <= 0 || !codeCommitHost(src[:idx]) {
+		return "", false, nil
+	}
+
+	u, err := url.Parse("https://" + src)
+	if err != nil {
+		return "", true, fmt.Errorf("error parsing CodeCommit URL: %s", err)
+	}
+
+	repo, subDir := u.Path, ""
+	if idx := strings.Index(repo, "//"); idx >= 0 {
+		repo, subDir = repo[:idx], repo[idx+2:]
+	}
+
+	parts := strings.Split(strings.Trim(repo, "/"), "/")
+	if len(parts) != 3 || parts[0] != "v1" || parts[1] != "repos" || parts[2] == "" {
+		return "", true, fmt.Errorf(
+			"CodeCommit URLs should be "+
+				"git-codecommit.REGION.amazonaws.com/v1/repos/REPOSITORY: %s",
+			src)
+	}
+
+	u.Path = "/" + strings.Join(parts, "/")
+	if subDir != "" {
+		u.Path += "//" + subDir
+	}
+
+	return "git::" + u.String(), true, nil
+}
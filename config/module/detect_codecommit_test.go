@@ -0,0 +1,59 @@
+package module
+
+import (
+	"testing"
+)
+
+func TestCodeCommitDetector(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output string
+		Ok     bool
+		Err    bool
+	}{
+		{
+			"git-codecommit.us-east-1.amazonaws.com/v1/repos/vpc",
+			"git::https://git-codecommit.us-east-1.amazonaws.com/v1/repos/vpc",
+			true,
+			false,
+		},
+		{
+			"git-codecommit.eu-west-2.amazonaws.com/v1/repos/vpc//modules/subnet?ref=v1.0",
+			"git::https://git-codecommit.eu-west-2.amazonaws.com/v1/repos/vpc//modules/subnet?ref=v1.0",
+			true,
+			false,
+		},
+		{
+			"git-codecommit-fips.us-gov-west-1.amazonaws.com/v1/repos/vpc",
+			"git::https://git-codecommit-fips.us-gov-west-1.amazonaws.com/v1/repos/vpc",
+			true,
+			false,
+		},
+		{
+			"git-codecommit.cn-north-1.amazonaws.com.cn/v1/repos/vpc",
+			"git::https://git-codecommit.cn-north-1.amazonaws.com.cn/v1/repos/vpc",
+			true,
+			false,
+		},
+		{"git-codecommit.us-east-1.amazonaws.com/vpc", "", true, true},
+		{"git-codecommit.us-east-1.amazonaws.com/v1/repos/vpc/modules", "", true, true},
+		{"codecommit.example.com/v1/repos/vpc", "", false, false},
+		{"./foo", "", false, false},
+	}
+
+	pwd := "/pwd"
+	f := new(CodeCommitDetector)
+	for i, tc := range cases {
+		output, ok, err := f.Detect(tc.Input, pwd)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if ok != tc.Ok {
+			t.Fatalf("%d: bad ok: %#v", i, ok)
+		}
+
+		if output != tc.Output {
+			t.Fatalf("%d: bad: %#v", i, output)
+		}
+	}
+}
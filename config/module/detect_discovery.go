@@ -0,0 +1,149 @@
+package module
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DefaultDiscoveryTimeout is how long a DiscoveryDetector waits for the
+// discovery service when its Timeout isn't set.
+const DefaultDiscoveryTimeout = 10 * time.Second
+
+// DiscoveryDetector implements Detector to detect sources of the form
+// "discover::name", whose real source is looked up by name from a
+// discovery service, so that modules can be repointed centrally without
+// changing the configurations that use them.
+//
+// A GET request is made to Endpoint with the additional parameter
+// "name" set to the name, and the service must answer with a JSON object
+// whose "source" is the real source, example:
+//
+//	{"source": "github.com/hashicorp/vpc?ref=v1.2.0"}
+//
+// The real source is then detected like any other source, so it can use
+// any syntax that a module source normally can, except for discovering
+// another source. A response of "404 Not Found" means that the name is
+// unknown. Redirects are followed, and the service must answer within
+// the timeout.
+//
+// Discovered sources are cached until Load is called again, so that each
+// name is only discovered once per load of a tree.
+//
+// The detector isn't in the default Detectors since it needs to be given
+// the endpoint to use:
+//
+//	module.Detectors = append(
+//	    module.Detectors, &module.DiscoveryDetector{Endpoint: endpoint})
+type DiscoveryDetector struct {
+	// Endpoint is the URL of the discovery service.
+	Endpoint string
+
+	// Transport, if set, is used to make the discovery requests instead of
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// Timeout is the longest to wait for the discovery service to answer,
+	// including following redirects. If it isn't set,
+	// DefaultDiscoveryTimeout is used.
+	Timeout time.Duration
+
+	cacheLock sync.Mutex
+	cache     map[string]string
+}
+
+func (d *DiscoveryDetector) Detect(src, _ string) (string, bool, error) {
+	force, name := getForcedGetter(src)
+	if force != d.forcedGetter() {
+		return "", false, nil
+	}
+	if Vendored {
+		return "", true, vendoredError(src)
+	}
+
+	d.cacheLock.Lock()
+	result, ok := d.cache[name]
+	d.cacheLock.Unlock()
+	if ok {
+		return result, true, nil
+	}
+
+	result, err := d.discover(name)
+	if err != nil {
+		return "", true, fmt.Errorf("error discovering source %s: %s", src, err)
+	}
+
+	d.cacheLock.Lock()
+	defer d.cacheLock.Unlock()
+	if d.cache == nil {
+		d.cache = make(map[string]string)
+	}
+	d.cache[name] = result
+
+	return result, true, nil
+}
+
+// forcedGetter implements forcingDetector.
+func (d *DiscoveryDetector) forcedGetter() string {
+	return "discover"
+}
+
+// resetCache forgets the discovered sources.
+func (d *DiscoveryDetector) resetCache() {
+	d.cacheLock.Lock()
+	defer d.cacheLock.Unlock()
+	d.cache = nil
+}
+
+// discover asks the discovery service for the real source of name.
+func (d *DiscoveryDetector) discover(name string) (string, error) {
+	if d.Endpoint == "" {
+		return "", fmt.Errorf("no discovery endpoint is configured")
+	}
+
+	u, err := url.Parse(d.Endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid discovery endpoint: %s", err)
+	}
+	q := u.Query()
+	q.Set("name", name)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{Transport: d.Transport, Timeout: d.Timeout}
+	if client.Timeout == 0 {
+		client.Timeout = DefaultDiscoveryTimeout
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf(
+			"discovery service %s is unreachable: %s", d.Endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("unknown module name: %s", name)
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return "", fmt.Errorf("bad response code: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Source string `json:"source"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("invalid response: %s", err)
+	}
+	if result.Source == "" {
+		return "", fmt.Errorf("no source was returned for %s", name)
+	}
+
+	return result.Source, nil
+}
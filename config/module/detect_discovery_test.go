@@ -0,0 +1,140 @@
+package module
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiscoveryDetector(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			switch name := r.URL.Query().Get("name"); name {
+			case "vpc":
+				fmt.Fprint(w, `{"source": "github.com/hashicorp/vpc?ref=v1.0.0"}`)
+			case "empty":
+				fmt.Fprint(w, `{}`)
+			case "broken":
+				w.WriteHeader(500)
+			case "moved":
+				http.Redirect(w, r, "/modules?name=vpc", http.StatusFound)
+			default:
+				w.WriteHeader(404)
+			}
+		}))
+	defer server.Close()
+
+	cases := []struct {
+		Input  string
+		Output string
+		Ok     bool
+		Err    string
+	}{
+		{"discover::vpc", "github.com/hashicorp/vpc?ref=v1.0.0", true, ""},
+		{"discover::missing", "", true, "unknown module name: missing"},
+		{"discover::empty", "", true, "no source was returned"},
+		{"discover::broken", "", true, "bad response code: 500"},
+		{"discover::moved", "github.com/hashicorp/vpc?ref=v1.0.0", true, ""},
+		{"alias::vpc", "", false, ""},
+		{"github.com/hashicorp/vpc", "", false, ""},
+	}
+
+	d := &DiscoveryDetector{Endpoint: server.URL + "/modules"}
+	for _, tc := range cases {
+		output, ok, err := d.Detect(tc.Input, "/pwd")
+		if (err != nil) != (tc.Err != "") {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), tc.Err) {
+			t.Fatalf("%s: bad: %s", tc.Input, err)
+		}
+		if ok != tc.Ok {
+			t.Fatalf("%s: bad ok: %v", tc.Input, ok)
+		}
+		if output != tc.Output {
+			t.Fatalf("%s: bad: %s", tc.Input, output)
+		}
+	}
+
+	// Discovered sources are cached until they're reset
+	requests = 0
+	if _, _, err := d.Detect("discover::vpc", "/pwd"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if requests != 0 {
+		t.Fatalf("should be cached: %d", requests)
+	}
+
+	d.resetCache()
+	if _, _, err := d.Detect("discover::vpc", "/pwd"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if requests != 1 {
+		t.Fatalf("should not be cached: %d", requests)
+	}
+}
+
+func TestDiscoveryDetector_unreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	d := &DiscoveryDetector{Endpoint: server.URL}
+	_, _, err := d.Detect("discover::vpc", "/pwd")
+	if err == nil || !strings.Contains(err.Error(), "unreachable") {
+		t.Fatalf("bad: %v", err)
+	}
+
+	if _, _, err := new(DiscoveryDetector).Detect("discover::vpc", "/pwd"); err == nil {
+		t.Fatal("should error without an endpoint")
+	}
+
+	// A service that accepts the connection but never answers times out
+	done := make(chan struct{})
+	server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) { <-done }))
+	defer server.Close()
+	defer close(done)
+
+	d = &DiscoveryDetector{Endpoint: server.URL, Timeout: 50 * time.Millisecond}
+	_, _, err = d.Detect("discover::vpc", "/pwd")
+	if err == nil || !strings.Contains(err.Error(), "unreachable") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestDetect_discovery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Query().Get("name") {
+			case "vpc":
+				fmt.Fprint(w, `{"source": "github.com/hashicorp/vpc?ref=v1.0.0"}`)
+			case "loop":
+				fmt.Fprint(w, `{"source": "discover::vpc"}`)
+			default:
+				w.WriteHeader(404)
+			}
+		}))
+	defer server.Close()
+
+	defer func(ds []Detector) { Detectors = ds }(Detectors)
+	Detectors = append(Detectors, &DiscoveryDetector{Endpoint: server.URL})
+
+	output, err := Detect("discover::vpc", "/pwd")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if output != "git::https://github.com/hashicorp/vpc.git?ref=v1.0.0" {
+		t.Fatalf("bad: %s", output)
+	}
+
+	// Discovered sources can't be discovered again
+	if _, err := Detect("discover::loop", "/pwd"); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -0,0 +1,197 @@
+package module
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// GitLabDetector implements Detector to detect GitLab URLs and turn them
+// into URLs that the Git Getter can understand.
+//
+// GitLab projects can be within any number of nested subgroups, such as
+// "gitlab.com/group/subgroup/project", so the path alone doesn't tell where
+// the project ends and a subdirectory of it begins. The subdirectory can be
+// given explicitly after "//", and a part of the path that ends in ".git"
+// is always the project. Otherwise the GitLab API is asked which part of
+// the path is the project, and the rest of it is kept as the subdirectory.
+// The answers are cached until Load is called again.
+//
+// The detector isn't in the default Detectors since detecting a source can
+// make requests to the GitLab API. It must come before the FileDetector,
+// which would take the source for a local path:
+//
+//	module.Detectors = append(
+//	    []module.Detector{new(module.GitLabDetector)}, module.Detectors...)
+type GitLabDetector struct {
+	// Hosts are the hosts of self-hosted GitLab servers to detect sources
+	// on, in addition to gitlab.com.
+	Hosts []string
+
+	// Secrets, if set, is asked for the token to use the API with, which
+	// is needed to find private projects. The password is the token.
+	Secrets SecretResolver
+
+	// Transport, if set, is used to make the API requests instead of
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+
+	cacheLock sync.Mutex
+	cache     map[string]int
+}
+
+func (d *GitLabDetector) Detect(src, _ string) (string, bool, error) {
+	idx := strings.Index(src, "/")
+	if idx <= 0 || !d.matches(src[:idx]) {
+		return "", false, nil
+	}
+
+	u, err := url.Parse("https://" + src)
+	if err != nil {
+		return "", true, fmt.Errorf("error parsing GitLab URL: %s", err)
+	}
+
+	project, subDir := u.Path, ""
+	if idx := strings.Index(project, "//"); idx >= 0 {
+		project, subDir = project[:idx], project[idx+2:]
+	}
+
+	parts := strings.Split(strings.Trim(project, "/"), "/")
+	if subDir == "" {
+		n, err := d.projectParts(u.Host, parts)
+		if err != nil {
+			return "", true, err
+		}
+
+		subDir = strings.Join(parts[n:], "/")
+		parts = parts[:n]
+	}
+	if len(parts) < 2 {
+		return "", true, fmt.Errorf(
+			"GitLab URLs should be gitlab.com/group/project: %s", src)
+	}
+
+	u.Path = "/" + strings.Join(parts, "/")
+	if !strings.HasSuffix(u.Path, ".git") {
+		u.Path += ".git"
+	}
+	if subDir != "" {
+		u.Path += "//" + subDir
+	}
+
+	return "git::" + u.String(), true, nil
+}
+
+// resetCache forgets the projects that were found with the API.
+func (d *GitLabDetector) resetCache() {
+	d.cacheLock.Lock()
+	defer d.cacheLock.Unlock()
+	d.cache = nil
+}
+
+// matches returns whether the host is gitlab.com or one of Hosts.
+func (d *GitLabDetector) matches(host string) bool {
+	if strings.EqualFold(host, "gitlab.com") {
+		return true
+	}
+
+	for _, h := range d.Hosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// projectParts returns how many of the parts of the path are the project,
+// with the rest being a subdirectory of it.
+func (d *GitLabDetector) projectParts(host string, parts []string) (int, error) {
+	for i, p := range parts {
+		if strings.HasSuffix(p, ".git") {
+			return i + 1, nil
+		}
+	}
+
+	// A group and a project are as short as a project gets
+	if len(parts) <= 2 {
+		return len(parts), nil
+	}
+
+	key := host + "/" + strings.Join(parts, "/")
+	d.cacheLock.Lock()
+	n, ok := d.cache[key]
+	d.cacheLock.Unlock()
+	if ok {
+		return n, nil
+	}
+
+	if Vendored {
+		return 0, vendoredError(key)
+	}
+
+	// The longest project wins, since a project can't contain groups
+	for n = len(parts); n >= 2; n-- {
+		ok, err := d.projectExists(host, strings.Join(parts[:n], "/"))
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			continue
+		}
+
+		d.cacheLock.Lock()
+		defer d.cacheLock.Unlock()
+		if d.cache == nil {
+			d.cache = make(map[string]int)
+		}
+		d.cache[key] = n
+
+		return n, nil
+	}
+
+	return 0, fmt.Errorf(
+		"no GitLab project found for %s. If the project is private, the "+
+			"GitLab detector needs a token. The project can also be given "+
+			"with \".git\" or followed by \"//\" and the subdirectory", key)
+}
+
+// projectExists asks the API of the host whether the project exists.
+func (d *GitLabDetector) projectExists(host, project string) (bool, error) {
+	req, err := http.NewRequest(
+		"GET", "https://"+host+"/api/v4/projects/"+url.QueryEscape(project), nil)
+	if err != nil {
+		return false, err
+	}
+
+	_, token, ok, err := resolveSecret(d.Secrets, host)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		req.Header.Set("PRIVATE-TOKEN", token)
+	}
+
+	transport := d.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return false, fmt.Errorf("error looking up GitLab project %s: %s", project, err)
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case 200:
+		return true, nil
+	case 404:
+		return false, nil
+	default:
+		return false, fmt.Errorf(
+			"error looking up GitLab project %s: HTTP status %d",
+			project, resp.StatusCode)
+	}
+}
@@ -0,0 +1,158 @@
+package module
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGitLabDetector(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output string
+	}{
+		{"gitlab.com/group/project", "git::https://gitlab.com/group/project.git"},
+		{
+			"gitlab.com/group/project?ref=v1.0",
+			"git::https://gitlab.com/group/project.git?ref=v1.0",
+		},
+		{
+			"gitlab.com/group/sub/project.git/modules/vpc?ref=v1.0",
+			"git::https://gitlab.com/group/sub/project.git//modules/vpc?ref=v1.0",
+		},
+		{
+			"gitlab.com/group/sub/project//modules/vpc",
+			"git::https://gitlab.com/group/sub/project.git//modules/vpc",
+		},
+	}
+
+	d := new(GitLabDetector)
+	for _, tc := range cases {
+		output, ok, err := d.Detect(tc.Input, "/pwd")
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if !ok {
+			t.Fatalf("%s: not ok", tc.Input)
+		}
+		if output != tc.Output {
+			t.Fatalf("%s: bad: %s", tc.Input, output)
+		}
+	}
+
+	if _, ok, _ := d.Detect("github.com/hashicorp/foo", "/pwd"); ok {
+		t.Fatal("should not detect other hosts")
+	}
+}
+
+func TestGitLabDetector_optIn(t *testing.T) {
+	// The default detectors never ask the GitLab API
+	output, err := Detect("gitlab.com/group/project", "/pwd")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if strings.HasPrefix(output, "git::") {
+		t.Fatalf("bad: %s", output)
+	}
+
+	old := Detectors
+	defer func() { Detectors = old }()
+	Detectors = append([]Detector{new(GitLabDetector)}, Detectors...)
+
+	output, err = Detect("gitlab.com/group/project.git", "/pwd")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if output != "git::https://gitlab.com/group/project.git" {
+		t.Fatalf("bad: %s", output)
+	}
+}
+
+func TestGitLabDetector_api(t *testing.T) {
+	requests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if r.Header.Get("PRIVATE-TOKEN") != "secret" {
+				w.WriteHeader(401)
+				return
+			}
+
+			switch strings.TrimPrefix(r.URL.EscapedPath(), "/api/v4/projects/") {
+			case "group%2Fsub%2Fproject", "group%2Fproject":
+				w.Write([]byte("{}"))
+			default:
+				w.WriteHeader(404)
+			}
+		}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	host := u.Host
+
+	d := &GitLabDetector{
+		Hosts: []string{host},
+		Secrets: &testSecretResolver{
+			Secrets: map[string][2]string{host: {"", "secret"}},
+		},
+		Transport: server.Client().Transport,
+	}
+
+	cases := []struct {
+		Input  string
+		Output string
+		Err    bool
+	}{
+		{
+			host + "/group/sub/project/modules/vpc?ref=v1.0",
+			"git::https://" + host + "/group/sub/project.git//modules/vpc?ref=v1.0",
+			false,
+		},
+		{
+			host + "/group/sub/project",
+			"git::https://" + host + "/group/sub/project.git",
+			false,
+		},
+		{
+			host + "/group/project/modules",
+			"git::https://" + host + "/group/project.git//modules",
+			false,
+		},
+		{host + "/nope/nope/nope", "", true},
+	}
+
+	for _, tc := range cases {
+		output, ok, err := d.Detect(tc.Input, "/pwd")
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if !ok {
+			t.Fatalf("%s: not ok", tc.Input)
+		}
+		if output != tc.Output {
+			t.Fatalf("%s: bad: %s", tc.Input, output)
+		}
+	}
+
+	// Projects are cached until the cache is reset
+	requests = 0
+	if _, _, err := d.Detect(host+"/group/sub/project/modules/vpc", "/pwd"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if requests != 0 {
+		t.Fatalf("should be cached: %d", requests)
+	}
+
+	d.resetCache()
+	if _, _, err := d.Detect(host+"/group/sub/project/modules/vpc", "/pwd"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if requests != 3 {
+		t.Fatalf("should not be cached: %d", requests)
+	}
+}
@@ -0,0 +1,22 @@
+package module
+
+import (
+	"regexp"
+)
+
+// ipfsCidRegexp matches IPFS content identifiers: base58 CIDv0 ("Qm...")
+// and base32 CIDv1 ("b...").
+var ipfsCidRegexp = regexp.MustCompile(
+	`^(Qm[1-9A-HJ-NP-Za-km-z]{44}|b[a-z2-7]{58,})$`)
+
+// IPFSDetector implements Detector to detect IPFS content identifiers
+// and turn them into URLs that the IPFS Getter can understand.
+type IPFSDetector struct{}
+
+func (d *IPFSDetector) Detect(src, _ string) (string, bool, error) {
+	if !ipfsCidRegexp.MatchString(src) {
+		return "", false, nil
+	}
+
+	return "ipfs://" + src, true, nil
+}
@@ -0,0 +1,42 @@
+package module
+
+import (
+	"testing"
+)
+
+func TestIPFSDetector(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output string
+		Ok     bool
+	}{
+		{
+			"QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG",
+			"ipfs://QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG",
+			true,
+		},
+		{
+			"bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi",
+			"ipfs://bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi",
+			true,
+		},
+		{"./foo", "", false},
+		{"QmFoo", "", false},
+	}
+
+	pwd := "/pwd"
+	f := new(IPFSDetector)
+	for i, tc := range cases {
+		output, ok, err := f.Detect(tc.Input, pwd)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if ok != tc.Ok {
+			t.Fatalf("%d: bad ok: %#v", i, ok)
+		}
+
+		if output != tc.Output {
+			t.Fatalf("%d: bad: %#v", i, output)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package module
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// registryPrefixSource is the start of sources that
+// LoadOptions.RegistryPrefix is applied to.
+const registryPrefixSource = "@registry/"
+
+// registryRegexp matches module registry sources of the form
+// host/namespace/name/provider. The host must look like a hostname (it
+// must contain a ".") so that this doesn't match relative paths.
+var registryRegexp = regexp.MustCompile(
+	`^[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)+(:[0-9]+)?/[^/?]+/[^/?]+/[^/?]+(\?.*)?$`)
+
+// RegistryDetector implements Detector to detect module registry sources
+// and turn them into URLs that the Registry Getter can understand.
+type RegistryDetector struct{}
+
+func (d *RegistryDetector) Detect(src, _ string) (string, bool, error) {
+	if !registryRegexp.MatchString(src) {
+		return "", false, nil
+	}
+
+	return "registry::https://" + src, true, nil
+}
+
+// expandRegistryPrefix expands src with prefix if it starts with
+// "@registry/", and otherwise returns src unchanged. An error is returned
+// if there is no prefix to expand it with.
+func expandRegistryPrefix(src, prefix string) (string, error) {
+	if !strings.HasPrefix(src, registryPrefixSource) {
+		return src, nil
+	}
+
+	if prefix == "" {
+		return "", fmt.Errorf("%s requires a registry prefix", src)
+	}
+
+	return strings.TrimRight(prefix, "/") + "/" +
+		src[len(registryPrefixSource):], nil
+}
@@ -0,0 +1,73 @@
+package module
+
+import (
+	"testing"
+)
+
+func TestRegistryDetector(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output string
+		Ok     bool
+	}{
+		{
+			"registry.example.com/hashicorp/consul/aws",
+			"registry::https://registry.example.com/hashicorp/consul/aws",
+			true,
+		},
+		{
+			"registry.example.com:8443/hashicorp/consul/aws?version=1.0",
+			"registry::https://registry.example.com:8443/hashicorp/consul/aws?version=1.0",
+			true,
+		},
+		{"registry.example.com/hashicorp/consul", "", false},
+		{"modules/consul/aws/foo", "", false},
+		{"./foo", "", false},
+	}
+
+	pwd := "/pwd"
+	f := new(RegistryDetector)
+	for i, tc := range cases {
+		output, ok, err := f.Detect(tc.Input, pwd)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if ok != tc.Ok {
+			t.Fatalf("%d: bad ok: %#v", i, ok)
+		}
+
+		if output != tc.Output {
+			t.Fatalf("%d: bad: %#v", i, output)
+		}
+	}
+}
+
+func TestExpandRegistryPrefix(t *testing.T) {
+	cases := []struct {
+		Prefix string
+		Input  string
+		Output string
+		Err    bool
+	}{
+		{"dev.example.com", "@registry/hashicorp/vpc/aws",
+			"dev.example.com/hashicorp/vpc/aws", false},
+		{"dev.example.com/", "@registry/hashicorp/vpc/aws",
+			"dev.example.com/hashicorp/vpc/aws", false},
+		{"prod.example.com/hashicorp", "@registry/vpc/aws",
+			"prod.example.com/hashicorp/vpc/aws", false},
+		{"", "@registry/hashicorp/vpc/aws", "", true},
+		{"", "prod.example.com/hashicorp/vpc/aws",
+			"prod.example.com/hashicorp/vpc/aws", false},
+		{"dev.example.com", "./foo", "./foo", false},
+	}
+
+	for i, tc := range cases {
+		output, err := expandRegistryPrefix(tc.Input, tc.Prefix)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%d: bad err: %s", i, err)
+		}
+		if output != tc.Output {
+			t.Fatalf("%d: bad output: %s", i, output)
+		}
+	}
+}
@@ -14,6 +14,28 @@ func TestDetect(t *testing.T) {
 		{"./foo", "/foo", "file:///foo/foo", false},
 		{"git::./foo", "/foo", "git::file:///foo/foo", false},
 		{"git::github.com/hashicorp/foo", "", "git::https://github.com/hashicorp/foo.git", false},
+		{"git::file::./foo", "/foo", "git::file:///foo/foo", false},
+		{"git::https::example.com/foo.git", "", "git::https://example.com/foo.git", false},
+		{"git::file::https::example.com/foo", "", "", true},
+		{"git::https::https://example.com/foo", "", "", true},
+		{
+			"registry.example.com/hashicorp/consul/aws",
+			"/foo",
+			"registry::https://registry.example.com/hashicorp/consul/aws",
+			false,
+		},
+		{
+			"ipfs::QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG",
+			"/foo",
+			"ipfs::ipfs://QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG",
+			false,
+		},
+		{
+			"torrent::magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a",
+			"/foo",
+			"torrent::magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a",
+			false,
+		},
 	}
 
 	for i, tc := range cases {
@@ -0,0 +1,211 @@
+package module
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+// VanityDetector implements Detector to detect sources on vanity hosts,
+// such as "modules.example.com/vpc", whose real location is discovered
+// from the host, similar to the "?go-get=1" discovery of Go. This lets the
+// host repoint a module without changing the configurations that use it.
+//
+// An HTTPS GET request is made to the source with the additional parameter
+// "terraform-get=1". The real source is taken from the Location header of
+// a redirect, or otherwise from the X-Terraform-Get header or the
+// "terraform-get" meta tag, just like HttpGetter. Redirects to shorthand
+// hosts such as GitHub, and to URLs that end in ".git", are turned into git
+// sources. Any parameters of the vanity source, such as "ref", are added to
+// the real source.
+//
+// Discovered sources are cached until Load is called again, so that each
+// source is only discovered once per load of a tree.
+//
+// The detector isn't in the default Detectors since it needs to be given
+// the hosts to use. Put it first so that its hosts take precedence:
+//
+//	module.Detectors = append(
+//	    []module.Detector{&module.VanityDetector{Hosts: hosts}},
+//	    module.Detectors...)
+type VanityDetector struct {
+	// Hosts are the hosts to discover sources on, including the port if
+	// there is one. Sources on other hosts are left to other Detectors.
+	Hosts []string
+
+	// Transport, if set, is used to make the discovery requests instead of
+	// http.DefaultTransport. Redirects are never followed.
+	Transport http.RoundTripper
+
+	cacheLock sync.Mutex
+	cache     map[string]string
+}
+
+func (d *VanityDetector) Detect(src, _ string) (string, bool, error) {
+	idx := strings.Index(src, "/")
+	if idx <= 0 || !d.matches(src[:idx]) {
+		return "", false, nil
+	}
+	if Vendored {
+		return "", true, vendoredError(src)
+	}
+
+	d.cacheLock.Lock()
+	result, ok := d.cache[src]
+	d.cacheLock.Unlock()
+	if ok {
+		return result, true, nil
+	}
+
+	result, err := d.discover(src)
+	if err != nil {
+		return "", true, fmt.Errorf("error discovering source %s: %s", src, err)
+	}
+	if err := checkRemoteSource(result); err != nil {
+		return "", true, err
+	}
+
+	d.cacheLock.Lock()
+	defer d.cacheLock.Unlock()
+	if d.cache == nil {
+		d.cache = make(map[string]string)
+	}
+	d.cache[src] = result
+
+	return result, true, nil
+}
+
+// resetCache forgets the discovered sources.
+func (d *VanityDetector) resetCache() {
+	d.cacheLock.Lock()
+	defer d.cacheLock.Unlock()
+	d.cache = nil
+}
+
+// matches returns whether the host is one of Hosts.
+func (d *VanityDetector) matches(host string) bool {
+	for _, h := range d.Hosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// discover makes the discovery request for src and returns the real
+// source with the parameters of src added.
+func (d *VanityDetector) discover(src string) (string, error) {
+	u, err := url.Parse("https://" + src)
+	if err != nil {
+		return "", err
+	}
+	params := u.Query()
+
+	reqU := *u
+	reqU.RawQuery = url.Values{"terraform-get": []string{"1"}}.Encode()
+	req, err := http.NewRequest("GET", reqU.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	transport := d.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result string
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		loc, err := resp.Location()
+		if err != nil {
+			return "", err
+		}
+
+		// The redirect isn't meant for us, so drop our parameter
+		q := loc.Query()
+		q.Del("terraform-get")
+		loc.RawQuery = q.Encode()
+
+		result, err = vanityRedirectSource(loc)
+		if err != nil {
+			return "", err
+		}
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		result = resp.Header.Get("X-Terraform-Get")
+		if result == "" {
+			result, err = new(HttpGetter).parseMeta(resp.Body)
+			if err != nil {
+				return "", err
+			}
+		}
+		if result == "" {
+			return "", fmt.Errorf("no source URL was returned")
+		}
+	default:
+		return "", fmt.Errorf("bad response code: %d", resp.StatusCode)
+	}
+
+	if len(params) == 0 {
+		return result, nil
+	}
+
+	force, realSrc := getForcedGetter(result)
+	realU, err := url.Parse(realSrc)
+	if err != nil {
+		return "", err
+	}
+	q := realU.Query()
+	for k, vs := range params {
+		for _, v := range vs {
+			q.Add(k, v)
+		}
+	}
+	realU.RawQuery = q.Encode()
+
+	result = realU.String()
+	if force != "" {
+		result = force + "::" + result
+	}
+
+	return result, nil
+}
+
+// vanityRedirectSource returns the source for the location of a redirect.
+// Since a redirect can't say which getter to use, locations on hosts that
+// other Detectors know, such as GitHub, are detected by them, and
+// locations ending in ".git" are git repositories. Anything else is used
+// as is.
+func vanityRedirectSource(loc *url.URL) (string, error) {
+	if path.Ext(loc.Path) == ".git" {
+		return "git::" + loc.String(), nil
+	}
+
+	if loc.Scheme == "https" {
+		shorthand := strings.TrimPrefix(loc.String(), "https://")
+		for _, d := range Detectors {
+			switch d.(type) {
+			case *VanityDetector, *FileDetector:
+				continue
+			}
+
+			result, ok, err := d.Detect(shorthand, "")
+			if err != nil {
+				return "", err
+			}
+			if ok {
+				return result, nil
+			}
+		}
+	}
+
+	return loc.String(), nil
+}
@@ -0,0 +1,149 @@
+package module
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestVanityDetector(t *testing.T) {
+	var requests int
+	server := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if r.URL.Query().Get("terraform-get") != "1" {
+				w.WriteHeader(404)
+				return
+			}
+
+			switch r.URL.Path {
+			case "/github":
+				http.Redirect(w, r, "https://github.com/hashicorp/foo", 302)
+			case "/git":
+				http.Redirect(w, r, "https://git.example.com/foo.git", 301)
+			case "/header":
+				w.Header().Add("X-Terraform-Get", "hg::https://hg.example.com/foo")
+			case "/meta":
+				fmt.Fprintf(w, testHttpMetaStr, testRemoteModule("basic"))
+			default:
+				w.WriteHeader(404)
+			}
+		}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	host := u.Host
+
+	cases := []struct {
+		Input  string
+		Output string
+		Ok     bool
+		Err    bool
+	}{
+		{
+			host + "/github",
+			"git::https://github.com/hashicorp/foo.git",
+			true,
+			false,
+		},
+		{
+			host + "/github?ref=v1.0.0",
+			"git::https://github.com/hashicorp/foo.git?ref=v1.0.0",
+			true,
+			false,
+		},
+		{
+			host + "/git",
+			"git::https://git.example.com/foo.git",
+			true,
+			false,
+		},
+		{
+			host + "/header?rev=1",
+			"hg::https://hg.example.com/foo?rev=1",
+			true,
+			false,
+		},
+		{
+			host + "/meta",
+			testRemoteModule("basic"),
+			true,
+			false,
+		},
+		{
+			host + "/missing",
+			"",
+			true,
+			true,
+		},
+		{
+			"example.com/foo",
+			"",
+			false,
+			false,
+		},
+	}
+
+	d := &VanityDetector{
+		Hosts:     []string{host},
+		Transport: server.Client().Transport,
+	}
+	for _, tc := range cases {
+		output, ok, err := d.Detect(tc.Input, "/pwd")
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if ok != tc.Ok {
+			t.Fatalf("%s: bad ok: %v", tc.Input, ok)
+		}
+		if output != tc.Output {
+			t.Fatalf("%s: bad: %s", tc.Input, output)
+		}
+	}
+
+	// Discovered sources are cached until they're reset
+	requests = 0
+	if _, _, err := d.Detect(host+"/github", "/pwd"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if requests != 0 {
+		t.Fatalf("should be cached: %d", requests)
+	}
+
+	d.resetCache()
+	if _, _, err := d.Detect(host+"/github", "/pwd"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if requests != 1 {
+		t.Fatalf("should not be cached: %d", requests)
+	}
+}
+
+func TestVanityDetector_error(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	d := &VanityDetector{
+		Hosts:     []string{u.Host},
+		Transport: server.Client().Transport,
+	}
+	_, _, err = d.Detect(u.Host+"/foo", "/pwd")
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "no source URL") {
+		t.Fatalf("bad: %s", err)
+	}
+}
@@ -0,0 +1,261 @@
+package module
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+// FileSystem is what the configurations of modules are loaded from. By
+// default this is the local disk, but a tree can be loaded from anything
+// that implements this, such as an archive that is only in memory.
+type FileSystem interface {
+	// ReadDir returns the entries of the directory, sorted by name.
+	ReadDir(string) ([]os.FileInfo, error)
+
+	// ReadFile returns the contents of the file.
+	ReadFile(string) ([]byte, error)
+}
+
+// FileSystemStorage is implemented by Storages whose modules aren't on
+// the local disk. The directories that Dir returns are then within the
+// FileSystem, and the configurations of the modules are loaded from it.
+type FileSystemStorage interface {
+	Storage
+
+	FileSystem() FileSystem
+}
+
+// DiskFileSystem is the FileSystem of the local disk.
+var DiskFileSystem FileSystem = diskFileSystem{}
+
+type diskFileSystem struct{}
+
+func (diskFileSystem) ReadDir(dir string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(dir)
+}
+
+func (diskFileSystem) ReadFile(path string) ([]byte, error) {
+	return ioutil.ReadFile(path)
+}
+
+// MemFileSystem is a FileSystem that is held entirely in memory, for
+// loading configurations without touching the disk at all.
+//
+// The paths within it are relative to its root, though a leading "/" is
+// allowed, and directories only exist by containing files.
+type MemFileSystem struct {
+	files map[string][]byte
+}
+
+// NewMemFileSystem returns a MemFileSystem with the given files, by path.
+func NewMemFileSystem(files map[string][]byte) *MemFileSystem {
+	result := &MemFileSystem{files: make(map[string][]byte)}
+	for p, data := range files {
+		result.files[memPath(p)] = data
+	}
+
+	return result
+}
+
+// NewZipFileSystem returns a MemFileSystem with the files of the given
+// zip archive.
+func NewZipFileSystem(data []byte) (*MemFileSystem, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte)
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f.Name, err)
+		}
+		files[f.Name], err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f.Name, err)
+		}
+	}
+
+	return NewMemFileSystem(files), nil
+}
+
+func (fs *MemFileSystem) ReadDir(dir string) ([]os.FileInfo, error) {
+	dir = memPath(dir)
+	if _, ok := fs.files[dir]; ok && dir != "" {
+		return nil, &os.PathError{
+			Op: "readdir", Path: dir, Err: fmt.Errorf("not a directory")}
+	}
+
+	entries := make(map[string]*memFileInfo)
+	for p, data := range fs.files {
+		rel := p
+		if dir != "" {
+			if !strings.HasPrefix(p, dir+"/") {
+				continue
+			}
+			rel = p[len(dir)+1:]
+		}
+
+		if idx := strings.Index(rel, "/"); idx >= 0 {
+			entries[rel[:idx]] = &memFileInfo{name: rel[:idx], dir: true}
+		} else {
+			entries[rel] = &memFileInfo{name: rel, size: int64(len(data))}
+		}
+	}
+	if len(entries) == 0 && dir != "" {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: os.ErrNotExist}
+	}
+
+	names := make([]string, 0, len(entries))
+	for n := range entries {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	result := make([]os.FileInfo, len(names))
+	for i, n := range names {
+		result[i] = entries[n]
+	}
+
+	return result, nil
+}
+
+func (fs *MemFileSystem) ReadFile(p string) ([]byte, error) {
+	data, ok := fs.files[memPath(p)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+	}
+
+	return data, nil
+}
+
+// memPath returns the path within a MemFileSystem that p refers to.
+func memPath(p string) string {
+	return strings.Trim(path.Clean("/"+filepath.ToSlash(p)), "/")
+}
+
+// memFileInfo is the os.FileInfo of an entry of a MemFileSystem.
+type memFileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi *memFileInfo) IsDir() bool        { return fi.dir }
+func (fi *memFileInfo) Sys() interface{}   { return nil }
+
+func (fi *memFileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0755
+	}
+
+	return 0644
+}
+
+// storageFileSystem returns the FileSystem that the modules of the
+// storage are loaded from.
+func storageFileSystem(s Storage) FileSystem {
+	if fs, ok := s.(FileSystemStorage); ok {
+		return fs.FileSystem()
+	}
+
+	return DiskFileSystem
+}
+
+// loadDirFS loads the configuration in the directory of the FileSystem.
+// The configurations on the local disk are loaded by the config package
+// directly, so that their directory is absolute.
+func loadDirFS(fs FileSystem, dir string) (*config.Config, error) {
+	if fs == nil || fs == DiskFileSystem {
+		return config.LoadDir(dir)
+	}
+
+	fis, err := fs.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte)
+	for _, fi := range fis {
+		if fi.IsDir() || !isConfigFile(fi.Name()) {
+			continue
+		}
+
+		files[fi.Name()], err = fs.ReadFile(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return config.LoadFiles(dir, files)
+}
+
+// hasConfigFilesFS is like hasConfigFiles, for a directory of the
+// FileSystem.
+func hasConfigFilesFS(fs FileSystem, dir string) (bool, error) {
+	if fs == nil || fs == DiskFileSystem {
+		return hasConfigFiles(dir)
+	}
+
+	fis, err := fs.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	for _, fi := range fis {
+		if !fi.IsDir() && isConfigFile(fi.Name()) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// isFileFS returns whether the path within the FileSystem is a file rather
+// than a directory. A path that doesn't exist is neither.
+func isFileFS(fs FileSystem, path string) (bool, error) {
+	if fs == nil || fs == DiskFileSystem {
+		fi, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+
+			return false, err
+		}
+
+		return !fi.IsDir(), nil
+	}
+
+	_, err := fs.ReadFile(path)
+	return err == nil, nil
+}
+
+// isConfigFile returns whether the file with the given name is a
+// Terraform configuration file.
+func isConfigFile(name string) bool {
+	return strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".tf.json")
+}
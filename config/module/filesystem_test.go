@@ -0,0 +1,176 @@
+package module
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMemFileSystem(t *testing.T) {
+	fs := NewMemFileSystem(map[string][]byte{
+		"main.tf":           []byte("foo"),
+		"/child/main.tf":    []byte("bar"),
+		"child/nested/a.tf": []byte("baz"),
+	})
+
+	cases := []struct {
+		Dir     string
+		Entries []string
+		Err     bool
+	}{
+		{"", []string{"child", "main.tf"}, false},
+		{"/", []string{"child", "main.tf"}, false},
+		{"child", []string{"main.tf", "nested"}, false},
+		{"/child/nested/", []string{"a.tf"}, false},
+		{"missing", nil, true},
+		{"main.tf", nil, true},
+	}
+
+	for _, tc := range cases {
+		fis, err := fs.ReadDir(tc.Dir)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %v", tc.Dir, err)
+		}
+
+		var actual []string
+		for _, fi := range fis {
+			actual = append(actual, fi.Name())
+		}
+		if !reflect.DeepEqual(actual, tc.Entries) {
+			t.Fatalf("%s: bad: %#v", tc.Dir, actual)
+		}
+	}
+
+	data, err := fs.ReadFile("/child/../child/main.tf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "bar" {
+		t.Fatalf("bad: %q", data)
+	}
+
+	if _, err := fs.ReadFile("child"); !os.IsNotExist(err) {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestNewTreeModuleFS(t *testing.T) {
+	fs := testZipFileSystem(t, map[string]string{
+		"main.tf": `
+module "child" {
+    source = "./child"
+    memory = "yes"
+}
+`,
+		"override.tf": `
+module "child" {
+    memory = "override"
+}
+`,
+		"child/main.tf": `
+variable "memory" {}
+output "memory" { value = "${var.memory}" }
+`,
+	})
+
+	tree, err := NewTreeModuleFS("", fs, "/")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := tree.Load(&testFileSystemStorage{fs}, GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	child, ok := tree.Children()["child"]
+	if !ok {
+		t.Fatalf("bad: %#v", tree.Children())
+	}
+	if len(child.config.Outputs) != 1 {
+		t.Fatalf("bad: %#v", child.config.Outputs)
+	}
+
+	m := tree.config.Modules[0]
+	if m.RawConfig.Raw["memory"] != "override" {
+		t.Fatalf("bad: %#v", m.RawConfig.Raw)
+	}
+}
+
+func TestNewTreeModuleFS_disk(t *testing.T) {
+	tree, err := NewTreeModuleFS("", DiskFileSystem, filepath.Join(fixtureDir, "basic"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestNewTreeModuleFS_noConfigs(t *testing.T) {
+	fs := testZipFileSystem(t, map[string]string{"README.md": "hello"})
+
+	if _, err := NewTreeModuleFS("", fs, "/"); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+// testFileSystemStorage is a Storage of the modules already within a
+// FileSystem, by the path of their source.
+type testFileSystemStorage struct {
+	fs FileSystem
+}
+
+func (s *testFileSystemStorage) Dir(source string) (string, bool, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return "", false, err
+	}
+
+	return u.Path, true, nil
+}
+
+func (s *testFileSystemStorage) Get(string, bool) error { return nil }
+
+func (s *testFileSystemStorage) UpdateAvailable(string) (bool, error) {
+	return false, nil
+}
+
+func (s *testFileSystemStorage) Check(string) error { return nil }
+
+func (s *testFileSystemStorage) List() ([]string, error) { return nil, nil }
+
+func (s *testFileSystemStorage) FileSystem() FileSystem { return s.fs }
+
+// testZipFileSystem returns a MemFileSystem of a zip archive of the given
+// files, built in memory.
+func testZipFileSystem(t *testing.T, files map[string]string) *MemFileSystem {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, contents := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if _, err := f.Write([]byte(contents)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	fs, err := NewZipFileSystem(buf.Bytes())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return fs
+}
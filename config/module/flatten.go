@@ -0,0 +1,542 @@
+package module
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+// FlattenConfig merges the configurations of every module in the tree into
+// a single configuration, wiring the parameters of every module into its
+// variables and its outputs into the modules that use them:
+//
+//   - The variables, provider configurations, and outputs of this tree
+//     are kept as they are.
+//   - The resources of every module are added, renamed to the path of the
+//     module and the resource name joined by "-". For example, resource
+//     "aws_instance.web" in module "vpc.subnets" becomes
+//     "aws_instance.vpc-subnets-web", and every reference to it, including
+//     depends_on, is renamed to match. It is an error if renamed resources
+//     still collide with other resources.
+//   - References to the variables of a module are replaced with the
+//     parameter the module was given, or else the default of the variable.
+//     References to the outputs of a module are replaced with the value of
+//     the output.
+//   - Resources can't be namespaced by provider, so a provider configured
+//     in a module is only used if no module above it, or before it, has
+//     configured the same provider. Modules are taken in the order of
+//     Modules, except that a module whose outputs are parameters of
+//     another module comes before that module.
+//
+// The tree must be loaded and valid, and an error is returned if it isn't.
+// The configurations of the tree aren't modified.
+func (t *Tree) FlattenConfig() (*config.Config, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+
+	f := &flattener{
+		result:    &config.Config{Dir: t.config.Dir},
+		providers: make(map[string]struct{}),
+		resources: make(map[string]string),
+	}
+	root := f.scope(t, nil, nil)
+	if err := root.flatten(); err != nil {
+		return nil, err
+	}
+
+	for _, v := range t.config.Variables {
+		f.result.Variables = append(f.result.Variables, v)
+	}
+	for _, o := range t.config.Outputs {
+		raw, err := root.rewriteRaw(o.RawConfig)
+		if err != nil {
+			return nil, fmt.Errorf("output %s: %s", o.Name, err)
+		}
+
+		f.result.Outputs = append(f.result.Outputs, &config.Output{
+			Name:        o.Name,
+			Description: o.Description,
+			RawConfig:   raw,
+		})
+	}
+
+	return f.result, nil
+}
+
+// flattener builds the result of FlattenConfig.
+type flattener struct {
+	result *config.Config
+
+	// providers are the providers that are already configured, and
+	// resources are the renamed resources, mapped to the module that they
+	// came from, to detect collisions.
+	providers map[string]struct{}
+	resources map[string]string
+}
+
+// flattenScope is a single module being flattened.
+type flattenScope struct {
+	f    *flattener
+	tree *Tree
+	path []string
+
+	// vars are the values of the variables of the module, already
+	// rewritten for the flattened configuration. This is nil for the
+	// root, whose variables are kept as variables.
+	vars map[string]interface{}
+
+	// outputs are the rewritten outputs of the child modules, by module
+	// name. A nil map means that the module is being flattened.
+	outputs map[string]map[string]interface{}
+}
+
+func (f *flattener) scope(
+	t *Tree, path []string, vars map[string]interface{}) *flattenScope {
+	return &flattenScope{
+		f:       f,
+		tree:    t,
+		path:    path,
+		vars:    vars,
+		outputs: make(map[string]map[string]interface{}),
+	}
+}
+
+// flatten adds the providers and resources of the module and all the
+// modules beneath it to the result.
+func (s *flattenScope) flatten() error {
+	for _, p := range s.tree.config.ProviderConfigs {
+		if _, ok := s.f.providers[p.Name]; ok {
+			continue
+		}
+		s.f.providers[p.Name] = struct{}{}
+
+		raw, err := s.rewriteRaw(p.RawConfig)
+		if err != nil {
+			return s.err("provider %s: %s", p.Name, err)
+		}
+
+		s.f.result.ProviderConfigs = append(s.f.result.ProviderConfigs,
+			&config.ProviderConfig{Name: p.Name, RawConfig: raw})
+	}
+
+	// Modules are flattened before the resources so that the order in
+	// which providers are taken from them doesn't depend on the resources.
+	for _, m := range s.tree.Modules() {
+		if _, err := s.moduleOutputs(m.Name); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range s.tree.config.Resources {
+		if err := s.flattenResource(r); err != nil {
+			return s.err("resource %s: %s", r.Id(), err)
+		}
+	}
+
+	return nil
+}
+
+func (s *flattenScope) flattenResource(r *config.Resource) error {
+	result := &config.Resource{
+		Name:  s.name(r.Name),
+		Type:  r.Type,
+		Count: r.Count,
+	}
+
+	id := result.Id()
+	if other, ok := s.f.resources[id]; ok {
+		return fmt.Errorf(
+			"collides with a resource in module %q when flattened as %s",
+			other, id)
+	}
+	s.f.resources[id] = strings.Join(s.path, ".")
+
+	var err error
+	result.RawConfig, err = s.rewriteRaw(r.RawConfig)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range r.Provisioners {
+		np := &config.Provisioner{Type: p.Type}
+		if np.RawConfig, err = s.rewriteRaw(p.RawConfig); err != nil {
+			return fmt.Errorf("provisioner %s: %s", p.Type, err)
+		}
+		if np.ConnInfo, err = s.rewriteRaw(p.ConnInfo); err != nil {
+			return fmt.Errorf("provisioner %s: %s", p.Type, err)
+		}
+
+		result.Provisioners = append(result.Provisioners, np)
+	}
+
+	for _, d := range r.DependsOn {
+		result.DependsOn = append(result.DependsOn, s.resourceKey(d))
+	}
+
+	s.f.result.Resources = append(s.f.result.Resources, result)
+	return nil
+}
+
+// moduleOutputs flattens the child module with the given name, if it
+// hasn't been already, and returns its rewritten outputs.
+func (s *flattenScope) moduleOutputs(name string) (map[string]interface{}, error) {
+	if outputs, ok := s.outputs[name]; ok {
+		if outputs == nil {
+			return nil, s.err("module %s: cycle in module references", name)
+		}
+
+		return outputs, nil
+	}
+	s.outputs[name] = nil
+
+	var m *config.Module
+	for _, cm := range s.tree.config.Modules {
+		if cm.Name == name {
+			m = cm
+		}
+	}
+	child := s.tree.Children()[name]
+
+	// The parameters are evaluated in this module, and variables that
+	// weren't given are set to their defaults.
+	vars := make(map[string]interface{})
+	for _, v := range child.config.Variables {
+		if v.Default != nil {
+			vars[v.Name] = v.Default
+		}
+	}
+	for k, v := range m.RawConfig.Raw {
+		nv, err := s.rewriteValue(v)
+		if err != nil {
+			return nil, s.err("module %s: %s: %s", name, k, err)
+		}
+
+		vars[k] = nv
+	}
+
+	path := make([]string, len(s.path), len(s.path)+1)
+	copy(path, s.path)
+	path = append(path, name)
+
+	cs := s.f.scope(child, path, vars)
+	if err := cs.flatten(); err != nil {
+		return nil, err
+	}
+
+	outputs := make(map[string]interface{})
+	for _, o := range child.config.Outputs {
+		v, err := cs.rewriteValue(o.RawConfig.Raw["value"])
+		if err != nil {
+			return nil, cs.err("output %s: %s", o.Name, err)
+		}
+
+		outputs[o.Name] = v
+	}
+	s.outputs[name] = outputs
+
+	return outputs, nil
+}
+
+// name returns the name of a resource of this module once flattened.
+func (s *flattenScope) name(n string) string {
+	if len(s.path) == 0 {
+		return n
+	}
+
+	return strings.Join(s.path, "-") + "-" + n
+}
+
+// resourceKey renames the resource in a "type.name" reference, along
+// with anything that follows it.
+func (s *flattenScope) resourceKey(key string) string {
+	parts := strings.SplitN(key, ".", 3)
+	if len(parts) < 2 {
+		return key
+	}
+
+	parts[1] = s.name(parts[1])
+	return strings.Join(parts, ".")
+}
+
+func (s *flattenScope) rewriteRaw(r *config.RawConfig) (*config.RawConfig, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	raw, err := s.rewriteValue(r.Raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.NewRawConfig(raw.(map[string]interface{}))
+}
+
+// rewriteValue returns a copy of the raw configuration value with every
+// interpolation rewritten for the flattened configuration.
+func (s *flattenScope) rewriteValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return s.rewriteString(v)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			ne, err := s.rewriteValue(e)
+			if err != nil {
+				return nil, err
+			}
+
+			result[k] = ne
+		}
+
+		return result, nil
+	case []map[string]interface{}:
+		result := make([]map[string]interface{}, len(v))
+		for i, e := range v {
+			ne, err := s.rewriteValue(e)
+			if err != nil {
+				return nil, err
+			}
+
+			result[i] = ne.(map[string]interface{})
+		}
+
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, e := range v {
+			ne, err := s.rewriteValue(e)
+			if err != nil {
+				return nil, err
+			}
+
+			result[i] = ne
+		}
+
+		return result, nil
+	default:
+		return v, nil
+	}
+}
+
+// rewriteString rewrites every interpolation in v. The result is usually
+// a string, but a value that is only a reference to a variable or output
+// is replaced with its value as is, so it can be a map or list.
+func (s *flattenScope) rewriteString(v string) (interface{}, error) {
+	matches := config.InterpRegexp.FindAllStringSubmatchIndex(v, -1)
+
+	var buf []string
+	last := 0
+	for _, idx := range matches {
+		dollars := idx[3] - idx[2]
+
+		// If there are even amounts of dollar signs, then it is escaped
+		if dollars%2 == 0 {
+			continue
+		}
+
+		// The extra dollar signs are escaped ones that come before
+		buf = append(buf, v[last:idx[0]+dollars-1])
+		last = idx[1]
+
+		expr := strings.TrimSpace(v[idx[4]:idx[5]])
+		if value, ok, err := s.lookup(expr); err != nil {
+			return nil, fmt.Errorf("%s: %s", expr, err)
+		} else if ok {
+			// A value that is exactly a reference is replaced whole
+			if len(matches) == 1 && dollars == 1 &&
+				idx[0] == 0 && idx[1] == len(v) {
+				return value, nil
+			}
+
+			str, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf(
+					"%s: a list or map can't be part of a string", expr)
+			}
+
+			buf = append(buf, str)
+			continue
+		}
+
+		expr, err := s.rewriteExpr(expr)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, "${"+expr+"}")
+	}
+	buf = append(buf, v[last:])
+
+	return strings.Join(buf, ""), nil
+}
+
+// rewriteExpr rewrites every variable in the interpolated expression.
+func (s *flattenScope) rewriteExpr(expr string) (string, error) {
+	var buf []string
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == '"':
+			end := strings.IndexByte(expr[i+1:], '"')
+			if end < 0 {
+				return "", fmt.Errorf("%s: unterminated string", expr)
+			}
+
+			buf = append(buf, expr[i:i+end+2])
+			i += end + 2
+		case flattenIdentChar(c):
+			start := i
+			for i < len(expr) && flattenIdentChar(expr[i]) {
+				i++
+			}
+
+			ident := expr[start:i]
+			if !strings.Contains(ident, ".") {
+				// Function names aren't variables
+				buf = append(buf, ident)
+				continue
+			}
+
+			value, err := s.variableExpr(ident)
+			if err != nil {
+				return "", err
+			}
+			buf = append(buf, value)
+		default:
+			buf = append(buf, string(c))
+			i++
+		}
+	}
+
+	return strings.Join(buf, ""), nil
+}
+
+// variableExpr returns the expression that the variable is replaced with
+// within a larger expression.
+func (s *flattenScope) variableExpr(ident string) (string, error) {
+	value, ok, err := s.lookup(ident)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", ident, err)
+	}
+	if !ok {
+		return s.resourceKey(ident), nil
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf(
+			"%s: a list or map can't be used within an expression", ident)
+	}
+
+	// Strings that are only a single interpolation become that expression,
+	// otherwise the parts are joined with concat.
+	var parts []string
+	quoted := false
+	literal := func(lit string) {
+		quoted = quoted || strings.Contains(lit, `"`)
+		parts = append(parts, `"`+lit+`"`)
+	}
+	last := 0
+	for _, idx := range config.InterpRegexp.FindAllStringSubmatchIndex(str, -1) {
+		if (idx[3]-idx[2])%2 == 0 {
+			continue
+		}
+
+		if lit := str[last : idx[0]+idx[3]-idx[2]-1]; lit != "" {
+			literal(lit)
+		}
+		parts = append(parts, strings.TrimSpace(str[idx[4]:idx[5]]))
+		last = idx[1]
+	}
+	if lit := str[last:]; lit != "" || len(parts) == 0 {
+		literal(lit)
+	}
+
+	result := parts[0]
+	if len(parts) > 1 {
+		result = "concat(" + strings.Join(parts, ", ") + ")"
+	}
+
+	// Literals can contain characters that can't be interpolated
+	if quoted || !flattenInterpolates(result) {
+		return "", fmt.Errorf(
+			"%s: value %q can't be used within an expression", ident, str)
+	}
+
+	return result, nil
+}
+
+// flattenInterpolates returns whether expr is an expression that the
+// config package can interpolate.
+func flattenInterpolates(expr string) bool {
+	v := "${" + expr + "}"
+	idx := config.InterpRegexp.FindStringIndex(v)
+	return idx != nil && idx[0] == 0 && idx[1] == len(v)
+}
+
+// lookup returns the value of the variable if it refers to a variable of
+// this module or an output of a child module, already rewritten. It
+// returns false for anything else, which are resources.
+func (s *flattenScope) lookup(ident string) (interface{}, bool, error) {
+	v, err := config.NewInterpolatedVariable(ident)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	switch v := v.(type) {
+	case *config.UserVariable:
+		if s.vars == nil {
+			// The variables of the root stay variables
+			return nil, false, nil
+		}
+
+		value, ok := s.vars[v.Name]
+		if !ok {
+			return nil, false, fmt.Errorf("no value for variable %s", v.Name)
+		}
+		if v.Elem == "" {
+			return value, true, nil
+		}
+
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false, fmt.Errorf("variable %s is not a map", v.Name)
+		}
+		elem, ok := m[v.Elem]
+		if !ok {
+			return nil, false, fmt.Errorf(
+				"variable %s has no key %s", v.Name, v.Elem)
+		}
+
+		return elem, true, nil
+	case *config.ModuleVariable:
+		outputs, err := s.moduleOutputs(v.Name)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return outputs[v.Field], true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+// err returns an error prefixed with the path of the module, if it isn't
+// the root.
+func (s *flattenScope) err(format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	if len(s.path) == 0 {
+		return err
+	}
+
+	return fmt.Errorf("module %s: %s", strings.Join(s.path, "."), err)
+}
+
+// flattenIdentChar returns whether the character can be part of a variable
+// or function name in an interpolated expression.
+func flattenIdentChar(c byte) bool {
+	return c == '_' || c == '-' || c == '.' || c == '*' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9')
+}
@@ -0,0 +1,104 @@
+package module
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTreeFlattenConfig(t *testing.T) {
+	tree := NewTree("", testConfig(t, "flatten"))
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	c, err := tree.FlattenConfig()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(c.Modules) != 0 {
+		t.Fatalf("bad: %#v", c.Modules)
+	}
+	if len(c.Variables) != 1 || c.Variables[0].Name != "region" {
+		t.Fatalf("bad: %#v", c.Variables)
+	}
+
+	// The provider of the root is used
+	if len(c.ProviderConfigs) != 1 {
+		t.Fatalf("bad: %#v", c.ProviderConfigs)
+	}
+	if v := c.ProviderConfigs[0].RawConfig.Raw["region"]; v != "${var.region}" {
+		t.Fatalf("bad: %#v", v)
+	}
+
+	resources := make(map[string]map[string]interface{})
+	for _, r := range c.Resources {
+		resources[r.Id()] = r.RawConfig.Raw
+	}
+	expected := map[string]map[string]interface{}{
+		"aws_instance.web": map[string]interface{}{
+			"ami": "foo",
+		},
+		"aws_instance.child-web": map[string]interface{}{
+			"ami":    "${aws_instance.web.id}",
+			"tag":    "web-${var.region}-small",
+			"size":   "size-small",
+			"joined": `${concat(concat("web-", var.region), "small")}`,
+		},
+		"aws_security_group.child-web": map[string]interface{}{
+			"name": "web-${var.region}",
+		},
+	}
+	if !reflect.DeepEqual(resources, expected) {
+		t.Fatalf("bad: %#v", resources)
+	}
+
+	for _, r := range c.Resources {
+		if r.Id() != "aws_instance.child-web" {
+			continue
+		}
+
+		expected := []string{"aws_security_group.child-web"}
+		if !reflect.DeepEqual(r.DependsOn, expected) {
+			t.Fatalf("bad: %#v", r.DependsOn)
+		}
+	}
+
+	if len(c.Outputs) != 1 {
+		t.Fatalf("bad: %#v", c.Outputs)
+	}
+	if v := c.Outputs[0].RawConfig.Raw["value"]; v != "${aws_instance.child-web.private_ip}" {
+		t.Fatalf("bad: %#v", v)
+	}
+	if d := c.Outputs[0].Description; d != "The private IP of the child web instance" {
+		t.Fatalf("bad: %#v", d)
+	}
+
+	// The tree itself isn't changed
+	if len(tree.Children()["child"].config.Resources) != 2 {
+		t.Fatal("tree should not be modified")
+	}
+	if v := tree.config.Outputs[0].RawConfig.Raw["value"]; v != "${module.child.ip}" {
+		t.Fatalf("tree should not be modified: %#v", v)
+	}
+}
+
+func TestTreeFlattenConfig_collision(t *testing.T) {
+	tree := NewTree("", testConfig(t, "flatten-collide"))
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	_, err := tree.FlattenConfig()
+	if err == nil || !strings.Contains(err.Error(), "collides") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestTreeFlattenConfig_notLoaded(t *testing.T) {
+	tree := NewTree("", testConfig(t, "flatten"))
+	if _, err := tree.FlattenConfig(); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -4,8 +4,14 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
+	"hash"
+	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 )
 
 // FolderStorage is an implementation of the Storage interface that manages
@@ -13,15 +19,114 @@ import (
 type FolderStorage struct {
 	// StorageDir is the directory where the modules will be stored.
 	StorageDir string
+
+	// Naming names the directory within StorageDir that each module
+	// source is stored in. If nil, FolderNamingHash is used. The hash can
+	// be changed with FolderNamingHashFunc.
+	Naming FolderNaming
+
+	// Cache, if set, is consulted before modules are downloaded from
+	// their sources, and modules downloaded from their sources are stored
+	// in it. Updates always go to the source, and local file sources are
+	// never cached. If nil and the environment variable named by
+	// CacheURLEnvVar is set, an HttpCache for that URL is used.
+	Cache Cache
+
+	// MirrorDir, if set, is a directory that a copy of every module that
+	// is downloaded from its source is kept in, building up a browsable
+	// record of everything that was ever downloaded. Each version of a
+	// module is kept in its own directory, named after its checksum,
+	// within a directory named after the source. Local file sources
+	// aren't mirrored. Failing to mirror a module fails the download.
+	MirrorDir string
+
+	// PreferMirror, if true, copies modules from the latest version in
+	// MirrorDir rather than downloading them, unless they are being
+	// updated. This allows loading modules that were mirrored before
+	// without a network.
+	PreferMirror bool
+}
+
+// FolderNaming is a strategy for naming the directory that a module source
+// is stored in. Every source must be given a different name, and the name
+// must be the same every time for the same source. Names must not start
+// with "." since those are used for temporary directories and for the
+// files that FolderStorage keeps about each module.
+type FolderNaming func(source string) string
+
+// FolderNamingHash names directories with the hex encoded MD5 hash of the
+// detected source, exactly as it is given, which is the default. These
+// names are stable: they won't change in future versions, so modules that
+// are already stored are found again, and other tools can compute them.
+func FolderNamingHash(source string) string {
+	return FolderNamingHashFunc(md5.New)(source)
+}
+
+// FolderNamingHashFunc returns a FolderNaming that names directories with
+// the hex encoded hash of the detected source using the given hash, such
+// as sha256.New, for storage that must match the layout of other tools.
+func FolderNamingHashFunc(h func() hash.Hash) FolderNaming {
+	return func(source string) string {
+		sum := h()
+		sum.Write([]byte(source))
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+}
+
+// folderNamingReadableMax is the maximum length of the readable part of
+// the names given by FolderNamingReadable.
+const folderNamingReadableMax = 64
+
+// folderNamingUnsafe matches the characters that FolderNamingReadable
+// replaces.
+var folderNamingUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// FolderNamingReadable names directories after the source so that they can
+// be browsed by hand, for example "github.com-hashicorp-vpc-5d41402a".
+// Characters that aren't safe in file names are replaced and only the end
+// of long sources is kept. Since different sources can end up with the
+// same name this way, the start of the hash of the full source is always
+// appended to keep names unique.
+func FolderNamingReadable(source string) string {
+	_, name := getForcedGetter(source)
+	if idx := strings.Index(name, "://"); idx >= 0 {
+		name = name[idx+3:]
+	}
+
+	name = folderNamingUnsafe.ReplaceAllString(name, "-")
+	if len(name) > folderNamingReadableMax {
+		name = name[len(name)-folderNamingReadableMax:]
+	}
+	name = strings.Trim(name, ".-")
+
+	hash := FolderNamingHash(source)[:8]
+	if name == "" {
+		return hash
+	}
+
+	return name + "-" + hash
 }
 
 // Dir implements Storage.Dir
+//
+// A source can name a subdirectory of what is downloaded after "//" in its
+// path, example: "git::https://example.com/repo.git//modules/vpc". The
+// whole source is stored once, no matter how many of its subdirectories
+// are used, and the directory of the subdirectory is returned.
 func (s *FolderStorage) Dir(source string) (d string, e bool, err error) {
+	source, subDir := getDirSubdir(source)
 	d = s.dir(source)
 	_, err = os.Stat(d)
 	if err == nil {
 		// Directory exists
 		e = true
+		if subDir != "" {
+			d, err = getSubdirPath(d, subDir)
+			if err != nil {
+				d = ""
+				e = false
+			}
+		}
 		return
 	}
 	if os.IsNotExist(err) {
@@ -39,27 +144,379 @@ func (s *FolderStorage) Dir(source string) (d string, e bool, err error) {
 }
 
 // Get implements Storage.Get
+//
+// Getting the same source is serialized with a lock file next to its
+// directory, so concurrent loads using the same StorageDir, even from
+// different processes, wait for each other rather than overwrite each
+// other's downloads. Each download still happens in its own temporary
+// directory.
 func (s *FolderStorage) Get(source string, update bool) error {
+	return s.GetCancel(source, update, nil)
+}
+
+// GetCancel implements CancelStorage.GetCancel
+//
+// Since modules are downloaded into a temporary directory that is only
+// moved into place when the download succeeds, canceling leaves the module
+// directory as it was and removes the temporary directory.
+func (s *FolderStorage) GetCancel(source string, update bool, cancel <-chan struct{}) error {
+	_, err := s.GetAction(source, update, cancel)
+	return err
+}
+
+// GetAction implements ActionStorage.GetAction
+func (s *FolderStorage) GetAction(
+	source string, update bool, cancel <-chan struct{}) (ModuleAction, error) {
+	return s.GetWithOptions(
+		source, &StorageGetOptions{Update: update, Cancel: cancel})
+}
+
+// GetWithOptions implements OptionsStorage.GetWithOptions
+//
+// For Progress, the temporary directory that the module is downloaded
+// into is measured while the getter writes to it. Modules that come from
+// the cache or the mirror aren't reported.
+func (s *FolderStorage) GetWithOptions(
+	source string, opts *StorageGetOptions) (ModuleAction, error) {
+	update := opts.Update
+	// The whole source is downloaded, and Dir finds the subdirectory
+	source, _ = getDirSubdir(source)
 	dir := s.dir(source)
+	if err := os.MkdirAll(s.StorageDir, 0755); err != nil {
+		return ModuleActionNone, err
+	}
+
+	unlock, err := lockPath(s.metaPath(dir, "lock"))
+	if err != nil {
+		return ModuleActionNone, fmt.Errorf("Error locking module directory: %s", err)
+	}
+	defer unlock()
+
+	// The directory may have been created while waiting for the lock
 	if !update {
 		if _, err := os.Stat(dir); err == nil {
 			// If the directory already exists, then we're done since
 			// we're not updating.
-			return nil
+			return ModuleActionSkipped, s.recordSource(dir, source)
 		} else if !os.IsNotExist(err) {
 			// If the error we got wasn't a file-not-exist error, then
 			// something went wrong and we should report it.
-			return fmt.Errorf("Error reading module directory: %s", err)
+			return ModuleActionNone, fmt.Errorf("Error reading module directory: %s", err)
 		}
 	}
 
+	// Skip updating the module if its getter can cheaply tell that the
+	// source hasn't changed, such as with "git ls-remote" or a conditional
+	// HTTP request. If it can't tell, the module is got again.
+	if update && s.unchanged(dir, source) {
+		return ModuleActionUnchanged, s.recordSource(dir, source)
+	}
+
 	// Get the source. This always forces an update.
-	return Get(dir, source)
+	action, err := s.get(dir, source, opts)
+	if err != nil {
+		return ModuleActionNone, err
+	}
+
+	return action, s.recordSource(dir, source)
+}
+
+// unchanged returns whether the module in dir is already what getting the
+// source would give. Errors aren't fatal, the module is just got again.
+func (s *FolderStorage) unchanged(dir, source string) bool {
+	if _, err := os.Lstat(dir); err != nil {
+		return false
+	}
+
+	ok, err := UpdateAvailable(dir, source)
+	if err != nil {
+		log.Printf("[WARN] module %s: error checking for updates: %s", source, err)
+		return false
+	}
+
+	return !ok
+}
+
+// recordSource remembers the source of the module in dir so that List can
+// report it, since it can't be derived from the directory name.
+func (s *FolderStorage) recordSource(dir, source string) error {
+	path := s.metaPath(dir, "source")
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	return ioutil.WriteFile(path, []byte(source), 0644)
+}
+
+// get downloads the source into dir with the options, without ever leaving
+// dir in a partial state. The module is downloaded into a temporary
+// directory, starting from a copy of the current module so that getters
+// can update it incrementally, and that directory is only moved into place
+// if downloading succeeds.
+func (s *FolderStorage) get(
+	dir, source string, opts *StorageGetOptions) (ModuleAction, error) {
+	td, err := newTempDir(dir, ".tmp")
+	if err != nil {
+		return ModuleActionNone, err
+	}
+	defer os.RemoveAll(td)
+
+	_, err = os.Lstat(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return ModuleActionNone, fmt.Errorf("Error reading module directory: %s", err)
+	}
+	exists := err == nil
+
+	tmp := filepath.Join(td, "module")
+	if exists {
+		if err := copyDir(tmp, dir); err != nil {
+			return ModuleActionNone, fmt.Errorf("Error copying module directory: %s", err)
+		}
+	}
+
+	action, err := s.getCached(tmp, source, opts)
+	if err != nil {
+		return ModuleActionNone, err
+	}
+	if action == ModuleActionDownloaded && s.mirrored(source) {
+		if err := s.mirrorPut(source, tmp); err != nil {
+			return ModuleActionNone, fmt.Errorf("Error mirroring module: %s", err)
+		}
+	}
+	if exists && action == ModuleActionDownloaded {
+		action = ModuleActionUpdated
+	}
+
+	// A getter that doesn't support canceling may have finished anyway
+	if canceled(opts.Cancel) {
+		return ModuleActionNone, fmt.Errorf("canceled")
+	}
+
+	// The download may be in TempDir on another disk, so it is moved next
+	// to dir first. Swapping the directories is then only renames.
+	swap, err := ioutil.TempDir(s.StorageDir, ".tmp")
+	if err != nil {
+		return ModuleActionNone, err
+	}
+	defer os.RemoveAll(swap)
+
+	staged := filepath.Join(swap, "module")
+	if err := moveDir(staged, tmp); err != nil {
+		return ModuleActionNone, err
+	}
+
+	if !exists {
+		return action, os.Rename(staged, dir)
+	}
+
+	// Move the old copy out of the way and the new one in. If the new one
+	// can't be moved into place, put the old one back.
+	old := filepath.Join(swap, "old")
+	if err := os.Rename(dir, old); err != nil {
+		return ModuleActionNone, err
+	}
+	if err := os.Rename(staged, dir); err != nil {
+		os.Rename(old, dir)
+		return ModuleActionNone, err
+	}
+
+	return action, nil
+}
+
+// getCached gets the source into dst, going through the mirror if it is
+// preferred and then the cache if there is one. Problems with either
+// aren't fatal, the source is used instead. The result is
+// ModuleActionMirrored or ModuleActionCached if the module came from the
+// mirror or the cache, and ModuleActionDownloaded otherwise.
+func (s *FolderStorage) getCached(
+	dst, source string, opts *StorageGetOptions) (ModuleAction, error) {
+	if !opts.Update && s.PreferMirror && s.mirrored(source) {
+		ok, err := s.mirrorGet(dst, source)
+		if err == nil && ok {
+			return ModuleActionMirrored, nil
+		}
+		if err != nil {
+			log.Printf("[WARN] module %s: error reading mirror: %s", source, err)
+		}
+
+		// Don't leave anything partially copied from the mirror behind
+		if err := os.RemoveAll(dst); err != nil {
+			return ModuleActionNone, err
+		}
+	}
+
+	cache := s.cache()
+	if cache == nil || getScheme(source) == "file" {
+		return ModuleActionDownloaded, getProgress(dst, source, opts)
+	}
+
+	key := FolderNamingHash(source)
+	if !opts.Update {
+		ok, err := cache.Get(dst, key)
+		if err == nil && ok {
+			return ModuleActionCached, nil
+		}
+		if err != nil {
+			log.Printf("[WARN] module %s: error reading cache: %s", source, err)
+		}
+
+		// Don't leave anything partially read from the cache behind
+		if err := os.RemoveAll(dst); err != nil {
+			return ModuleActionNone, err
+		}
+	}
+
+	if err := getProgress(dst, source, opts); err != nil {
+		return ModuleActionNone, err
+	}
+
+	if err := cache.Put(key, dst); err != nil {
+		log.Printf("[WARN] module %s: error writing cache: %s", source, err)
+	}
+
+	return ModuleActionDownloaded, nil
+}
+
+// progressInterval is how often getProgress measures a download.
+var progressInterval = 50 * time.Millisecond
+
+// getProgress gets the source into dst with the options, reporting the
+// size of dst to their Progress every progressInterval while the module is
+// downloaded, and once more when it is done, if Progress isn't nil. The
+// first error that Progress returns is the result, since the download is
+// expected to be canceled because of it.
+func getProgress(dst, source string, opts *StorageGetOptions) error {
+	getOpts := &GetOptions{
+		Cancel:       opts.Cancel,
+		Secrets:      opts.Secrets,
+		RequireHTTPS: opts.RequireHTTPS,
+	}
+	progress := opts.Progress
+	if progress == nil {
+		return getCancel(dst, source, getOpts)
+	}
+
+	var perr error
+	measure := func() {
+		// The getter may not have created dst yet, or be changing it
+		n, err := fileSystemSize(DiskFileSystem, dst)
+		if err == nil && perr == nil {
+			perr = progress(n)
+		}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				measure()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := getCancel(dst, source, getOpts)
+	close(done)
+	<-stopped
+	if err == nil {
+		measure()
+	}
+	if perr != nil {
+		return perr
+	}
+
+	return err
+}
+
+// mirrored returns whether the source is kept in the mirror.
+func (s *FolderStorage) mirrored(source string) bool {
+	return s.MirrorDir != "" && getScheme(source) != "file"
+}
+
+// cache returns the Cache to use, or nil if there isn't one.
+func (s *FolderStorage) cache() Cache {
+	if s.Cache != nil {
+		return s.Cache
+	}
+
+	if u := os.Getenv(CacheURLEnvVar); u != "" {
+		return &HttpCache{URL: u}
+	}
+
+	return nil
+}
+
+// UpdateAvailable implements UpdateStorage.UpdateAvailable
+func (s *FolderStorage) UpdateAvailable(source string) (bool, error) {
+	source, _ = getDirSubdir(source)
+	return UpdateAvailable(s.dir(source), source)
+}
+
+// Check implements CheckStorage.Check
+func (s *FolderStorage) Check(source string) error {
+	source, _ = getDirSubdir(source)
+	return Check(source)
+}
+
+// List implements ListStorage.List
+//
+// Modules downloaded by versions of FolderStorage that didn't record their
+// source can't be listed, so they are skipped with a warning.
+func (s *FolderStorage) List() ([]string, error) {
+	entries, err := ioutil.ReadDir(s.StorageDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var result []string
+	for _, e := range entries {
+		// Modules from local files are symlinks to their directory
+		module := e.IsDir() || e.Mode()&os.ModeSymlink != 0
+		if !module || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		dir := filepath.Join(s.StorageDir, e.Name())
+		source, err := ioutil.ReadFile(s.metaPath(dir, "source"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				log.Printf("[WARN] module: unknown source for %s, skipping", dir)
+				continue
+			}
+
+			return nil, err
+		}
+
+		result = append(result, string(source))
+	}
+
+	return result, nil
+}
+
+// metaPath returns the path of the file of the given kind that FolderStorage
+// keeps about the module in dir, such as its lock file.
+func (s *FolderStorage) metaPath(dir, kind string) string {
+	return filepath.Join(s.StorageDir, "."+filepath.Base(dir)+"."+kind)
 }
 
 // dir returns the directory name internally that we'll use to map to
 // internally.
 func (s *FolderStorage) dir(source string) string {
-	sum := md5.Sum([]byte(source))
-	return filepath.Join(s.StorageDir, hex.EncodeToString(sum[:]))
+	naming := s.Naming
+	if naming == nil {
+		naming = FolderNamingHash
+	}
+
+	return filepath.Join(s.StorageDir, naming(source))
 }
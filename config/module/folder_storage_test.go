@@ -1,9 +1,20 @@
 package module
 
 import (
+	"crypto/sha256"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestFolderStorage_impl(t *testing.T) {
@@ -24,6 +35,15 @@ func TestFolderStorage(t *testing.T) {
 		t.Fatal("should not exist")
 	}
 
+	// An update is available since it doesn't exist
+	ok, err = s.UpdateAvailable(module)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ok {
+		t.Fatal("should have update")
+	}
+
 	// We can get it
 	err = s.Get(module, false)
 	if err != nil {
@@ -43,4 +63,310 @@ func TestFolderStorage(t *testing.T) {
 	if _, err := os.Stat(mainPath); err != nil {
 		t.Fatalf("err: %s", err)
 	}
+
+	// No more updates
+	ok, err = s.UpdateAvailable(module)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ok {
+		t.Fatal("should not have update")
+	}
+}
+
+func TestFolderStorage_updateFailure(t *testing.T) {
+	s := &FolderStorage{StorageDir: tempDir(t)}
+
+	// Use a copy of an archive so that we can break it
+	archive := tempDir(t) + ".zip"
+	err := copyFile(archive, filepath.Join(fixtureDir, "archive.zip"), 0644)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(archive)
+	module := "file://" + archive
+
+	if err := s.Get(module, false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Break the archive and update, which should fail
+	if err := ioutil.WriteFile(archive, []byte("nope"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := s.Get(module, true); err == nil {
+		t.Fatal("should error")
+	}
+
+	// The module we had should be intact
+	dir, ok, err := s.Dir(module)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ok {
+		t.Fatal("should exist")
+	}
+
+	mainPath := filepath.Join(dir, "main.tf")
+	if _, err := os.Stat(mainPath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestFolderStorage_unchanged(t *testing.T) {
+	etag := `"v1"`
+	var downloads int
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			downloads++
+			w.Header().Set("ETag", etag)
+			http.ServeFile(w, r, filepath.Join(fixtureDir, "archive.zip"))
+		}))
+	defer server.Close()
+
+	s := &FolderStorage{StorageDir: tempDir(t)}
+	cases := []struct {
+		Source    string
+		Update    bool
+		ETag      string
+		Action    ModuleAction
+		Downloads int
+	}{
+		{server.URL + "/module.zip", false, `"v1"`, ModuleActionDownloaded, 1},
+		{server.URL + "/module.zip", true, `"v1"`, ModuleActionUnchanged, 1},
+
+		// The check and the update are both answered with the archive
+		{server.URL + "/module.zip", true, `"v2"`, ModuleActionUpdated, 3},
+
+		// Local modules are symlinked, so they never change
+		{testModule("basic"), false, "", ModuleActionDownloaded, 3},
+		{testModule("basic"), true, "", ModuleActionUnchanged, 3},
+	}
+
+	for i, tc := range cases {
+		etag = tc.ETag
+		action, err := s.GetAction(tc.Source, tc.Update, nil)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if action != tc.Action {
+			t.Fatalf("%d: bad: %s", i, action)
+		}
+		if downloads != tc.Downloads {
+			t.Fatalf("%d: bad: %d", i, downloads)
+		}
+
+		dir, ok, err := s.Dir(tc.Source)
+		if err != nil || !ok {
+			t.Fatalf("%d: bad: %v %s", i, ok, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "main.tf")); err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+	}
+}
+
+func TestFolderNamingHash(t *testing.T) {
+	// The default names must never change, or stored modules are lost
+	source := "git::https://github.com/hashicorp/vpc.git?ref=v1.0"
+	if actual := FolderNamingHash(source); actual != "0d45924d87bb7a35725d7f8feceb653d" {
+		t.Fatalf("bad: %s", actual)
+	}
+
+	naming := FolderNamingHashFunc(sha256.New)
+	if actual := naming(source); actual != "5cfb3032028709808504f8cd777595db828eaf4a7dab0ab83b4159b184ae8200" {
+		t.Fatalf("bad: %s", actual)
+	}
+}
+
+func TestFolderNamingReadable(t *testing.T) {
+	long := "git::https://example.com/" + strings.Repeat("a", 100) + ".git"
+
+	cases := []struct {
+		Input  string
+		Prefix string
+	}{
+		{"github.com/hashicorp/vpc", "github.com-hashicorp-vpc-"},
+		{"git::https://github.com/hashicorp/vpc.git?ref=v1.0",
+			"github.com-hashicorp-vpc.git-ref-v1.0-"},
+		{"file:///foo/bar", "foo-bar-"},
+		{long, strings.Repeat("a", 60) + ".git-"},
+		{"file:///", ""},
+	}
+
+	for i, tc := range cases {
+		expected := tc.Prefix + FolderNamingHash(tc.Input)[:8]
+		if actual := FolderNamingReadable(tc.Input); actual != expected {
+			t.Fatalf("%d: bad: %s", i, actual)
+		}
+	}
+
+	// Sources that only differ in unsafe characters get different names
+	a := FolderNamingReadable("file:///foo/bar")
+	b := FolderNamingReadable("file:///foo:bar")
+	if a == b {
+		t.Fatalf("bad: %s", a)
+	}
+}
+
+func TestFolderStorage_naming(t *testing.T) {
+	s := &FolderStorage{
+		StorageDir: tempDir(t),
+		Naming:     FolderNamingReadable,
+	}
+
+	module := testModule("basic")
+	if err := s.Get(module, false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dir, ok, err := s.Dir(module)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ok {
+		t.Fatal("should exist")
+	}
+	if filepath.Base(dir) != FolderNamingReadable(module) {
+		t.Fatalf("bad: %s", dir)
+	}
+}
+
+func TestFolderStorage_subdir(t *testing.T) {
+	s := &FolderStorage{StorageDir: tempDir(t)}
+
+	module := testModule("basic") + "//foo"
+	if err := s.Get(module, false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The whole source is stored, and the subdirectory is used
+	dir, ok, err := s.Dir(module)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ok {
+		t.Fatal("should exist")
+	}
+	if filepath.Base(dir) != "foo" {
+		t.Fatalf("bad: %s", dir)
+	}
+	if _, ok, _ := s.Dir(testModule("basic")); !ok {
+		t.Fatal("should share the download")
+	}
+
+	for _, subDir := range []string{"nope", "../basic"} {
+		if _, ok, err := s.Dir(testModule("basic") + "//" + subDir); err == nil || ok {
+			t.Fatalf("%s: should error", subDir)
+		}
+	}
+}
+
+func TestFolderStorage_list(t *testing.T) {
+	s := &FolderStorage{StorageDir: tempDir(t)}
+
+	// Nothing is listed before anything is downloaded
+	actual, err := s.List()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(actual) != 0 {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	modules := []string{testModule("basic"), testModule("basic/foo")}
+	for _, m := range modules {
+		if err := s.Get(m, false); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// Directories with an unknown source are skipped
+	if err := os.MkdirAll(filepath.Join(s.StorageDir, "unknown"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual, err = s.List()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	sort.Strings(actual)
+	if !reflect.DeepEqual(actual, modules) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestFolderStorage_concurrent(t *testing.T) {
+	g := new(testSlowGetter)
+	Getters["locktest"] = g
+	defer delete(Getters, "locktest")
+
+	s := &FolderStorage{StorageDir: tempDir(t)}
+
+	// Concurrent gets of the same source only download it once
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.Get("locktest://foo", false)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if n := atomic.LoadInt32(&g.Calls); n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+
+	// Concurrent loads that update overlapping sources don't interfere
+	trees := make([]*Tree, 8)
+	for i := range trees {
+		trees[i] = NewTree("", testConfig(t, "concurrent"))
+	}
+	errs = make([]error, len(trees))
+	for i := range trees {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 3 && errs[i] == nil; j++ {
+				errs[i] = trees[i].Load(s, GetModeUpdate)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+}
+
+// testSlowGetter is a Getter that takes a while to write a module, so that
+// concurrent gets overlap, and counts how many times it was called.
+type testSlowGetter struct {
+	testGetter
+
+	Calls int32
+}
+
+func (g *testSlowGetter) Get(dst string, u *url.URL) error {
+	atomic.AddInt32(&g.Calls, 1)
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	return ioutil.WriteFile(
+		filepath.Join(dst, "main.tf"), []byte("# Hello\n"), 0644)
 }
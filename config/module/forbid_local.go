@@ -0,0 +1,20 @@
+package module
+
+import (
+	"fmt"
+)
+
+// checkLocal returns an error if the detected source is local, for loads
+// with LoadOptions.ForbidLocal. remote is whether the source is imported
+// from within a remote module, in which case local sources, such as
+// "./modules/subnets", are part of that version of the module, so they
+// are still allowed.
+func checkLocal(source string, remote bool) error {
+	if remote || getScheme(source) != "file" {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"local source %s is forbidden, modules must come from remote sources",
+		source)
+}
@@ -0,0 +1,30 @@
+package module
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTreeLoad_forbidLocal(t *testing.T) {
+	opts := &LoadOptions{Mode: GetModeGet, ForbidLocal: true}
+	tree := NewTree("", testConfig(t, "basic"))
+	err := tree.LoadWithOptions(testStorage(t), opts)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.HasPrefix(err.Error(), "module foo: local source") {
+		t.Fatalf("bad: %s", err)
+	}
+
+	// Local sources within remote modules are part of the module
+	Getters["vendortest"] = new(testVendorGetter)
+	defer delete(Getters, "vendortest")
+
+	tree = NewTree("", testConfig(t, "forbid-local"))
+	if err := tree.LoadWithOptions(testStorage(t), opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if tree.Children()["remote"].Children()["sub"] == nil {
+		t.Fatalf("bad: %s", tree)
+	}
+}
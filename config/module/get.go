@@ -4,8 +4,12 @@ import (
 	"bytes"
 	"fmt"
 	"net/url"
+	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"syscall"
 )
 
@@ -21,6 +25,40 @@ type Getter interface {
 	Get(string, *url.URL) error
 }
 
+// UpdateGetter is implemented by Getters that can tell whether an update
+// is available without downloading anything. An update is always assumed
+// to be available for Getters that don't implement it.
+type UpdateGetter interface {
+	Getter
+
+	// UpdateAvailable checks whether calling Get with the same arguments
+	// would result in a different module than what is already in the
+	// directory, without downloading anything. If the directory doesn't
+	// exist, an update is always available.
+	//
+	// Getters that can't cheaply determine this should conservatively
+	// return true.
+	UpdateAvailable(string, *url.URL) (bool, error)
+}
+
+// CheckGetter is implemented by Getters that can verify a source without
+// downloading it. The sources of Getters that don't implement it aren't
+// checked.
+type CheckGetter interface {
+	Getter
+
+	// Check verifies that the given URL is reachable and could be
+	// downloaded, as cheaply as possible and without downloading it. An
+	// error describing the problem is returned if it can't be.
+	Check(*url.URL) error
+}
+
+// CAFileEnvVar is the name of the environment variable that can be set to
+// the path of a PEM encoded bundle of CA certificates. Getters that support
+// HTTPS verify servers against it when no bundle is explicitly configured,
+// instead of the system certificates.
+const CAFileEnvVar = "TF_MODULE_CA_FILE"
+
 // Getters is the mapping of scheme to the Getter implementation that will
 // be used to get a dependency.
 var Getters map[string]Getter
@@ -33,11 +71,16 @@ func init() {
 	httpGetter := new(HttpGetter)
 
 	Getters = map[string]Getter{
-		"file":  new(FileGetter),
-		"git":   new(GitGetter),
-		"hg":    new(HgGetter),
-		"http":  httpGetter,
-		"https": httpGetter,
+		"exec":    new(ExecGetter),
+		"file":    new(FileGetter),
+		"git":     new(GitGetter),
+		"hg":      new(HgGetter),
+		"http":    httpGetter,
+		"https":   httpGetter,
+		"ipfs":    new(IPFSGetter),
+		"torrent": new(TorrentGetter),
+
+		"registry": new(RegistryGetter),
 	}
 }
 
@@ -46,42 +89,186 @@ func init() {
 //
 // src is a URL, whereas dst is always just a file path to a folder. This
 // folder doesn't need to exist. It will be created if it doesn't exist.
+//
+// The getter is chosen by the scheme of the URL, unless it is forced with
+// the "getter::url" syntax. Both the getter and the scheme of the URL can
+// be forced with "getter::scheme::address", which is the same as
+// "getter::scheme://address", example: "git::file::/path/to/repo". The
+// first force always chooses the getter, and the second always sets the
+// scheme, so no more than two can be given.
+//
+// Whatever the getter, the "checksum" parameter verifies the downloaded
+// module against a checksum from ModuleChecksum, in the form "type:value"
+// where the type is "md5", "sha1", or "sha256". The parameter is removed
+// before the URL is given to the getter, and dst is left as downloaded if
+// the checksum doesn't match.
 func Get(dst, src string) error {
+	return GetCancel(dst, src, nil)
+}
+
+// GetCancel is like Get, except that getting the module stops when cancel
+// is closed. The commands that getters which implement OptionsGetter run,
+// such as git, are killed. Other getters finish what they are doing, but
+// nothing more is started. dst may be left partially written, so it should
+// be a temporary directory.
+func GetCancel(dst, src string, cancel <-chan struct{}) error {
+	return getCancel(dst, src, &GetOptions{Cancel: cancel})
+}
+
+// getCancel is like GetCancel, except that the cancellation, credentials,
+// and RequireHTTPS of opts are used. opts may be nil.
+func getCancel(dst, src string, opts *GetOptions) error {
+	src, subDir := getDirSubdir(src)
+	g, u, checksum, err := getGetter(src)
+	if err != nil {
+		return err
+	}
+
+	err = getWithOptions(g, dst, u, subDir, checksum, opts)
+	if err == nil && checksum != "" {
+		err = verifyChecksum(dst, checksum)
+	}
+	if err != nil {
+		err = fmt.Errorf("error downloading module '%s': %s", u, err)
+	}
+
+	return err
+}
+
+// UpdateAvailable checks whether calling Get with the same dst and src
+// would change the module that is in dst, without downloading the module.
+// If the Getter for src isn't an UpdateGetter, this is always true.
+func UpdateAvailable(dst, src string) (bool, error) {
+	g, u, _, err := getGetter(src)
+	if err != nil {
+		return false, err
+	}
+
+	ug, ok := g.(UpdateGetter)
+	if !ok {
+		return true, nil
+	}
+
+	ok, err = ug.UpdateAvailable(dst, u)
+	if err != nil {
+		err = fmt.Errorf("error checking module '%s' for updates: %s", u, err)
+	}
+
+	return ok, err
+}
+
+// Check verifies that the module specified by src could be downloaded,
+// without downloading it. If the Getter for src isn't a CheckGetter, only
+// the source itself is checked.
+func Check(src string) error {
+	g, u, _, err := getGetter(src)
+	if err != nil {
+		return err
+	}
+
+	cg, ok := g.(CheckGetter)
+	if !ok {
+		return nil
+	}
+
+	err = cg.Check(u)
+	if err != nil {
+		err = fmt.Errorf("error checking module '%s': %s", u, err)
+	}
+
+	return err
+}
+
+// getGetter returns the Getter that handles the given source along
+// with the parsed URL (without the force syntax, the subdirectory or the
+// checksum) to pass to it, and the checksum to verify the module against,
+// if any.
+func getGetter(src string) (Getter, *url.URL, string, error) {
+	src, _ = getDirSubdir(src)
+	src, err := getForcedScheme(src, "")
+	if err != nil {
+		return nil, nil, "", err
+	}
+
 	var force string
 	force, src = getForcedGetter(src)
 
 	u, err := url.Parse(src)
 	if err != nil {
-		return err
+		return nil, nil, "", err
 	}
 	if force == "" {
 		force = u.Scheme
 	}
+	if Vendored && force != "file" {
+		return nil, nil, "", fmt.Errorf(
+			"module download not allowed for scheme '%s', "+
+				"only vendored modules can be used", force)
+	}
 
 	g, ok := Getters[force]
 	if !ok {
-		return fmt.Errorf(
+		return nil, nil, "", fmt.Errorf(
 			"module download not supported for scheme '%s'", force)
 	}
 
-	err = g.Get(dst, u)
+	checksum, err := getChecksum(u)
 	if err != nil {
-		err = fmt.Errorf("error downloading module '%s': %s", src, err)
+		return nil, nil, "", err
 	}
 
-	return err
+	return g, u, checksum, nil
+}
+
+// getCAFile returns the path of the CA bundle to use, falling back to the
+// environment if the given path is blank.
+func getCAFile(path string) string {
+	if path != "" {
+		return path
+	}
+
+	return os.Getenv(CAFileEnvVar)
 }
 
 // getRunCommand is a helper that will run a command and capture the output
-// in the case an error happens.
-func getRunCommand(cmd *exec.Cmd) error {
+// in the case an error happens. The timeout and cancellation of the options
+// apply to the command, if the options aren't nil.
+func getRunCommand(cmd *exec.Cmd, opts *GetOptions) error {
 	var buf bytes.Buffer
 	cmd.Stdout = &buf
 	cmd.Stderr = &buf
-	err := cmd.Run()
+	err := cmd.Start()
+	if err == nil {
+		err = opts.wait(cmd)
+	}
 	if err == nil {
 		return nil
 	}
+
+	return getCommandError(cmd, err, buf.String())
+}
+
+// getRunCommandOutput is like getRunCommand, except that the standard
+// output of the command is returned on success. Only the standard error
+// is used to build the error message if the command fails.
+func getRunCommandOutput(cmd *exec.Cmd, opts *GetOptions) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Start()
+	if err == nil {
+		err = opts.wait(cmd)
+	}
+	if err != nil {
+		return "", getCommandError(cmd, err, stderr.String())
+	}
+
+	return stdout.String(), nil
+}
+
+// getCommandError turns the error from running a command into an error
+// that contains the output of the command.
+func getCommandError(cmd *exec.Cmd, err error, output string) error {
 	if exiterr, ok := err.(*exec.ExitError); ok {
 		// The program has exited with an exit code != 0
 		if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
@@ -89,11 +276,11 @@ func getRunCommand(cmd *exec.Cmd) error {
 				"%s exited with %d: %s",
 				cmd.Path,
 				status.ExitStatus(),
-				buf.String())
+				output)
 		}
 	}
 
-	return fmt.Errorf("error running %s: %s", cmd.Path, buf.String())
+	return fmt.Errorf("error running %s: %s: %s", cmd.Path, err, output)
 }
 
 // getForcedGetter takes a source and returns the tuple of the forced
@@ -107,3 +294,103 @@ func getForcedGetter(src string) (string, string) {
 
 	return forced, src
 }
+
+// getDirSubdir splits the source into the source of what to download and
+// the subdirectory of it that is the module, which is given after "//" in
+// the path so that modules can be kept within a larger repository, example:
+// "git::https://example.com/repo.git//modules/vpc?ref=v1.0" is the
+// "modules/vpc" directory of "git::https://example.com/repo.git?ref=v1.0".
+// The subdirectory is blank if there isn't one.
+func getDirSubdir(src string) (string, string) {
+	// The "//" of the scheme isn't a subdirectory
+	var offset int
+	if idx := strings.Index(src, "://"); idx > -1 {
+		offset = idx + 3
+	}
+
+	idx := strings.Index(src[offset:], "//")
+	if idx == -1 {
+		return src, ""
+	}
+	idx += offset
+
+	subDir := src[idx+2:]
+	src = src[:idx]
+
+	// The parameters belong to the source
+	if idx := strings.Index(subDir, "?"); idx > -1 {
+		src += subDir[idx:]
+		subDir = subDir[:idx]
+	}
+
+	return src, subDir
+}
+
+// getSubdirPath returns the path of the subdirectory subDir of the
+// downloaded module in dir. It is an error for subDir to be outside of dir
+// or to not exist.
+func getSubdirPath(dir, subDir string) (string, error) {
+	clean := path.Clean("/" + subDir)[1:]
+	if clean == "" || subDir != clean && subDir != clean+"/" {
+		return "", fmt.Errorf("invalid subdirectory: %s", subDir)
+	}
+
+	result := filepath.Join(dir, filepath.FromSlash(clean))
+	if _, err := os.Stat(result); err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("subdirectory %s not found in module", subDir)
+		}
+
+		return "", err
+	}
+
+	return result, nil
+}
+
+// getForcedScheme turns a source that forces both the getter and the scheme
+// of the URL, "getter::scheme::address", into the usual form
+// "getter::scheme://address". Relative paths with the file scheme are made
+// absolute using pwd. Any other source is returned as is.
+func getForcedScheme(src, pwd string) (string, error) {
+	force, rest := getForcedGetter(src)
+	scheme, addr := getForcedGetter(rest)
+	if force == "" || scheme == "" {
+		return src, nil
+	}
+
+	if extra, _ := getForcedGetter(addr); extra != "" {
+		return "", fmt.Errorf(
+			"only a getter and a scheme can be forced: %s", src)
+	}
+	if strings.Contains(addr, "://") {
+		return "", fmt.Errorf(
+			"the scheme can't be forced for a URL that has one: %s", src)
+	}
+
+	if scheme == "file" {
+		result, _, err := new(FileDetector).Detect(addr, pwd)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%s::%s", force, result), nil
+	}
+
+	return fmt.Sprintf("%s::%s://%s", force, scheme, addr), nil
+}
+
+// getScheme returns the scheme that selects the getter for a source: the
+// forced getter if there is one, otherwise the scheme of the URL.
+func getScheme(src string) string {
+	force, src := getForcedGetter(src)
+	if force != "" {
+		return force
+	}
+
+	u, err := url.Parse(src)
+	if err != nil {
+		return ""
+	}
+
+	return u.Scheme
+}
@@ -0,0 +1,141 @@
+package module
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checksumTypes are the hashes that the "checksum" parameter can use.
+var checksumTypes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+// ModuleChecksum returns the checksum of the module in the directory dir,
+// in the form that the "checksum" parameter of a source expects, example:
+// "sha256:2cf24dba...". The checksum covers the names, contents, and
+// symlinks of everything in the directory except for the git and
+// Mercurial metadata directories, so it is the same no matter which
+// getter downloaded the module.
+func ModuleChecksum(dir string) (string, error) {
+	sum, err := checksumDir(dir, sha256.New())
+	if err != nil {
+		return "", err
+	}
+
+	return "sha256:" + sum, nil
+}
+
+// getChecksum removes the "checksum" parameter from u, returning the
+// checksum to verify the module against. The checksum is of the form
+// "type:value", such as "sha256:2cf24dba...". A blank checksum means that
+// there is nothing to verify.
+func getChecksum(u *url.URL) (string, error) {
+	q := u.Query()
+	v := q.Get("checksum")
+	if v == "" {
+		return "", nil
+	}
+
+	idx := strings.Index(v, ":")
+	if idx < 0 {
+		return "", fmt.Errorf("checksum must be of the form type:value: %s", v)
+	}
+	if _, ok := checksumTypes[v[:idx]]; !ok {
+		return "", fmt.Errorf("unsupported checksum type: %s", v[:idx])
+	}
+
+	q.Del("checksum")
+	u.RawQuery = q.Encode()
+
+	return v, nil
+}
+
+// verifyChecksum verifies the module in dir against the checksum from
+// getChecksum.
+func verifyChecksum(dir, checksum string) error {
+	idx := strings.Index(checksum, ":")
+	expected := strings.ToLower(checksum[idx+1:])
+
+	actual, err := checksumDir(dir, checksumTypes[checksum[:idx]]())
+	if err != nil {
+		return fmt.Errorf("error computing checksum: %s", err)
+	}
+	if actual != expected {
+		return fmt.Errorf(
+			"checksum mismatch, expected %s but got %s:%s",
+			checksum, checksum[:idx], actual)
+	}
+
+	return nil
+}
+
+// checksumDir hashes the contents of dir with h, returning the hex
+// encoded sum. See ModuleChecksum.
+func checksumDir(dir string, h hash.Hash) (string, error) {
+	// The getter may have made dir a symlink, such as for file sources
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch {
+		case info.IsDir():
+			if info.Name() == ".git" || info.Name() == ".hg" {
+				return filepath.SkipDir
+			}
+
+			fmt.Fprintf(h, "d %s\x00", rel)
+			return nil
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(h, "l %s\x00%s\x00", rel, filepath.ToSlash(target))
+			return nil
+		case !info.Mode().IsRegular():
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		fmt.Fprintf(h, "f %s\x00%d\x00", rel, info.Size())
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,118 @@
+package module
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestModuleChecksum(t *testing.T) {
+	dir := tempDir(t)
+	if err := copyDir(dir, filepath.Join(fixtureDir, "basic")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected, err := ModuleChecksum(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.HasPrefix(expected, "sha256:") {
+		t.Fatalf("bad: %s", expected)
+	}
+
+	// VCS metadata doesn't count
+	if err := os.MkdirAll(filepath.Join(dir, ".git"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("x"), 0644)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual, err := ModuleChecksum(dir); err != nil || actual != expected {
+		t.Fatalf("bad: %s %s", actual, err)
+	}
+
+	// Contents do
+	err = ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte("x"), 0644)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual, err := ModuleChecksum(dir); err != nil || actual == expected {
+		t.Fatalf("bad: %s %s", actual, err)
+	}
+}
+
+func TestGetChecksum(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Checksum string
+		URL      string
+		Err      bool
+	}{
+		{"file:///foo", "", "file:///foo", false},
+		{"file:///foo?checksum=sha256:abc&a=b", "sha256:abc", "file:///foo?a=b", false},
+		{"file:///foo?checksum=md5:abc", "md5:abc", "file:///foo", false},
+		{"file:///foo?checksum=abc", "", "", true},
+		{"file:///foo?checksum=crc32:abc", "", "", true},
+	}
+
+	for i, tc := range cases {
+		u, err := url.Parse(tc.Input)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+
+		checksum, err := getChecksum(u)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%d: bad err: %s", i, err)
+		}
+		if err != nil {
+			continue
+		}
+		if checksum != tc.Checksum || u.String() != tc.URL {
+			t.Fatalf("%d: bad: %s %s", i, checksum, u)
+		}
+	}
+}
+
+func TestGet_checksum(t *testing.T) {
+	checksum, err := ModuleChecksum(filepath.Join(fixtureDir, "basic"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	u := testModule("basic") + "?checksum=" + checksum
+	if err := Get(tempDir(t), u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	u = testModule("basic") + "?checksum=sha256:abc"
+	err = Get(tempDir(t), u)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestGet_forcedSchemeChecksum(t *testing.T) {
+	if !testHasGit {
+		t.Skip("git not found, skipping")
+	}
+
+	repo := testGitRepo(t)
+	checksum, err := ModuleChecksum(repo.dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dst := tempDir(t)
+	src := "git::file::" + repo.dir + "?checksum=" + checksum
+	if err := Get(dst, src); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, ".git")); err != nil {
+		t.Fatalf("should be cloned with git: %s", err)
+	}
+}
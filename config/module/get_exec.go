@@ -0,0 +1,142 @@
+package module
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ExecGetter is a Getter implementation that runs a command to download a
+// module, as an escape hatch for transports that no other Getter handles.
+// The source is the path of the command, which is relative to the
+// configuration like any local path, example:
+//
+//	source = "exec::./fetch-module.sh?name=vpc"
+//
+// The command is run with the directory to download the module into and
+// the full source URL as its arguments, and is trusted to fill in the
+// directory. The same values are in the environment as TF_MODULE_DST and
+// TF_MODULE_SOURCE, along with every parameter of the source as
+// TF_MODULE_PARAM_<NAME>, such as TF_MODULE_PARAM_NAME=vpc. The "timeout"
+// parameter limits how long the command can run. It is parsed like the
+// "commit" and "depth" parameters of other getters (see GetOptions), and
+// these three aren't passed on to the command. The command fails the
+// download by exiting with a non-zero status, and its output is part of
+// the error.
+//
+// Since this runs arbitrary commands from configurations, it is disabled
+// unless Enabled is set, for example:
+//
+//	module.Getters["exec"] = &module.ExecGetter{Enabled: true}
+//
+// Even then, only the configurations that aren't downloaded can use exec
+// sources. Load refuses them in modules from remote sources, and in the
+// modules that those import, since their commands come from the download.
+// Getters and Detectors refuse them as the sources that servers send them
+// to, such as with X-Terraform-Get, as well.
+type ExecGetter struct {
+	// Enabled must be true for any command to be run.
+	Enabled bool
+}
+
+func (g *ExecGetter) Get(dst string, u *url.URL) error {
+	opts, err := parseGetOptions(u, "")
+	if err != nil {
+		return err
+	}
+
+	return g.GetWithOptions(dst, opts)
+}
+
+func (g *ExecGetter) GetWithOptions(dst string, opts *GetOptions) error {
+	path, err := g.command(opts.URL)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(path, dst, opts.URL.String())
+	cmd.Dir = filepath.Dir(path)
+	cmd.Env = append(os.Environ(),
+		"TF_MODULE_DST="+dst,
+		"TF_MODULE_SOURCE="+opts.URL.String())
+	for k, vs := range opts.URL.Query() {
+		if len(vs) > 0 {
+			cmd.Env = append(cmd.Env, "TF_MODULE_PARAM_"+execParamName(k)+"="+vs[0])
+		}
+	}
+
+	return getRunCommand(cmd, opts)
+}
+
+// UpdateAvailable for commands can't be determined, so an update is
+// always reported as available.
+func (g *ExecGetter) UpdateAvailable(dst string, u *url.URL) (bool, error) {
+	return true, nil
+}
+
+func (g *ExecGetter) Check(u *url.URL) error {
+	path, err := g.command(u)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() || fi.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("%s is not an executable file", path)
+	}
+
+	return nil
+}
+
+// command returns the path of the command to run for u.
+func (g *ExecGetter) command(u *url.URL) (string, error) {
+	if !g.Enabled {
+		return "", fmt.Errorf(
+			"exec sources run commands, so they must be enabled to be used")
+	}
+	if u.Scheme != "" && u.Scheme != "file" {
+		return "", fmt.Errorf("exec sources must be local commands: %s", u)
+	}
+	if u.Path == "" {
+		return "", fmt.Errorf("exec sources must specify a command")
+	}
+
+	return filepath.FromSlash(u.Path), nil
+}
+
+// checkExec returns an error if the detected source runs a command and is
+// imported from within a remote module. Like for checkLocal, remote is
+// whether the source is imported from within a remote module.
+func checkExec(source string, remote bool) error {
+	if !remote || getScheme(source) != "exec" {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"exec source %s can't be used by modules from remote sources", source)
+}
+
+// execParamName turns the name of a parameter into the suffix of its
+// environment variable.
+func execParamName(k string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, k)
+}
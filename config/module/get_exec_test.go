@@ -0,0 +1,199 @@
+package module
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecGetter_impl(t *testing.T) {
+	var _ OptionsGetter = new(ExecGetter)
+}
+
+func TestExecGetter(t *testing.T) {
+	cmd := testExecCommand(t, `
+mkdir -p "$1"
+echo "$TF_MODULE_PARAM_NAME $TF_MODULE_PARAM_REF" > "$TF_MODULE_DST/main.tf"
+echo "$2" > "$1/source"
+`)
+	g := &ExecGetter{Enabled: true}
+	dst := tempDir(t)
+
+	// Parameters that only other getters read are passed on
+	u := testExecURL(t, cmd+"?name=vpc&ref=v1.0")
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dst, "main.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "vpc v1.0\n" {
+		t.Fatalf("bad: %q", data)
+	}
+
+	data, err = ioutil.ReadFile(filepath.Join(dst, "source"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != u.String()+"\n" {
+		t.Fatalf("bad: %q", data)
+	}
+
+	if err := g.Check(u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestExecGetter_detect(t *testing.T) {
+	cmd := testExecCommand(t, `touch "$1/main.tf"`)
+	dst := tempDir(t)
+
+	src, err := Detect("exec::./fetch.sh?name=vpc", filepath.Dir(cmd))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	old := Getters["exec"]
+	defer func() { Getters["exec"] = old }()
+	Getters["exec"] = &ExecGetter{Enabled: true}
+
+	if err := Get(dst, src); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "main.tf")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestExecGetter_disabled(t *testing.T) {
+	cmd := testExecCommand(t, `touch "$1/main.tf"`)
+	dst := tempDir(t)
+
+	u := testExecURL(t, cmd)
+	err := new(ExecGetter).Get(dst, u)
+	if err == nil || !strings.Contains(err.Error(), "enabled") {
+		t.Fatalf("bad: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "main.tf")); !os.IsNotExist(err) {
+		t.Fatalf("command should not have run: %v", err)
+	}
+
+	if err := new(ExecGetter).Check(u); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestExecGetter_fail(t *testing.T) {
+	cmd := testExecCommand(t, `
+echo "no such module"
+exit 1
+`)
+	g := &ExecGetter{Enabled: true}
+
+	err := g.Get(tempDir(t), testExecURL(t, cmd))
+	if err == nil || !strings.Contains(err.Error(), "no such module") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestExecGetterCheck_notExecutable(t *testing.T) {
+	cmd := testExecCommand(t, "")
+	if err := os.Chmod(cmd, 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	g := &ExecGetter{Enabled: true}
+	if err := g.Check(testExecURL(t, cmd)); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestTreeLoad_execRemote(t *testing.T) {
+	cmd := testExecCommand(t, `touch "$1/main.tf"`)
+	dir := filepath.Dir(cmd)
+	testWriteFile(t, filepath.Join(dir, "main.tf"), `
+module "cmd" {
+    source = "exec::./fetch.sh"
+}
+`)
+
+	old := Getters["exec"]
+	defer func() { Getters["exec"] = old }()
+	Getters["exec"] = &ExecGetter{Enabled: true}
+	Getters["dirtest"] = &testDirGetter{Dir: dir}
+	defer delete(Getters, "dirtest")
+
+	// The configuration that isn't downloaded can run commands
+	tree, err := NewTreeModule("", dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The same configuration can't once it is downloaded
+	root := tempDir(t)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testWriteFile(t, filepath.Join(root, "main.tf"), `
+module "remote" {
+    source = "dirtest://example.com/foo"
+}
+`)
+	tree, err = NewTreeModule("", root)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	err = tree.Load(testStorage(t), GetModeGet)
+	if err == nil || !strings.Contains(err.Error(), "exec source") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+// testExecCommand writes a shell script with the given body named
+// fetch.sh into a new directory and returns its path.
+func testExecCommand(t *testing.T, body string) string {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("/bin/sh not found, skipping")
+	}
+
+	dir, err := ioutil.TempDir("", "tf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	path := filepath.Join(dir, "fetch.sh")
+	testWriteFile(t, path, "#!/bin/sh\nset -e\n"+body+"\n")
+	if err := os.Chmod(path, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return path
+}
+
+func testExecURL(t *testing.T, path string) *url.URL {
+	u, err := url.Parse("file://" + filepath.ToSlash(path))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return u
+}
+
+// testDirGetter is a Getter that gets a copy of Dir for every source.
+type testDirGetter struct {
+	testGetter
+
+	Dir string
+}
+
+func (g *testDirGetter) Get(dst string, u *url.URL) error {
+	return copyDir(dst, g.Dir)
+}
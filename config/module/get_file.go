@@ -9,17 +9,50 @@ import (
 
 // FileGetter is a Getter implementation that will download a module from
 // a file scheme.
-type FileGetter struct{}
+//
+// If the source is a directory, the destination is a symlink to it rather
+// than a copy, so edits to a local module are reflected immediately without
+// having to get the module again. If the source is an archive that one of
+// the Decompressors understands, it is unpacked into the destination. The
+// "archive_strip" parameter removes that many leading directories from the
+// paths of the files in the archive, like tar --strip-components, and the
+// "archive_include" and "archive_exclude" parameters choose which files
+// are unpacked, such as "archive_exclude=examples" (see archiveOptions).
+// The permissions of the files are preserved, so scripts for provisioners
+// stay executable, unless "archive_mode=normalize" is given.
+//
+// Sources within the root of Manifest are copied instead, and the copy is
+// verified against the manifest before it is used.
+type FileGetter struct {
+	// Manifest, if set, is the signed manifest of a volume of modules
+	// that sources within it are verified against.
+	Manifest *FileManifest
+}
 
 func (g *FileGetter) Get(dst string, u *url.URL) error {
-	// The source path must exist and be a directory to be usable.
-	if fi, err := os.Stat(u.Path); err != nil {
+	// The source path must exist and be a directory or archive to be usable.
+	fi, err := os.Stat(u.Path)
+	if err != nil {
 		return fmt.Errorf("source path error: %s", err)
-	} else if !fi.IsDir() {
-		return fmt.Errorf("source path must be a directory")
+	}
+	if g.verified(u) {
+		return g.getVerified(dst, u, fi)
+	}
+	if !fi.IsDir() {
+		d := getDecompressor(u.Path)
+		if d == nil {
+			return fmt.Errorf("source path must be a directory or archive")
+		}
+
+		opts, err := getArchiveOptions(u)
+		if err != nil {
+			return err
+		}
+
+		return getArchive(dst, u.Path, d, opts)
 	}
 
-	fi, err := os.Lstat(dst)
+	fi, err = os.Lstat(dst)
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
@@ -44,3 +77,97 @@ func (g *FileGetter) Get(dst string, u *url.URL) error {
 
 	return os.Symlink(u.Path, dst)
 }
+
+func (g *FileGetter) UpdateAvailable(dst string, u *url.URL) (bool, error) {
+	// We can't tell if an archive or a verified copy changed without
+	// getting it again
+	if getDecompressor(u.Path) != nil || g.verified(u) {
+		return true, nil
+	}
+
+	// The destination is a symlink to the source, so any changes to the
+	// source are visible immediately. The only update that can happen is
+	// pointing the symlink somewhere else.
+	target, err := os.Readlink(dst)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+
+		return false, err
+	}
+
+	return target != u.Path, nil
+}
+
+func (g *FileGetter) Check(u *url.URL) error {
+	fi, err := os.Stat(u.Path)
+	if err != nil {
+		return fmt.Errorf("source path error: %s", err)
+	}
+	if !fi.IsDir() && getDecompressor(u.Path) == nil {
+		return fmt.Errorf("source path must be a directory or archive")
+	}
+
+	return nil
+}
+
+// verified returns whether the source must be verified against Manifest.
+func (g *FileGetter) verified(u *url.URL) bool {
+	return g.Manifest != nil && g.Manifest.covers(u.Path)
+}
+
+// getVerified gets a source from the volume of Manifest. The source is
+// copied first and the copy is what is verified, so that the files can't
+// change between being verified and being used.
+func (g *FileGetter) getVerified(dst string, u *url.URL, fi os.FileInfo) error {
+	if fi.IsDir() {
+		td, err := newTempDir(dst, ".tf-file")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(td)
+
+		tmp := filepath.Join(td, "module")
+		if err := copyDir(tmp, u.Path); err != nil {
+			return err
+		}
+		if err := g.Manifest.verify(tmp, u.Path); err != nil {
+			return err
+		}
+
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+
+		return moveDir(dst, tmp)
+	}
+
+	d := getDecompressor(u.Path)
+	if d == nil {
+		return fmt.Errorf("source path must be a directory or archive")
+	}
+	opts, err := getArchiveOptions(u)
+	if err != nil {
+		return err
+	}
+
+	f, err := newTempFile(dst, ".tf-file")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+
+	if err := copyFile(f.Name(), u.Path, 0644); err != nil {
+		return err
+	}
+	if err := g.Manifest.verify(f.Name(), u.Path); err != nil {
+		return err
+	}
+
+	return getArchive(dst, f.Name(), d, opts)
+}
@@ -0,0 +1,222 @@
+package module
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FileManifest is a signed list of the hashes of the files on a volume of
+// modules, such as an approved modules volume that is mounted read-only.
+// FileGetter verifies modules from the volume against it before they are
+// used.
+type FileManifest struct {
+	// Root is the directory that the manifest covers, such as the mount
+	// point of the volume. Only sources within Root are verified, sources
+	// elsewhere are used as usual.
+	Root string
+
+	// Path is the path of the manifest. Each line is the hex encoded
+	// SHA-256 hash of a file and the path of the file relative to Root,
+	// separated by whitespace. This is the output of "sha256sum" when it
+	// is run from Root.
+	Path string
+
+	// KeyFile is the path of the PEM encoded RSA public key that the
+	// manifest is signed with. The PKCS #1 v1.5 signature of the SHA-256
+	// hash of the manifest must be in the file Path+".sig", such as from
+	// "openssl dgst -sha256 -sign key.pem -out MANIFEST.sig MANIFEST".
+	KeyFile string
+}
+
+// covers returns whether the file or directory p is within Root.
+func (m *FileManifest) covers(p string) bool {
+	rel, err := m.rel(p)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// rel returns the slash separated path of p relative to Root.
+func (m *FileManifest) rel(p string) (string, error) {
+	root, err := filepath.Abs(m.Root)
+	if err != nil {
+		return "", err
+	}
+	p, err = filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.ToSlash(rel), nil
+}
+
+// hashes verifies the signature of the manifest and returns the hashes in
+// it by the slash separated path of each file relative to Root.
+func (m *FileManifest) hashes() (map[string]string, error) {
+	data, err := ioutil.ReadFile(m.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest: %s", err)
+	}
+	if err := m.verifySignature(data); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid manifest line: %s", line)
+		}
+
+		// sha256sum marks files that were read in binary mode with "*"
+		name := strings.TrimPrefix(strings.TrimSpace(parts[1]), "*")
+		result[path.Clean(name)] = strings.ToLower(parts[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// verifySignature verifies the signature of the manifest contents data.
+func (m *FileManifest) verifySignature(data []byte) error {
+	keyData, err := ioutil.ReadFile(m.KeyFile)
+	if err != nil {
+		return fmt.Errorf("error reading manifest key: %s", err)
+	}
+	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return fmt.Errorf("no PEM encoded key found in %s", m.KeyFile)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("error parsing manifest key: %s", err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("manifest key must be an RSA public key")
+	}
+
+	sig, err := ioutil.ReadFile(m.Path + ".sig")
+	if err != nil {
+		return fmt.Errorf("error reading manifest signature: %s", err)
+	}
+
+	sum := sha256.Sum256(data)
+	if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, sum[:], sig); err != nil {
+		return fmt.Errorf("manifest signature is invalid: %s", err)
+	}
+
+	return nil
+}
+
+// verify verifies the copy dst of the file or directory src from the
+// volume against the manifest. Every file must be in the manifest with the
+// same hash, and every file in the manifest within src must be present.
+// Anything other than regular files and directories is refused.
+func (m *FileManifest) verify(dst, src string) error {
+	hashes, err := m.hashes()
+	if err != nil {
+		return err
+	}
+
+	srcRel, err := m.rel(src)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]struct{})
+	err = filepath.Walk(dst, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dst, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(srcRel, filepath.ToSlash(rel))
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", name)
+		}
+
+		expected, ok := hashes[name]
+		if !ok {
+			return fmt.Errorf("%s is not in the manifest", name)
+		}
+
+		actual, err := sha256File(p)
+		if err != nil {
+			return err
+		}
+		if actual != expected {
+			return fmt.Errorf("%s doesn't match the hash in the manifest", name)
+		}
+
+		seen[name] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("manifest verification failed: %s", err)
+	}
+
+	for name := range hashes {
+		within := srcRel == "." || name == srcRel ||
+			strings.HasPrefix(name, srcRel+"/")
+		if !within {
+			continue
+		}
+		if _, ok := seen[name]; !ok {
+			return fmt.Errorf(
+				"manifest verification failed: %s is missing", name)
+		}
+	}
+
+	return nil
+}
+
+// sha256File returns the hex encoded SHA-256 hash of the file at p.
+func sha256File(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,222 @@
+package module
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileGetter_manifest(t *testing.T) {
+	m := testFileManifest(t)
+	g := &FileGetter{Manifest: m}
+
+	dst := tempDir(t)
+	if err := g.Get(dst, testFileManifestURL(m, "basic")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The module is a verified copy rather than a symlink
+	fi, err := os.Lstat(dst)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !fi.IsDir() {
+		t.Fatalf("bad: %s", fi.Mode())
+	}
+	if _, err := os.Stat(filepath.Join(dst, "main.tf")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Archives are verified too
+	dst = tempDir(t)
+	if err := g.Get(dst, testFileManifestURL(m, "archive.tar")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "foo", "main.tf")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Sources outside of the volume aren't affected
+	dst = tempDir(t)
+	if err := g.Get(dst, testModuleURL("basic")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestFileGetter_manifestBad(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Source string
+		Modify func(*testing.T, *FileManifest)
+		Err    string
+	}{
+		{
+			"modified file",
+			"basic",
+			func(t *testing.T, m *FileManifest) {
+				testWriteFile(t, filepath.Join(m.Root, "basic", "main.tf"), "# evil\n")
+			},
+			"basic/main.tf doesn't match",
+		},
+		{
+			"added file",
+			"basic",
+			func(t *testing.T, m *FileManifest) {
+				testWriteFile(t, filepath.Join(m.Root, "basic", "evil.tf"), "# evil\n")
+			},
+			"basic/evil.tf is not in the manifest",
+		},
+		{
+			"removed file",
+			"basic",
+			func(t *testing.T, m *FileManifest) {
+				os.Remove(filepath.Join(m.Root, "basic", "main.tf"))
+			},
+			"basic/main.tf is missing",
+		},
+		{
+			"symlink",
+			"basic",
+			func(t *testing.T, m *FileManifest) {
+				os.Symlink("/etc/passwd", filepath.Join(m.Root, "basic", "link.tf"))
+			},
+			"basic/link.tf is not a regular file",
+		},
+		{
+			"modified manifest",
+			"basic",
+			func(t *testing.T, m *FileManifest) {
+				f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_WRONLY, 0644)
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				defer f.Close()
+				fmt.Fprintf(f, "%x  basic/evil.tf\n", sha256.Sum256(nil))
+			},
+			"manifest signature is invalid",
+		},
+	}
+
+	for _, tc := range cases {
+		m := testFileManifest(t)
+		tc.Modify(t, m)
+
+		g := &FileGetter{Manifest: m}
+		err := g.Get(tempDir(t), testFileManifestURL(m, tc.Source))
+		if err == nil {
+			t.Fatalf("%s: should error", tc.Name)
+		}
+		if !strings.Contains(err.Error(), tc.Err) {
+			t.Fatalf("%s: bad: %s", tc.Name, err)
+		}
+	}
+}
+
+func TestFileGetterUpdateAvailable_manifest(t *testing.T) {
+	m := testFileManifest(t)
+	g := &FileGetter{Manifest: m}
+	u := testFileManifestURL(m, "basic")
+
+	dst := tempDir(t)
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ok, err := g.UpdateAvailable(dst, u)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ok {
+		t.Fatal("verified copies should always be updated")
+	}
+}
+
+// testFileManifest creates a volume with copies of the "basic" fixture and
+// archive.tar, with a manifest signed by a new key.
+func testFileManifest(t *testing.T) *FileManifest {
+	root := tempDir(t)
+	if err := copyDir(filepath.Join(root, "basic"), filepath.Join(fixtureDir, "basic")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := copyFile(
+		filepath.Join(root, "archive.tar"),
+		filepath.Join(fixtureDir, "archive.tar"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var manifest []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		sum, err := sha256File(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		manifest = append(manifest, sum+"  "+filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	data := []byte(strings.Join(manifest, "\n") + "\n")
+	sum := sha256.Sum256(data)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The manifest and key are kept off the volume so that modifying the
+	// volume doesn't modify them.
+	dir := tempDir(t)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	m := &FileManifest{
+		Root:    root,
+		Path:    filepath.Join(dir, "MANIFEST"),
+		KeyFile: filepath.Join(dir, "key.pem"),
+	}
+	testWriteFile(t, m.Path, string(data))
+	testWriteFile(t, m.Path+".sig", string(sig))
+	testWriteFile(t, m.KeyFile, string(pem.EncodeToMemory(
+		&pem.Block{Type: "PUBLIC KEY", Bytes: pub})))
+
+	return m
+}
+
+func testFileManifestURL(m *FileManifest, n string) *url.URL {
+	return &url.URL{Scheme: "file", Path: filepath.Join(m.Root, n)}
+}
+
+func testWriteFile(t *testing.T, path, contents string) {
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
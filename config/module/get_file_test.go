@@ -35,6 +35,247 @@ func TestFileGetter(t *testing.T) {
 	}
 }
 
+func TestFileGetter_archive(t *testing.T) {
+	g := new(FileGetter)
+	dst := tempDir(t)
+
+	u := testModuleURL("archive.zip")
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Verify the destination folder is not a symlink
+	fi, err := os.Lstat(dst)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !fi.IsDir() {
+		t.Fatal("destination is not a directory")
+	}
+
+	// Verify the main file exists
+	mainPath := filepath.Join(dst, "main.tf")
+	if _, err := os.Stat(mainPath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Get again should work
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := os.Stat(mainPath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestFileGetter_archiveStrip(t *testing.T) {
+	g := new(FileGetter)
+	dst := tempDir(t)
+
+	u := testModuleURL("archive-wrapped.tar")
+	u.RawQuery = "archive_strip=1"
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, name := range []string{"main.tf", "foo/main.tf"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, "module-1.0")); err == nil {
+		t.Fatal("wrapper directory should be stripped")
+	}
+}
+
+func TestFileGetter_archiveStripBad(t *testing.T) {
+	cases := []struct {
+		Archive string
+		Query   string
+	}{
+		// Stripping the whole path of a file
+		{"archive.tar", "archive_strip=1"},
+		// Two files at the same path
+		{"archive-collide.tar", "archive_strip=1"},
+		{"archive.tar", "archive_strip=nope"},
+		{"archive.tar", "archive_strip=-1"},
+	}
+
+	for i, tc := range cases {
+		u := testModuleURL(tc.Archive)
+		u.RawQuery = tc.Query
+		if err := new(FileGetter).Get(tempDir(t), u); err == nil {
+			t.Fatalf("%d: should error", i)
+		}
+	}
+}
+
+func TestFileGetter_archiveFilter(t *testing.T) {
+	cases := []struct {
+		Query    string
+		Included []string
+	}{
+		{
+			"",
+			[]string{"main.tf", "README.md", "docs/index.md",
+				"examples/basic/main.tf", "modules/vpc/main.tf"},
+		},
+		{
+			"archive_exclude=examples,docs",
+			[]string{"main.tf", "README.md", "modules/vpc/main.tf"},
+		},
+		{
+			"archive_include=*.tf,modules/",
+			[]string{"main.tf", "modules/vpc/main.tf"},
+		},
+		{
+			"archive_include=*.tf&archive_include=examples&archive_exclude=examples/basic",
+			[]string{"main.tf"},
+		},
+	}
+
+	all := []string{"main.tf", "README.md", "docs/index.md",
+		"examples/basic/main.tf", "modules/vpc/main.tf"}
+	for _, tc := range cases {
+		dst := tempDir(t)
+		u := testModuleURL("archive-extras.tar")
+		u.RawQuery = tc.Query
+		if err := new(FileGetter).Get(dst, u); err != nil {
+			t.Fatalf("%s: err: %s", tc.Query, err)
+		}
+
+		included := make(map[string]bool)
+		for _, name := range tc.Included {
+			included[name] = true
+		}
+		for _, name := range all {
+			_, err := os.Stat(filepath.Join(dst, name))
+			if included[name] && err != nil {
+				t.Fatalf("%s: err: %s", tc.Query, err)
+			}
+			if !included[name] && err == nil {
+				t.Fatalf("%s: %s should not be unpacked", tc.Query, name)
+			}
+		}
+
+		// Excluded directories aren't left behind empty
+		if !included["docs/index.md"] {
+			if _, err := os.Stat(filepath.Join(dst, "docs")); err == nil {
+				t.Fatalf("%s: docs should not exist", tc.Query)
+			}
+		}
+	}
+}
+
+func TestFileGetter_archiveFilterBad(t *testing.T) {
+	cases := []string{
+		// No Terraform files are left
+		"archive_include=docs",
+		"archive_exclude=*.tf,modules,examples",
+		// Bad patterns
+		"archive_include=[",
+	}
+
+	for _, tc := range cases {
+		u := testModuleURL("archive-extras.tar")
+		u.RawQuery = tc
+		if err := new(FileGetter).Get(tempDir(t), u); err == nil {
+			t.Fatalf("%s: should error", tc)
+		}
+	}
+}
+
+func TestFileGetter_archiveMode(t *testing.T) {
+	for _, archive := range []string{"archive-exec.tar", "archive-exec.zip"} {
+		g := new(FileGetter)
+		dst := tempDir(t)
+
+		u := testModuleURL(archive)
+		if err := g.Get(dst, u); err != nil {
+			t.Fatalf("%s: err: %s", archive, err)
+		}
+		testFileExecutable(t, filepath.Join(dst, "scripts", "setup.sh"), true)
+		testFileExecutable(t, filepath.Join(dst, "main.tf"), false)
+
+		u.RawQuery = "archive_mode=normalize"
+		if err := g.Get(dst, u); err != nil {
+			t.Fatalf("%s: err: %s", archive, err)
+		}
+		for name, expected := range map[string]os.FileMode{
+			"main.tf":          0644,
+			"README.md":        0644,
+			"scripts":          0755,
+			"scripts/setup.sh": 0755,
+		} {
+			fi, err := os.Stat(filepath.Join(dst, name))
+			if err != nil {
+				t.Fatalf("%s: err: %s", archive, err)
+			}
+			if fi.Mode().Perm() != expected {
+				t.Fatalf("%s: %s: bad: %s", archive, name, fi.Mode())
+			}
+		}
+
+		u.RawQuery = "archive_mode=nope"
+		if err := g.Get(dst, u); err == nil {
+			t.Fatalf("%s: should error", archive)
+		}
+	}
+}
+
+func TestFileGetterUpdateAvailable(t *testing.T) {
+	g := new(FileGetter)
+	dst := tempDir(t)
+
+	// With a dir that doesn't exist
+	ok, err := g.UpdateAvailable(dst, testModuleURL("basic"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ok {
+		t.Fatal("should have update")
+	}
+
+	if err := g.Get(dst, testModuleURL("basic")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Pointing to the same source
+	ok, err = g.UpdateAvailable(dst, testModuleURL("basic"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ok {
+		t.Fatal("should not have update")
+	}
+
+	// Pointing to a different source
+	ok, err = g.UpdateAvailable(dst, testModuleURL("dup"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ok {
+		t.Fatal("should have update")
+	}
+}
+
+func TestFileGetterCheck(t *testing.T) {
+	g := new(FileGetter)
+
+	if err := g.Check(testModuleURL("basic")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := g.Check(testModuleURL("archive.zip")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := g.Check(testModuleURL("basic/main.tf")); err == nil {
+		t.Fatal("should error")
+	}
+	if err := g.Check(testModuleURL("nope")); err == nil {
+		t.Fatal("should error")
+	}
+}
+
 func TestFileGetter_sourceFile(t *testing.T) {
 	g := new(FileGetter)
 	dst := tempDir(t)
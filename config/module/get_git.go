@@ -1,32 +1,127 @@
 package module
 
 import (
+	"bufio"
 	"fmt"
+	"log"
 	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 // GitGetter is a Getter implementation that will download a module from
 // a git repository.
-type GitGetter struct{}
+//
+// The "ref" parameter can be a branch, tag, or commit to check out, and
+// defaults to master. When the module is updated, a branch is moved to the
+// latest commit of the branch on the remote, replacing the local branch if
+// the remote history was rewritten. Tags and commits never move.
+//
+// The "commit" parameter, if set, is the full SHA of the commit that the
+// ref must resolve to once it is checked out. A tag is convenient to read
+// but can be moved by whoever controls the server, while the SHA can't be
+// forged, so pinning both catches a tampered repository. A mismatch is a
+// *GitCommitMismatchError.
+//
+// While a tree is being loaded, or checked for updates, the refs of each
+// remote are only listed once, so modules that use the same repository
+// with different refs don't ask the remote again. What is listed is
+// forgotten when the next load starts, so that it never goes stale.
+type GitGetter struct {
+	// CAFile is the path to a PEM encoded bundle of CA certificates that
+	// git uses to verify HTTPS servers. If blank, the bundle from the
+	// environment variable named by CAFileEnvVar is used, if set.
+	CAFile string
+
+	// LFS, if true, runs "git lfs pull" after the repository is checked
+	// out so that files tracked with git LFS are downloaded rather than
+	// left as pointer files. This requires the git-lfs extension.
+	LFS bool
+
+	// DisableProtocolV2, if true, stops git from being asked to use
+	// version 2 of the git wire protocol. Protocol v2 makes fetching from
+	// repositories with many branches and tags much faster, and git falls
+	// back to the original protocol if either it or the server doesn't
+	// support it, but this can be set for servers that misbehave with it.
+	// Setting the environment variable named by GitProtocolV2EnvVar to
+	// "false" has the same effect.
+	DisableProtocolV2 bool
+
+	// Secrets, if set, is asked for the credentials for repositories that
+	// are cloned over HTTP or HTTPS. They are passed to git in the
+	// environment, so they are never stored in the repository. Without
+	// credentials from Secrets, git uses its own credential helpers.
+	Secrets SecretResolver
+
+	// CodeCommitCredentialHelper is the git credential helper that gets
+	// the credentials for AWS CodeCommit repositories cloned over HTTPS,
+	// which must be signed with SigV4, when Secrets has none for them.
+	// If blank, DefaultCodeCommitCredentialHelper is used, which needs the
+	// AWS CLI. To use git-remote-codecommit instead, use its URLs, such as
+	// "git::codecommit://vpc", which it gets the credentials for itself.
+	CodeCommitCredentialHelper string
+
+	// ReplaceInvalid, if true, deletes a module directory that exists but
+	// isn't a valid git repository, such as one that was modified by hand,
+	// and clones the repository again. By default this is an error that
+	// explains how to recover, so that nothing is deleted unexpectedly.
+	ReplaceInvalid bool
+
+	refsLock sync.Mutex
+	refs     map[string]*gitRemoteRefs
+}
+
+// gitRemoteRefs are the refs listed from a remote, mapped to their
+// commits. The lock is held while they are listed so that the remote is
+// only asked once.
+type gitRemoteRefs struct {
+	sync.Mutex
+	refs map[string]string
+}
+
+// GitCommitMismatchError is returned by GitGetter when the ref of a module
+// resolves to a different commit than the one given by the "commit"
+// parameter. This can mean that the repository was tampered with, so it
+// should be treated as a security problem rather than retried.
+type GitCommitMismatchError struct {
+	URL      string
+	Ref      string
+	Expected string
+	Actual   string
+}
+
+func (e *GitCommitMismatchError) Error() string {
+	return fmt.Sprintf(
+		"%s: ref %s is commit %s, but commit %s was expected; "+
+			"the repository may have been tampered with",
+		e.URL, e.Ref, e.Actual, e.Expected)
+}
+
+// GitProtocolV2EnvVar is the name of the environment variable that can be
+// set to "false" to disable git protocol v2 for all GitGetters.
+const GitProtocolV2EnvVar = "TF_MODULE_GIT_PROTOCOL_V2"
 
 func (g *GitGetter) Get(dst string, u *url.URL) error {
-	if _, err := exec.LookPath("git"); err != nil {
-		return fmt.Errorf("git must be available and on the PATH")
+	opts, err := parseGetOptions(u, g.refParam())
+	if err != nil {
+		return err
 	}
 
-	// Extract some query parameters we use
-	var ref string
-	q := u.Query()
-	if len(q) > 0 {
-		ref = q.Get("ref")
-		q.Del("ref")
+	return g.GetWithOptions(dst, opts)
+}
+
+// The branch, tag, or commit to check out is given in "ref".
+func (g *GitGetter) refParam() string {
+	return "ref"
+}
 
-		// Copy the URL
-		var newU url.URL = *u
-		u = &newU
-		u.RawQuery = q.Encode()
+func (g *GitGetter) GetWithOptions(dst string, opts *GetOptions) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("git must be available and on the PATH")
 	}
 
 	// First: clone or update the repository
@@ -34,41 +129,495 @@ func (g *GitGetter) Get(dst string, u *url.URL) error {
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	if err == nil {
-		err = g.update(dst, u)
+	exists := err == nil
+
+	// A directory that isn't a repository can't be updated, and git's own
+	// errors for it are confusing, so it is either replaced or explained.
+	if exists {
+		if err := g.checkRepo(dst, opts); err != nil {
+			if !g.ReplaceInvalid {
+				return err
+			}
+
+			log.Printf("[WARN] cloning again, replacing the invalid directory: %s", err)
+			if err := os.RemoveAll(dst); err != nil {
+				return err
+			}
+			exists = false
+		}
+	}
+
+	if exists {
+		err = g.update(dst, opts)
 	} else {
-		err = g.clone(dst, u)
+		err = g.clone(dst, opts)
 	}
 	if err != nil {
 		return err
 	}
 
 	// Next: check out the proper tag/branch if it is specified, and checkout
-	if ref == "" {
-		return nil
+	if opts.Ref != "" {
+		if err := g.checkout(dst, opts.Ref, opts); err != nil {
+			return err
+		}
+	}
+
+	// Then: make sure that the ref is the commit that was expected
+	if opts.Commit != "" {
+		if err := g.verifyCommit(dst, opts); err != nil {
+			return err
+		}
 	}
 
-	return g.checkout(dst, ref)
+	// Last: replace any LFS pointers with the real files
+	if g.LFS {
+		return g.lfsPull(dst, opts)
+	}
+
+	return nil
 }
 
-func (g *GitGetter) checkout(dst string, ref string) error {
-	cmd := exec.Command("git", "checkout", ref)
+func (g *GitGetter) UpdateAvailable(dst string, u *url.URL) (bool, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return false, fmt.Errorf("git must be available and on the PATH")
+	}
+
+	if _, err := os.Stat(dst); err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+
+		return false, err
+	}
+
+	opts, err := parseGetOptions(u, g.refParam())
+	if err != nil {
+		return false, err
+	}
+
+	// An invalid directory is replaced by getting it again, if allowed
+	if err := g.checkRepo(dst, opts); err != nil {
+		if g.ReplaceInvalid {
+			return true, nil
+		}
+
+		return false, err
+	}
+
+	ok, err := g.upToDate(dst, opts)
+	if err != nil {
+		return false, err
+	}
+
+	return !ok, nil
+}
+
+func (g *GitGetter) Check(u *url.URL) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("git must be available and on the PATH")
+	}
+
+	opts, err := parseGetOptions(u, g.refParam())
+	if err != nil {
+		return err
+	}
+
+	// Only ask for HEAD so that the remote doesn't have to list every
+	// ref. This is enough to know that the repository exists and that we
+	// are allowed to read it.
+	cmd, err := g.remoteCommand(opts, "ls-remote", opts.URL.String(), "HEAD")
+	if err != nil {
+		return err
+	}
+	_, err = getRunCommandOutput(cmd, opts)
+	return err
+}
+
+func (g *GitGetter) checkout(dst string, ref string, opts *GetOptions) error {
+	cmd := g.command("checkout", ref)
+	cmd.Dir = dst
+	return getRunCommand(cmd, opts)
+}
+
+// checkRepo returns an error if dst isn't the top of a git repository with
+// a commit checked out. dst being within another repository, such as the
+// repository of the configuration, doesn't count.
+func (g *GitGetter) checkRepo(dst string, opts *GetOptions) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf(
+			"module directory %s exists but is not a valid git repository "+
+				"(%s). Delete the directory to download the module again",
+			dst, reason)
+	}
+
+	cmd := g.command("rev-parse", "--show-toplevel")
+	cmd.Dir = dst
+	top, err := getRunCommandOutput(cmd, opts)
+	if err != nil {
+		return invalid("not a git repository")
+	}
+
+	// Symlinks are resolved on both sides since git reports the real path
+	expected, err := filepath.EvalSymlinks(dst)
+	if err != nil {
+		return err
+	}
+	actual, err := filepath.EvalSymlinks(strings.TrimSpace(top))
+	if err != nil || filepath.Clean(actual) != filepath.Clean(expected) {
+		return invalid("it is within the repository " + strings.TrimSpace(top))
+	}
+
+	cmd = g.command("rev-parse", "--verify", "--quiet", "HEAD^{commit}")
 	cmd.Dir = dst
-	return getRunCommand(cmd)
+	if err := getRunCommand(cmd, opts); err != nil {
+		return invalid("no commit is checked out")
+	}
+
+	return nil
 }
 
-func (g *GitGetter) clone(dst string, u *url.URL) error {
-	cmd := exec.Command("git", "clone", u.String(), dst)
-	return getRunCommand(cmd)
+// verifyCommit checks that the commit checked out in dst is opts.Commit.
+func (g *GitGetter) verifyCommit(dst string, opts *GetOptions) error {
+	cmd := g.command("rev-parse", "HEAD")
+	cmd.Dir = dst
+	actual, err := getRunCommandOutput(cmd, opts)
+	if err != nil {
+		return err
+	}
+
+	actual = strings.ToLower(strings.TrimSpace(actual))
+	if actual == opts.Commit {
+		return nil
+	}
+
+	ref := opts.Ref
+	if ref == "" {
+		ref = "master"
+	}
+
+	return &GitCommitMismatchError{
+		URL:      opts.URL.String(),
+		Ref:      ref,
+		Expected: opts.Commit,
+		Actual:   actual,
+	}
 }
 
-func (g *GitGetter) update(dst string, u *url.URL) error {
-	// We have to be on a branch to pull
-	if err := g.checkout(dst, "master"); err != nil {
+func (g *GitGetter) clone(dst string, opts *GetOptions) error {
+	args := []string{"clone"}
+	if opts.Depth > 0 {
+		// All branches are fetched so that updating can find the
+		// branch to move to. The ref must be a branch or tag for it to
+		// be part of the shallow history.
+		args = append(args,
+			"--depth", strconv.Itoa(opts.Depth), "--no-single-branch")
+		if opts.Ref != "" {
+			args = append(args, "--branch", opts.Ref)
+		}
+	}
+	args = append(args, opts.URL.String(), dst)
+
+	cmd, err := g.remoteCommand(opts, args...)
+	if err != nil {
 		return err
 	}
+	return getRunCommand(cmd, opts)
+}
+
+func (g *GitGetter) lfsPull(dst string, opts *GetOptions) error {
+	if err := getRunCommand(g.command("lfs", "version"), opts); err != nil {
+		return fmt.Errorf(
+			"git-lfs must be installed to get modules that use git LFS")
+	}
 
-	cmd := exec.Command("git", "pull", "--ff-only")
+	cmd, err := g.remoteCommand(opts, "lfs", "pull")
+	if err != nil {
+		return err
+	}
+	cmd.Dir = dst
+	return getRunCommand(cmd, opts)
+}
+
+func (g *GitGetter) update(dst string, opts *GetOptions) error {
+	// If the remote ref points to what we already have checked out then
+	// there is nothing to pull. Failing to determine this isn't fatal, we
+	// just fall back to a normal update.
+	if ok, err := g.upToDate(dst, opts); err == nil && ok {
+		log.Printf("[INFO] module %s: already up to date", opts.URL.String())
+		return nil
+	}
+
+	args := []string{"fetch", "origin"}
+	if opts.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(opts.Depth))
+	}
+	cmd, err := g.remoteCommand(opts, args...)
+	if err != nil {
+		return err
+	}
+	cmd.Dir = dst
+	if err := getRunCommand(cmd, opts); err != nil {
+		return err
+	}
+
+	// Tags and commits never move, so they are simply checked out after
+	// this. Branches track the remote though, so they are moved to the
+	// remote branch, even if its history was rewritten. Without a ref, the
+	// branch that is checked out, which is the default branch of the
+	// remote when it was cloned, is tracked.
+	ref := opts.Ref
+	if ref == "" {
+		cmd = g.command("symbolic-ref", "--quiet", "--short", "HEAD")
+		cmd.Dir = dst
+		branch, err := getRunCommandOutput(cmd, opts)
+		if err != nil {
+			return fmt.Errorf(
+				"can't update %s, no branch is checked out and no ref is given",
+				opts.URL.String())
+		}
+		ref = strings.TrimSpace(branch)
+	}
+	cmd = g.command("rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+ref)
+	cmd.Dir = dst
+	if err := getRunCommand(cmd, opts); err != nil {
+		if opts.Ref == "" {
+			return fmt.Errorf("branch %s not found in %s", ref, opts.URL.String())
+		}
+
+		cmd = g.command("rev-parse", "--verify", "--quiet", ref+"^{commit}")
+		cmd.Dir = dst
+		if err := getRunCommand(cmd, opts); err != nil {
+			return fmt.Errorf(
+				"ref %s is not a branch, tag, or commit in %s",
+				ref, opts.URL.String())
+		}
+
+		return nil
+	}
+
+	if err := g.checkout(dst, ref, opts); err != nil {
+		return err
+	}
+
+	cmd = g.command("reset", "--hard", "origin/"+ref)
+	cmd.Dir = dst
+	return getRunCommand(cmd, opts)
+}
+
+// command returns the command to run git with the given arguments, with
+// the environment set up according to the configuration of the getter.
+func (g *GitGetter) command(args ...string) *exec.Cmd {
+	// Versions of git that don't know about protocol v2 ignore the
+	// setting, so it is always safe to pass.
+	if g.protocolV2() {
+		args = append([]string{"-c", "protocol.version=2"}, args...)
+	}
+
+	cmd := exec.Command("git", args...)
+	if caFile := getCAFile(g.CAFile); caFile != "" {
+		cmd.Env = append(os.Environ(), "GIT_SSL_CAINFO="+caFile)
+	}
+
+	return cmd
+}
+
+// remoteCommand is like command but for commands that talk to the remote
+// at the URL of opts, which get the credentials from the Secrets of opts
+// and then from Secrets for HTTP and HTTPS remotes.
+func (g *GitGetter) remoteCommand(opts *GetOptions, args ...string) (*exec.Cmd, error) {
+	u := opts.URL
+	cmd := g.command(args...)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return cmd, nil
+	}
+
+	secrets := chainSecrets(opts.Secrets, g.Secrets)
+	user, pass, ok, err := resolveSecret(secrets, u.Host)
+	if err != nil {
+		return cmd, err
+	}
+	if !ok {
+		if u.Scheme == "https" && codeCommitHost(u.Host) {
+			g.codeCommitCredentials(cmd, u)
+		}
+
+		return cmd, nil
+	}
+
+	// The header is scoped to the host so that it isn't sent to other
+	// hosts, such as those of submodules.
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = gitConfigEnv(cmd.Env,
+		fmt.Sprintf("http.%s://%s/.extraHeader", u.Scheme, u.Host),
+		"Authorization: "+basicAuth(user, pass))
+
+	return cmd, nil
+}
+
+// DefaultCodeCommitCredentialHelper is the git credential helper that is
+// used for AWS CodeCommit repositories if CodeCommitCredentialHelper isn't
+// set. It is the credential helper of the AWS CLI, which signs credentials
+// with the AWS credentials from the environment.
+const DefaultCodeCommitCredentialHelper = "!aws codecommit credential-helper $@"
+
+// codeCommitCredentials configures the command to get the credentials for
+// the CodeCommit repository at the URL from the CodeCommit credential
+// helper alone. The credentials are signed for the path of the repository,
+// so git has to pass it to the helper.
+func (g *GitGetter) codeCommitCredentials(cmd *exec.Cmd, u *url.URL) {
+	helper := g.CodeCommitCredentialHelper
+	if helper == "" {
+		helper = DefaultCodeCommitCredentialHelper
+	}
+
+	// The empty helper resets the helpers from the user's configuration,
+	// whose credentials for the host would only be stale.
+	prefix := fmt.Sprintf("credential.%s://%s.", u.Scheme, u.Host)
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = gitConfigEnv(cmd.Env,
+		prefix+"helper", "",
+		prefix+"helper", helper,
+		prefix+"useHttpPath", "true")
+}
+
+// protocolV2 returns whether git should be asked to use protocol v2.
+func (g *GitGetter) protocolV2() bool {
+	if g.DisableProtocolV2 {
+		return false
+	}
+
+	if v := os.Getenv(GitProtocolV2EnvVar); v != "" {
+		if enabled, err := strconv.ParseBool(v); err == nil {
+			return enabled
+		}
+	}
+
+	return true
+}
+
+// upToDate cheaply checks whether the repository in dst is already at the
+// commit that ref points to on the remote, using "git ls-remote" so that
+// nothing needs to be fetched. A blank ref is treated as "master" to match
+// the branch that update pulls.
+func (g *GitGetter) upToDate(dst string, opts *GetOptions) (bool, error) {
+	ref := opts.Ref
+	if ref == "" {
+		ref = "master"
+	}
+
+	cmd := g.command("rev-parse", "HEAD")
 	cmd.Dir = dst
-	return getRunCommand(cmd)
+	local, err := getRunCommandOutput(cmd, opts)
+	if err != nil {
+		return false, err
+	}
+	local = strings.TrimSpace(local)
+
+	remote, err := g.remoteRef(ref, opts)
+	if err != nil {
+		return false, err
+	}
+
+	// If the ref isn't a branch or tag on the remote (a commit SHA, for
+	// example) we can't tell, so report that an update is needed.
+	return remote != "" && remote == local, nil
+}
+
+// remoteRef returns the commit that ref is on the remote, or "" if it
+// isn't a branch or tag there. While the caches of a tree operation are
+// in use, every ref of the remote is listed once and kept, since modules
+// that share a repository often ask for several of its refs.
+func (g *GitGetter) remoteRef(ref string, opts *GetOptions) (string, error) {
+	if !cachesActive() {
+		refs, err := g.listRemote(opts, ref)
+		if err != nil {
+			return "", err
+		}
+
+		return gitRefCommit(refs, ref), nil
+	}
+
+	key := opts.URL.String()
+	g.refsLock.Lock()
+	r, ok := g.refs[key]
+	if !ok {
+		if g.refs == nil {
+			g.refs = make(map[string]*gitRemoteRefs)
+		}
+
+		r = new(gitRemoteRefs)
+		g.refs[key] = r
+	}
+	g.refsLock.Unlock()
+
+	r.Lock()
+	defer r.Unlock()
+	if r.refs == nil {
+		refs, err := g.listRemote(opts)
+		if err != nil {
+			return "", err
+		}
+
+		r.refs = refs
+	}
+
+	return gitRefCommit(r.refs, ref), nil
+}
+
+// listRemote lists the refs of the remote that match the patterns, or
+// every ref if there are none, mapped to their commits.
+func (g *GitGetter) listRemote(opts *GetOptions, patterns ...string) (map[string]string, error) {
+	args := append([]string{"ls-remote", opts.URL.String()}, patterns...)
+	cmd, err := g.remoteCommand(opts, args...)
+	if err != nil {
+		return nil, err
+	}
+	out, err := getRunCommandOutput(cmd, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) == 2 {
+			refs[parts[1]] = parts[0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// gitRefCommit returns the commit of the branch or tag named ref in refs.
+// Annotated tags show up twice: once as the tag object and once peeled
+// ("^{}") to the commit it points to. The peeled commit is what would be
+// checked out, so it takes precedence.
+func gitRefCommit(refs map[string]string, ref string) string {
+	for _, name := range []string{
+		"refs/tags/" + ref + "^{}",
+		"refs/heads/" + ref,
+		"refs/tags/" + ref,
+	} {
+		if commit, ok := refs[name]; ok {
+			return commit
+		}
+	}
+
+	return ""
+}
+
+// resetCache forgets the refs that were listed from remotes.
+func (g *GitGetter) resetCache() {
+	g.refsLock.Lock()
+	defer g.refsLock.Unlock()
+	g.refs = nil
 }
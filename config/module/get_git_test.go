@@ -1,9 +1,14 @@
 package module
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -19,6 +24,54 @@ func TestGitGetter_impl(t *testing.T) {
 	var _ Getter = new(GitGetter)
 }
 
+func TestGitGetter_caFile(t *testing.T) {
+	g := &GitGetter{CAFile: "/foo/ca.pem"}
+	cmd := g.command("status")
+
+	found := false
+	for _, v := range cmd.Env {
+		if v == "GIT_SSL_CAINFO=/foo/ca.pem" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("bad: %#v", cmd.Env)
+	}
+}
+
+func TestGitGetter_protocolV2(t *testing.T) {
+	defer os.Setenv(GitProtocolV2EnvVar, os.Getenv(GitProtocolV2EnvVar))
+
+	cases := []struct {
+		Disable bool
+		Env     string
+		Result  bool
+	}{
+		{false, "", true},
+		{true, "", false},
+		{false, "false", false},
+		{false, "0", false},
+		{false, "true", true},
+		{true, "true", false},
+		{false, "nope", true},
+	}
+
+	for i, tc := range cases {
+		os.Setenv(GitProtocolV2EnvVar, tc.Env)
+
+		g := &GitGetter{DisableProtocolV2: tc.Disable}
+		cmd := g.command("status")
+		actual := strings.Join(cmd.Args, " ")
+		expected := "git status"
+		if tc.Result {
+			expected = "git -c protocol.version=2 status"
+		}
+		if actual != expected {
+			t.Fatalf("%d: bad: %s", i, actual)
+		}
+	}
+}
+
 func TestGitGetter(t *testing.T) {
 	if !testHasGit {
 		t.Log("git not found, skipping")
@@ -50,6 +103,58 @@ func TestGitGetter(t *testing.T) {
 	}
 }
 
+func TestGitGetter_depth(t *testing.T) {
+	if !testHasGit {
+		t.Log("git not found, skipping")
+		t.Skip()
+	}
+
+	g := new(GitGetter)
+	dst := tempDir(t)
+
+	// Git doesn't allow nested ".git" directories so we do some hackiness
+	// here to get around that...
+	moduleDir := filepath.Join(fixtureDir, "basic-git")
+	oldName := filepath.Join(moduleDir, "DOTgit")
+	newName := filepath.Join(moduleDir, ".git")
+	if err := os.Rename(oldName, newName); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Rename(newName, oldName)
+
+	url := testModuleURL("basic-git")
+	q := url.Query()
+	q.Add("depth", "1")
+	q.Add("ref", "test-branch")
+	url.RawQuery = q.Encode()
+
+	if err := g.Get(dst, url); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Only one commit was downloaded
+	cmd := exec.Command("git", "rev-list", "--count", "HEAD")
+	cmd.Dir = dst
+	out, err := getRunCommandOutput(cmd, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if strings.TrimSpace(out) != "1" {
+		t.Fatalf("bad: %s", out)
+	}
+
+	// Verify the branch file exists
+	mainPath := filepath.Join(dst, "main_branch.tf")
+	if _, err := os.Stat(mainPath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Updating works too
+	if err := g.Get(dst, url); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
 func TestGitGetter_branch(t *testing.T) {
 	if !testHasGit {
 		t.Log("git not found, skipping")
@@ -141,3 +246,525 @@ func TestGitGetter_tag(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 }
+
+func TestGitGetter_upToDate(t *testing.T) {
+	if !testHasGit {
+		t.Log("git not found, skipping")
+		t.Skip()
+	}
+
+	g := new(GitGetter)
+	dst := tempDir(t)
+
+	// Git doesn't allow nested ".git" directories so we do some hackiness
+	// here to get around that...
+	moduleDir := filepath.Join(fixtureDir, "basic-git")
+	oldName := filepath.Join(moduleDir, "DOTgit")
+	newName := filepath.Join(moduleDir, ".git")
+	if err := os.Rename(oldName, newName); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Rename(newName, oldName)
+
+	url := testModuleURL("basic-git")
+	if err := g.Get(dst, url); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// We just cloned master, so master is up to date
+	ok, err := g.upToDate(dst, &GetOptions{URL: url})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ok {
+		t.Fatal("should be up to date")
+	}
+
+	// But we don't have the branch checked out
+	ok, err = g.upToDate(dst, &GetOptions{URL: url, Ref: "test-branch"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ok {
+		t.Fatal("should not be up to date")
+	}
+
+	// Updating should still work
+	if err := g.Get(dst, url); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestGitGetterUpdateAvailable(t *testing.T) {
+	if !testHasGit {
+		t.Log("git not found, skipping")
+		t.Skip()
+	}
+
+	g := new(GitGetter)
+	dst := tempDir(t)
+
+	// Git doesn't allow nested ".git" directories so we do some hackiness
+	// here to get around that...
+	moduleDir := filepath.Join(fixtureDir, "basic-git")
+	oldName := filepath.Join(moduleDir, "DOTgit")
+	newName := filepath.Join(moduleDir, ".git")
+	if err := os.Rename(oldName, newName); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Rename(newName, oldName)
+
+	url := testModuleURL("basic-git")
+	ok, err := g.UpdateAvailable(dst, url)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ok {
+		t.Fatal("should have update")
+	}
+
+	if err := g.Get(dst, url); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ok, err = g.UpdateAvailable(dst, url)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ok {
+		t.Fatal("should not have update")
+	}
+
+	// A different branch is an update
+	q := url.Query()
+	q.Add("ref", "test-branch")
+	url.RawQuery = q.Encode()
+	ok, err = g.UpdateAvailable(dst, url)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ok {
+		t.Fatal("should have update")
+	}
+}
+
+func TestGitGetter_commit(t *testing.T) {
+	if !testHasGit {
+		t.Log("git not found, skipping")
+		t.Skip()
+	}
+
+	repo := testGitRepo(t)
+	repo.git("tag", "v1.0")
+	expected := repo.head()
+
+	g := new(GitGetter)
+	dst := tempDir(t)
+	if err := g.Get(dst, repo.url("ref=v1.0&commit="+expected)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual := testGitHead(t, dst); actual != expected {
+		t.Fatalf("bad: %s != %s", actual, expected)
+	}
+
+	// Move the tag to another commit, as a compromised server could
+	repo.commit("new.tf")
+	repo.git("tag", "-f", "v1.0")
+
+	dst = tempDir(t)
+	err := g.Get(dst, repo.url("ref=v1.0&commit="+expected))
+	merr, ok := err.(*GitCommitMismatchError)
+	if !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+	if merr.Expected != expected || merr.Actual != repo.head() {
+		t.Fatalf("bad: %#v", merr)
+	}
+}
+
+func TestGitGetter_lfs(t *testing.T) {
+	if !testHasGit {
+		t.Log("git not found, skipping")
+		t.Skip()
+	}
+
+	g := &GitGetter{LFS: true}
+	dst := tempDir(t)
+
+	// Git doesn't allow nested ".git" directories so we do some hackiness
+	// here to get around that...
+	moduleDir := filepath.Join(fixtureDir, "basic-git")
+	oldName := filepath.Join(moduleDir, "DOTgit")
+	newName := filepath.Join(moduleDir, ".git")
+	if err := os.Rename(oldName, newName); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Rename(newName, oldName)
+
+	err := g.Get(dst, testModuleURL("basic-git"))
+	if getRunCommand(exec.Command("git", "lfs", "version"), nil) != nil {
+		// Without git-lfs we should get a helpful error
+		if err == nil || !strings.Contains(err.Error(), "git-lfs") {
+			t.Fatalf("bad: %s", err)
+		}
+
+		return
+	}
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Verify the main file exists
+	mainPath := filepath.Join(dst, "main.tf")
+	if _, err := os.Stat(mainPath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestGitGetter_updateBranch(t *testing.T) {
+	if !testHasGit {
+		t.Log("git not found, skipping")
+		t.Skip()
+	}
+
+	repo := testGitRepo(t)
+	repo.git("checkout", "-b", "dev")
+	repo.commit("dev.tf")
+
+	g := new(GitGetter)
+	dst := tempDir(t)
+	u := repo.url("ref=dev")
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// New commits on the branch are pulled in
+	repo.commit("dev2.tf")
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual, expected := testGitHead(t, dst), repo.head(); actual != expected {
+		t.Fatalf("bad: %s != %s", actual, expected)
+	}
+
+	// Rewritten history replaces the local branch
+	repo.git("reset", "--hard", "HEAD~2")
+	repo.commit("other.tf")
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual, expected := testGitHead(t, dst), repo.head(); actual != expected {
+		t.Fatalf("bad: %s != %s", actual, expected)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "dev.tf")); err == nil {
+		t.Fatal("dev.tf should be gone")
+	}
+}
+
+func TestGitGetter_updateDefaultBranch(t *testing.T) {
+	if !testHasGit {
+		t.Log("git not found, skipping")
+		t.Skip()
+	}
+
+	repo := testGitRepo(t)
+	repo.git("branch", "-m", "master", "main")
+
+	g := new(GitGetter)
+	dst := tempDir(t)
+	u := repo.url("")
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Without a ref, the branch that was cloned is pulled in
+	repo.commit("new.tf")
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual, expected := testGitHead(t, dst), repo.head(); actual != expected {
+		t.Fatalf("bad: %s != %s", actual, expected)
+	}
+
+	// A branch that is gone from the remote can't be updated
+	repo.git("branch", "-m", "main", "other")
+	cmd := exec.Command("git", "remote", "prune", "origin")
+	cmd.Dir = dst
+	if err := getRunCommand(cmd, nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	repo.commit("other.tf")
+	err := g.Get(dst, u)
+	if err == nil || !strings.Contains(err.Error(), "branch main not found") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestGitGetter_updateTag(t *testing.T) {
+	if !testHasGit {
+		t.Log("git not found, skipping")
+		t.Skip()
+	}
+
+	repo := testGitRepo(t)
+	repo.git("tag", "v1.0")
+	expected := repo.head()
+
+	g := new(GitGetter)
+	dst := tempDir(t)
+	u := repo.url("ref=v1.0")
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// New commits don't move the tag
+	repo.commit("new.tf")
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual := testGitHead(t, dst); actual != expected {
+		t.Fatalf("bad: %s != %s", actual, expected)
+	}
+}
+
+func TestGitGetter_updateCommit(t *testing.T) {
+	if !testHasGit {
+		t.Log("git not found, skipping")
+		t.Skip()
+	}
+
+	repo := testGitRepo(t)
+	expected := repo.head()
+
+	g := new(GitGetter)
+	dst := tempDir(t)
+	u := repo.url("ref=" + expected)
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// New commits don't move a commit
+	repo.commit("new.tf")
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual := testGitHead(t, dst); actual != expected {
+		t.Fatalf("bad: %s != %s", actual, expected)
+	}
+}
+
+func TestGitGetter_invalidRepo(t *testing.T) {
+	if !testHasGit {
+		t.Log("git not found, skipping")
+		t.Skip()
+	}
+
+	repo := testGitRepo(t)
+	u := repo.url("")
+
+	// A directory with the files but no repository, as if it was modified
+	// by hand, is an error by default
+	dst := tempDir(t)
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testWriteFile(t, filepath.Join(dst, "main.tf"), "# main.tf\n")
+
+	g := new(GitGetter)
+	err := g.Get(dst, u)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "not a valid git repository") {
+		t.Fatalf("bad: %s", err)
+	}
+	if _, err := g.UpdateAvailable(dst, u); err == nil {
+		t.Fatal("should error")
+	}
+
+	// A directory within another repository isn't valid either
+	inner := filepath.Join(repo.dir, "inner")
+	if err := os.MkdirAll(inner, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	err = g.Get(inner, u)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "within the repository") {
+		t.Fatalf("bad: %s", err)
+	}
+
+	// Opting in replaces the directory with a new clone
+	g.ReplaceInvalid = true
+	ok, err := g.UpdateAvailable(dst, u)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ok {
+		t.Fatal("should have an update")
+	}
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual, expected := testGitHead(t, dst), repo.head(); actual != expected {
+		t.Fatalf("bad: %s != %s", actual, expected)
+	}
+}
+
+func TestGitGetter_refsCached(t *testing.T) {
+	if !testHasGit {
+		t.Log("git not found, skipping")
+		t.Skip()
+	}
+
+	repo := testGitRepo(t)
+	repo.git("tag", "v1.0.0")
+	repo.git("branch", "other")
+
+	// Count the ls-remotes by putting a git that logs them first on the
+	// PATH
+	real, err := exec.LookPath("git")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	bin := tempDir(t)
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	logPath := filepath.Join(bin, "log")
+	testWriteFile(t, filepath.Join(bin, "git"), fmt.Sprintf(
+		"#!/bin/sh\ncase \"$*\" in *ls-remote*) echo >> %q;; esac\nexec %q \"$@\"\n",
+		logPath, real))
+	if err := os.Chmod(filepath.Join(bin, "git"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dir := tempDir(t)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var main string
+	for name, ref := range map[string]string{
+		"master": "", "tag": "?ref=v1.0.0", "branch": "?ref=other",
+	} {
+		main += fmt.Sprintf(
+			"module %q {\n  source = \"git::file://%s%s\"\n}\n",
+			name, filepath.ToSlash(repo.dir), ref)
+	}
+	testWriteFile(t, filepath.Join(dir, "main.tf"), main)
+
+	tree, err := NewTreeModule("", dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	storage := testStorage(t)
+	if err := tree.Load(storage, GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	count := func() int {
+		data, err := ioutil.ReadFile(logPath)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatalf("err: %s", err)
+		}
+
+		return len(data)
+	}
+
+	// The refs of the repository are only listed once for all three
+	expected := map[string]bool{"master": false, "tag": false, "branch": false}
+	actual, err := tree.HasUpdates(storage)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if n := count(); n != 1 {
+		t.Fatalf("bad: %d ls-remotes", n)
+	}
+
+	// The next operation lists them again, so new commits are seen
+	repo.commit("new.tf")
+	expected["master"] = true
+	actual, err = tree.HasUpdates(storage)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if n := count(); n != 2 {
+		t.Fatalf("bad: %d ls-remotes", n)
+	}
+}
+
+// testGitRepository is a git repository created for a test.
+type testGitRepository struct {
+	t   *testing.T
+	dir string
+}
+
+// testGitRepo creates a git repository with one commit on master.
+func testGitRepo(t *testing.T) *testGitRepository {
+	dir := tempDir(t)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	r := &testGitRepository{t: t, dir: dir}
+	r.git("init")
+	r.git("symbolic-ref", "HEAD", "refs/heads/master")
+	r.commit("main.tf")
+	return r
+}
+
+// git runs git with the arguments in the repository.
+func (r *testGitRepository) git(args ...string) string {
+	cmd := exec.Command("git", append([]string{
+		"-c", "user.name=test", "-c", "user.email=test@example.com",
+	}, args...)...)
+	cmd.Dir = r.dir
+	out, err := getRunCommandOutput(cmd, nil)
+	if err != nil {
+		r.t.Fatalf("err: %s", err)
+	}
+
+	return strings.TrimSpace(out)
+}
+
+// commit commits a new file with the given name.
+func (r *testGitRepository) commit(name string) {
+	path := filepath.Join(r.dir, name)
+	if err := ioutil.WriteFile(path, []byte("# "+name+"\n"), 0644); err != nil {
+		r.t.Fatalf("err: %s", err)
+	}
+
+	r.git("add", name)
+	r.git("commit", "-m", name)
+}
+
+// head returns the commit that is checked out.
+func (r *testGitRepository) head() string {
+	return r.git("rev-parse", "HEAD")
+}
+
+// url returns the URL of the repository with the given query.
+func (r *testGitRepository) url(query string) *url.URL {
+	return &url.URL{Scheme: "file", Path: r.dir, RawQuery: query}
+}
+
+// testGitHead returns the commit that is checked out in dir.
+func testGitHead(t *testing.T, dir string) string {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+	out, err := getRunCommandOutput(cmd, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return strings.TrimSpace(out)
+}
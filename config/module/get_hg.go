@@ -12,21 +12,28 @@ import (
 type HgGetter struct{}
 
 func (g *HgGetter) Get(dst string, u *url.URL) error {
+	opts, err := parseGetOptions(u, g.refParam())
+	if err != nil {
+		return err
+	}
+
+	return g.GetWithOptions(dst, opts)
+}
+
+// The revision to update to is given in "rev".
+func (g *HgGetter) refParam() string {
+	return "rev"
+}
+
+func (g *HgGetter) GetWithOptions(dst string, opts *GetOptions) error {
 	if _, err := exec.LookPath("hg"); err != nil {
 		return fmt.Errorf("hg must be available and on the PATH")
 	}
 
-	// Extract some query parameters we use
-	var rev string
-	q := u.Query()
-	if len(q) > 0 {
-		rev = q.Get("rev")
-		q.Del("rev")
-
-		// Copy the URL
-		var newU url.URL = *u
-		u = &newU
-		u.RawQuery = q.Encode()
+	// Mercurial changeset IDs are hashes already, so rev is pinned to one
+	// directly instead.
+	if opts.Commit != "" {
+		return fmt.Errorf("commit isn't supported for hg, set rev to the changeset ID")
 	}
 
 	_, err := os.Stat(dst)
@@ -34,36 +41,56 @@ func (g *HgGetter) Get(dst string, u *url.URL) error {
 		return err
 	}
 	if err != nil {
-		if err := g.clone(dst, u); err != nil {
+		if err := g.clone(dst, opts); err != nil {
 			return err
 		}
 	}
 
-	if err:= g.pull(dst, u); err != nil {
+	if err := g.pull(dst, opts); err != nil {
+		return err
+	}
+
+	return g.update(dst, opts)
+}
+
+// UpdateAvailable for Mercurial can't be cheaply determined without
+// pulling, so an update is always reported as available.
+func (g *HgGetter) UpdateAvailable(dst string, u *url.URL) (bool, error) {
+	return true, nil
+}
+
+func (g *HgGetter) Check(u *url.URL) error {
+	if _, err := exec.LookPath("hg"); err != nil {
+		return fmt.Errorf("hg must be available and on the PATH")
+	}
+
+	opts, err := parseGetOptions(u, g.refParam())
+	if err != nil {
 		return err
 	}
 
-	return g.update(dst, u, rev)
+	cmd := exec.Command("hg", "identify", opts.URL.String())
+	return getRunCommand(cmd, opts)
 }
 
-func (g *HgGetter) clone(dst string, u *url.URL) error {
-	cmd := exec.Command("hg", "clone", "-U", u.String(), dst)
-	return getRunCommand(cmd)
+func (g *HgGetter) clone(dst string, opts *GetOptions) error {
+	cmd := exec.Command("hg", "clone", "-U", opts.URL.String(), dst)
+	return getRunCommand(cmd, opts)
 }
 
-func (g *HgGetter) pull(dst string, u *url.URL) error {
+func (g *HgGetter) pull(dst string, opts *GetOptions) error {
 	cmd := exec.Command("hg", "pull")
 	cmd.Dir = dst
-	return getRunCommand(cmd)
+	return getRunCommand(cmd, opts)
 }
 
-func (g *HgGetter) update(dst string, u *url.URL, rev string) error {
+func (g *HgGetter) update(dst string, opts *GetOptions) error {
 	args := []string{"update"}
-	if rev != "" {
-		args = append(args, rev)
+	if opts.Ref != "" {
+		args = append(args, opts.Ref)
 	}
 
 	cmd := exec.Command("hg", args...)
 	cmd.Dir = dst
-	return getRunCommand(cmd)
+	return getRunCommand(cmd, opts)
 }
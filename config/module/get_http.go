@@ -1,12 +1,22 @@
 package module
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 // HttpGetter is a Getter implementation that will download a module from
@@ -26,9 +36,204 @@ import (
 // The source URL, whether from the header or meta tag, must be a fully
 // formed URL. The shorthand syntax of "github.com/foo/bar" or relative
 // paths are not allowed.
-type HttpGetter struct{}
+//
+// Alternatively, the response can be the module itself as an archive, with
+// a Content-Type from DecompressorContentTypes, such as "application/zip".
+// The "archive_strip", "archive_include", "archive_exclude" and
+// "archive_mode" parameters of the URL work as they do for files. If the
+// response has an ETag or Last-Modified header, they're recorded with the
+// module and sent back in conditional requests, so if the server or a
+// caching proxy answers "304 Not Modified" the archive that was already
+// unpacked is reused rather than downloaded again.
+type HttpGetter struct {
+	// RootCAs, if set, is the set of CA certificates that servers are
+	// verified against. Otherwise, if CAFile is set, the PEM encoded
+	// certificates within that file are used. If neither is set, the file
+	// from the environment variable named by CAFileEnvVar is used, and if
+	// that isn't set either, the system certificates are used.
+	RootCAs *x509.CertPool
+	CAFile  string
+
+	// InsecureSkipVerifyHosts is a list of hosts for which TLS certificates
+	// are not verified at all. A host matches with or without its port.
+	// This should only be used as a last resort for hosts with certificates
+	// that can't otherwise be verified, and a warning is logged every time
+	// verification is skipped. All other hosts are verified normally.
+	InsecureSkipVerifyHosts []string
+
+	// Proxy, if set, is called with the host (including the port, if
+	// present) of every request and returns the URL of the proxy to route
+	// that request through. If Proxy is nil or returns a nil URL, the proxy
+	// is determined from the environment (HTTP_PROXY, etc.)
+	Proxy func(string) (*url.URL, error)
+
+	// UnixSockets maps hosts to the paths of Unix domain sockets that
+	// requests to those hosts are sent over instead of TCP, such as for a
+	// local agent that serves modules within a sandbox. A host matches
+	// with or without its port. Requests to these hosts never go through
+	// a proxy.
+	UnixSockets map[string]string
+
+	// Dial, if set, is used to connect to all other hosts instead of
+	// connecting over TCP directly.
+	Dial func(network, addr string) (net.Conn, error)
+
+	// WrapTransport, if set, is called with the transport built from the
+	// other settings and returns the http.RoundTripper that requests are
+	// actually sent with, such as one that caches responses following HTTP
+	// cache semantics, which should send its own requests with the given
+	// transport.
+	WrapTransport func(http.RoundTripper) http.RoundTripper
+
+	// ClientCerts maps hosts to the client certificates that are presented
+	// to them for mutual TLS. A host matches with or without its port.
+	// Other hosts are never presented a certificate.
+	ClientCerts map[string]*HttpClientCert
+
+	// MaxRedirects is the most redirects that are followed for a single
+	// request, DefaultHttpMaxRedirects if zero. If it is negative, no
+	// redirects are followed at all.
+	MaxRedirects int
+
+	// RedirectHosts is a list of the other hosts that requests may be
+	// redirected to. By default, redirects are only followed to the host
+	// of the original request, so that a redirect can't send requests and
+	// their credentials somewhere unexpected. A host matches with or
+	// without its port, and "*" allows redirects to any host.
+	RedirectHosts []string
+
+	// Auth, if set, is asked for a bearer token to authenticate requests
+	// to each host. Tokens are cached per host until they expire.
+	Auth HttpAuth
+
+	// Secrets, if set, is asked for a username and password to
+	// authenticate requests to each host with HTTP basic authentication,
+	// just before each request. Credentials from Secrets take precedence over
+	// tokens from Auth and over credentials in the URL. To get them from
+	// an external credentials helper, use a HelperSecretResolver, and to
+	// read them from mounted secret files, use a FileSecretResolver.
+	Secrets SecretResolver
+
+	// Accept, if set, is sent as the Accept header of the terraform-get
+	// request, such as "application/zip" or "application/gzip", so that
+	// servers which serve the module themselves can choose the format of
+	// the archive. If the response has the media type of an archive in
+	// DecompressorContentTypes, it is unpacked as the module.
+	Accept string
+
+	// UserAgent is sent as the User-Agent header of every request,
+	// including redirected ones, so that servers can identify module
+	// downloads. If blank, DefaultHttpUserAgent is sent.
+	UserAgent string
+
+	tokenLock sync.Mutex
+	tokens    map[string]*HttpToken
+}
 
 func (g *HttpGetter) Get(dst string, u *url.URL) error {
+	return g.getFollow(dst, &GetOptions{URL: u})
+}
+
+// getFollow implements followGetter. The credentials from the options are
+// used before those from Secrets, both for the terraform-get request and
+// for the source that the module is then downloaded from.
+func (g *HttpGetter) getFollow(dst string, opts *GetOptions) error {
+	u := opts.URL
+	resp, err := g.request(u, opts, readHttpValidators(dst, u))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The archive we already have is still current
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+
+	if d := g.archive(resp); d != nil {
+		if err := g.getArchive(dst, u, d, resp.Body); err != nil {
+			return err
+		}
+
+		return writeHttpValidators(dst, u, resp)
+	}
+
+	source, err := g.source(resp)
+	if err != nil {
+		return err
+	}
+
+	// Get it!
+	return getFollowed(dst, source, opts)
+}
+
+func (g *HttpGetter) UpdateAvailable(dst string, u *url.URL) (bool, error) {
+	resp, err := g.request(u, nil, readHttpValidators(dst, u))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+
+	// Without validators there's no way to tell whether an archive has
+	// changed without downloading it, so it is always downloaded again.
+	if g.archive(resp) != nil {
+		return true, nil
+	}
+
+	source, err := g.source(resp)
+	if err != nil {
+		return false, err
+	}
+
+	// The source we're redirected to may have changed, in which case the
+	// check is done against the new source. This matches what Get would do.
+	if err := checkRemoteSource(source); err != nil {
+		return false, err
+	}
+
+	return UpdateAvailable(dst, source)
+}
+
+func (g *HttpGetter) Check(u *url.URL) error {
+	// The terraform-get request only returns where the module is, so it
+	// is cheap. The real source is checked in turn.
+	resp, err := g.request(u, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The server answered with the module itself, so it clearly exists
+	if g.archive(resp) != nil {
+		return nil
+	}
+
+	source, err := g.source(resp)
+	if err != nil {
+		return err
+	}
+	if err := checkRemoteSource(source); err != nil {
+		return err
+	}
+
+	return Check(source)
+}
+
+// request makes the terraform-get request to the URL, using the credentials
+// from the Secrets of opts first, and refusing redirects to plain HTTP if
+// their RequireHTTPS is set. opts may be nil. If validators isn't nil, the
+// request is conditional and the response may be "304 Not Modified". The
+// caller must close the body of the response.
+func (g *HttpGetter) request(
+	u *url.URL, opts *GetOptions, validators *httpValidators) (*http.Response, error) {
+	if opts == nil {
+		opts = new(GetOptions)
+	}
+
 	// Copy the URL so we can modify it
 	var newU url.URL = *u
 	u = &newU
@@ -39,31 +244,556 @@ func (g *HttpGetter) Get(dst string, u *url.URL) error {
 	u.RawQuery = q.Encode()
 
 	// Get the URL
-	resp, err := http.Get(u.String())
+	client, err := g.client()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if opts.RequireHTTPS {
+		check := client.CheckRedirect
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if err := checkHTTPS(req.URL.String()); err != nil {
+				return err
+			}
+
+			return check(req, via)
+		}
+	}
+	resp, err := g.get(client, u, opts.Secrets, validators)
+	if err != nil {
+		return nil, err
+	}
+	if validators != nil && resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("bad response code: %d", resp.StatusCode)
+	}
+
+	return resp, nil
+}
+
+// download downloads the file at the URL with the client, credentials and
+// headers of the getter, giving up once timeout passes if it isn't zero,
+// and returns its content. This is for the files that other getters need,
+// so it isn't a terraform-get request.
+func (g *HttpGetter) download(u *url.URL, timeout time.Duration) ([]byte, error) {
+	client, err := g.client()
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = timeout
+
+	resp, err := g.get(client, u, nil, nil)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("bad response code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("bad response code: %d", resp.StatusCode)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// archive returns the Decompressor for the response if the server answered
+// the terraform-get request with an archive of the module rather than with
+// the source URL to download it from, or nil otherwise. The
+// X-Terraform-Get header always wins over the type of the body.
+func (g *HttpGetter) archive(resp *http.Response) Decompressor {
+	if resp.Header.Get("X-Terraform-Get") != "" {
+		return nil
+	}
+
+	return getContentTypeDecompressor(resp.Header.Get("Content-Type"))
+}
+
+// getArchive unpacks the archive in the body of the response into dst.
+// The body is saved to a temporary file first since the decompressors work
+// on files.
+func (g *HttpGetter) getArchive(dst string, u *url.URL, d Decompressor, body io.Reader) error {
+	opts, err := getArchiveOptions(u)
+	if err != nil {
+		return err
+	}
+
+	f, err := newTempFile(dst, ".tf-http")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("error downloading archive: %s", err)
 	}
 
+	return getArchive(dst, f.Name(), d, opts)
+}
+
+// source returns the source URL that the module should actually be
+// downloaded from, from the response to the terraform-get request.
+func (g *HttpGetter) source(resp *http.Response) (string, error) {
 	// Extract the source URL
 	var source string
 	if v := resp.Header.Get("X-Terraform-Get"); v != "" {
 		source = v
 	} else {
+		var err error
 		source, err = g.parseMeta(resp.Body)
 		if err != nil {
-			return err
+			return "", err
 		}
 	}
 	if source == "" {
-		return fmt.Errorf("no source URL was returned")
+		return "", fmt.Errorf("no source URL was returned")
 	}
 
-	// Get it!
-	return Get(dst, source)
+	return source, nil
+}
+
+// get makes a GET request to the URL, authenticating it with credentials
+// from secrets or Secrets, or a token from Auth, and making it conditional
+// on validators if they aren't nil. If the server rejects a cached token,
+// a new token is requested and the request is made once more.
+func (g *HttpGetter) get(
+	client *http.Client, u *url.URL, secrets SecretResolver,
+	validators *httpValidators) (*http.Response, error) {
+	user, pass, ok, err := resolveSecret(chainSecrets(secrets, g.Secrets), u.Host)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		req, err := g.newRequest(u, validators)
+		if err != nil {
+			return nil, err
+		}
+		req.SetBasicAuth(user, pass)
+
+		return client.Do(req)
+	}
+
+	for retry := true; ; retry = false {
+		req, err := g.newRequest(u, validators)
+		if err != nil {
+			return nil, err
+		}
+
+		token, cached, err := g.token(u.Host)
+		if err != nil {
+			return nil, fmt.Errorf("error authenticating to %s: %s", u.Host, err)
+		}
+		if token != nil {
+			req.Header.Set("Authorization", "Bearer "+token.Value)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if token == nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, nil
+		}
+
+		// The token was rejected so it shouldn't be used again
+		g.tokenLock.Lock()
+		delete(g.tokens, u.Host)
+		g.tokenLock.Unlock()
+
+		if !retry || !cached {
+			return resp, nil
+		}
+		resp.Body.Close()
+	}
+}
+
+// newRequest returns a GET request to the URL with the Accept and
+// User-Agent headers set, and the conditional headers for validators if
+// they aren't nil.
+func (g *HttpGetter) newRequest(u *url.URL, validators *httpValidators) (*http.Request, error) {
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if g.Accept != "" {
+		req.Header.Set("Accept", g.Accept)
+	}
+	req.Header.Set("User-Agent", g.userAgent())
+	if validators != nil {
+		if validators.ETag != "" {
+			req.Header.Set("If-None-Match", validators.ETag)
+		}
+		if validators.LastModified != "" {
+			req.Header.Set("If-Modified-Since", validators.LastModified)
+		}
+	}
+
+	return req, nil
+}
+
+// token returns the token for the host, and whether it came from the
+// cache. The lock is held while a new token is requested so that the user
+// is only prompted once per host even when modules are downloaded
+// concurrently.
+func (g *HttpGetter) token(host string) (*HttpToken, bool, error) {
+	if g.Auth == nil {
+		return nil, false, nil
+	}
+
+	g.tokenLock.Lock()
+	defer g.tokenLock.Unlock()
+
+	if t, ok := g.tokens[host]; ok && !t.expired() {
+		return t, true, nil
+	}
+
+	t, err := g.Auth.Token(host)
+	if err != nil || t == nil {
+		return nil, false, err
+	}
+
+	if g.tokens == nil {
+		g.tokens = make(map[string]*HttpToken)
+	}
+	g.tokens[host] = t
+
+	return t, false, nil
+}
+
+// client returns the HTTP client to use for requests.
+func (g *HttpGetter) client() (*http.Client, error) {
+	rootCAs, err := g.rootCAs()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := g.transport(rootCAs, nil)
+	if len(g.ClientCerts) > 0 {
+		hosts := make(map[string]http.RoundTripper)
+		for host, c := range g.ClientCerts {
+			cert, err := c.certificate()
+			if err != nil {
+				return nil, fmt.Errorf(
+					"error loading client certificate for %s: %s", host, err)
+			}
+
+			hosts[host] = g.transport(rootCAs, cert)
+		}
+
+		transport = &httpClientCertTransport{Hosts: hosts, Default: transport}
+	}
+	if g.WrapTransport != nil {
+		transport = g.WrapTransport(transport)
+	}
+
+	return &http.Client{
+		Transport:     transport,
+		CheckRedirect: g.checkRedirect,
+	}, nil
+}
+
+// transport returns the transport for requests that present the client
+// certificate cert during the TLS handshake, or none if cert is nil.
+func (g *HttpGetter) transport(rootCAs *x509.CertPool, cert *tls.Certificate) http.RoundTripper {
+	var certs []tls.Certificate
+	if cert != nil {
+		certs = []tls.Certificate{*cert}
+	}
+
+	secure := &http.Transport{Proxy: g.proxy, Dial: g.dial}
+	if rootCAs != nil || cert != nil {
+		secure.TLSClientConfig = &tls.Config{
+			RootCAs:      rootCAs,
+			Certificates: certs,
+		}
+	}
+	if len(g.InsecureSkipVerifyHosts) == 0 {
+		return secure
+	}
+
+	hosts := make(map[string]struct{})
+	for _, h := range g.InsecureSkipVerifyHosts {
+		hosts[h] = struct{}{}
+	}
+
+	return &httpInsecureTransport{
+		Hosts:  hosts,
+		Secure: secure,
+		Insecure: &http.Transport{
+			Proxy: g.proxy,
+			Dial:  g.dial,
+			TLSClientConfig: &tls.Config{
+				Certificates:       certs,
+				InsecureSkipVerify: true,
+			},
+		},
+	}
+}
+
+// DefaultHttpUserAgent is the User-Agent that HttpGetter sends if its
+// UserAgent isn't set. The version of Terraform isn't known to this
+// package, so the terraform command sets this to include it.
+var DefaultHttpUserAgent = "Terraform"
+
+// userAgent returns the User-Agent to send.
+func (g *HttpGetter) userAgent() string {
+	if g.UserAgent != "" {
+		return g.UserAgent
+	}
+
+	return DefaultHttpUserAgent
+}
+
+// DefaultHttpMaxRedirects is the number of redirects that HttpGetter
+// follows for a request if MaxRedirects isn't set.
+const DefaultHttpMaxRedirects = 10
+
+// checkRedirect is the CheckRedirect function of the client, which stops
+// redirects beyond MaxRedirects and to hosts that aren't allowed, and sets
+// the User-Agent of the redirects that are followed. req is the redirect
+// about to be followed and via are the requests so far, oldest first.
+func (g *HttpGetter) checkRedirect(req *http.Request, via []*http.Request) error {
+	req.Header.Set("User-Agent", g.userAgent())
+
+	max := g.MaxRedirects
+	if max == 0 {
+		max = DefaultHttpMaxRedirects
+	}
+	if len(via) > max || max < 0 {
+		return fmt.Errorf(
+			"not following redirect to %s: more than %d redirects",
+			req.URL, max)
+	}
+
+	host := via[0].URL.Host
+	if req.URL.Host == host {
+		return nil
+	}
+	for _, h := range g.RedirectHosts {
+		if h == "*" || h == req.URL.Host {
+			return nil
+		}
+		if rh, _, err := net.SplitHostPort(req.URL.Host); err == nil && h == rh {
+			return nil
+		}
+	}
+
+	return fmt.Errorf(
+		"not following redirect from %s to %s: redirects to other hosts "+
+			"must be allowed by RedirectHosts", host, req.URL)
+}
+
+// rootCAs returns the CA certificates to verify servers against, or nil
+// if the system certificates should be used.
+func (g *HttpGetter) rootCAs() (*x509.CertPool, error) {
+	if g.RootCAs != nil {
+		return g.RootCAs, nil
+	}
+
+	path := getCAFile(g.CAFile)
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA file: %s", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in CA file: %s", path)
+	}
+
+	return pool, nil
+}
+
+// proxy is the proxy function for the client's transport.
+func (g *HttpGetter) proxy(req *http.Request) (*url.URL, error) {
+	if _, ok := g.unixSocket(req.URL.Host); ok {
+		return nil, nil
+	}
+
+	if g.Proxy != nil {
+		u, err := g.Proxy(req.URL.Host)
+		if err != nil || u != nil {
+			return u, err
+		}
+	}
+
+	return http.ProxyFromEnvironment(req)
+}
+
+// dial is the dial function for the client's transport. addr always
+// includes the port.
+func (g *HttpGetter) dial(network, addr string) (net.Conn, error) {
+	if path, ok := g.unixSocket(addr); ok {
+		return net.Dial("unix", path)
+	}
+
+	if g.Dial != nil {
+		return g.Dial(network, addr)
+	}
+
+	return net.Dial(network, addr)
+}
+
+// unixSocket returns the path of the Unix domain socket to connect to the
+// host over, if there is one.
+func (g *HttpGetter) unixSocket(host string) (string, bool) {
+	if path, ok := g.UnixSockets[host]; ok {
+		return path, true
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		if path, ok := g.UnixSockets[h]; ok {
+			return path, true
+		}
+	}
+
+	return "", false
+}
+
+// httpValidatorsFile is the file within the destination directory that
+// records the validators of the archive that was unpacked there.
+const httpValidatorsFile = ".terraform-http"
+
+// httpValidators are the validators of an archive that HttpGetter
+// downloaded, from the ETag and Last-Modified headers of the response,
+// which make the next request for the archive conditional.
+type httpValidators struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// readHttpValidators returns the validators recorded in dst for the
+// archive at the URL, or nil if there aren't any. Validators that can't be
+// read are ignored, since the archive is simply downloaded again.
+func readHttpValidators(dst string, u *url.URL) *httpValidators {
+	data, err := ioutil.ReadFile(filepath.Join(dst, httpValidatorsFile))
+	if err != nil {
+		return nil
+	}
+
+	var v httpValidators
+	if err := json.Unmarshal(data, &v); err != nil {
+		log.Printf("[WARN] module: ignoring invalid %s in %s: %s",
+			httpValidatorsFile, dst, err)
+		return nil
+	}
+	if v.URL != u.String() || (v.ETag == "" && v.LastModified == "") {
+		return nil
+	}
+
+	return &v
+}
+
+// writeHttpValidators records the validators of the response for the
+// archive at the URL, which was just unpacked to dst, if it has any.
+func writeHttpValidators(dst string, u *url.URL, resp *http.Response) error {
+	v := &httpValidators{
+		URL:          u.String(),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	if v.ETag == "" && v.LastModified == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dst, httpValidatorsFile), data, 0644)
+}
+
+// HttpClientCert is a client certificate that HttpGetter presents to a
+// host for mutual TLS.
+type HttpClientCert struct {
+	// Certificate is the certificate with its private key. If it is nil,
+	// they're loaded from the PEM encoded CertFile and KeyFile instead,
+	// every time a module is downloaded, so renewed certificates are
+	// picked up.
+	Certificate *tls.Certificate
+	CertFile    string
+	KeyFile     string
+}
+
+// certificate returns the certificate, loading it if needed.
+func (c *HttpClientCert) certificate() (*tls.Certificate, error) {
+	if c.Certificate != nil {
+		return c.Certificate, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cert, nil
+}
+
+// httpClientCertTransport is an http.RoundTripper that sends HTTPS
+// requests to each of the hosts with its own RoundTripper, which presents
+// the client certificate of the host, and all other requests with Default.
+// This is done per request so that redirects to other hosts don't get the
+// certificate.
+type httpClientCertTransport struct {
+	Hosts   map[string]http.RoundTripper
+	Default http.RoundTripper
+}
+
+func (t *httpClientCertTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" {
+		return t.Default.RoundTrip(req)
+	}
+
+	host := req.URL.Host
+	rt, ok := t.Hosts[host]
+	if !ok {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			rt, ok = t.Hosts[h]
+		}
+	}
+	if !ok {
+		return t.Default.RoundTrip(req)
+	}
+
+	return rt.RoundTrip(req)
+}
+
+// httpInsecureTransport is an http.RoundTripper that skips TLS verification
+// only for requests to the given hosts. This is done per request rather
+// than per client so that redirects to other hosts are still verified.
+type httpInsecureTransport struct {
+	Hosts    map[string]struct{}
+	Secure   http.RoundTripper
+	Insecure http.RoundTripper
+}
+
+func (t *httpInsecureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" {
+		return t.Secure.RoundTrip(req)
+	}
+
+	host := req.URL.Host
+	_, ok := t.Hosts[host]
+	if !ok {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			_, ok = t.Hosts[h]
+		}
+	}
+	if !ok {
+		return t.Secure.RoundTrip(req)
+	}
+
+	log.Printf("[WARN] module: skipping TLS verification for host %s", host)
+	return t.Insecure.RoundTrip(req)
 }
 
 // parseMeta looks for the first meta tag in the given reader that
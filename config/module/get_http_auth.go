@@ -0,0 +1,194 @@
+package module
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// HttpAuth is the interface that HttpGetter uses to authenticate requests
+// to hosts that require it.
+type HttpAuth interface {
+	// Token returns a bearer token for requests to the given host. The
+	// host includes the port, if present. A nil token means that requests
+	// to the host aren't authenticated.
+	//
+	// Tokens are cached by the HttpGetter until they expire, so Token is
+	// only called again for a host once its token has expired or has been
+	// rejected by the server.
+	Token(host string) (*HttpToken, error)
+}
+
+// HttpToken is a bearer token returned by an HttpAuth.
+type HttpToken struct {
+	Value string
+
+	// Expires is the time the token expires. A zero time means that the
+	// token doesn't expire.
+	Expires time.Time
+}
+
+// expired returns whether the token has expired, or will very soon.
+func (t *HttpToken) expired() bool {
+	return !t.Expires.IsZero() && time.Now().Add(30*time.Second).After(t.Expires)
+}
+
+// deviceFlowSleep waits between polls of the token endpoint. It is a
+// variable so that tests don't have to wait.
+var deviceFlowSleep = time.Sleep
+
+// DeviceFlowAuth is an HttpAuth that gets tokens with the OAuth 2.0
+// device authorization grant (RFC 8628). The user is prompted to visit a
+// URL and enter a code in a browser, which lets a command line program
+// authenticate with single sign-on providers.
+type DeviceFlowAuth struct {
+	// ClientID is the OAuth client ID, and Scopes are the scopes to
+	// request, if any.
+	ClientID string
+	Scopes   []string
+
+	// DeviceAuthURL and TokenURL are the device authorization and token
+	// endpoints of the authorization server.
+	DeviceAuthURL string
+	TokenURL      string
+
+	// Hosts, if not empty, is the list of hosts that tokens are requested
+	// for. Requests to other hosts aren't authenticated. If empty, tokens
+	// are requested for every host.
+	Hosts []string
+
+	// Prompt is called with the URL the user has to visit and the code
+	// they must enter there. It must not block. If nil, the prompt is
+	// printed to standard error.
+	Prompt func(verificationURL, userCode string)
+
+	// Client is the HTTP client used to talk to the authorization server.
+	// If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+func (a *DeviceFlowAuth) Token(host string) (*HttpToken, error) {
+	if !a.hasHost(host) {
+		return nil, nil
+	}
+
+	var device struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		ExpiresIn               int    `json:"expires_in"`
+		Interval                int    `json:"interval"`
+	}
+	params := url.Values{"client_id": []string{a.ClientID}}
+	if len(a.Scopes) > 0 {
+		params.Set("scope", strings.Join(a.Scopes, " "))
+	}
+	if err := a.post(a.DeviceAuthURL, params, &device); err != nil {
+		return nil, fmt.Errorf("error starting device authorization: %s", err)
+	}
+	if device.DeviceCode == "" {
+		return nil, fmt.Errorf(
+			"error starting device authorization: no device code returned")
+	}
+
+	verificationURL := device.VerificationURIComplete
+	if verificationURL == "" {
+		verificationURL = device.VerificationURI
+	}
+	if a.Prompt != nil {
+		a.Prompt(verificationURL, device.UserCode)
+	} else {
+		fmt.Fprintf(os.Stderr,
+			"To download modules from %s, visit %s and enter the code %s\n",
+			host, verificationURL, device.UserCode)
+	}
+
+	// Poll the token endpoint until the user has authorized us
+	interval := time.Duration(device.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(device.ExpiresIn) * time.Second)
+	params = url.Values{
+		"client_id":   []string{a.ClientID},
+		"device_code": []string{device.DeviceCode},
+		"grant_type":  []string{"urn:ietf:params:oauth:grant-type:device_code"},
+	}
+	for {
+		if device.ExpiresIn > 0 && time.Now().After(deadline) {
+			return nil, fmt.Errorf("device authorization expired")
+		}
+		deviceFlowSleep(interval)
+
+		var token struct {
+			AccessToken string `json:"access_token"`
+			ExpiresIn   int    `json:"expires_in"`
+			Error       string `json:"error"`
+		}
+		if err := a.post(a.TokenURL, params, &token); err != nil {
+			return nil, fmt.Errorf("error getting token: %s", err)
+		}
+
+		switch token.Error {
+		case "":
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += 5 * time.Second
+			continue
+		default:
+			return nil, fmt.Errorf("error getting token: %s", token.Error)
+		}
+
+		result := &HttpToken{Value: token.AccessToken}
+		if token.ExpiresIn > 0 {
+			result.Expires = time.Now().Add(
+				time.Duration(token.ExpiresIn) * time.Second)
+		}
+
+		return result, nil
+	}
+}
+
+// hasHost returns whether tokens should be requested for the host.
+func (a *DeviceFlowAuth) hasHost(host string) bool {
+	if len(a.Hosts) == 0 {
+		return true
+	}
+
+	for _, h := range a.Hosts {
+		if h == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+// post posts the form to the URL and decodes the JSON response into v.
+// Responses with an "error" are decoded rather than treated as failures,
+// since the token endpoint uses them to report that authorization is
+// still pending.
+func (a *DeviceFlowAuth) post(u string, form url.Values, v interface{}) error {
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.PostForm(u, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+		return fmt.Errorf("bad response code: %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,220 @@
+package module
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestDeviceFlowAuth_impl(t *testing.T) {
+	var _ HttpAuth = new(DeviceFlowAuth)
+}
+
+func TestDeviceFlowAuth(t *testing.T) {
+	oldSleep := deviceFlowSleep
+	defer func() { deviceFlowSleep = oldSleep }()
+	deviceFlowSleep = func(time.Duration) {}
+
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != "tf" || r.FormValue("scope") != "a b" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"device_code":      "dev",
+			"user_code":        "ABCD-EFGH",
+			"verification_uri": "https://example.com/device",
+			"expires_in":       600,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("device_code") != "dev" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		polls++
+		if polls < 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "authorization_pending"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "secret",
+			"expires_in":   3600,
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var prompted []string
+	a := &DeviceFlowAuth{
+		ClientID:      "tf",
+		Scopes:        []string{"a", "b"},
+		DeviceAuthURL: server.URL + "/device",
+		TokenURL:      server.URL + "/token",
+		Prompt: func(u, code string) {
+			prompted = append(prompted, u, code)
+		},
+	}
+
+	token, err := a.Token("example.com")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if token.Value != "secret" {
+		t.Fatalf("bad: %#v", token)
+	}
+	if token.Expires.IsZero() || token.expired() {
+		t.Fatalf("bad: %#v", token)
+	}
+	if len(prompted) != 2 ||
+		prompted[0] != "https://example.com/device" || prompted[1] != "ABCD-EFGH" {
+		t.Fatalf("bad: %#v", prompted)
+	}
+	if polls != 3 {
+		t.Fatalf("bad: %d", polls)
+	}
+}
+
+func TestDeviceFlowAuth_denied(t *testing.T) {
+	oldSleep := deviceFlowSleep
+	defer func() { deviceFlowSleep = oldSleep }()
+	deviceFlowSleep = func(time.Duration) {}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"device_code": "dev",
+			"user_code":   "ABCD-EFGH",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "access_denied"})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	a := &DeviceFlowAuth{
+		DeviceAuthURL: server.URL + "/device",
+		TokenURL:      server.URL + "/token",
+		Prompt:        func(string, string) {},
+	}
+
+	if _, err := a.Token("example.com"); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestDeviceFlowAuth_hosts(t *testing.T) {
+	a := &DeviceFlowAuth{Hosts: []string{"example.com"}}
+
+	token, err := a.Token("other.com")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if token != nil {
+		t.Fatalf("bad: %#v", token)
+	}
+}
+
+func TestHttpGetter_auth(t *testing.T) {
+	valid := "a"
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer "+valid {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			testHttpHandlerHeader(w, r)
+		}))
+	defer server.Close()
+
+	auth := &testHttpAuth{Tokens: []string{"a", "b"}}
+	g := &HttpGetter{Auth: auth}
+	u, err := url.Parse(server.URL + "/header")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := g.Get(tempDir(t), u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if auth.Calls != 1 {
+		t.Fatalf("bad: %d", auth.Calls)
+	}
+
+	// The token is cached
+	if err := g.Get(tempDir(t), u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if auth.Calls != 1 {
+		t.Fatalf("bad: %d", auth.Calls)
+	}
+
+	// A rejected cached token is replaced
+	valid = "b"
+	if err := g.Get(tempDir(t), u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if auth.Calls != 2 {
+		t.Fatalf("bad: %d", auth.Calls)
+	}
+
+	// A rejected new token is an error
+	valid = "c"
+	auth.Tokens = []string{"d"}
+	auth.Calls = 0
+	if err := g.Get(tempDir(t), u); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestHttpGetter_authExpired(t *testing.T) {
+	ln := testHttpServer(t)
+	defer ln.Close()
+
+	auth := &testHttpAuth{
+		Tokens:  []string{"a", "b"},
+		Expires: time.Now().Add(-time.Minute),
+	}
+	g := &HttpGetter{Auth: auth}
+
+	var u url.URL
+	u.Scheme = "http"
+	u.Host = ln.Addr().String()
+	u.Path = "/header"
+
+	for i := 0; i < 2; i++ {
+		if err := g.Get(tempDir(t), &u); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if auth.Calls != 2 {
+		t.Fatalf("bad: %d", auth.Calls)
+	}
+}
+
+// testHttpAuth is an HttpAuth that returns the given tokens in order.
+type testHttpAuth struct {
+	Tokens  []string
+	Expires time.Time
+	Calls   int
+}
+
+func (a *testHttpAuth) Token(host string) (*HttpToken, error) {
+	v := a.Tokens[a.Calls]
+	a.Calls++
+	return &HttpToken{Value: v, Expires: a.Expires}, nil
+}
@@ -1,13 +1,27 @@
 package module
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"math/big"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestHttpGetter_impl(t *testing.T) {
@@ -80,6 +94,541 @@ func TestHttpGetter_none(t *testing.T) {
 	}
 }
 
+func TestHttpGetter_accept(t *testing.T) {
+	// The same URL serves the module as a zip or a tar.gz depending on
+	// what the getter accepts.
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fixture, contentType := "archive.tar.gz", "application/gzip"
+			if r.Header.Get("Accept") == "application/zip" {
+				fixture, contentType = "archive.zip", "application/zip"
+			}
+
+			w.Header().Set("Content-Type", contentType)
+			http.ServeFile(w, r, filepath.Join(fixtureDir, fixture))
+		}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL + "/module")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, accept := range []string{"application/zip", "application/gzip"} {
+		g := &HttpGetter{Accept: accept}
+		dst := tempDir(t)
+
+		if err := g.Get(dst, u); err != nil {
+			t.Fatalf("%s: err: %s", accept, err)
+		}
+
+		for _, p := range []string{"main.tf", "foo/main.tf"} {
+			if _, err := os.Stat(filepath.Join(dst, p)); err != nil {
+				t.Fatalf("%s: err: %s", accept, err)
+			}
+		}
+
+		// ServeFile answers the conditional request for the archive with
+		// "304 Not Modified"
+		ok, err := g.UpdateAvailable(dst, u)
+		if err != nil {
+			t.Fatalf("%s: err: %s", accept, err)
+		}
+		if ok {
+			t.Fatalf("%s: should not have update", accept)
+		}
+	}
+}
+
+func TestHttpGetter_conditional(t *testing.T) {
+	etag := `"v1"`
+	var downloads int
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			downloads++
+			data, err := ioutil.ReadFile(filepath.Join(fixtureDir, "archive.zip"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/zip")
+			w.Header().Set("ETag", etag)
+			w.Write(data)
+		}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL + "/module")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Requests go through the wrapped transport
+	var requests int
+	g := &HttpGetter{
+		WrapTransport: func(rt http.RoundTripper) http.RoundTripper {
+			return testRoundTripper(func(req *http.Request) (*http.Response, error) {
+				requests++
+				return rt.RoundTrip(req)
+			})
+		},
+	}
+	dst := tempDir(t)
+
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ok, err := g.UpdateAvailable(dst, u); err != nil || ok {
+		t.Fatalf("bad: %v %s", ok, err)
+	}
+
+	// The archive isn't downloaded again while it is unchanged
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "main.tf")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if downloads != 1 {
+		t.Fatalf("bad: %d", downloads)
+	}
+	if requests != 3 {
+		t.Fatalf("bad: %d", requests)
+	}
+
+	etag = `"v2"`
+	if ok, err := g.UpdateAvailable(dst, u); err != nil || !ok {
+		t.Fatalf("bad: %v %s", ok, err)
+	}
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if downloads != 3 {
+		t.Fatalf("bad: %d", downloads)
+	}
+
+	// Without a validator for the URL, the request isn't conditional
+	other := *u
+	other.RawQuery = "archive_mode=normalize"
+	if err := g.Get(dst, &other); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if downloads != 4 {
+		t.Fatalf("bad: %d", downloads)
+	}
+}
+
+func TestHttpGetter_proxy(t *testing.T) {
+	ln := testHttpServer(t)
+	defer ln.Close()
+
+	// The proxy receives the request for the unresolvable host and the
+	// test server handles it just the same.
+	var proxied string
+	g := &HttpGetter{
+		Proxy: func(host string) (*url.URL, error) {
+			proxied = host
+			if host != "module.invalid" {
+				return nil, nil
+			}
+
+			return &url.URL{Scheme: "http", Host: ln.Addr().String()}, nil
+		},
+	}
+	dst := tempDir(t)
+
+	var u url.URL
+	u.Scheme = "http"
+	u.Host = "module.invalid"
+	u.Path = "/header"
+
+	// Get it!
+	if err := g.Get(dst, &u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if proxied != "module.invalid" {
+		t.Fatalf("bad: %s", proxied)
+	}
+
+	// Verify the main file exists
+	mainPath := filepath.Join(dst, "main.tf")
+	if _, err := os.Stat(mainPath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestHttpGetter_unixSocket(t *testing.T) {
+	dir := tempDir(t)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	path := filepath.Join(dir, "agent.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("can't listen on a unix socket: %s", err)
+	}
+	defer ln.Close()
+	go http.Serve(ln, http.HandlerFunc(testHttpHandlerHeader))
+
+	// The proxy would be used for any host not on a socket
+	g := &HttpGetter{
+		UnixSockets: map[string]string{"modules.invalid": path},
+		Proxy: func(string) (*url.URL, error) {
+			return nil, fmt.Errorf("should not be proxied")
+		},
+	}
+	dst := tempDir(t)
+
+	var u url.URL
+	u.Scheme = "http"
+	u.Host = "modules.invalid"
+	u.Path = "/header"
+
+	// Get it!
+	if err := g.Get(dst, &u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Verify the main file exists
+	mainPath := filepath.Join(dst, "main.tf")
+	if _, err := os.Stat(mainPath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestHttpGetter_caFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(testHttpHandlerHeader))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL + "/header")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Without the CA the server can't be verified
+	if err := new(HttpGetter).Get(tempDir(t), u); err == nil {
+		t.Fatal("should error")
+	}
+
+	// Write the server certificate out as the CA bundle
+	f, err := ioutil.TempFile("", "tf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(f.Name())
+	err = pem.Encode(f, &pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.TLS.Certificates[0].Certificate[0],
+	})
+	f.Close()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	g := &HttpGetter{CAFile: f.Name()}
+	dst := tempDir(t)
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Verify the main file exists
+	mainPath := filepath.Join(dst, "main.tf")
+	if _, err := os.Stat(mainPath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The environment variable works too
+	defer os.Setenv(CAFileEnvVar, os.Getenv(CAFileEnvVar))
+	os.Setenv(CAFileEnvVar, f.Name())
+	if err := new(HttpGetter).Get(tempDir(t), u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestHttpGetter_clientCerts(t *testing.T) {
+	cert, certPEM, keyPEM := testClientCert(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert.Leaf)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(testHttpHandlerHeader))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	u, err := url.Parse(server.URL + "/header")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+
+	// Write the certificate and key out for loading them from files
+	td := tempDir(t)
+	if err := os.MkdirAll(td, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	certFile := filepath.Join(td, "cert.pem")
+	keyFile := filepath.Join(td, "key.pem")
+	testWriteFile(t, certFile, string(certPEM))
+	testWriteFile(t, keyFile, string(keyPEM))
+
+	cases := []struct {
+		Certs map[string]*HttpClientCert
+		Err   bool
+	}{
+		{nil, true},
+		{
+			map[string]*HttpClientCert{
+				"example.com": &HttpClientCert{Certificate: cert},
+			},
+			true,
+		},
+		{
+			map[string]*HttpClientCert{
+				u.Host: &HttpClientCert{Certificate: cert},
+			},
+			false,
+		},
+		{
+			map[string]*HttpClientCert{
+				"127.0.0.1": &HttpClientCert{Certificate: cert},
+			},
+			false,
+		},
+		{
+			map[string]*HttpClientCert{
+				"127.0.0.1": &HttpClientCert{
+					CertFile: certFile,
+					KeyFile:  keyFile,
+				},
+			},
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		g := &HttpGetter{RootCAs: rootCAs, ClientCerts: tc.Certs}
+		dst := tempDir(t)
+		err := g.Get(dst, u)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		// Verify the main file exists
+		mainPath := filepath.Join(dst, "main.tf")
+		if _, err := os.Stat(mainPath); err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+	}
+
+	// A certificate that can't be loaded is an error
+	g := &HttpGetter{
+		RootCAs: rootCAs,
+		ClientCerts: map[string]*HttpClientCert{
+			"127.0.0.1": &HttpClientCert{
+				CertFile: keyFile,
+				KeyFile:  certFile,
+			},
+		},
+	}
+	err = g.Get(tempDir(t), u)
+	if err == nil || !strings.Contains(err.Error(), "client certificate") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestHttpGetter_insecureSkipVerifyHosts(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(testHttpHandlerHeader))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL + "/header")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Other hosts don't relax verification
+	g := &HttpGetter{InsecureSkipVerifyHosts: []string{"example.com"}}
+	if err := g.Get(tempDir(t), u); err == nil {
+		t.Fatal("should error")
+	}
+
+	// The host without the port
+	host, _, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	g = &HttpGetter{InsecureSkipVerifyHosts: []string{host}}
+	dst := tempDir(t)
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Verify the main file exists
+	mainPath := filepath.Join(dst, "main.tf")
+	if _, err := os.Stat(mainPath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The host with the port
+	g = &HttpGetter{InsecureSkipVerifyHosts: []string{u.Host}}
+	if err := g.Get(tempDir(t), u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestHttpGetter_redirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(testHttpHandlerHeader))
+	defer target.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/chain", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		if n <= 1 {
+			http.Redirect(w, r, "/header", 302)
+			return
+		}
+
+		http.Redirect(w, r, fmt.Sprintf("/chain?n=%d", n-1), 302)
+	})
+	mux.HandleFunc("/header", testHttpHandlerHeader)
+	mux.HandleFunc("/other", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+"/header", 302)
+	})
+	origin := httptest.NewServer(mux)
+	defer origin.Close()
+
+	targetU, err := url.Parse(target.URL)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Getter *HttpGetter
+		Path   string
+		Err    string
+	}{
+		{new(HttpGetter), "/chain?n=3", ""},
+		{&HttpGetter{MaxRedirects: 3}, "/chain?n=3", ""},
+		{&HttpGetter{MaxRedirects: 2}, "/chain?n=3", "more than 2 redirects"},
+		{&HttpGetter{MaxRedirects: -1}, "/chain?n=1", "redirects"},
+		{new(HttpGetter), "/other", target.URL + "/header"},
+		{&HttpGetter{RedirectHosts: []string{targetU.Host}}, "/other", ""},
+		{&HttpGetter{RedirectHosts: []string{"127.0.0.1"}}, "/other", ""},
+		{&HttpGetter{RedirectHosts: []string{"example.com"}}, "/other", "RedirectHosts"},
+		{&HttpGetter{RedirectHosts: []string{"*"}}, "/other", ""},
+	}
+
+	for i, tc := range cases {
+		u, err := url.Parse(origin.URL + tc.Path)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		err = tc.Getter.Get(tempDir(t), u)
+		if tc.Err == "" {
+			if err != nil {
+				t.Fatalf("%d: err: %s", i, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.Err) {
+			t.Fatalf("%d: bad: %v", i, err)
+		}
+	}
+}
+
+func TestHttpGetter_userAgent(t *testing.T) {
+	var agents []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.UserAgent())
+		http.Redirect(w, r, "/header", 302)
+	})
+	mux.HandleFunc("/header", func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.UserAgent())
+		testHttpHandlerHeader(w, r)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	u, err := url.Parse(server.URL + "/redirect")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Getter *HttpGetter
+		Agent  string
+	}{
+		{new(HttpGetter), DefaultHttpUserAgent},
+		{&HttpGetter{UserAgent: "modules/1.0"}, "modules/1.0"},
+	}
+
+	for _, tc := range cases {
+		agents = nil
+		if err := tc.Getter.Get(tempDir(t), u); err != nil {
+			t.Fatalf("%s: err: %s", tc.Agent, err)
+		}
+
+		expected := []string{tc.Agent, tc.Agent}
+		if !reflect.DeepEqual(agents, expected) {
+			t.Fatalf("%s: bad: %#v", tc.Agent, agents)
+		}
+	}
+}
+
+func TestHttpGetterUpdateAvailable(t *testing.T) {
+	ln := testHttpServer(t)
+	defer ln.Close()
+
+	g := new(HttpGetter)
+	dst := tempDir(t)
+
+	var u url.URL
+	u.Scheme = "http"
+	u.Host = ln.Addr().String()
+	u.Path = "/header"
+
+	ok, err := g.UpdateAvailable(dst, &u)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ok {
+		t.Fatal("should have update")
+	}
+
+	if err := g.Get(dst, &u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ok, err = g.UpdateAvailable(dst, &u)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ok {
+		t.Fatal("should not have update")
+	}
+}
+
+// testRoundTripper is an http.RoundTripper implemented by a function.
+type testRoundTripper func(*http.Request) (*http.Response, error)
+
+func (f testRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
 func testHttpServer(t *testing.T) net.Listener {
 	ln, err := net.Listen("tcp", ":0")
 	if err != nil {
@@ -97,13 +646,55 @@ func testHttpServer(t *testing.T) net.Listener {
 	return ln
 }
 
+// testClientCert generates a self-signed client certificate, returning it
+// along with the PEM encoded certificate and key.
+func testClientCert(t *testing.T) (*tls.Certificate, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "terraform"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(
+		rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	cert.Leaf, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return &cert, certPEM, keyPEM
+}
+
 func testHttpHandlerHeader(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("X-Terraform-Get", testModuleURL("basic").String())
+	w.Header().Add("X-Terraform-Get", testRemoteModule("basic"))
 	w.WriteHeader(200)
 }
 
 func testHttpHandlerMeta(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte(fmt.Sprintf(testHttpMetaStr, testModuleURL("basic").String())))
+	w.Write([]byte(fmt.Sprintf(testHttpMetaStr, testRemoteModule("basic"))))
 }
 
 func testHttpHandlerNone(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,154 @@
+package module
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IPFSGatewayDefault is the gateway used by IPFSGetter if no gateway is
+// configured. This is the gateway of a local IPFS daemon.
+const IPFSGatewayDefault = "http://127.0.0.1:8080"
+
+// ipfsCidFile is the file within the destination directory that records
+// which content identifier was downloaded there.
+const ipfsCidFile = ".terraform-ipfs"
+
+// IPFSGetter is a Getter implementation that will download a module from
+// IPFS. The URL is of the form ipfs://CID, where CID is the content
+// identifier of a directory.
+//
+// Content is fetched as a tar archive through an IPFS HTTP gateway. Since
+// IPFS content is immutable, a directory that was already downloaded for
+// the same content identifier is never downloaded again.
+type IPFSGetter struct {
+	// Gateway is the base URL of the IPFS HTTP gateway to download from.
+	// If blank, IPFSGatewayDefault is used.
+	Gateway string
+}
+
+func (g *IPFSGetter) Get(dst string, u *url.URL) error {
+	cid := g.cid(u)
+	if cid == "" {
+		return fmt.Errorf("IPFS URL must specify a content identifier")
+	}
+
+	// Content is immutable, so if we already have it we're done
+	if ok, err := g.UpdateAvailable(dst, u); err != nil {
+		return err
+	} else if !ok {
+		return nil
+	}
+
+	td, err := newTempDir(dst, ".tf-ipfs")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(td)
+
+	archive := filepath.Join(td, "archive.tar")
+	if err := g.download(archive, cid); err != nil {
+		return err
+	}
+
+	unpacked := filepath.Join(td, "unpacked")
+	if err := new(TarDecompressor).Decompress(unpacked, archive); err != nil {
+		return err
+	}
+
+	// The gateway wraps the content in a directory named by the CID
+	root := filepath.Join(unpacked, cid)
+	if fi, err := os.Stat(root); err != nil || !fi.IsDir() {
+		return fmt.Errorf("IPFS content %s must be a directory", cid)
+	}
+
+	if err := ioutil.WriteFile(
+		filepath.Join(root, ipfsCidFile), []byte(cid), 0644); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+
+	return moveDir(dst, root)
+}
+
+func (g *IPFSGetter) UpdateAvailable(dst string, u *url.URL) (bool, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dst, ipfsCidFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+
+		return false, err
+	}
+
+	return strings.TrimSpace(string(data)) != g.cid(u), nil
+}
+
+func (g *IPFSGetter) Check(u *url.URL) error {
+	cid := g.cid(u)
+	if cid == "" {
+		return fmt.Errorf("IPFS URL must specify a content identifier")
+	}
+
+	resp, err := http.Head(fmt.Sprintf("%s/ipfs/%s", g.gateway(), cid))
+	if err != nil {
+		return fmt.Errorf(
+			"error reaching IPFS gateway %s: %s", g.gateway(), err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("bad response code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// cid returns the content identifier from the URL.
+func (g *IPFSGetter) cid(u *url.URL) string {
+	if u.Host != "" {
+		return u.Host
+	}
+
+	return strings.Trim(u.Path, "/")
+}
+
+// download downloads the content for the cid as a tar archive to dst.
+func (g *IPFSGetter) download(dst, cid string) error {
+	resp, err := http.Get(fmt.Sprintf("%s/ipfs/%s?format=tar", g.gateway(), cid))
+	if err != nil {
+		return fmt.Errorf(
+			"error reaching IPFS gateway %s: %s", g.gateway(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("bad response code: %d", resp.StatusCode)
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, resp.Body)
+	return err
+}
+
+// gateway returns the base URL of the gateway to use, without a trailing
+// slash.
+func (g *IPFSGetter) gateway() string {
+	gateway := g.Gateway
+	if gateway == "" {
+		gateway = IPFSGatewayDefault
+	}
+
+	return strings.TrimRight(gateway, "/")
+}
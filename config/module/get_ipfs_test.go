@@ -0,0 +1,115 @@
+package module
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testIPFSCid = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+
+func TestIPFSGetter_impl(t *testing.T) {
+	var _ Getter = new(IPFSGetter)
+}
+
+func TestIPFSGetter(t *testing.T) {
+	ln, count := testIPFSServer(t)
+	defer ln.Close()
+
+	g := &IPFSGetter{Gateway: "http://" + ln.Addr().String()}
+	dst := tempDir(t)
+
+	u, err := url.Parse("ipfs://" + testIPFSCid)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Get it!
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Verify the main file exists
+	mainPath := filepath.Join(dst, "main.tf")
+	if _, err := os.Stat(mainPath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Getting again shouldn't download anything
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if *count != 1 {
+		t.Fatalf("bad: %d", *count)
+	}
+}
+
+func TestIPFSGetter_noGateway(t *testing.T) {
+	ln, _ := testIPFSServer(t)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	g := &IPFSGetter{Gateway: "http://" + addr}
+	u, err := url.Parse("ipfs://" + testIPFSCid)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = g.Get(tempDir(t), u)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "IPFS gateway") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func testIPFSServer(t *testing.T) (net.Listener, *int) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	count := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ipfs/"+testIPFSCid, func(w http.ResponseWriter, r *http.Request) {
+		count++
+		if r.URL.Query().Get("format") != "tar" {
+			w.WriteHeader(400)
+			return
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(fixtureDir, "basic", "main.tf"))
+		if err != nil {
+			w.WriteHeader(500)
+			return
+		}
+
+		tw := tar.NewWriter(w)
+		tw.WriteHeader(&tar.Header{
+			Name:     testIPFSCid + "/",
+			Mode:     0755,
+			Typeflag: tar.TypeDir,
+		})
+		tw.WriteHeader(&tar.Header{
+			Name:     testIPFSCid + "/main.tf",
+			Mode:     0644,
+			Size:     int64(len(data)),
+			Typeflag: tar.TypeReg,
+		})
+		tw.Write(data)
+		tw.Close()
+	})
+
+	var server http.Server
+	server.Handler = mux
+	go server.Serve(ln)
+
+	return ln, &count
+}
@@ -0,0 +1,250 @@
+package module
+
+import (
+	"fmt"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetOptions are the options for getting a module. Rather than every
+// Getter parsing the query parameters of the source URL itself, the
+// common parameters are parsed into GetOptions by parseGetOptions:
+//
+//   - "ref" for git, "rev" for hg - The branch, tag, or revision to check
+//     out. Each is only read by the Getters that define it, so other
+//     Getters receive it in the URL.
+//   - "depth" - The number of commits of history to download, for Getters
+//     that support shallow copies.
+//   - "timeout" - The longest that each command that is run to get the
+//     module may take, such as "5m".
+//   - "commit" - The full commit SHA that the ref must resolve to, for
+//     Getters that verify it. This guards against a tag being moved to a
+//     different commit on the server.
+//
+// The "checksum" parameter and the subdirectory after "//" are removed
+// before then, and given as Checksum and SubDir.
+//
+// Getters that implement OptionsGetter receive GetOptions. Other Getters
+// receive the source URL as is, so they keep working unchanged.
+type GetOptions struct {
+	// URL is the source URL with the parameters above removed.
+	URL *url.URL
+
+	Ref     string
+	Commit  string
+	Depth   int
+	Timeout time.Duration
+
+	// SubDir is the subdirectory of the source that is the module. The
+	// whole source is still downloaded into dst. It is blank when the
+	// download is shared by several subdirectories, as with FolderStorage.
+	SubDir string
+
+	// Checksum is the "type:value" checksum that the module is verified
+	// against once it is downloaded, if any. Getters don't have to verify
+	// it themselves.
+	Checksum string
+
+	// Cancel, if not nil, cancels getting the module when it is closed.
+	Cancel <-chan struct{}
+
+	// Secrets, if not nil, resolves the credentials for this module, such
+	// as from LoadOptions.Secrets. Getters that support credentials ask it
+	// before their own SecretResolver.
+	Secrets SecretResolver
+
+	// RequireHTTPS, if true, refuses any source that the getter is sent to
+	// by a server, such as with X-Terraform-Get or a redirect, that is
+	// fetched over plain HTTP, for LoadOptions.RequireHTTPS.
+	RequireHTTPS bool
+}
+
+// OptionsGetter is implemented by Getters that accept GetOptions instead
+// of parsing the source URL themselves.
+type OptionsGetter interface {
+	Getter
+
+	GetWithOptions(string, *GetOptions) error
+}
+
+// commitSHA matches a full SHA-1 or SHA-256 commit ID.
+var commitSHA = regexp.MustCompile(`^([0-9a-fA-F]{40}|[0-9a-fA-F]{64})$`)
+
+// refGetter is implemented by Getters that check out a ref, returning the
+// name of the query parameter that it is given in.
+type refGetter interface {
+	refParam() string
+}
+
+// parseGetOptions parses the options from the query parameters of u. The
+// ref is read from the refParam parameter, and isn't read if refParam is
+// blank.
+func parseGetOptions(u *url.URL, refParam string) (*GetOptions, error) {
+	opts := new(GetOptions)
+
+	// Copy the URL so we can modify it
+	var newU url.URL = *u
+	opts.URL = &newU
+
+	q := newU.Query()
+	if len(q) == 0 {
+		return opts, nil
+	}
+
+	if refParam != "" {
+		opts.Ref = q.Get(refParam)
+		q.Del(refParam)
+	}
+
+	if v := q.Get("depth"); v != "" {
+		depth, err := strconv.Atoi(v)
+		if err != nil || depth < 1 {
+			return nil, fmt.Errorf("depth must be a positive number: %s", v)
+		}
+
+		opts.Depth = depth
+	}
+
+	if v := q.Get("commit"); v != "" {
+		if !commitSHA.MatchString(v) {
+			return nil, fmt.Errorf("commit must be a full commit SHA: %s", v)
+		}
+
+		opts.Commit = strings.ToLower(v)
+	}
+
+	if v := q.Get("timeout"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("timeout must be a positive duration: %s", v)
+		}
+
+		opts.Timeout = timeout
+	}
+
+	for _, k := range []string{"commit", "depth", "timeout"} {
+		q.Del(k)
+	}
+	newU.RawQuery = q.Encode()
+
+	return opts, nil
+}
+
+// followGetter is implemented by Getters that don't accept parsed
+// GetOptions, since they pass the parameters of the URL on as is, but
+// follow it to another source that is gotten with the cancellation and
+// credentials of the options. The URL of the options is the URL as is.
+type followGetter interface {
+	getFollow(string, *GetOptions) error
+}
+
+// getFollowed gets the source that a getter was sent to by a remote
+// server into dst, with the cancellation, credentials, and RequireHTTPS of
+// opts. Sources that only the configuration can use are refused.
+func getFollowed(dst, source string, opts *GetOptions) error {
+	if err := checkRemoteSource(source); err != nil {
+		return err
+	}
+	if opts.RequireHTTPS {
+		if err := checkHTTPS(source); err != nil {
+			return err
+		}
+	}
+
+	return getCancel(dst, source, opts)
+}
+
+// getWithOptions gets the module at u into dst with g, passing the parsed
+// options if g supports them. The subdirectory and checksum are only
+// passed on in the options, along with the cancellation, credentials, and
+// RequireHTTPS of base, which may be nil.
+func getWithOptions(
+	g Getter, dst string, u *url.URL, subDir, checksum string,
+	base *GetOptions) error {
+	if base == nil {
+		base = new(GetOptions)
+	}
+	if canceled(base.Cancel) {
+		return fmt.Errorf("canceled")
+	}
+
+	og, ok := g.(OptionsGetter)
+	if !ok {
+		if fg, ok := g.(followGetter); ok {
+			return fg.getFollow(dst, &GetOptions{
+				URL:          u,
+				SubDir:       subDir,
+				Checksum:     checksum,
+				Cancel:       base.Cancel,
+				Secrets:      base.Secrets,
+				RequireHTTPS: base.RequireHTTPS,
+			})
+		}
+
+		return g.Get(dst, u)
+	}
+
+	var refParam string
+	if rg, ok := g.(refGetter); ok {
+		refParam = rg.refParam()
+	}
+
+	opts, err := parseGetOptions(u, refParam)
+	if err != nil {
+		return err
+	}
+	opts.SubDir = subDir
+	opts.Checksum = checksum
+	opts.Cancel = base.Cancel
+	opts.Secrets = base.Secrets
+	opts.RequireHTTPS = base.RequireHTTPS
+
+	return og.GetWithOptions(dst, opts)
+}
+
+// canceled returns whether cancel is closed. cancel may be nil.
+func canceled(cancel <-chan struct{}) bool {
+	select {
+	case <-cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait waits for the started command to exit, killing it if it takes
+// longer than the timeout or the get is canceled. The options may be nil.
+func (o *GetOptions) wait(cmd *exec.Cmd) error {
+	if o == nil || (o.Timeout == 0 && o.Cancel == nil) {
+		return cmd.Wait()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var timeout <-chan time.Time
+	if o.Timeout > 0 {
+		timer := time.NewTimer(o.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-timeout:
+		cmd.Process.Kill()
+		<-done
+		return fmt.Errorf("timed out after %s", o.Timeout)
+	case <-o.Cancel:
+		cmd.Process.Kill()
+		<-done
+		return fmt.Errorf("canceled")
+	}
+}
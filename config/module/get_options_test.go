@@ -0,0 +1,215 @@
+package module
+
+import (
+	"net/url"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseGetOptions(t *testing.T) {
+	cases := []struct {
+		Input    string
+		RefParam string
+		Output   *GetOptions
+		URL      string
+		Err      bool
+	}{
+		{
+			"https://example.com/foo.git",
+			"ref",
+			&GetOptions{},
+			"https://example.com/foo.git",
+			false,
+		},
+		{
+			"https://example.com/foo.git?ref=v1.0&depth=1&timeout=5m&other=yes",
+			"ref",
+			&GetOptions{Ref: "v1.0", Depth: 1, Timeout: 5 * time.Minute},
+			"https://example.com/foo.git?other=yes",
+			false,
+		},
+		{
+			"https://example.com/foo?rev=default",
+			"rev",
+			&GetOptions{Ref: "default"},
+			"https://example.com/foo",
+			false,
+		},
+		{
+			"https://example.com/foo?rev=default",
+			"ref",
+			&GetOptions{},
+			"https://example.com/foo?rev=default",
+			false,
+		},
+		{
+			"https://example.com/foo?ref=v1.0&rev=default",
+			"",
+			&GetOptions{},
+			"https://example.com/foo?ref=v1.0&rev=default",
+			false,
+		},
+		{
+			"https://example.com/foo.git?ref=v1.0&commit=0123456789ABCDEF0123456789abcdef01234567",
+			"ref",
+			&GetOptions{Ref: "v1.0", Commit: "0123456789abcdef0123456789abcdef01234567"},
+			"https://example.com/foo.git",
+			false,
+		},
+		{"https://example.com/foo.git?commit=0123abc", "ref", nil, "", true},
+		{"https://example.com/foo.git?depth=0", "ref", nil, "", true},
+		{"https://example.com/foo.git?depth=nope", "ref", nil, "", true},
+		{"https://example.com/foo.git?timeout=nope", "ref", nil, "", true},
+	}
+
+	for i, tc := range cases {
+		u, err := url.Parse(tc.Input)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+
+		opts, err := parseGetOptions(u, tc.RefParam)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%d: bad err: %s", i, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		if opts.URL.String() != tc.URL {
+			t.Fatalf("%d: bad url: %s", i, opts.URL)
+		}
+		if u.String() != tc.Input {
+			t.Fatalf("%d: input modified: %s", i, u)
+		}
+
+		opts.URL = nil
+		if !reflect.DeepEqual(opts, tc.Output) {
+			t.Fatalf("%d: bad: %#v", i, opts)
+		}
+	}
+}
+
+func TestGetWithOptions(t *testing.T) {
+	u, err := url.Parse("https://example.com/foo?ref=v1.0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Getters that only implement Getter get the URL as is
+	old := new(testGetter)
+	if err := getWithOptions(old, "dst", u, "", "", nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if old.URL.String() != u.String() {
+		t.Fatalf("bad: %s", old.URL)
+	}
+
+	// The ref is left in the URL for getters that don't define it
+	g := new(testOptionsGetter)
+	if err := getWithOptions(g, "dst", u, "", "", nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if g.Opts.Ref != "" || g.Opts.URL.String() != u.String() {
+		t.Fatalf("bad: %#v", g.Opts)
+	}
+
+	rg := new(testRefGetter)
+	err = getWithOptions(rg, "dst", u, "modules/vpc", "md5:abc", nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if rg.Opts.Ref != "v1.0" || rg.Opts.URL.String() != "https://example.com/foo" {
+		t.Fatalf("bad: %#v", rg.Opts)
+	}
+	if rg.Opts.SubDir != "modules/vpc" || rg.Opts.Checksum != "md5:abc" {
+		t.Fatalf("bad: %#v", rg.Opts)
+	}
+}
+
+func TestGetCancel_options(t *testing.T) {
+	g := new(testRefGetter)
+	Getters["testref"] = g
+	defer delete(Getters, "testref")
+
+	src := "testref::https://example.com/repo//modules/vpc?ref=v1.0&checksum=md5:abc"
+	if err := getCancel(tempDir(t), src, nil); err == nil {
+		t.Fatal("should error on the checksum")
+	}
+	if g.Opts.URL.String() != "https://example.com/repo" || g.Opts.Ref != "v1.0" {
+		t.Fatalf("bad: %#v", g.Opts)
+	}
+	if g.Opts.SubDir != "modules/vpc" || g.Opts.Checksum != "md5:abc" {
+		t.Fatalf("bad: %#v", g.Opts)
+	}
+}
+
+func TestGetRunCommand_timeout(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep not found, skipping")
+	}
+
+	opts := &GetOptions{Timeout: 50 * time.Millisecond}
+	err := getRunCommand(exec.Command("sleep", "5"), opts)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestGetRunCommand_cancel(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep not found, skipping")
+	}
+
+	cancel := make(chan struct{})
+	close(cancel)
+
+	opts := &GetOptions{Cancel: cancel}
+	err := getRunCommand(exec.Command("sleep", "5"), opts)
+	if err == nil || !strings.Contains(err.Error(), "canceled") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+// testGetter is a Getter that records the URL it was asked to get.
+type testGetter struct {
+	URL *url.URL
+}
+
+func (g *testGetter) Get(dst string, u *url.URL) error {
+	g.URL = u
+	return nil
+}
+
+func (g *testGetter) UpdateAvailable(string, *url.URL) (bool, error) {
+	return true, nil
+}
+
+func (g *testGetter) Check(*url.URL) error {
+	return nil
+}
+
+// testOptionsGetter is an OptionsGetter that records the options it was
+// asked to get with.
+type testOptionsGetter struct {
+	testGetter
+
+	Opts *GetOptions
+}
+
+func (g *testOptionsGetter) GetWithOptions(dst string, opts *GetOptions) error {
+	g.Opts = opts
+	return nil
+}
+
+// testRefGetter is a testOptionsGetter that reads the ref from "ref".
+type testRefGetter struct {
+	testOptionsGetter
+}
+
+func (g *testRefGetter) refParam() string {
+	return "ref"
+}
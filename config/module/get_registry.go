@@ -0,0 +1,201 @@
+package module
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RegistryGetter is a Getter implementation that will download a module
+// from a module registry. The URL is of the form
+// https://host/namespace/name/provider, with an optional "version" query
+// parameter that constrains which version of the module is used, such as
+// "~> 1.2" or ">= 1.0, < 2.0". Without a constraint, the newest version is
+// used.
+//
+// The registry is found using service discovery on the host. The registry
+// returns the source URL for the chosen version, which is then downloaded
+// with the Getter for that source.
+type RegistryGetter struct{}
+
+func (g *RegistryGetter) Get(dst string, u *url.URL) error {
+	return g.getFollow(dst, &GetOptions{URL: u})
+}
+
+// getFollow implements followGetter. With RequireHTTPS, the registry that
+// the host points to, and any redirects of the requests to it, must use
+// HTTPS as well.
+func (g *RegistryGetter) getFollow(dst string, opts *GetOptions) error {
+	source, err := g.source(opts.URL, opts.RequireHTTPS)
+	if err != nil {
+		return err
+	}
+
+	return getFollowed(dst, source, opts)
+}
+
+func (g *RegistryGetter) UpdateAvailable(dst string, u *url.URL) (bool, error) {
+	source, err := g.source(u, false)
+	if err != nil {
+		return false, err
+	}
+	if err := checkRemoteSource(source); err != nil {
+		return false, err
+	}
+
+	return UpdateAvailable(dst, source)
+}
+
+func (g *RegistryGetter) Check(u *url.URL) error {
+	source, err := g.source(u, false)
+	if err != nil {
+		return err
+	}
+	if err := checkRemoteSource(source); err != nil {
+		return err
+	}
+
+	return Check(source)
+}
+
+// source looks up the source URL to download the module from, refusing
+// anything over plain HTTP if requireHTTPS is true.
+func (g *RegistryGetter) source(u *url.URL, requireHTTPS bool) (string, error) {
+	constraint, err := parseVersionConstraint(u.Query().Get("version"))
+	if err != nil {
+		return "", err
+	}
+
+	path := strings.Trim(u.Path, "/")
+	if len(strings.Split(path, "/")) != 3 {
+		return "", fmt.Errorf(
+			"registry module must be namespace/name/provider: %s", path)
+	}
+
+	client := http.DefaultClient
+	if requireHTTPS {
+		client = httpsClient()
+	}
+
+	base, err := g.discover(client, u)
+	if err != nil {
+		return "", err
+	}
+	if requireHTTPS {
+		if err := checkHTTPS(base.String()); err != nil {
+			return "", err
+		}
+	}
+
+	// Find the newest version that satisfies the constraint
+	versionsURL, err := base.Parse(path + "/versions")
+	if err != nil {
+		return "", err
+	}
+	var versions struct {
+		Modules []struct {
+			Versions []struct {
+				Version string `json:"version"`
+			} `json:"versions"`
+		} `json:"modules"`
+	}
+	if err := g.getJSON(client, versionsURL, &versions); err != nil {
+		return "", err
+	}
+
+	var best *version
+	var bestRaw string
+	for _, m := range versions.Modules {
+		for _, v := range m.Versions {
+			parsed, err := parseVersion(v.Version)
+			if err != nil {
+				continue
+			}
+			if !constraint.Check(parsed) {
+				continue
+			}
+			if best == nil || parsed.Compare(best) > 0 {
+				best = parsed
+				bestRaw = v.Version
+			}
+		}
+	}
+	if best == nil {
+		return "", fmt.Errorf(
+			"no version of %s matches constraint: %s",
+			path, u.Query().Get("version"))
+	}
+
+	// Ask for the location of that version
+	downloadURL, err := base.Parse(path + "/" + bestRaw + "/download")
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Get(downloadURL.String())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("bad response code: %d", resp.StatusCode)
+	}
+
+	source := resp.Header.Get("X-Terraform-Get")
+	if source == "" {
+		return "", fmt.Errorf("no source URL was returned")
+	}
+
+	// The source may be relative to the download URL. Sources with a
+	// forced getter are always absolute.
+	if force, _ := getForcedGetter(source); force == "" {
+		su, err := downloadURL.Parse(source)
+		if err != nil {
+			return "", err
+		}
+		source = su.String()
+	}
+
+	return source, nil
+}
+
+// discover uses service discovery on the host of the URL to find the base
+// URL of the modules API.
+func (g *RegistryGetter) discover(client *http.Client, u *url.URL) (*url.URL, error) {
+	discoURL := &url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   "/.well-known/terraform.json",
+	}
+
+	var services map[string]interface{}
+	if err := g.getJSON(client, discoURL, &services); err != nil {
+		return nil, fmt.Errorf("error discovering registry on %s: %s", u.Host, err)
+	}
+
+	raw, ok := services["modules.v1"].(string)
+	if !ok {
+		return nil, fmt.Errorf("host %s does not provide a module registry", u.Host)
+	}
+	if !strings.HasSuffix(raw, "/") {
+		raw += "/"
+	}
+
+	return discoURL.Parse(raw)
+}
+
+// getJSON requests the URL with the client and decodes the JSON response
+// into v.
+func (g *RegistryGetter) getJSON(client *http.Client, u *url.URL, v interface{}) error {
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("bad response code: %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
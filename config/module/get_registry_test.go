@@ -0,0 +1,100 @@
+package module
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistryGetter_impl(t *testing.T) {
+	var _ Getter = new(RegistryGetter)
+}
+
+func TestRegistryGetter(t *testing.T) {
+	server, downloaded := testRegistryServer(t)
+	defer server.Close()
+
+	cases := []struct {
+		Constraint string
+		Version    string
+		Err        bool
+	}{
+		{"", "1.1.0", false},
+		{"~> 1.0.0", "1.0.1", false},
+		{"< 1.0", "0.9.0", false},
+		{">= 2.0", "", true},
+	}
+
+	for i, tc := range cases {
+		u, err := url.Parse(server.URL + "/hashicorp/consul/aws")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if tc.Constraint != "" {
+			u.RawQuery = url.Values{"version": []string{tc.Constraint}}.Encode()
+		}
+
+		g := new(RegistryGetter)
+		dst := tempDir(t)
+		*downloaded = ""
+		err = g.Get(dst, u)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%d: bad err: %s", i, err)
+		}
+		if tc.Err {
+			continue
+		}
+
+		if *downloaded != tc.Version {
+			t.Fatalf("%d: bad version: %s", i, *downloaded)
+		}
+
+		// Verify the main file exists
+		mainPath := filepath.Join(dst, "main.tf")
+		if _, err := os.Stat(mainPath); err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+	}
+}
+
+func testRegistryServer(t *testing.T) (*httptest.Server, *string) {
+	var downloaded string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/terraform.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"modules.v1": "/v1/modules/"}`))
+	})
+	mux.HandleFunc("/v1/modules/hashicorp/consul/aws/versions", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testRegistryVersionsStr))
+	})
+	for _, v := range []string{"0.9.0", "1.0.0", "1.0.1", "1.1.0", "1.2.0-beta"} {
+		v := v
+		path := fmt.Sprintf("/v1/modules/hashicorp/consul/aws/%s/download", v)
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			downloaded = v
+			w.Header().Add("X-Terraform-Get", testRemoteModule("basic"))
+			w.WriteHeader(204)
+		})
+	}
+
+	return httptest.NewServer(mux), &downloaded
+}
+
+const testRegistryVersionsStr = `
+{
+  "modules": [
+    {
+      "versions": [
+        {"version": "0.9.0"},
+        {"version": "1.0.0"},
+        {"version": "1.0.1"},
+        {"version": "1.1.0"},
+        {"version": "1.2.0-beta"}
+      ]
+    }
+  ]
+}
+`
@@ -0,0 +1,229 @@
+package module
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SecretResolver looks up the credentials for a host at the moment a
+// module is downloaded from it, such as from a secrets manager, so that the
+// credentials don't have to be part of the source or the environment.
+//
+// Getters that support a SecretResolver fall back to the credentials they
+// would otherwise use, such as those in the source URL, when no resolver
+// is configured or it has no credentials for the host.
+type SecretResolver interface {
+	// Resolve returns the username and password for the host, which
+	// includes the port if there is one. Both are blank if the resolver
+	// has no credentials for the host.
+	Resolve(host string) (user, pass string, err error)
+}
+
+// HelperSecretResolver is a SecretResolver that runs an external
+// credentials helper, like the credential helpers of git, so that existing
+// credential tooling can supply the credentials just in time.
+//
+// The helper is run with the host as its last argument, and prints the
+// credentials to standard output as "key=value" lines:
+//
+//	username=alice
+//	password=s3cr3t
+//
+// Other keys are ignored. A helper that prints no credentials has none for
+// the host, while a helper that exits with a non-zero status fails the
+// download.
+type HelperSecretResolver struct {
+	// Command is the helper program followed by any arguments to run it
+	// with, before the host.
+	Command []string
+
+	// Timeout, if set, is the longest the helper may take, such as when it
+	// prompts for a login that nobody answers.
+	Timeout time.Duration
+}
+
+func (r *HelperSecretResolver) Resolve(host string) (string, string, error) {
+	if len(r.Command) == 0 {
+		return "", "", fmt.Errorf("no credentials helper command")
+	}
+
+	args := append(r.Command[1:len(r.Command):len(r.Command)], host)
+	cmd := exec.Command(r.Command[0], args...)
+	out, err := getRunCommandOutput(cmd, &GetOptions{Timeout: r.Timeout})
+	if err != nil {
+		return "", "", err
+	}
+
+	var user, pass string
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		parts := strings.SplitN(strings.TrimRight(scanner.Text(), "\r"), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		switch strings.TrimSpace(parts[0]) {
+		case "username":
+			user = parts[1]
+		case "password":
+			pass = parts[1]
+		}
+	}
+
+	return user, pass, scanner.Err()
+}
+
+// FileSecretResolver is a SecretResolver that reads the credentials for
+// each host from files, such as those that Kubernetes mounts for a secret.
+// The files are read every time the credentials are needed, so rotated
+// credentials are picked up without restarting.
+//
+// The contents of the files are never part of errors or logs.
+type FileSecretResolver struct {
+	// Files maps hosts, including the port if there is one, to the path
+	// of the file with the password or token for the host. Whitespace
+	// around the contents, such as a trailing newline, is ignored.
+	//
+	// The path can also be a directory with a file for each key, which is
+	// how Kubernetes mounts a whole secret: the password is read from its
+	// "password" file, or its "token" file if there is no password, and the
+	// username from its "username" file, if there is one.
+	Files map[string]string
+
+	// Usernames maps hosts to the usernames that go with their passwords.
+	// A username from a secret directory takes precedence.
+	Usernames map[string]string
+}
+
+func (r *FileSecretResolver) Resolve(host string) (string, string, error) {
+	path, ok := r.Files[host]
+	if !ok {
+		return "", "", nil
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", "", err
+	}
+	if !fi.IsDir() {
+		pass, err := readSecretFile(path)
+		return r.Usernames[host], pass, err
+	}
+
+	user := r.Usernames[host]
+	if v, err := readSecretFile(filepath.Join(path, "username")); err == nil {
+		user = v
+	} else if !os.IsNotExist(err) {
+		return "", "", err
+	}
+
+	for _, key := range []string{"password", "token"} {
+		pass, err := readSecretFile(filepath.Join(path, key))
+		if err == nil {
+			return user, pass, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", "", err
+		}
+	}
+
+	return "", "", fmt.Errorf("no password or token file in %s", path)
+}
+
+// readSecretFile returns the contents of the file without surrounding
+// whitespace.
+func readSecretFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// resolveSecret asks the resolver for the credentials for the host. It
+// returns false if there is no resolver or no credentials.
+func resolveSecret(r SecretResolver, host string) (string, string, bool, error) {
+	if r == nil {
+		return "", "", false, nil
+	}
+
+	user, pass, err := r.Resolve(host)
+	if err != nil {
+		return "", "", false, fmt.Errorf(
+			"error resolving credentials for %s: %s", host, err)
+	}
+
+	return user, pass, user != "" || pass != "", nil
+}
+
+// secretsChain is a SecretResolver that asks each of its resolvers in turn
+// until one of them has credentials for the host.
+type secretsChain []SecretResolver
+
+func (c secretsChain) Resolve(host string) (string, string, error) {
+	for _, r := range c {
+		user, pass, err := r.Resolve(host)
+		if err != nil || user != "" || pass != "" {
+			return user, pass, err
+		}
+	}
+
+	return "", "", nil
+}
+
+// chainSecrets returns a SecretResolver that asks the given resolvers in
+// order, skipping nil ones, or nil if they are all nil.
+func chainSecrets(rs ...SecretResolver) SecretResolver {
+	var result secretsChain
+	for _, r := range rs {
+		if r != nil {
+			result = append(result, r)
+		}
+	}
+	switch len(result) {
+	case 0:
+		return nil
+	case 1:
+		return result[0]
+	default:
+		return result
+	}
+}
+
+// basicAuth returns the value of an Authorization header for HTTP basic
+// authentication.
+func basicAuth(user, pass string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+}
+
+// gitConfigEnv returns the environment variables that add the given git
+// configuration, pairs of keys and values, to whatever is already
+// configured through the environment. Configuration in the environment
+// isn't visible in the process list and isn't written to the repository,
+// unlike "git -c" or the remote URL.
+func gitConfigEnv(env []string, config ...string) []string {
+	n := 0
+	if v := os.Getenv("GIT_CONFIG_COUNT"); v != "" {
+		if count, err := strconv.Atoi(v); err == nil && count > 0 {
+			n = count
+		}
+	}
+
+	for i := 0; i+1 < len(config); i += 2 {
+		env = append(env,
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", n, config[i]),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", n, config[i+1]))
+		n++
+	}
+
+	return append(env, fmt.Sprintf("GIT_CONFIG_COUNT=%d", n))
+}
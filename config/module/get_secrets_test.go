@@ -0,0 +1,331 @@
+package module
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestHttpGetter_secrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			user, pass, ok := r.BasicAuth()
+			if !ok || user != "foo" || pass != "bar" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			testHttpHandlerHeader(w, r)
+		}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL + "/header")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Without a resolver there are no credentials
+	g := new(HttpGetter)
+	if err := g.Get(tempDir(t), u); err == nil {
+		t.Fatal("should error")
+	}
+
+	secrets := &testSecretResolver{
+		Secrets: map[string][2]string{u.Host: {"foo", "bar"}},
+	}
+	g = &HttpGetter{Secrets: secrets}
+	if err := g.Get(tempDir(t), u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(secrets.Hosts) != 1 || secrets.Hosts[0] != u.Host {
+		t.Fatalf("bad: %#v", secrets.Hosts)
+	}
+
+	// Without credentials from the resolver, the URL is used
+	secrets.Secrets = nil
+	userU := *u
+	userU.User = url.UserPassword("foo", "bar")
+	if err := g.Get(tempDir(t), &userU); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestHttpGetter_secretsError(t *testing.T) {
+	ln := testHttpServer(t)
+	defer ln.Close()
+
+	g := &HttpGetter{Secrets: &testSecretResolver{Err: true}}
+	u := &url.URL{Scheme: "http", Host: ln.Addr().String(), Path: "/header"}
+	if err := g.Get(tempDir(t), u); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestGitGetter_secrets(t *testing.T) {
+	defer os.Setenv("GIT_CONFIG_COUNT", os.Getenv("GIT_CONFIG_COUNT"))
+	os.Setenv("GIT_CONFIG_COUNT", "1")
+
+	g := &GitGetter{
+		Secrets: &testSecretResolver{
+			Secrets: map[string][2]string{"example.com": {"foo", "bar"}},
+		},
+	}
+
+	cases := []struct {
+		URL    string
+		Header bool
+	}{
+		{"https://example.com/foo.git", true},
+		{"https://other.com/foo.git", false},
+		{"ssh://git@example.com/foo.git", false},
+	}
+
+	for _, tc := range cases {
+		u, err := url.Parse(tc.URL)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		cmd, err := g.remoteCommand(&GetOptions{URL: u}, "ls-remote", tc.URL)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.URL, err)
+		}
+
+		// The credentials are never part of the arguments
+		if strings.Contains(strings.Join(cmd.Args, " "), "Authorization") {
+			t.Fatalf("%s: bad: %#v", tc.URL, cmd.Args)
+		}
+
+		env := strings.Join(cmd.Env, "\n")
+		header := strings.Contains(env,
+			"GIT_CONFIG_KEY_1=http.https://example.com/.extraHeader\n"+
+				"GIT_CONFIG_VALUE_1=Authorization: "+basicAuth("foo", "bar"))
+		if header != tc.Header {
+			t.Fatalf("%s: bad: %#v", tc.URL, cmd.Env)
+		}
+		if tc.Header && !strings.Contains(env, "GIT_CONFIG_COUNT=2") {
+			t.Fatalf("%s: bad: %#v", tc.URL, cmd.Env)
+		}
+	}
+}
+
+func TestGitGetter_codeCommit(t *testing.T) {
+	defer os.Setenv("GIT_CONFIG_COUNT", os.Getenv("GIT_CONFIG_COUNT"))
+	os.Unsetenv("GIT_CONFIG_COUNT")
+
+	prefix := "credential.https://git-codecommit.us-east-1.amazonaws.com."
+	cases := []struct {
+		URL    string
+		Getter *GitGetter
+		Env    []string
+	}{
+		{
+			"https://git-codecommit.us-east-1.amazonaws.com/v1/repos/vpc",
+			new(GitGetter),
+			[]string{
+				"GIT_CONFIG_KEY_0=" + prefix + "helper",
+				"GIT_CONFIG_VALUE_0=",
+				"GIT_CONFIG_KEY_1=" + prefix + "helper",
+				"GIT_CONFIG_VALUE_1=" + DefaultCodeCommitCredentialHelper,
+				"GIT_CONFIG_KEY_2=" + prefix + "useHttpPath",
+				"GIT_CONFIG_VALUE_2=true",
+				"GIT_CONFIG_COUNT=3",
+			},
+		},
+		{
+			"https://git-codecommit.us-east-1.amazonaws.com/v1/repos/vpc",
+			&GitGetter{CodeCommitCredentialHelper: "!aws --profile ci codecommit credential-helper $@"},
+			[]string{
+				"GIT_CONFIG_KEY_0=" + prefix + "helper",
+				"GIT_CONFIG_VALUE_0=",
+				"GIT_CONFIG_KEY_1=" + prefix + "helper",
+				"GIT_CONFIG_VALUE_1=!aws --profile ci codecommit credential-helper $@",
+				"GIT_CONFIG_KEY_2=" + prefix + "useHttpPath",
+				"GIT_CONFIG_VALUE_2=true",
+				"GIT_CONFIG_COUNT=3",
+			},
+		},
+
+		// Credentials from Secrets are used instead of the helper
+		{
+			"https://git-codecommit.us-east-1.amazonaws.com/v1/repos/vpc",
+			&GitGetter{
+				Secrets: &testSecretResolver{
+					Secrets: map[string][2]string{
+						"git-codecommit.us-east-1.amazonaws.com": {"foo", "bar"},
+					},
+				},
+			},
+			[]string{
+				"GIT_CONFIG_KEY_0=http.https://git-codecommit.us-east-1.amazonaws.com/.extraHeader",
+				"GIT_CONFIG_VALUE_0=Authorization: " + basicAuth("foo", "bar"),
+				"GIT_CONFIG_COUNT=1",
+			},
+		},
+
+		{"https://example.com/foo.git", new(GitGetter), nil},
+		{"codecommit://vpc", new(GitGetter), nil},
+	}
+
+	for _, tc := range cases {
+		u, err := url.Parse(tc.URL)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		cmd, err := tc.Getter.remoteCommand(&GetOptions{URL: u}, "ls-remote", tc.URL)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.URL, err)
+		}
+
+		var env []string
+		for _, v := range cmd.Env {
+			if strings.HasPrefix(v, "GIT_CONFIG_") {
+				env = append(env, v)
+			}
+		}
+		if !reflect.DeepEqual(env, tc.Env) {
+			t.Fatalf("%s: bad: %#v", tc.URL, env)
+		}
+	}
+}
+
+func TestHelperSecretResolver(t *testing.T) {
+	dir := tempDir(t)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	helper := filepath.Join(dir, "helper")
+	script := `#!/bin/sh
+if [ "$2" = "fail.example.com" ]; then
+    echo "no session" >&2
+    exit 1
+fi
+if [ "$1" = "get" ] && [ "$2" = "example.com:8080" ]; then
+    echo "protocol=https"
+    echo "username=foo"
+    echo "password=b=ar"
+fi
+`
+	if err := ioutil.WriteFile(helper, []byte(script), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	r := &HelperSecretResolver{Command: []string{helper, "get"}}
+	cases := []struct {
+		Host string
+		User string
+		Pass string
+		Err  bool
+	}{
+		{"example.com:8080", "foo", "b=ar", false},
+		{"other.example.com", "", "", false},
+		{"fail.example.com", "", "", true},
+	}
+
+	for _, tc := range cases {
+		user, pass, err := r.Resolve(tc.Host)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Host, err)
+		}
+		if tc.Err && !strings.Contains(err.Error(), "no session") {
+			t.Fatalf("%s: bad: %s", tc.Host, err)
+		}
+		if user != tc.User || pass != tc.Pass {
+			t.Fatalf("%s: bad: %s %s", tc.Host, user, pass)
+		}
+	}
+
+	if _, _, err := new(HelperSecretResolver).Resolve("example.com"); err == nil {
+		t.Fatal("should error without a command")
+	}
+}
+
+func TestFileSecretResolver(t *testing.T) {
+	dir := tempDir(t)
+	secret := filepath.Join(dir, "secret")
+	tokens := filepath.Join(dir, "tokens")
+	for _, d := range []string{secret, tokens, filepath.Join(dir, "empty")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	testWriteFile(t, filepath.Join(dir, "password"), "s3cr3t\n")
+	testWriteFile(t, filepath.Join(secret, "username"), "alice\n")
+	testWriteFile(t, filepath.Join(secret, "password"), "p4ss\n")
+	testWriteFile(t, filepath.Join(tokens, "token"), "t0ken")
+
+	r := &FileSecretResolver{
+		Files: map[string]string{
+			"example.com":        filepath.Join(dir, "password"),
+			"secret.example.com": secret,
+			"token.example.com":  tokens,
+			"empty.example.com":  filepath.Join(dir, "empty"),
+			"gone.example.com":   filepath.Join(dir, "gone"),
+		},
+		Usernames: map[string]string{
+			"example.com":        "foo",
+			"secret.example.com": "bob",
+		},
+	}
+	cases := []struct {
+		Host string
+		User string
+		Pass string
+		Err  bool
+	}{
+		{"example.com", "foo", "s3cr3t", false},
+		{"secret.example.com", "alice", "p4ss", false},
+		{"token.example.com", "", "t0ken", false},
+		{"other.example.com", "", "", false},
+		{"empty.example.com", "", "", true},
+		{"gone.example.com", "", "", true},
+	}
+
+	for _, tc := range cases {
+		user, pass, err := r.Resolve(tc.Host)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Host, err)
+		}
+		if user != tc.User || pass != tc.Pass {
+			t.Fatalf("%s: bad: %s %s", tc.Host, user, pass)
+		}
+	}
+
+	// Rotated credentials are picked up
+	testWriteFile(t, filepath.Join(dir, "password"), "r0tated")
+	if _, pass, _ := r.Resolve("example.com"); pass != "r0tated" {
+		t.Fatalf("bad: %s", pass)
+	}
+}
+
+// testSecretResolver is a SecretResolver that returns credentials from a
+// map and records the hosts it was asked about.
+type testSecretResolver struct {
+	Secrets map[string][2]string
+	Err     bool
+	Hosts   []string
+
+	lock sync.Mutex
+}
+
+func (r *testSecretResolver) Resolve(host string) (string, string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.Hosts = append(r.Hosts, host)
+	if r.Err {
+		return "", "", fmt.Errorf("error")
+	}
+
+	v := r.Secrets[host]
+	return v[0], v[1], nil
+}
@@ -1,6 +1,7 @@
 package module
 
 import (
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -45,3 +46,65 @@ func TestGet_fileForced(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 }
+
+func TestGetScheme(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output string
+	}{
+		{"file:///foo", "file"},
+		{"git::https://github.com/hashicorp/foo.git", "git"},
+		{"https://example.com/foo", "https"},
+	}
+
+	for i, tc := range cases {
+		output := getScheme(tc.Input)
+		if output != tc.Output {
+			t.Fatalf("%d: bad: %s", i, output)
+		}
+	}
+}
+
+func TestGetDirSubdir(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Source string
+		SubDir string
+	}{
+		{"https://example.com/foo", "https://example.com/foo", ""},
+		{
+			"git::https://example.com/foo.git//bar/baz?ref=v1.0",
+			"git::https://example.com/foo.git?ref=v1.0",
+			"bar/baz",
+		},
+		{"file:///foo//bar", "file:///foo", "bar"},
+		{"file:///foo", "file:///foo", ""},
+	}
+
+	for i, tc := range cases {
+		source, subDir := getDirSubdir(tc.Input)
+		if source != tc.Source || subDir != tc.SubDir {
+			t.Fatalf("%d: bad: %s %s", i, source, subDir)
+		}
+	}
+}
+
+func TestGet_basicGetter(t *testing.T) {
+	Getters["basictest"] = new(testBasicGetter)
+	defer delete(Getters, "basictest")
+
+	// Getters that only implement Get always have an update available,
+	// and their sources aren't checked
+	if ok, err := UpdateAvailable(tempDir(t), "basictest::foo"); err != nil || !ok {
+		t.Fatalf("bad: %v %s", ok, err)
+	}
+	if err := Check("basictest::foo"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+// testBasicGetter is a Getter that only implements Get, like Getters from
+// outside this package that predate the optional interfaces.
+type testBasicGetter struct{}
+
+func (g *testBasicGetter) Get(string, *url.URL) error { return nil }
@@ -0,0 +1,357 @@
+package module
+
+import (
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTorrentFileTimeout is how long a TorrentGetter waits for a
+// .torrent file to download when its Timeout isn't set.
+const DefaultTorrentFileTimeout = 30 * time.Second
+
+// torrentInfoHashFile is the file within the destination directory that
+// records which infohash was downloaded there.
+const torrentInfoHashFile = ".terraform-torrent"
+
+// TorrentGetter is a Getter implementation that downloads a module with
+// BitTorrent, to spread the load of downloading large modules to many
+// machines between the machines themselves. The source is a magnet link,
+// or the URL of a .torrent file over HTTP or on local disk, with the
+// getter forced, examples:
+//
+//	source = "torrent::magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a"
+//	source = "torrent::https://example.com/modules/vpc.torrent"
+//
+// The content of the torrent is the module: either a directory, or a
+// single archive file that is unpacked just like with the file getter,
+// including the "archive_*" parameters.
+//
+// This package doesn't include a BitTorrent implementation, so Client
+// must be set to one first, for example:
+//
+//	module.Getters["torrent"] = &module.TorrentGetter{Client: client}
+//
+// Since the content of a torrent is identified by its infohash, a module
+// that was already downloaded for the same infohash is never downloaded
+// again.
+type TorrentGetter struct {
+	// Client downloads the content of the torrents. Without a Client,
+	// modules can't be downloaded.
+	Client TorrentClient
+
+	// Http, if set, downloads the .torrent files of HTTP and HTTPS
+	// sources, so that its certificate, proxy, credential and User-Agent
+	// settings apply. Otherwise the getter for the scheme in Getters is
+	// used if it is an HttpGetter.
+	Http *HttpGetter
+
+	// Timeout is the longest that downloading a .torrent file may take. If
+	// it isn't set, DefaultTorrentFileTimeout is used.
+	Timeout time.Duration
+}
+
+// TorrentClient is the interface that TorrentGetter uses to download the
+// content of torrents, so that any BitTorrent client library can be used.
+type TorrentClient interface {
+	// Download downloads the content of the torrent into the directory
+	// dir, which exists and is empty, returning once it is complete. The
+	// content is laid out as usual, so a torrent named "vpc" is in
+	// dir/vpc, whether it is a single file or a directory of files.
+	Download(dir string, t *Torrent) error
+}
+
+// Torrent is a torrent to download with a TorrentClient.
+type Torrent struct {
+	// InfoHash is the hex encoded infohash of the torrent, in lowercase.
+	InfoHash string
+
+	// Magnet is the magnet link for the torrent, if the source is one,
+	// and Metainfo is the content of the .torrent file otherwise.
+	Magnet   string
+	Metainfo []byte
+}
+
+func (g *TorrentGetter) Get(dst string, u *url.URL) error {
+	if g.Client == nil {
+		return fmt.Errorf("no BitTorrent client is configured for torrent sources")
+	}
+
+	t, err := g.torrent(u)
+	if err != nil {
+		return err
+	}
+
+	// The content can't change, so if we already have it we're done
+	if ok, err := g.updateAvailable(dst, t); err != nil {
+		return err
+	} else if !ok {
+		return nil
+	}
+
+	opts, err := getArchiveOptions(u)
+	if err != nil {
+		return err
+	}
+
+	td, err := newTempDir(dst, ".tf-torrent")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(td)
+
+	content := filepath.Join(td, "content")
+	if err := os.MkdirAll(content, 0755); err != nil {
+		return err
+	}
+	if err := g.Client.Download(content, t); err != nil {
+		return fmt.Errorf("error downloading torrent %s: %s", t.InfoHash, err)
+	}
+
+	// The content is a single directory or archive named after the torrent
+	fis, err := ioutil.ReadDir(content)
+	if err != nil {
+		return err
+	}
+	if len(fis) != 1 {
+		return fmt.Errorf(
+			"torrent %s must contain a single directory or archive", t.InfoHash)
+	}
+
+	root := filepath.Join(content, fis[0].Name())
+	if !fis[0].IsDir() {
+		d := getDecompressor(root)
+		if d == nil {
+			return fmt.Errorf(
+				"torrent %s must contain a single directory or archive",
+				t.InfoHash)
+		}
+
+		unpacked := filepath.Join(td, "unpacked")
+		if err := getArchive(unpacked, root, d, opts); err != nil {
+			return err
+		}
+		root = unpacked
+	}
+
+	if err := ioutil.WriteFile(
+		filepath.Join(root, torrentInfoHashFile), []byte(t.InfoHash), 0644); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+
+	return moveDir(dst, root)
+}
+
+func (g *TorrentGetter) UpdateAvailable(dst string, u *url.URL) (bool, error) {
+	t, err := g.torrent(u)
+	if err != nil {
+		return false, err
+	}
+
+	return g.updateAvailable(dst, t)
+}
+
+func (g *TorrentGetter) Check(u *url.URL) error {
+	if g.Client == nil {
+		return fmt.Errorf("no BitTorrent client is configured for torrent sources")
+	}
+
+	_, err := g.torrent(u)
+	return err
+}
+
+// updateAvailable returns whether dst doesn't have the content of t.
+func (g *TorrentGetter) updateAvailable(dst string, t *Torrent) (bool, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dst, torrentInfoHashFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+
+		return false, err
+	}
+
+	return strings.TrimSpace(string(data)) != t.InfoHash, nil
+}
+
+// torrent returns the torrent for the URL, reading the .torrent file if
+// the URL isn't a magnet link.
+func (g *TorrentGetter) torrent(u *url.URL) (*Torrent, error) {
+	var data []byte
+	switch u.Scheme {
+	case "magnet":
+		hash, err := magnetInfoHash(u)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Torrent{InfoHash: hash, Magnet: u.String()}, nil
+	case "file":
+		var err error
+		data, err = ioutil.ReadFile(u.Path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading torrent file: %s", err)
+		}
+	case "http", "https":
+		timeout := g.Timeout
+		if timeout == 0 {
+			timeout = DefaultTorrentFileTimeout
+		}
+
+		var err error
+		data, err = g.httpGetter(u.Scheme).download(u, timeout)
+		if err != nil {
+			return nil, fmt.Errorf("error downloading torrent file: %s", err)
+		}
+	default:
+		return nil, fmt.Errorf(
+			"torrent source must be a magnet link or the URL of a .torrent "+
+				"file, not %s", u.Scheme)
+	}
+
+	info, err := bencodeInfo(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid torrent file: %s", err)
+	}
+	sum := sha1.Sum(info)
+
+	return &Torrent{InfoHash: hex.EncodeToString(sum[:]), Metainfo: data}, nil
+}
+
+// httpGetter returns the HttpGetter to download .torrent files with over
+// the scheme.
+func (g *TorrentGetter) httpGetter(scheme string) *HttpGetter {
+	if g.Http != nil {
+		return g.Http
+	}
+	if hg, ok := Getters[scheme].(*HttpGetter); ok {
+		return hg
+	}
+
+	return new(HttpGetter)
+}
+
+// magnetInfoHash returns the hex encoded infohash of the magnet link,
+// which can be encoded in either hex or base32.
+func magnetInfoHash(u *url.URL) (string, error) {
+	for _, xt := range u.Query()["xt"] {
+		if !strings.HasPrefix(xt, "urn:btih:") {
+			continue
+		}
+
+		hash := xt[len("urn:btih:"):]
+		switch len(hash) {
+		case 40:
+			if _, err := hex.DecodeString(hash); err == nil {
+				return strings.ToLower(hash), nil
+			}
+		case 32:
+			if data, err := base32.StdEncoding.DecodeString(
+				strings.ToUpper(hash)); err == nil {
+				return hex.EncodeToString(data), nil
+			}
+		}
+
+		return "", fmt.Errorf("invalid infohash in magnet link: %s", hash)
+	}
+
+	return "", fmt.Errorf("magnet link must have a BitTorrent infohash")
+}
+
+// bencodeInfo returns the bencoded "info" dictionary within the bencoded
+// metainfo of a .torrent file, exactly as it is in data, which the
+// infohash is computed from.
+func bencodeInfo(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != 'd' {
+		return nil, fmt.Errorf("metainfo must be a dictionary")
+	}
+
+	i := 1
+	for i < len(data) && data[i] != 'e' {
+		key, next, err := bencodeString(data, i)
+		if err != nil {
+			return nil, err
+		}
+
+		end, err := bencodeSkip(data, next)
+		if err != nil {
+			return nil, err
+		}
+		if key == "info" {
+			return data[next:end], nil
+		}
+
+		i = end
+	}
+
+	return nil, fmt.Errorf("metainfo has no info dictionary")
+}
+
+// bencodeString parses the bencoded string at data[i:], returning it and
+// the index just past it.
+func bencodeString(data []byte, i int) (string, int, error) {
+	colon := i
+	for colon < len(data) && data[colon] >= '0' && data[colon] <= '9' {
+		colon++
+	}
+	if colon == i || colon >= len(data) || data[colon] != ':' {
+		return "", 0, fmt.Errorf("invalid string at offset %d", i)
+	}
+
+	n, err := strconv.Atoi(string(data[i:colon]))
+	if err != nil || n > len(data)-colon-1 {
+		return "", 0, fmt.Errorf("invalid string at offset %d", i)
+	}
+
+	end := colon + 1 + n
+	return string(data[colon+1 : end]), end, nil
+}
+
+// bencodeSkip returns the index just past the bencoded value at data[i:].
+func bencodeSkip(data []byte, i int) (int, error) {
+	if i >= len(data) {
+		return 0, fmt.Errorf("unexpected end of data")
+	}
+
+	switch c := data[i]; {
+	case c == 'i':
+		for j := i + 1; j < len(data); j++ {
+			if data[j] == 'e' {
+				return j + 1, nil
+			}
+		}
+
+		return 0, fmt.Errorf("unterminated integer at offset %d", i)
+	case c == 'l' || c == 'd':
+		j := i + 1
+		for j < len(data) && data[j] != 'e' {
+			var err error
+			j, err = bencodeSkip(data, j)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if j >= len(data) {
+			return 0, fmt.Errorf("unterminated %c at offset %d", c, i)
+		}
+
+		return j + 1, nil
+	case c >= '0' && c <= '9':
+		_, end, err := bencodeString(data, i)
+		return end, err
+	default:
+		return 0, fmt.Errorf("invalid value at offset %d", i)
+	}
+}
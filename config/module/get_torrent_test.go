@@ -0,0 +1,256 @@
+package module
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testTorrentInfoHash = "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"
+
+func TestTorrentGetter_impl(t *testing.T) {
+	var _ Getter = new(TorrentGetter)
+}
+
+func TestTorrentGetter(t *testing.T) {
+	client := &testTorrentClient{Content: filepath.Join(fixtureDir, "basic")}
+	g := &TorrentGetter{Client: client}
+	dst := tempDir(t)
+
+	u, err := url.Parse("magnet:?xt=urn:btih:" + testTorrentInfoHash + "&dn=basic")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Get it!
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Verify the main file exists
+	mainPath := filepath.Join(dst, "main.tf")
+	if _, err := os.Stat(mainPath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(client.Torrents) != 1 || client.Torrents[0].InfoHash != testTorrentInfoHash {
+		t.Fatalf("bad: %#v", client.Torrents)
+	}
+	if client.Torrents[0].Magnet != u.String() {
+		t.Fatalf("bad: %#v", client.Torrents[0])
+	}
+
+	// Getting again shouldn't download anything
+	if ok, err := g.UpdateAvailable(dst, u); err != nil || ok {
+		t.Fatalf("bad: %v %s", ok, err)
+	}
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(client.Torrents) != 1 {
+		t.Fatalf("bad: %d", len(client.Torrents))
+	}
+}
+
+func TestTorrentGetter_archive(t *testing.T) {
+	client := &testTorrentClient{
+		Content: filepath.Join(fixtureDir, "archive-exec.tar"),
+	}
+	g := &TorrentGetter{Client: client}
+	dst := tempDir(t)
+
+	u, err := url.Parse(
+		"magnet:?xt=urn:btih:" + testTorrentInfoHash + "&archive_mode=normalize")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	testFileExecutable(t, filepath.Join(dst, "scripts", "setup.sh"), true)
+	fi, err := os.Stat(filepath.Join(dst, "README.md"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if fi.Mode().Perm() != 0644 {
+		t.Fatalf("bad: %s", fi.Mode())
+	}
+}
+
+func TestTorrentGetter_file(t *testing.T) {
+	client := &testTorrentClient{Content: filepath.Join(fixtureDir, "basic")}
+	g := &TorrentGetter{Client: client}
+
+	dir := tempDir(t)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	info := "d6:lengthi8e4:name5:basic12:piece lengthi16384ee"
+	path := filepath.Join(dir, "basic.torrent")
+	testWriteFile(t, path,
+		"d8:announce20:http://example.com/a4:info"+info+"7:privatei1ee")
+
+	u := &url.URL{Scheme: "file", Path: path}
+	if err := g.Get(filepath.Join(dir, "dst"), u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	sum := sha1.Sum([]byte(info))
+	expected := hex.EncodeToString(sum[:])
+	if len(client.Torrents) != 1 || client.Torrents[0].InfoHash != expected {
+		t.Fatalf("bad: %#v", client.Torrents)
+	}
+	if len(client.Torrents[0].Metainfo) == 0 {
+		t.Fatalf("bad: %#v", client.Torrents[0])
+	}
+
+	// A file that isn't a torrent can't be downloaded
+	testWriteFile(t, path, "d8:announce20:http://example.com/a")
+	if err := g.Check(u); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestTorrentGetter_http(t *testing.T) {
+	info := "d6:lengthi8e4:name5:basic12:piece lengthi16384ee"
+	done := make(chan struct{})
+	var agent string
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/basic.torrent":
+				agent = r.Header.Get("User-Agent")
+				w.Write([]byte("d4:info" + info + "e"))
+			case "/slow.torrent":
+				<-done
+			default:
+				w.WriteHeader(404)
+			}
+		}))
+	defer server.Close()
+	defer close(done)
+
+	client := &testTorrentClient{Content: filepath.Join(fixtureDir, "basic")}
+	g := &TorrentGetter{
+		Client:  client,
+		Http:    &HttpGetter{UserAgent: "test-agent"},
+		Timeout: 50 * time.Millisecond,
+	}
+
+	u, err := url.Parse(server.URL + "/basic.torrent")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := g.Get(tempDir(t), u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	sum := sha1.Sum([]byte(info))
+	if len(client.Torrents) != 1 || client.Torrents[0].InfoHash != hex.EncodeToString(sum[:]) {
+		t.Fatalf("bad: %#v", client.Torrents)
+	}
+	if agent != "test-agent" {
+		t.Fatalf("bad: %s", agent)
+	}
+
+	// A server that never answers times out
+	u, err = url.Parse(server.URL + "/slow.torrent")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := g.Check(u); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestTorrentGetter_noClient(t *testing.T) {
+	u, err := url.Parse("magnet:?xt=urn:btih:" + testTorrentInfoHash)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	g := new(TorrentGetter)
+	if err := g.Get(tempDir(t), u); err == nil {
+		t.Fatal("should error")
+	}
+	if err := g.Check(u); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestMagnetInfoHash(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output string
+		Err    bool
+	}{
+		{
+			"magnet:?xt=urn:btih:C12FE1C06BBA254A9DC9F519B335AA7C1367A88A",
+			testTorrentInfoHash,
+			false,
+		},
+		{
+			"magnet:?dn=vpc&xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK",
+			testTorrentInfoHash,
+			false,
+		},
+		{
+			"magnet:?xt=urn:sha1:YNCKHTQCWBTRNJIV4WNAE52SJUQCZO5C&xt=urn:btih:" +
+				testTorrentInfoHash,
+			testTorrentInfoHash,
+			false,
+		},
+		{"magnet:?xt=urn:btih:c12fe1c06bba", "", true},
+		{"magnet:?xt=urn:sha1:YNCKHTQCWBTRNJIV4WNAE52SJUQCZO5C", "", true},
+		{"magnet:?dn=vpc", "", true},
+	}
+
+	for _, tc := range cases {
+		u, err := url.Parse(tc.Input)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		output, err := magnetInfoHash(u)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if output != tc.Output {
+			t.Fatalf("%s: bad: %s", tc.Input, output)
+		}
+	}
+}
+
+// testTorrentClient is a TorrentClient that "downloads" the file or
+// directory at Content, and records the torrents it was asked for.
+type testTorrentClient struct {
+	Content  string
+	Torrents []*Torrent
+}
+
+func (c *testTorrentClient) Download(dir string, t *Torrent) error {
+	c.Torrents = append(c.Torrents, t)
+
+	dst := filepath.Join(dir, filepath.Base(c.Content))
+	fi, err := os.Stat(c.Content)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return copyDir(dst, c.Content)
+	}
+
+	data, err := ioutil.ReadFile(c.Content)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(dst, data, 0644)
+}
@@ -0,0 +1,119 @@
+package module
+
+import (
+	"strings"
+)
+
+// ModuleAction is what loading did to get a module into the storage.
+type ModuleAction byte
+
+const (
+	// ModuleActionNone means the module wasn't got, because the tree was
+	// loaded with GetModeNone, so it was loaded from the storage as is.
+	ModuleActionNone ModuleAction = iota
+
+	// ModuleActionGot means the module was got by a Storage that doesn't
+	// implement ActionStorage, so nothing more is known.
+	ModuleActionGot
+
+	// ModuleActionSkipped means the module was already in the storage
+	// and wasn't updated, so nothing was downloaded.
+	ModuleActionSkipped
+
+	// ModuleActionDownloaded means the module wasn't in the storage and
+	// was downloaded from its source.
+	ModuleActionDownloaded
+
+	// ModuleActionUpdated means the module was in the storage and was
+	// downloaded from its source again to update it.
+	ModuleActionUpdated
+
+	// ModuleActionCached means the module wasn't in the storage and was
+	// copied from the Cache of the storage instead of its source.
+	ModuleActionCached
+
+	// ModuleActionMirrored means the module wasn't in the storage and was
+	// copied from the mirror of the storage instead of its source.
+	ModuleActionMirrored
+
+	// ModuleActionUnchanged means the module was in the storage and was
+	// being updated, but its source was found to be unchanged without
+	// downloading it, so it was kept as is.
+	ModuleActionUnchanged
+)
+
+func (a ModuleAction) String() string {
+	switch a {
+	case ModuleActionNone:
+		return "none"
+	case ModuleActionGot:
+		return "got"
+	case ModuleActionSkipped:
+		return "skipped"
+	case ModuleActionDownloaded:
+		return "downloaded"
+	case ModuleActionUpdated:
+		return "updated"
+	case ModuleActionCached:
+		return "cached"
+	case ModuleActionMirrored:
+		return "mirrored"
+	case ModuleActionUnchanged:
+		return "unchanged"
+	default:
+		return "unknown"
+	}
+}
+
+// ModuleReport records how a module was loaded.
+type ModuleReport struct {
+	// Source is the source that the module was got from, after it was
+	// detected and resolved with pins, constraints and the lock file.
+	Source string
+
+	// Version is the version or ref that Source is pinned to, such as the
+	// "ref" of a git source, or blank if it isn't pinned.
+	Version string
+
+	// Dir is the directory in the storage that the module was loaded
+	// from.
+	Dir string
+
+	// Action is what was done to get the module into the storage.
+	Action ModuleAction
+}
+
+// LoadReport returns how each module in the tree was loaded by the last
+// load, keyed by the full path of the module (the module names from the
+// root joined by "."), such as whether it was downloaded or was already in
+// the storage. This answers why a load downloaded a module without having
+// to read its logs. Modules that share a source within a configuration are
+// only got once, so they share the same Action.
+//
+// The result is nil if the tree isn't loaded. Modules that weren't loaded,
+// such as those outside of the prefix of LoadSubtree, aren't included.
+func (t *Tree) LoadReport() map[string]ModuleReport {
+	if !t.Loaded() {
+		return nil
+	}
+
+	result := make(map[string]ModuleReport)
+	t.walkModules(func(path []string, parent *Tree, m *Module) error {
+		c, ok := parent.Children()[m.Name]
+		if !ok {
+			return nil
+		}
+
+		_, version := sourceVersion(c.origin)
+		result[strings.Join(path, ".")] = ModuleReport{
+			Source:  c.origin,
+			Version: version,
+			Dir:     c.config.Dir,
+			Action:  c.action,
+		}
+
+		return nil
+	})
+
+	return result
+}
@@ -0,0 +1,78 @@
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTreeLoadReport(t *testing.T) {
+	old := Getters["http"]
+	defer func() { Getters["http"] = old }()
+	Getters["http"] = new(testCacheGetter)
+
+	server := testCacheServer()
+	defer server.Close()
+	cache := &HttpCache{URL: server.URL}
+
+	dir := tempDir(t)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testWriteFile(t, filepath.Join(dir, "main.tf"), `
+module "foo" {
+    source = "http://example.com/foo?ref=v1.0.0"
+}
+`)
+	tree, err := NewTreeModule("", dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if tree.LoadReport() != nil {
+		t.Fatal("should be nil")
+	}
+
+	s := &FolderStorage{StorageDir: tempDir(t), Cache: cache}
+	cases := []struct {
+		Storage Storage
+		Mode    GetMode
+		Action  ModuleAction
+	}{
+		{s, GetModeGet, ModuleActionDownloaded},
+		{s, GetModeGet, ModuleActionSkipped},
+		{s, GetModeUpdate, ModuleActionUpdated},
+		{s, GetModeNone, ModuleActionNone},
+		{&FolderStorage{StorageDir: tempDir(t), Cache: cache}, GetModeGet, ModuleActionCached},
+		{testStorageOnly{testStorage(t)}, GetModeGet, ModuleActionGot},
+	}
+
+	for i, tc := range cases {
+		if err := tree.Load(tc.Storage, tc.Mode); err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+
+		report := tree.LoadReport()
+		if len(report) != 1 {
+			t.Fatalf("%d: bad: %#v", i, report)
+		}
+
+		r := report["foo"]
+		if r.Action != tc.Action {
+			t.Fatalf("%d: bad: %s", i, r.Action)
+		}
+		if r.Source != "http://example.com/foo?ref=v1.0.0" {
+			t.Fatalf("%d: bad: %s", i, r.Source)
+		}
+		if r.Version != "v1.0.0" {
+			t.Fatalf("%d: bad: %s", i, r.Version)
+		}
+		if _, err := os.Stat(filepath.Join(r.Dir, "main.tf")); err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+	}
+}
+
+// testStorageOnly hides every method of a Storage beyond Storage itself.
+type testStorageOnly struct {
+	Storage
+}
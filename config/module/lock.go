@@ -0,0 +1,66 @@
+package module
+
+import (
+	"log"
+	"os"
+	"sync"
+)
+
+// pathLocks are the locks held by this process, by path. They make sure
+// that the same path is never locked twice within the process, even on
+// systems where the file lock can't be taken.
+var pathLocks = make(map[string]*pathLock)
+var pathLocksLock sync.Mutex
+
+type pathLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lockPath takes an exclusive advisory lock on the file at path, which is
+// created if it doesn't exist, waiting for any other holder of the lock in
+// this or any other process to release it first. The returned function
+// releases the lock.
+//
+// The file is left in place afterwards since removing it would race with
+// others waiting for the lock. If the file can't be locked, for example
+// because the file system doesn't support locks, a warning is logged and
+// only other lockers within this process are waited for.
+func lockPath(path string) (func(), error) {
+	pathLocksLock.Lock()
+	l, ok := pathLocks[path]
+	if !ok {
+		l = new(pathLock)
+		pathLocks[path] = l
+	}
+	l.refs++
+	pathLocksLock.Unlock()
+
+	l.Lock()
+	unlock := func() {
+		l.Unlock()
+
+		pathLocksLock.Lock()
+		defer pathLocksLock.Unlock()
+		l.refs--
+		if l.refs == 0 {
+			delete(pathLocks, path)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		log.Printf("[WARN] module: can't lock %s, only waiting for "+
+			"this process: %s", path, err)
+	}
+
+	return func() {
+		// Closing the file releases the file lock
+		f.Close()
+		unlock()
+	}, nil
+}
@@ -0,0 +1,16 @@
+// +build !darwin,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package module
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// lockFile always fails on systems without a supported file lock, so that
+// lockPath warns that only other lockers within this process are waited
+// for.
+func lockFile(f *os.File) error {
+	return fmt.Errorf("file locks aren't supported on %s", runtime.GOOS)
+}
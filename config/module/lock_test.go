@@ -0,0 +1,54 @@
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockPath(t *testing.T) {
+	dir := tempDir(t)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	path := filepath.Join(dir, "lock")
+
+	unlock, err := lockPath(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	locked := make(chan struct{})
+	unlocked := make(chan struct{})
+	go func() {
+		defer close(unlocked)
+		unlock, err := lockPath(path)
+		if err != nil {
+			t.Errorf("err: %s", err)
+			return
+		}
+		close(locked)
+		unlock()
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("should wait for the lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("should get the lock")
+	}
+	<-unlocked
+
+	pathLocksLock.Lock()
+	defer pathLocksLock.Unlock()
+	if len(pathLocks) != 0 {
+		t.Fatalf("bad: %#v", pathLocks)
+	}
+}
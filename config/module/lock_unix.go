@@ -0,0 +1,14 @@
+// +build darwin freebsd linux netbsd openbsd
+
+package module
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on the open file, waiting until it is
+// available. The lock is released when the file is closed.
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
@@ -0,0 +1,30 @@
+// +build windows
+
+package module
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32   = syscall.MustLoadDLL("kernel32.dll")
+	lockFileEx = kernel32.MustFindProc("LockFileEx")
+)
+
+const lockfileExclusiveLock = 2
+
+// lockFile takes an exclusive lock on the open file, waiting until it is
+// available. The lock is released when the file is closed.
+func lockFile(f *os.File) error {
+	// See: http://msdn.microsoft.com/en-us/library/windows/desktop/aa365203(v=vs.85).aspx
+	var ol syscall.Overlapped
+	r, _, err := lockFileEx.Call(
+		f.Fd(), lockfileExclusiveLock, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
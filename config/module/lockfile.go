@@ -0,0 +1,91 @@
+package module
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Lockfile records the exact source that every module in a tree was
+// resolved to, so that the tree can be loaded again with exactly the same
+// modules using Tree.LoadFromLock.
+type Lockfile struct {
+	// Modules maps module paths, the module names from the root joined by
+	// ".", to the detected source of each module, pinned to an exact
+	// version such as a commit or a registry version like "1.2.3".
+	Modules map[string]string `json:"modules"`
+}
+
+// LoadLockfile reads the lock file at path. The file is JSON, example:
+//
+//	{
+//	    "modules": {
+//	        "vpc": "git::https://github.com/hashicorp/example.git?ref=9f3c...",
+//	        "vpc.subnets": "registry::registry.example.com/hashicorp/subnets/aws?version=1.2.3"
+//	    }
+//	}
+func LoadLockfile(path string) (*Lockfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var result Lockfile
+	if err := json.NewDecoder(f).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error reading lock file %s: %s", path, err)
+	}
+
+	return &result, nil
+}
+
+// source returns the locked source for the module at path, whose source
+// in the configuration detects to configured. It is an error if the module
+// isn't in the lock, or if the configuration has changed so that the
+// locked source no longer satisfies it, since the lock needs to be
+// refreshed then.
+func (l *Lockfile) source(path []string, configured string) (string, error) {
+	key := strings.Join(path, ".")
+	locked, ok := l.Modules[key]
+	if !ok {
+		return "", fmt.Errorf(
+			"not in the lock file, the lock file must be refreshed")
+	}
+	if msg := lintPinned(locked); msg != "" {
+		return "", fmt.Errorf("locked source %s: %s", locked, msg)
+	}
+
+	base, v := sourceVersion(configured)
+	lockedBase, lockedV := sourceVersion(locked)
+	if base != lockedBase {
+		return "", fmt.Errorf(
+			"source %s doesn't match the locked source %s, "+
+				"the lock file must be refreshed", base, lockedBase)
+	}
+	if v == "" || v == lockedV {
+		return locked, nil
+	}
+
+	// Registry versions are constraints that the locked version must
+	// satisfy. Other versions are refs, and only refs that are versions,
+	// such as tags, must match exactly since branches move.
+	if getScheme(configured) == "registry" {
+		c, err := parseVersionConstraint(v)
+		if err != nil {
+			return "", err
+		}
+		parsed, err := parseVersion(lockedV)
+		if err != nil || !c.Check(parsed) {
+			return "", fmt.Errorf(
+				"locked version %s doesn't satisfy %s, "+
+					"the lock file must be refreshed", lockedV, v)
+		}
+	} else if _, err := parseVersion(v); err == nil {
+		return "", fmt.Errorf(
+			"source is pinned to %s but is locked to %s, "+
+				"the lock file must be refreshed", v, lockedV)
+	}
+
+	return locked, nil
+}
@@ -0,0 +1,117 @@
+package module
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadLockfile(t *testing.T) {
+	actual, err := LoadLockfile(filepath.Join(fixtureDir, "lockfile.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &Lockfile{
+		Modules: map[string]string{
+			"foo":     "git::https://example.com/foo.git?ref=v1.2.0",
+			"foo.bar": "registry::registry.example.com/hashicorp/bar/aws?version=1.2.3",
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestLockfileSource(t *testing.T) {
+	lock := &Lockfile{
+		Modules: map[string]string{
+			"git":        "git::https://example.com/foo.git?ref=v1.2.0",
+			"registry":   "registry::registry.example.com/hashicorp/bar/aws?version=1.2.3",
+			"unpinned":   "git::https://example.com/foo.git",
+			"registry.x": "registry::registry.example.com/hashicorp/bar/aws?version=2.0.0",
+		},
+	}
+
+	cases := []struct {
+		Path       string
+		Configured string
+		Err        string
+	}{
+		{"git", "git::https://example.com/foo.git", ""},
+		{"git", "git::https://example.com/foo.git?ref=master", ""},
+		{"git", "git::https://example.com/foo.git?ref=v1.2.0", ""},
+		{
+			"git",
+			"git::https://example.com/foo.git?ref=v1.3.0",
+			"pinned to v1.3.0 but is locked to v1.2.0",
+		},
+		{
+			"git",
+			"git::https://example.com/other.git",
+			"doesn't match the locked source",
+		},
+		{
+			"registry",
+			"registry::registry.example.com/hashicorp/bar/aws?version=~%3E+1.2",
+			"",
+		},
+		{
+			"registry.x",
+			"registry::registry.example.com/hashicorp/bar/aws?version=~%3E+1.2",
+			"doesn't satisfy",
+		},
+		{"unpinned", "git::https://example.com/foo.git", "not pinned"},
+		{"missing", "git::https://example.com/foo.git", "not in the lock file"},
+	}
+
+	for _, tc := range cases {
+		actual, err := lock.source(strings.Split(tc.Path, "."), tc.Configured)
+		if tc.Err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.Err) {
+				t.Fatalf("%s %s: bad: %v", tc.Path, tc.Configured, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s %s: err: %s", tc.Path, tc.Configured, err)
+		}
+		if actual != lock.Modules[tc.Path] {
+			t.Fatalf("%s %s: bad: %s", tc.Path, tc.Configured, actual)
+		}
+	}
+}
+
+func TestTreeLoadFromLock(t *testing.T) {
+	pwd, err := filepath.Abs(filepath.Join(fixtureDir, "basic"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	source, err := Detect("./foo", pwd)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	storage := testStorage(t)
+	tree := NewTree("", testConfig(t, "basic"))
+	lock := &Lockfile{Modules: map[string]string{"foo": source}}
+	if err := tree.LoadFromLock(storage, lock); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(tree.String())
+	expected := strings.TrimSpace(treeLoadStr)
+	if actual != expected {
+		t.Fatalf("bad: \n\n%s", actual)
+	}
+
+	// Modules that aren't locked need the lock to be refreshed
+	err = tree.LoadFromLock(storage, &Lockfile{})
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "module foo: not in the lock file") {
+		t.Fatalf("bad: %s", err)
+	}
+}
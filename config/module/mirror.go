@@ -0,0 +1,111 @@
+package module
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The mirror of a FolderStorage keeps every version of each module that
+// was downloaded from its source, laid out to be browsed by hand:
+//
+//	<MirrorDir>/<name>/.source
+//	<MirrorDir>/<name>/.latest
+//	<MirrorDir>/<name>/<version>/...
+//
+// The name is given by FolderNamingReadable, and .source holds the source
+// since it can't be derived from the name. Each version is named after the
+// ModuleChecksum of the module, such as "sha256-2cf24dba...", so the same
+// contents are only kept once and a copy can be verified against its name.
+// .latest names the version that was downloaded most recently.
+
+// mirrorPut copies the module that was downloaded from the source into dir
+// into the mirror, if that version isn't there already.
+func (s *FolderStorage) mirrorPut(source, dir string) error {
+	sum, err := ModuleChecksum(dir)
+	if err != nil {
+		return err
+	}
+
+	name := s.mirrorName(source)
+	version := mirrorVersion(sum)
+	if err := os.MkdirAll(name, 0755); err != nil {
+		return err
+	}
+
+	target := filepath.Join(name, version)
+	if _, err := os.Stat(target); os.IsNotExist(err) {
+		td, err := ioutil.TempDir(name, ".tmp")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(td)
+
+		tmp := filepath.Join(td, "module")
+		if err := copyDir(tmp, dir); err != nil {
+			return err
+		}
+
+		// Another storage sharing the mirror may have just added it
+		if err := os.Rename(tmp, target); err != nil {
+			if _, serr := os.Stat(target); serr != nil {
+				return err
+			}
+		}
+	} else if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(
+		filepath.Join(name, ".source"), []byte(source), 0644)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(
+		filepath.Join(name, ".latest"), []byte(version), 0644)
+}
+
+// mirrorGet copies the latest version of the source in the mirror into
+// dst. It returns false if the mirror doesn't have the source.
+func (s *FolderStorage) mirrorGet(dst, source string) (bool, error) {
+	name := s.mirrorName(source)
+	data, err := ioutil.ReadFile(filepath.Join(name, ".latest"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	version := strings.TrimSpace(string(data))
+	if err := copyDir(dst, filepath.Join(name, version)); err != nil {
+		return false, err
+	}
+
+	// The mirror is meant to be browsed, so make sure nobody edited it
+	sum, err := ModuleChecksum(dst)
+	if err != nil {
+		return false, err
+	}
+	if mirrorVersion(sum) != version {
+		return false, fmt.Errorf(
+			"mirrored module %s doesn't match its checksum",
+			filepath.Join(name, version))
+	}
+
+	return true, nil
+}
+
+// mirrorName returns the directory for the source within the mirror.
+func (s *FolderStorage) mirrorName(source string) string {
+	return filepath.Join(s.MirrorDir, FolderNamingReadable(source))
+}
+
+// mirrorVersion returns the name of the version of a module within the
+// mirror, given its ModuleChecksum.
+func mirrorVersion(sum string) string {
+	return strings.Replace(sum, ":", "-", 1)
+}
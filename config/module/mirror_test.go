@@ -0,0 +1,195 @@
+package module
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFolderStorage_mirror(t *testing.T) {
+	g := &testVersionGetter{Version: "1"}
+	Getters["mirrortest"] = g
+	defer delete(Getters, "mirrortest")
+
+	mirror := tempDir(t)
+	module := "mirrortest://example.com/foo"
+	name := filepath.Join(mirror, FolderNamingReadable(module))
+
+	s := &FolderStorage{StorageDir: tempDir(t), MirrorDir: mirror}
+	if err := s.Get(module, false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Getting it again doesn't download it, so nothing changes
+	if err := s.Get(module, false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	g.Version = "2"
+	if err := s.Get(module, true); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Both versions are kept
+	fis, err := ioutil.ReadDir(name)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var versions []string
+	for _, fi := range fis {
+		if fi.IsDir() {
+			versions = append(versions, fi.Name())
+		}
+	}
+	if len(versions) != 2 {
+		t.Fatalf("bad: %#v", versions)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(name, ".source"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != module {
+		t.Fatalf("bad: %s", data)
+	}
+
+	latest, err := ioutil.ReadFile(filepath.Join(name, ".latest"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	data, err = ioutil.ReadFile(filepath.Join(name, string(latest), "main.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "# 2\n" {
+		t.Fatalf("bad: %s", data)
+	}
+	if g.Calls != 2 {
+		t.Fatalf("bad: %d", g.Calls)
+	}
+}
+
+func TestFolderStorage_mirrorPrefer(t *testing.T) {
+	g := &testVersionGetter{Version: "1"}
+	Getters["mirrortest"] = g
+	defer delete(Getters, "mirrortest")
+
+	mirror := tempDir(t)
+	module := "mirrortest://example.com/foo"
+
+	s := &FolderStorage{StorageDir: tempDir(t), MirrorDir: mirror}
+	if err := s.Get(module, false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Another storage preferring the mirror doesn't download it
+	g.Version = "2"
+	s = &FolderStorage{
+		StorageDir:   tempDir(t),
+		MirrorDir:    mirror,
+		PreferMirror: true,
+	}
+	action, err := s.GetAction(module, false, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if action != ModuleActionMirrored {
+		t.Fatalf("bad: %s", action)
+	}
+	if g.Calls != 1 {
+		t.Fatalf("bad: %d", g.Calls)
+	}
+
+	dir, _, err := s.Dir(module)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "main.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "# 1\n" {
+		t.Fatalf("bad: %s", data)
+	}
+
+	// Updates always go to the source
+	if err := s.Get(module, true); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if g.Calls != 2 {
+		t.Fatalf("bad: %d", g.Calls)
+	}
+}
+
+func TestFolderStorage_mirrorModified(t *testing.T) {
+	g := &testVersionGetter{Version: "1"}
+	Getters["mirrortest"] = g
+	defer delete(Getters, "mirrortest")
+
+	mirror := tempDir(t)
+	module := "mirrortest://example.com/foo"
+
+	s := &FolderStorage{StorageDir: tempDir(t), MirrorDir: mirror}
+	if err := s.Get(module, false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A mirrored copy that was changed is ignored
+	name := filepath.Join(mirror, FolderNamingReadable(module))
+	latest, err := ioutil.ReadFile(filepath.Join(name, ".latest"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testWriteFile(t, filepath.Join(name, string(latest), "main.tf"), "# bad\n")
+
+	s = &FolderStorage{
+		StorageDir:   tempDir(t),
+		MirrorDir:    mirror,
+		PreferMirror: true,
+	}
+	action, err := s.GetAction(module, false, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if action != ModuleActionDownloaded {
+		t.Fatalf("bad: %s", action)
+	}
+	if g.Calls != 2 {
+		t.Fatalf("bad: %d", g.Calls)
+	}
+}
+
+func TestFolderStorage_mirrorFile(t *testing.T) {
+	mirror := tempDir(t)
+	s := &FolderStorage{StorageDir: tempDir(t), MirrorDir: mirror}
+	if err := s.Get(testModule("basic"), false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Local files aren't mirrored
+	if _, err := os.Stat(mirror); !os.IsNotExist(err) {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+// testVersionGetter is a Getter that writes a configuration with the
+// current Version in it and counts how many times it was called.
+type testVersionGetter struct {
+	testGetter
+
+	Version string
+	Calls   int
+}
+
+func (g *testVersionGetter) Get(dst string, u *url.URL) error {
+	g.Calls++
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(
+		filepath.Join(dst, "main.tf"), []byte("# "+g.Version+"\n"), 0644)
+}
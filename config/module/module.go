@@ -1,7 +1,38 @@
 package module
 
+import (
+	"fmt"
+	"regexp"
+)
+
 // Module represents the metadata for a single module.
 type Module struct {
 	Name   string
 	Source string
 }
+
+// moduleSort implements sort.Interface to sort modules by name.
+type moduleSort []*Module
+
+func (s moduleSort) Len() int           { return len(s) }
+func (s moduleSort) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s moduleSort) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// ModuleNamePattern is the pattern that the names of modules must match.
+// The names are used to reference the outputs of modules, as in
+// "${module.name.output}", and to build the paths of modules within a
+// tree, "parent.name", so they're limited to what works for both.
+const ModuleNamePattern = `^[A-Za-z_][A-Za-z0-9_-]*$`
+
+var moduleNameRegexp = regexp.MustCompile(ModuleNamePattern)
+
+// checkModuleName returns an error if the name isn't a valid module name.
+func checkModuleName(name string) error {
+	if !moduleNameRegexp.MatchString(name) {
+		return fmt.Errorf(
+			"module %q: invalid name, module names must match %s",
+			name, ModuleNamePattern)
+	}
+
+	return nil
+}
@@ -0,0 +1,27 @@
+package module
+
+import (
+	"strings"
+)
+
+// sourceSecrets returns the resolvers from secrets, which maps module
+// paths to resolvers as described by LoadOptions.Secrets, for the sources
+// of the given modules of the tree. Modules that share a source are only
+// downloaded once, so the resolver of the first of them is used.
+func (t *Tree) sourceSecrets(
+	secrets map[string]SecretResolver,
+	modules []*Module, sources map[string]string) map[string]SecretResolver {
+	result := make(map[string]SecretResolver)
+	for _, m := range modules {
+		r, ok := secrets[strings.Join(t.childPath(m.Name), ".")]
+		if !ok || r == nil {
+			continue
+		}
+
+		if _, ok := result[sources[m.Name]]; !ok {
+			result[sources[m.Name]] = r
+		}
+	}
+
+	return result
+}
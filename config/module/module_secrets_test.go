@@ -0,0 +1,126 @@
+package module
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTreeLoad_moduleSecrets(t *testing.T) {
+	// The same host serves a module for each user
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			user, _, _ := r.BasicAuth()
+			if "/"+user != r.URL.Path {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			testHttpHandlerHeader(w, r)
+		}))
+	defer server.Close()
+
+	oldGetter := Getters["http"]
+	defer func() { Getters["http"] = oldGetter }()
+
+	host := server.Listener.Addr().String()
+	Getters["http"] = &HttpGetter{
+		Secrets: &testSecretResolver{
+			Secrets: map[string][2]string{host: {"public", ""}},
+		},
+	}
+
+	dir := tempDir(t)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testWriteFile(t, filepath.Join(dir, "main.tf"), fmt.Sprintf(`
+module "private" {
+    source = "%s/private"
+}
+
+module "public" {
+    source = "%s/public"
+}
+`, server.URL, server.URL))
+
+	// The host credentials alone don't work for both
+	tree, err := NewTreeModule("", dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := tree.Load(testStorage(t), GetModeGet); err == nil {
+		t.Fatal("should error")
+	}
+
+	// The module credentials take precedence, and the host credentials
+	// are used for the other module. The resolvers record the hosts
+	// they're asked about, so the modules are downloaded one at a time.
+	secrets := &testSecretResolver{
+		Secrets: map[string][2]string{host: {"private", ""}},
+	}
+	opts := &LoadOptions{
+		Mode:        GetModeGet,
+		Secrets:     map[string]SecretResolver{"private": secrets},
+		Concurrency: 1,
+	}
+	if err := tree.LoadWithOptions(testStorage(t), opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(secrets.Hosts) != 1 || secrets.Hosts[0] != host {
+		t.Fatalf("bad: %#v", secrets.Hosts)
+	}
+
+	// They're only used by that load, even while it is in progress
+	other, err := NewTreeModule("", dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	done := make(chan error)
+	go func() { done <- tree.LoadWithOptions(testStorage(t), opts) }()
+	if err := other.Load(testStorage(t), GetModeGet); err == nil {
+		t.Fatal("should error")
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestChainSecrets(t *testing.T) {
+	if chainSecrets(nil, nil) != nil {
+		t.Fatal("should be nil")
+	}
+
+	first := &testSecretResolver{
+		Secrets: map[string][2]string{"example.com": {"foo", "bar"}},
+	}
+	second := &testSecretResolver{
+		Secrets: map[string][2]string{
+			"example.com": {"baz", ""},
+			"other.com":   {"", "qux"},
+		},
+	}
+	r := chainSecrets(nil, first, second)
+
+	cases := []struct {
+		Host string
+		User string
+		Pass string
+	}{
+		{"example.com", "foo", "bar"},
+		{"other.com", "", "qux"},
+		{"none.com", "", ""},
+	}
+	for _, tc := range cases {
+		user, pass, err := r.Resolve(tc.Host)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Host, err)
+		}
+		if user != tc.User || pass != tc.Pass {
+			t.Fatalf("%s: bad: %s %s", tc.Host, user, pass)
+		}
+	}
+}
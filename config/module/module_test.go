@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/terraform/config"
@@ -24,6 +25,43 @@ func tempDir(t *testing.T) string {
 	return dir
 }
 
+func TestCheckModuleName(t *testing.T) {
+	cases := []struct {
+		Name string
+		Err  bool
+	}{
+		{"foo", false},
+		{"foo-bar_2", false},
+		{"_foo", false},
+		{"", true},
+		{"2foo", true},
+		{"foo.bar", true},
+		{"foo bar", true},
+		{"foo*", true},
+	}
+
+	for _, tc := range cases {
+		err := checkModuleName(tc.Name)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%q: err: %v", tc.Name, err)
+		}
+	}
+}
+
+func TestTreeLoad_badModuleName(t *testing.T) {
+	tree := NewTree("", testConfig(t, "module-name-bad"))
+	err := tree.Load(testStorage(t), GetModeGet)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), `module "vpc.prod": invalid name`) {
+		t.Fatalf("bad: %s", err)
+	}
+	if !strings.Contains(err.Error(), ModuleNamePattern) {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
 func testConfig(t *testing.T, n string) *config.Config {
 	c, err := config.LoadDir(filepath.Join(fixtureDir, n))
 	if err != nil {
@@ -46,6 +84,17 @@ func testModule(n string) string {
 	return url.String()
 }
 
+// testRemoteModule returns the source of the fixture n for test servers to
+// send modules to. Servers can't send modules to local files, so it goes
+// through a getter of its own.
+func testRemoteModule(n string) string {
+	return "testfile::" + testModule(n)
+}
+
+func init() {
+	Getters["testfile"] = new(FileGetter)
+}
+
 func testModuleURL(n string) *url.URL {
 	u, err := url.Parse(testModule(n))
 	if err != nil {
@@ -0,0 +1,115 @@
+package module
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+// checkParams checks that the interpolations within the raw values of the
+// parameters of the module are syntactically valid, so that a typo such as
+// an empty "${}" is reported when loading rather than being passed along
+// as a literal value. Whether what is interpolated exists is left to
+// evaluation, since it can depend on resources that aren't known yet.
+func checkParams(m *config.Module) error {
+	if m.RawConfig == nil {
+		return nil
+	}
+
+	keys := make([]string, 0, len(m.RawConfig.Raw))
+	for k := range m.RawConfig.Raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		err := checkParamValue(k, reflect.ValueOf(m.RawConfig.Raw[k]))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkParamValue checks the interpolations within the strings of v, which
+// is the value of the named parameter or of something nested within it.
+func checkParamValue(name string, v reflect.Value) error {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		if err := checkInterpolations(v.String()); err != nil {
+			return fmt.Errorf("parameter %s: %s", name, err)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := checkParamValue(name, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		keys := make([]string, 0, v.Len())
+		values := make(map[string]reflect.Value)
+		for _, k := range v.MapKeys() {
+			key := fmt.Sprintf("%v", k.Interface())
+			keys = append(keys, key)
+			values[key] = v.MapIndex(k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if err := checkParamValue(name+"."+k, values[k]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkInterpolations parses every interpolation within s. Like when the
+// configuration is evaluated, an even number of "$" escapes the "{".
+func checkInterpolations(s string) error {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			continue
+		}
+
+		start := i
+		for i < len(s) && s[i] == '$' {
+			i++
+		}
+		if i >= len(s) || s[i] != '{' || (i-start)%2 == 0 {
+			i--
+			continue
+		}
+
+		end := strings.Index(s[i:], "}")
+		if end < 0 {
+			return fmt.Errorf("unterminated interpolation: %q", s[start:])
+		}
+		end += i
+
+		expr := s[i+1 : end]
+		if strings.TrimSpace(expr) == "" {
+			return fmt.Errorf("empty interpolation: %q", s[start:end+1])
+		}
+		if _, err := config.ExprParse(expr); err != nil {
+			return fmt.Errorf(
+				"invalid interpolation %q: %s", s[start:end+1], err)
+		}
+
+		i = end
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package module
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+func TestCheckInterpolations(t *testing.T) {
+	cases := []struct {
+		Input string
+		Err   bool
+	}{
+		{"", false},
+		{"foo", false},
+		{"${var.foo}", false},
+		{"a-${var.foo}-${aws_instance.web.id}", false},
+		{`${lookup(var.amis, "us-east-1")}`, false},
+		{"$${var.foo", false},
+		{"$$$${", false},
+		{"100$", false},
+		{"{}", false},
+		{"${var.foo", true},
+		{"${var.foo}-${", true},
+		{"$$${var.foo", true},
+		{"${}", true},
+		{"${ }", true},
+		{`${lookup(var.amis}`, true},
+	}
+
+	for _, tc := range cases {
+		err := checkInterpolations(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%q: bad: %v", tc.Input, err)
+		}
+	}
+}
+
+func TestCheckParams(t *testing.T) {
+	raw, err := config.NewRawConfig(map[string]interface{}{
+		"name": "${var.name}",
+		"tags": []map[string]interface{}{
+			map[string]interface{}{
+				"good": "${var.good}",
+				"bad":  "${var.bad",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = checkParams(&config.Module{Name: "foo", RawConfig: raw})
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "parameter tags.bad:") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestTreeLoad_badParams(t *testing.T) {
+	storage := testStorage(t)
+	tree := NewTree("", testConfig(t, "params-bad"))
+
+	err := tree.Load(storage, GetModeGet)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "module foo: parameter name:") {
+		t.Fatalf("bad: %s", err)
+	}
+	if !strings.Contains(err.Error(), "empty interpolation") {
+		t.Fatalf("bad: %s", err)
+	}
+}
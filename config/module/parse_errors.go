@@ -0,0 +1,57 @@
+package module
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/multierror"
+)
+
+// parseErrors collects the parse errors of a load with
+// LoadOptions.CollectParseErrors, by the full path of the module. A nil
+// parseErrors doesn't collect anything, so the load stops at the first
+// error instead.
+type parseErrors map[string]error
+
+// newParseErrors returns a parseErrors if parse errors are collected, or
+// nil otherwise.
+func newParseErrors(collect bool) parseErrors {
+	if !collect {
+		return nil
+	}
+
+	return make(parseErrors)
+}
+
+// add records the error for the module at path, returning whether it was
+// collected. If it wasn't, the load should stop with the error.
+func (p parseErrors) add(path []string, err error) bool {
+	if p == nil {
+		return false
+	}
+
+	p[strings.Join(path, ".")] = err
+	return true
+}
+
+// error returns the collected errors sorted by path, or nil if there are
+// none.
+func (p parseErrors) error() error {
+	if len(p) == 0 {
+		return nil
+	}
+
+	paths := make([]string, 0, len(p))
+	for path := range p {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	errs := make([]error, len(paths))
+	for i, path := range paths {
+		errs[i] = fmt.Errorf("module %s: %s", path, p[path])
+	}
+
+	return &multierror.Error{Errors: errs}
+}
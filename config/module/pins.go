@@ -0,0 +1,42 @@
+package module
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadPinsFile reads pins from the JSON file at path. The file must
+// contain a single object mapping module paths to sources, example:
+//
+//	{
+//	    "vpc": "github.com/hashicorp/example?ref=v1.2.0",
+//	    "vpc.subnets": "git::https://example.com/subnets.git?ref=v0.3.1"
+//	}
+//
+// The result can be assigned to LoadOptions.Pins.
+func LoadPinsFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var result map[string]string
+	if err := json.NewDecoder(f).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error reading pins file %s: %s", path, err)
+	}
+
+	return result, nil
+}
+
+// pinnedSource returns the source in pins for the module at path, or src
+// if the module isn't pinned. See LoadOptions.Pins.
+func pinnedSource(path []string, src string, pins map[string]string) string {
+	if pin, ok := pins[strings.Join(path, ".")]; ok {
+		return pin
+	}
+
+	return src
+}
@@ -0,0 +1,54 @@
+package module
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadPinsFile(t *testing.T) {
+	actual, err := LoadPinsFile(filepath.Join(fixtureDir, "pins.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]string{
+		"foo":     "./foo",
+		"foo.bar": "git::https://example.com/bar.git?ref=v1.0.0",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestLoadPinsFile_bad(t *testing.T) {
+	_, err := LoadPinsFile(filepath.Join(fixtureDir, "pins", "main.tf"))
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestTreeLoad_pins(t *testing.T) {
+	storage := testStorage(t)
+	tree := NewTree("", testConfig(t, "pins"))
+	err := tree.LoadWithOptions(storage, &LoadOptions{
+		Mode: GetModeGet,
+		Pins: map[string]string{"foo.bar": testModule("pins/other")},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The pinned module came from the pinned source
+	if _, ok, err := storage.Dir(testModule("pins/other")); err != nil || !ok {
+		t.Fatalf("pinned source not downloaded: %v %s", ok, err)
+	}
+
+	// The unpinned module came from its configured source
+	if _, ok, err := storage.Dir(testModule("pins/foo")); err != nil || !ok {
+		t.Fatalf("configured source not downloaded: %v %s", ok, err)
+	}
+	if _, ok, _ := storage.Dir(testModule("pins/foo/bar")); ok {
+		t.Fatal("configured source of pinned module should not be downloaded")
+	}
+}
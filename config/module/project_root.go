@@ -0,0 +1,33 @@
+package module
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// expandRoot turns a "root::" source into the absolute path of the
+// directory within root, and otherwise returns src unchanged. See
+// LoadOptions.ProjectRoot.
+func expandRoot(src, root string) (string, error) {
+	force, rel := getForcedGetter(src)
+	if force != "root" {
+		return src, nil
+	}
+	if root == "" {
+		return "", fmt.Errorf("no project root to resolve source %s with", src)
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+
+	rel = filepath.Clean(filepath.FromSlash(rel))
+	if filepath.IsAbs(rel) || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("source %s is outside of the project root", src)
+	}
+
+	return filepath.Join(root, rel), nil
+}
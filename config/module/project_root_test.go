@@ -0,0 +1,70 @@
+package module
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandRoot(t *testing.T) {
+	root, err := filepath.Abs("/root")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Input  string
+		Output string
+		Err    bool
+	}{
+		{"./foo", "./foo", false},
+		{"root::modules/vpc", filepath.Join(root, "modules", "vpc"), false},
+		{"root::./modules/../vpc", filepath.Join(root, "vpc"), false},
+		{"root::../vpc", "", true},
+		{"root::/vpc", "", true},
+	}
+
+	for _, tc := range cases {
+		output, err := expandRoot(tc.Input, root)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if output != tc.Output {
+			t.Fatalf("%s: bad: %s", tc.Input, output)
+		}
+	}
+}
+
+func TestTreeLoad_projectRoot(t *testing.T) {
+	tree := NewTree("", testConfig(t, "project-root"))
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Local modules share the root of the configuration
+	vpc := tree.Children()["app"].Children()["vpc"]
+	if vpc == nil {
+		t.Fatalf("bad: %s", tree)
+	}
+	actual, err := filepath.EvalSymlinks(vpc.config.Dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected, err := filepath.Abs(
+		filepath.Join(fixtureDir, "project-root", "modules", "vpc"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual != expected {
+		t.Fatalf("bad: %s", actual)
+	}
+
+	// The root can be set to somewhere else
+	tree = NewTree("", testConfig(t, "project-root"))
+	err = tree.LoadWithOptions(testStorage(t), &LoadOptions{
+		Mode:        GetModeGet,
+		ProjectRoot: filepath.Join(fixtureDir, "basic"),
+	})
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -0,0 +1,21 @@
+package module
+
+import (
+	"fmt"
+)
+
+// checkRemoteSource returns an error if a source that a remote server sent
+// us to, such as with X-Terraform-Get or a discovery service, would run a
+// command or read local files. Only the configuration can use exec and
+// file sources: a server that could would be able to run any command on,
+// or copy any file from, the machine that loads the modules.
+func checkRemoteSource(source string) error {
+	switch getScheme(source) {
+	case "exec", "file":
+		return fmt.Errorf(
+			"source %s was returned by a remote server, which can't use "+
+				"exec or file sources", source)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,97 @@
+package module
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHttpGetter_remoteSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Terraform-Get", r.URL.Query().Get("to"))
+			w.WriteHeader(200)
+		}))
+	defer server.Close()
+
+	g := new(HttpGetter)
+	for _, to := range []string{"exec::/bin/sh", "file:///etc", "file::/etc"} {
+		u, err := url.Parse(server.URL + "?" + url.Values{"to": {to}}.Encode())
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		err = g.Get(tempDir(t), u)
+		if err == nil || !strings.Contains(err.Error(), "remote server") {
+			t.Fatalf("%s: bad: %v", to, err)
+		}
+		if _, err := g.UpdateAvailable(tempDir(t), u); err == nil {
+			t.Fatalf("%s: should error", to)
+		}
+		if err := g.Check(u); err == nil {
+			t.Fatalf("%s: should error", to)
+		}
+	}
+}
+
+func TestHttpGetter_followCancel(t *testing.T) {
+	g := new(testRefGetter)
+	Getters["testref"] = g
+	defer delete(Getters, "testref")
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Terraform-Get", "testref::https://example.com/repo?ref=v1.0")
+			w.WriteHeader(200)
+		}))
+	defer server.Close()
+
+	cancel := make(chan struct{})
+	if err := getCancel(tempDir(t), server.URL, &GetOptions{Cancel: cancel}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if g.Opts == nil || g.Opts.Cancel != (<-chan struct{})(cancel) {
+		t.Fatalf("bad: %#v", g.Opts)
+	}
+	if g.Opts.Ref != "v1.0" {
+		t.Fatalf("bad: %#v", g.Opts)
+	}
+}
+
+func TestDetect_remoteSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Query().Get("name") {
+			case "exec":
+				fmt.Fprint(w, `{"source": "exec::/bin/sh"}`)
+			case "local":
+				fmt.Fprint(w, `{"source": "/etc"}`)
+			default:
+				fmt.Fprint(w, `{"source": "git::https://example.com/vpc.git"}`)
+			}
+		}))
+	defer server.Close()
+
+	old := Detectors
+	defer func() { Detectors = old }()
+	Detectors = append(
+		[]Detector{&DiscoveryDetector{Endpoint: server.URL}}, Detectors...)
+
+	for _, name := range []string{"exec", "local"} {
+		_, err := Detect("discover::"+name, "/pwd")
+		if err == nil || !strings.Contains(err.Error(), "remote server") {
+			t.Fatalf("%s: bad: %v", name, err)
+		}
+	}
+
+	result, err := Detect("discover::vpc", "/pwd")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result != "git::https://example.com/vpc.git" {
+		t.Fatalf("bad: %s", result)
+	}
+}
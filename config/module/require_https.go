@@ -0,0 +1,38 @@
+package module
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// checkHTTPS returns an error if the detected source is fetched over plain
+// HTTP, for loads with LoadOptions.RequireHTTPS.
+func checkHTTPS(source string) error {
+	_, src := getForcedGetter(source)
+	u, err := url.Parse(src)
+	if err != nil || u.Scheme != "http" {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"insecure source %s, module sources must use HTTPS", source)
+}
+
+// httpsClient returns a client like http.DefaultClient, except that it
+// refuses redirects to plain HTTP, for the requests that getters make
+// with GetOptions.RequireHTTPS.
+func httpsClient() *http.Client {
+	return &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if err := checkHTTPS(req.URL.String()); err != nil {
+				return err
+			}
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+
+			return nil
+		},
+	}
+}
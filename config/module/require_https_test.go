@@ -0,0 +1,96 @@
+package module
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCheckHTTPS(t *testing.T) {
+	cases := []struct {
+		Source string
+		Err    bool
+	}{
+		{"http://example.com/foo", true},
+		{"git::http://example.com/foo.git?ref=v1.0", true},
+		{"hg::http://example.com/foo", true},
+		{"https://example.com/foo", false},
+		{"git::https://example.com/foo.git", false},
+		{"git::ssh://git@example.com/foo.git", false},
+		{"file:///foo", false},
+	}
+
+	for _, tc := range cases {
+		err := checkHTTPS(tc.Source)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %v", tc.Source, err)
+		}
+	}
+}
+
+func TestTreeLoad_requireHTTPS(t *testing.T) {
+	Getters["securetest"] = new(testCacheGetter)
+	defer delete(Getters, "securetest")
+
+	// Plain HTTP is allowed by default
+	tree := NewTree("", testConfig(t, "require-https"))
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	tree = NewTree("", testConfig(t, "require-https"))
+	err := tree.LoadWithOptions(testStorage(t), &LoadOptions{
+		Mode:         GetModeGet,
+		RequireHTTPS: true,
+	})
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.HasPrefix(err.Error(), "module insecure: insecure source") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestHttpGetter_requireHTTPS(t *testing.T) {
+	insecure := httptest.NewServer(http.HandlerFunc(testHttpHandlerHeader))
+	defer insecure.Close()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/header":
+				w.Header().Add("X-Terraform-Get", insecure.URL+"/module")
+				w.WriteHeader(200)
+			case "/redirect":
+				http.Redirect(w, r, insecure.URL+"/module", http.StatusFound)
+			}
+		}))
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	g := &HttpGetter{RootCAs: pool, RedirectHosts: []string{"*"}}
+
+	for _, path := range []string{"/header", "/redirect"} {
+		u, err := url.Parse(server.URL + path)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		// Plain HTTP is followed by default
+		if err := g.getFollow(tempDir(t), &GetOptions{URL: u}); err != nil {
+			t.Fatalf("%s: err: %s", path, err)
+		}
+
+		err = g.getFollow(tempDir(t), &GetOptions{URL: u, RequireHTTPS: true})
+		if err == nil || !strings.Contains(err.Error(), "insecure source") {
+			t.Fatalf("%s: bad: %v", path, err)
+		}
+	}
+}
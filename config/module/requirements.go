@@ -0,0 +1,145 @@
+package module
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/multierror"
+)
+
+// ValidateRequirements checks the "terraform" block of every module in
+// the tree against the environment that it will run in, so that a module
+// that needs a newer Terraform or provider is reported before anything is
+// applied. The running versions aren't known to this package, so they are
+// given: version is the version of Terraform, and providers maps the names
+// of the available providers to their versions. A blank version skips the
+// checks of required_version, and nil providers skips the checks of
+// required_providers. Prerelease versions, such as "0.3.0-dev", are
+// checked as the release that they precede.
+//
+// Every violation is returned together, each with the path of the module.
+//
+// Load must be called prior to calling ValidateRequirements or an error
+// will be returned.
+func (t *Tree) ValidateRequirements(version string, providers map[string]string) error {
+	if !t.Loaded() {
+		return fmt.Errorf(
+			"tree must be loaded before calling ValidateRequirements")
+	}
+
+	if version != "" {
+		if _, err := parseRunningVersion(version); err != nil {
+			return fmt.Errorf("invalid Terraform version: %s", err)
+		}
+	}
+	for k, v := range providers {
+		if _, err := parseRunningVersion(v); err != nil {
+			return fmt.Errorf("invalid version of provider %s: %s", k, err)
+		}
+	}
+
+	var result error
+	for _, err := range t.requirementErrors(version, providers) {
+		result = multierror.ErrorAppend(
+			result, fmt.Errorf("module %s: %s", t.Name(), err))
+	}
+
+	t.walkModules(func(path []string, parent *Tree, m *Module) error {
+		c, ok := parent.Children()[m.Name]
+		if !ok {
+			return nil
+		}
+
+		for _, err := range c.requirementErrors(version, providers) {
+			result = multierror.ErrorAppend(result, fmt.Errorf(
+				"module %s: %s", strings.Join(path, "."), err))
+		}
+
+		return nil
+	})
+
+	return result
+}
+
+// requirementErrors returns the ways that the environment doesn't satisfy
+// the requirements in the configuration of the tree itself. The versions
+// must already be known to parse.
+func (t *Tree) requirementErrors(version string, providers map[string]string) []error {
+	tf := t.config.Terraform
+	if tf == nil {
+		return nil
+	}
+
+	var errs []error
+	if version != "" && tf.RequiredVersion != "" {
+		ok, err := requirementMet(tf.RequiredVersion, version)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("required_version: %s", err))
+		} else if !ok {
+			errs = append(errs, fmt.Errorf(
+				"requires Terraform %s, but the version is %s",
+				tf.RequiredVersion, version))
+		}
+	}
+
+	if providers == nil {
+		return errs
+	}
+
+	names := make([]string, 0, len(tf.RequiredProviders))
+	for k := range tf.RequiredProviders {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		required := tf.RequiredProviders[k]
+		v, ok := providers[k]
+		if !ok {
+			errs = append(errs, fmt.Errorf(
+				"requires provider %s %s, but it isn't available",
+				k, required))
+			continue
+		}
+
+		ok, err := requirementMet(required, v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("provider %s: %s", k, err))
+		} else if !ok {
+			errs = append(errs, fmt.Errorf(
+				"requires provider %s %s, but the version is %s",
+				k, required, v))
+		}
+	}
+
+	return errs
+}
+
+// requirementMet returns whether the running version satisfies the
+// required version constraint.
+func requirementMet(required, running string) (bool, error) {
+	c, err := parseVersionConstraint(required)
+	if err != nil {
+		return false, err
+	}
+
+	v, err := parseRunningVersion(running)
+	if err != nil {
+		return false, err
+	}
+
+	return c.Check(v), nil
+}
+
+// parseRunningVersion parses the version of something that is running,
+// ignoring whether it is a prerelease.
+func parseRunningVersion(v string) (*version, error) {
+	result, err := parseVersion(v)
+	if err != nil {
+		return nil, err
+	}
+	result.Prerelease = ""
+
+	return result, nil
+}
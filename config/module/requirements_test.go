@@ -0,0 +1,95 @@
+package module
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTreeValidateRequirements(t *testing.T) {
+	cases := []struct {
+		Version   string
+		Providers map[string]string
+		Errors    []string
+	}{
+		{
+			"0.5.0",
+			map[string]string{"aws": "1.2.0", "consul": "2.1.0"},
+			nil,
+		},
+		{
+			"0.5.0-dev",
+			map[string]string{"aws": "1.2.0", "consul": "2.1.0"},
+			nil,
+		},
+		{
+			"0.4.0",
+			map[string]string{"aws": "1.2.0", "consul": "2.1.0"},
+			[]string{"module foo: requires Terraform >= 0.5.0, but the version is 0.4.0"},
+		},
+		{
+			"0.2.0",
+			nil,
+			[]string{
+				"module <root>: requires Terraform >= 0.3.0",
+				"module foo: requires Terraform >= 0.5.0",
+			},
+		},
+		{
+			"",
+			map[string]string{"aws": "2.0.0"},
+			[]string{
+				"module <root>: requires provider aws ~> 1.0, but the version is 2.0.0",
+				"module foo: requires provider consul >= 2.0, but it isn't available",
+			},
+		},
+		{
+			"",
+			nil,
+			nil,
+		},
+	}
+
+	tree := NewTree("", testConfig(t, "requirements"))
+	if err := tree.ValidateRequirements("0.5.0", nil); err == nil {
+		t.Fatal("should error")
+	}
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for i, tc := range cases {
+		err := tree.ValidateRequirements(tc.Version, tc.Providers)
+		if len(tc.Errors) == 0 {
+			if err != nil {
+				t.Fatalf("%d: err: %s", i, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("%d: should error", i)
+		}
+
+		for _, expected := range tc.Errors {
+			if !strings.Contains(err.Error(), expected) {
+				t.Fatalf("%d: bad: %s", i, err)
+			}
+		}
+		if n := strings.Count(err.Error(), "module "); n != len(tc.Errors) {
+			t.Fatalf("%d: bad: %s", i, err)
+		}
+	}
+}
+
+func TestTreeValidateRequirements_badVersion(t *testing.T) {
+	tree := NewTree("", testConfig(t, "requirements"))
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := tree.ValidateRequirements("nope", nil); err == nil {
+		t.Fatal("should error")
+	}
+	if err := tree.ValidateRequirements("", map[string]string{"aws": "x"}); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -1,5 +1,11 @@
 package module
 
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/config"
+)
+
 // Storage is an interface that knows how to lookup downloaded modules
 // as well as download and update modules from their sources into the
 // proper location.
@@ -11,3 +17,138 @@ type Storage interface {
 	// Get will download and optionally update the given module.
 	Get(string, bool) error
 }
+
+// UpdateStorage is implemented by Storages that can tell whether an update
+// is available for a module, for Tree.HasUpdates. An update is always
+// assumed to be available in Storages that don't implement it.
+type UpdateStorage interface {
+	Storage
+
+	// UpdateAvailable checks whether an update is available for the
+	// given module without downloading it. If the module hasn't been
+	// downloaded yet, this returns true.
+	UpdateAvailable(string) (bool, error)
+}
+
+// CheckStorage is implemented by Storages that can verify that a module
+// could be downloaded, for Tree.CheckSources. For Storages that don't
+// implement it, the source is checked with Check.
+type CheckStorage interface {
+	Storage
+
+	// Check verifies that the given module could be downloaded, without
+	// downloading it.
+	Check(string) error
+}
+
+// ListStorage is implemented by Storages that can list the modules they
+// have, for Tree.Orphans.
+type ListStorage interface {
+	Storage
+
+	// List returns the sources of all the modules that are downloaded.
+	List() ([]string, error)
+}
+
+// CancelStorage is implemented by Storages that can stop a Get part way
+// through. Whatever was partially downloaded when cancel is closed must be
+// cleaned up, so that the module is either as it was before or not there
+// at all.
+type CancelStorage interface {
+	Storage
+
+	GetCancel(string, bool, <-chan struct{}) error
+}
+
+// ActionStorage is implemented by CancelStorages that report what getting
+// a module did, such as whether it was downloaded or was already there,
+// for Tree.LoadReport.
+type ActionStorage interface {
+	CancelStorage
+
+	GetAction(string, bool, <-chan struct{}) (ModuleAction, error)
+}
+
+// OptionsStorage is implemented by ActionStorages that take the options
+// of the load for getting a module.
+type OptionsStorage interface {
+	ActionStorage
+
+	GetWithOptions(string, *StorageGetOptions) (ModuleAction, error)
+}
+
+// StorageGetOptions are the options for getting a module from an
+// OptionsStorage.
+type StorageGetOptions struct {
+	// Update and Cancel are as for ActionStorage.GetAction.
+	Update bool
+	Cancel <-chan struct{}
+
+	// Secrets, if not nil, is asked for the credentials of each host that
+	// the module is downloaded from before the SecretResolver of the
+	// getter, for LoadOptions.Secrets.
+	Secrets SecretResolver
+
+	// Progress, if not nil, is called with the size of the module so far
+	// every so often while it is downloaded, for
+	// LoadOptions.MaxDownloadBytes. If it returns an error, the download
+	// must be stopped and what was written removed, just like when Cancel
+	// is closed, and the error returned.
+	Progress func(int64) error
+
+	// RequireHTTPS is passed on to the getters, as GetOptions.RequireHTTPS,
+	// for LoadOptions.RequireHTTPS.
+	RequireHTTPS bool
+}
+
+// GetConfig loads the configuration of a single module without building a
+// Tree. The source is resolved just like the source of a module within a
+// configuration in the directory pwd, and is downloaded into the storage
+// if it isn't there yet. Modules that the configuration imports aren't
+// downloaded.
+func GetConfig(s Storage, source, pwd string) (*config.Config, error) {
+	return GetConfigWithOptions(s, source, pwd, nil)
+}
+
+// GetConfigWithOptions is like GetConfig, except that the source is
+// resolved with the Aliases, RegistryPrefix, and ProjectRoot of opts,
+// which may be nil. Their other options don't apply to a single module.
+func GetConfigWithOptions(
+	s Storage, source, pwd string, opts *LoadOptions) (*config.Config, error) {
+	if opts == nil {
+		opts = new(LoadOptions)
+	}
+
+	root := opts.ProjectRoot
+	if root == "" {
+		root = pwd
+	}
+
+	source, err := resolveSource(source, pwd, root, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Get(source, false); err != nil {
+		return nil, err
+	}
+
+	dir, ok, err := s.Dir(source)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("module not found after download: %s", source)
+	}
+
+	fs := storageFileSystem(s)
+	ok, err = hasConfigFilesFS(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("no Terraform configuration found in %s", dir)
+	}
+
+	return loadDirFS(fs, dir)
+}
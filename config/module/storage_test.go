@@ -0,0 +1,77 @@
+package module
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestGetConfig(t *testing.T) {
+	pwd, err := filepath.Abs(fixtureDir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	s := testStorage(t)
+	c, err := GetConfig(s, "./basic", pwd)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(c.Modules) != 1 || c.Modules[0].Name != "foo" {
+		t.Fatalf("bad: %#v", c.Modules)
+	}
+
+	// The module itself is downloaded, but not its children
+	dir, ok, err := s.Dir(testModule("basic"))
+	if err != nil || !ok {
+		t.Fatalf("bad: %v %s", ok, err)
+	}
+	if c.Dir != dir {
+		t.Fatalf("bad: %s", c.Dir)
+	}
+	_, ok, err = s.Dir(testModule("basic/foo"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ok {
+		t.Fatal("child should not be downloaded")
+	}
+}
+
+func TestGetConfig_bad(t *testing.T) {
+	cases := []string{
+		"./nope",
+		"./no-config/foo",
+	}
+
+	pwd, err := filepath.Abs(fixtureDir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, tc := range cases {
+		if _, err := GetConfig(testStorage(t), tc, pwd); err == nil {
+			t.Fatalf("%s: should error", tc)
+		}
+	}
+}
+
+func TestGetConfigWithOptions(t *testing.T) {
+	pwd, err := filepath.Abs(fixtureDir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Aliases are only known to the options they're given in
+	if _, err := GetConfig(testStorage(t), "alias::basic", pwd); err == nil {
+		t.Fatal("should error")
+	}
+
+	opts := &LoadOptions{Aliases: map[string]string{"basic": "./basic"}}
+	c, err := GetConfigWithOptions(testStorage(t), "alias::basic", pwd, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(c.Modules) != 1 || c.Modules[0].Name != "foo" {
+		t.Fatalf("bad: %#v", c.Modules)
+	}
+}
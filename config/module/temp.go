@@ -0,0 +1,77 @@
+package module
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// TempDir, if set, is the directory that modules are downloaded into and
+// archives are unpacked in before they are moved into place. This is
+// useful when the disk that modules are stored on is small or slow, such
+// as for modules that are gigabytes in size.
+//
+// If TempDir is blank, the directory from the TMPDIR environment variable
+// is used. If that isn't set either, temporary files are kept next to
+// where the module is stored so that moving them into place is only a
+// rename.
+//
+// Unlike the settings in LoadOptions, this is global, since the Getters
+// and Decompressors that make the temporary files are used outside of
+// loads and aren't given their options.
+var TempDir string
+
+// newTempDir creates a new temporary directory for work on the path dst.
+func newTempDir(dst, prefix string) (string, error) {
+	base, err := tempBase(dst)
+	if err != nil {
+		return "", err
+	}
+
+	return ioutil.TempDir(base, prefix)
+}
+
+// newTempFile creates a new temporary file for work on the path dst.
+func newTempFile(dst, prefix string) (*os.File, error) {
+	base, err := tempBase(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.TempFile(base, prefix)
+}
+
+// tempBase returns the directory to create temporary files for work on the
+// path dst in, creating it if needed. See TempDir.
+func tempBase(dst string) (string, error) {
+	base := TempDir
+	if base == "" {
+		base = os.Getenv("TMPDIR")
+	}
+	if base == "" {
+		base = filepath.Dir(dst)
+	}
+
+	if err := os.MkdirAll(base, 0755); err != nil {
+		return "", err
+	}
+
+	return base, nil
+}
+
+// moveDir moves the file or directory src to dst. If they are on different
+// disks, which can happen when TempDir is set, src is copied and then
+// removed, so dst should be a path that nothing else is using yet.
+func moveDir(dst, src string) error {
+	err := os.Rename(src, dst)
+	if _, ok := err.(*os.LinkError); !ok {
+		return err
+	}
+
+	if err := copyDir(dst, src); err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+
+	return os.RemoveAll(src)
+}
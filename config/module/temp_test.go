@@ -0,0 +1,75 @@
+package module
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewTempDir(t *testing.T) {
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	defer func() { TempDir = "" }()
+
+	custom := tempDir(t)
+	env := tempDir(t)
+	dst := filepath.Join(tempDir(t), "module")
+
+	cases := []struct {
+		TempDir string
+		Env     string
+		Base    string
+	}{
+		{custom, env, custom},
+		{"", env, env},
+		{"", "", filepath.Dir(dst)},
+	}
+
+	for i, tc := range cases {
+		TempDir = tc.TempDir
+		os.Setenv("TMPDIR", tc.Env)
+
+		td, err := newTempDir(dst, ".tmp")
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		os.RemoveAll(td)
+
+		if filepath.Dir(td) != tc.Base {
+			t.Fatalf("%d: bad: %s", i, td)
+		}
+	}
+}
+
+func TestFolderStorage_tempDir(t *testing.T) {
+	TempDir = tempDir(t)
+	defer func() { TempDir = "" }()
+
+	s := &FolderStorage{StorageDir: tempDir(t)}
+
+	u := testModuleURL("archive-wrapped.tar")
+	u.RawQuery = "archive_strip=1"
+	if err := s.Get(u.String(), false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dir, ok, err := s.Dir(u.String())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ok {
+		t.Fatal("should exist")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "main.tf")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Nothing should be left behind in the temporary directory
+	entries, err := ioutil.ReadDir(TempDir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("bad: %d entries left in %s", len(entries), TempDir)
+	}
+}
@@ -0,0 +1,11 @@
+module "foo" {
+    source = "./foo"
+}
+
+module "bar" {
+    source = "./bar"
+}
+
+module "baz" {
+    source = "./baz"
+}
@@ -0,0 +1,19 @@
+module "a" {
+    source = "breakertest::http://down.example.com/a"
+}
+
+module "b" {
+    source = "breakertest::http://down.example.com/b"
+}
+
+module "c" {
+    source = "breakertest::http://down.example.com/c"
+}
+
+module "d" {
+    source = "breakertest::http://down.example.com/d"
+}
+
+module "e" {
+    source = "breakertest::http://up.example.com/e"
+}
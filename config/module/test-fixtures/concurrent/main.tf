@@ -0,0 +1,7 @@
+module "foo" {
+    source = "locktest://foo"
+}
+
+module "bar" {
+    source = "locktest://bar"
+}
@@ -0,0 +1,3 @@
+module "parent" {
+    source = "../dataflow-cycle"
+}
@@ -0,0 +1,7 @@
+module "x" {
+    source = "./x"
+}
+
+output "out" {
+    value = "${module.x.out}"
+}
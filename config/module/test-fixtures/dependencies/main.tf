@@ -0,0 +1,12 @@
+module "a" {
+    source = "./a"
+}
+
+module "b" {
+    source = "./b"
+    foo = "${module.a.out}"
+}
+
+module "c" {
+    source = "./c"
+}
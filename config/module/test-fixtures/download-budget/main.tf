@@ -0,0 +1,15 @@
+module "a" {
+    source = "budgettest::http://example.com/a"
+}
+
+module "b" {
+    source = "budgettest::http://example.com/b"
+}
+
+module "c" {
+    source = "budgettest::http://example.com/c"
+}
+
+module "d" {
+    source = "./child"
+}
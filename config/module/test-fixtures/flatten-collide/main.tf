@@ -0,0 +1,9 @@
+resource "aws_security_group" "child-web" {
+    name = "foo"
+}
+
+module "child" {
+    source = "../flatten/child"
+    ami = "foo"
+    name = "bar"
+}
@@ -0,0 +1,26 @@
+variable "ami" {}
+variable "name" {}
+
+variable "size" {
+    default = "small"
+}
+
+provider "aws" {
+    region = "nope"
+}
+
+resource "aws_instance" "web" {
+    ami = "${var.ami}"
+    tag = "${var.name}-${var.size}"
+    size = "size-${var.size}"
+    joined = "${concat(var.name, var.size)}"
+    depends_on = ["aws_security_group.web"]
+}
+
+resource "aws_security_group" "web" {
+    name = "${var.name}"
+}
+
+output "ip" {
+    value = "${aws_instance.web.private_ip}"
+}
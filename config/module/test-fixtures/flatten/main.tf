@@ -0,0 +1,22 @@
+variable "region" {
+    default = "us-east-1"
+}
+
+provider "aws" {
+    region = "${var.region}"
+}
+
+resource "aws_instance" "web" {
+    ami = "foo"
+}
+
+module "child" {
+    source = "./child"
+    ami = "${aws_instance.web.id}"
+    name = "web-${var.region}"
+}
+
+output "ip" {
+    description = "The private IP of the child web instance"
+    value = "${module.child.ip}"
+}
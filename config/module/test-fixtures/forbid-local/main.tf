@@ -0,0 +1,3 @@
+module "remote" {
+    source = "vendortest://example.com/foo?ref=v1.0.0"
+}
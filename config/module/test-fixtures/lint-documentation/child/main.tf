@@ -0,0 +1,14 @@
+variable "documented" {
+    description = "Documented"
+}
+
+variable "undocumented" {}
+
+output "documented" {
+    value = "foo"
+    description = "Documented"
+}
+
+output "undocumented" {
+    value = "bar"
+}
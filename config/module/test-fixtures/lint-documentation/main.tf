@@ -0,0 +1,11 @@
+variable "undocumented" {}
+
+module "child" {
+    source = "./child"
+    documented = "foo"
+    undocumented = "bar"
+}
+
+output "foo" {
+    value = "${module.child.documented}"
+}
@@ -0,0 +1,15 @@
+module "a" {
+    source = "./foo"
+}
+
+module "b" {
+    source = "./foo"
+}
+
+module "c" {
+    source = "./foo"
+}
+
+module "d" {
+    source = "./foo"
+}
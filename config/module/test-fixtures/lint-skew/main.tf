@@ -0,0 +1,19 @@
+module "a" {
+    source = "git::https://example.com/foo.git?ref=v1.0"
+}
+
+module "b" {
+    source = "git::https://example.com/foo.git//modules/b?ref=v1.1"
+}
+
+module "c" {
+    source = "git::https://example.com/foo.git//modules/c?ref=v1.0"
+}
+
+module "d" {
+    source = "git::https://example.com/bar.git?ref=v1.0"
+}
+
+module "e" {
+    source = "git::https://example.com/bar.git//modules/e?ref=v1.0"
+}
@@ -0,0 +1,19 @@
+module "used" {
+    source = "./used"
+}
+
+module "resources" {
+    source = "./resources"
+}
+
+module "wrapper" {
+    source = "./wrapper"
+}
+
+module "unused" {
+    source = "./unused"
+}
+
+output "foo" {
+    value = "${module.used.foo}"
+}
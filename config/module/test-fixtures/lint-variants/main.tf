@@ -0,0 +1,15 @@
+module "a" {
+    source = "github.com/hashicorp/foo?ref=v1.0"
+}
+
+module "b" {
+    source = "git::https://github.com/hashicorp/foo.git?ref=v1.0"
+}
+
+module "c" {
+    source = "./foo"
+}
+
+module "d" {
+    source = "./foo/../foo"
+}
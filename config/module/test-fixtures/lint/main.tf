@@ -0,0 +1,19 @@
+module "local" {
+    source = "./foo"
+}
+
+module "git" {
+    source = "git::https://example.com/foo.git"
+}
+
+module "git-pinned" {
+    source = "git::https://example.com/foo.git?ref=v1.0"
+}
+
+module "http" {
+    source = "https://example.com/foo"
+}
+
+module "http-pinned" {
+    source = "https://example.com/foo?version=1.0"
+}
@@ -0,0 +1,8 @@
+module "child" {
+    source = "./child"
+    region = "${var.region}"
+}
+
+resource "aws_instance" "foo" {
+    address = "${module.child.address}"
+}
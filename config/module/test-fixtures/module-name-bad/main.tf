@@ -0,0 +1,3 @@
+module "vpc.prod" {
+    source = "./foo"
+}
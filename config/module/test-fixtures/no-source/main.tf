@@ -0,0 +1,3 @@
+module "foo" {
+    memory = "1G"
+}
@@ -0,0 +1,6 @@
+variable "name" {}
+
+module "foo" {
+    source = "./foo"
+    name = "${}"
+}
@@ -0,0 +1 @@
+output "foo" {
@@ -0,0 +1,11 @@
+module "a" {
+    source = "./a"
+}
+
+module "b" {
+    source = "./b"
+}
+
+module "d" {
+    source = "./d"
+}
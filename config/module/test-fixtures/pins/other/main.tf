@@ -0,0 +1 @@
+# Pinned
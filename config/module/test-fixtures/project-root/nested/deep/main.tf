@@ -0,0 +1,3 @@
+module "vpc" {
+    source = "root::modules/vpc"
+}
@@ -0,0 +1,7 @@
+module "secure" {
+    source = "securetest::https://example.com/secure"
+}
+
+module "insecure" {
+    source = "securetest::http://example.com/insecure"
+}
@@ -0,0 +1,7 @@
+terraform {
+    required_version = ">= 0.5.0"
+
+    required_providers {
+        consul = ">= 2.0"
+    }
+}
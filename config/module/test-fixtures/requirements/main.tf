@@ -0,0 +1,11 @@
+terraform {
+    required_version = ">= 0.3.0"
+
+    required_providers {
+        aws = "~> 1.0"
+    }
+}
+
+module "foo" {
+    source = "./foo"
+}
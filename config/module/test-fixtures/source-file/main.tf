@@ -0,0 +1,3 @@
+module "foo" {
+    source = "filetest::http://example.com/foo//main.tf"
+}
@@ -0,0 +1,11 @@
+module "b" {
+    source = "./bad"
+}
+
+module "c" {
+    source = "./good"
+}
+
+module "a" {
+    source = "./bad"
+}
@@ -0,0 +1,13 @@
+resource "aws_instance" "web" {}
+
+output "ip" {
+    value = "${aws_instance.missing.ip}"
+}
+
+output "name" {
+    value = "${var.missing}"
+}
+
+output "id" {
+    value = "${aws_instance.web.id}"
+}
@@ -0,0 +1,5 @@
+variable "memory" {}
+
+output "memory" {
+    value = "${var.memory}"
+}
@@ -0,0 +1,21 @@
+variable "untyped" {
+    default = "foo"
+}
+
+variable "required" {
+    type = "map"
+}
+
+variable "good" {
+    type = "map"
+    default = {
+        foo = "bar"
+    }
+}
+
+variable "bad" {
+    type = "string"
+    default = {
+        foo = "bar"
+    }
+}
@@ -3,11 +3,18 @@ package module
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/helper/multierror"
 )
 
 // Tree represents the module import tree of configurations.
@@ -17,7 +24,15 @@ import (
 // Terraform can use, etc.
 type Tree struct {
 	name     string
+	path     []string
+	origin   string
+	remote   bool
+	root     string
+	opts     *LoadOptions
+	action   ModuleAction
 	config   *config.Config
+	base     *config.Config
+	fs       FileSystem
 	children map[string]*Tree
 	lock     sync.RWMutex
 }
@@ -58,6 +73,22 @@ func NewTreeModule(name, dir string) (*Tree, error) {
 	return NewTree(name, c), nil
 }
 
+// NewTreeModuleFS is like NewTreeModule except the configuration is read
+// from the directory of the given FileSystem, so that the configuration
+// doesn't have to be on the local disk. The modules that it imports are
+// loaded from the Storage given to Load, which can implement
+// FileSystemStorage to keep them off of the disk as well.
+func NewTreeModuleFS(name string, fs FileSystem, dir string) (*Tree, error) {
+	c, err := loadDirFS(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	t := NewTree(name, c)
+	t.fs = fs
+	return t, nil
+}
+
 // Children returns the children of this tree (the modules that are
 // imported by this root).
 //
@@ -79,6 +110,10 @@ func (t *Tree) Loaded() bool {
 //
 // This is only the imports of _this_ level of the tree. To retrieve the
 // full nested imports, you'll have to traverse the tree.
+//
+// The modules are sorted by name, so the order is the same every time
+// the same configuration is loaded. Modules with the same name (which
+// Load rejects) keep the order they are declared in.
 func (t *Tree) Modules() []*Module {
 	result := make([]*Module, len(t.config.Modules))
 	for i, m := range t.config.Modules {
@@ -88,6 +123,7 @@ func (t *Tree) Modules() []*Module {
 		}
 	}
 
+	sort.Stable(moduleSort(result))
 	return result
 }
 
@@ -113,34 +149,504 @@ func (t *Tree) Name() string {
 // sane state: no circular dependencies, proper module sources, etc. A full
 // suite of validations can be done by running Validate (after loading).
 func (t *Tree) Load(s Storage, mode GetMode) error {
+	return t.LoadWithOptions(s, &LoadOptions{Mode: mode})
+}
+
+// LoadCancel is like Load, except that loading stops when cancel is
+// closed, such as from a signal handler when the user presses Ctrl-C.
+// Downloads that are in progress are stopped if the storage implements
+// CancelStorage, which FolderStorage does, and no more are started. The
+// modules that were already downloaded are kept, and no partially
+// downloaded module is left behind.
+func (t *Tree) LoadCancel(s Storage, mode GetMode, cancel <-chan struct{}) error {
+	return t.LoadWithOptions(s, &LoadOptions{Mode: mode, Cancel: cancel})
+}
+
+// LoadSubtree is like Load, except that only the modules along the path
+// given by prefix, and all the modules beneath it, are loaded. Modules in
+// unrelated branches of the tree are neither downloaded nor loaded. The
+// prefix is a list of module names starting from this tree, so
+// []string{"foo", "bar"} loads module "bar" within module "foo". An
+// empty prefix loads the entire tree.
+//
+// Since unrelated branches aren't loaded, a tree loaded this way can't be
+// validated as a whole.
+func (t *Tree) LoadSubtree(s Storage, mode GetMode, prefix []string) error {
+	return t.LoadWithOptions(s, &LoadOptions{Mode: mode, Prefix: prefix})
+}
+
+// LoadFromLock is like Load with GetModeGet, except that every module is
+// got at the exact source recorded for it in lock, ignoring any version
+// ranges or branches in the configuration, so that the same modules are
+// installed every time. Every module must be in the lock, and the source
+// in the configuration must still be satisfied by the locked source, or
+// an error asks for the lock to be refreshed.
+func (t *Tree) LoadFromLock(s Storage, lock *Lockfile) error {
+	return t.LoadWithOptions(s, &LoadOptions{Mode: GetModeGet, Lock: lock})
+}
+
+// LoadOptions are the options for loading a tree with LoadWithOptions.
+// The zero value loads the tree like Load with GetModeNone.
+type LoadOptions struct {
+	// Mode is whether modules are downloaded or updated before they're
+	// loaded.
+	Mode GetMode
+
+	// Prefix, if not empty, only loads the modules along it, as described
+	// by LoadSubtree.
+	Prefix []string
+
+	// Cancel, if not nil, stops the load when it is closed, as described
+	// by LoadCancel.
+	Cancel <-chan struct{}
+
+	// Lock, if not nil, has every module got at the source recorded for
+	// it, as described by LoadFromLock.
+	Lock *Lockfile
+
+	// Secrets maps module paths to the SecretResolvers for the credentials
+	// that those modules are downloaded with. A module path is the module
+	// names from the root joined by ".", just like for Pins. This is for
+	// when the credentials for a host aren't specific enough, such as a
+	// host that serves both public and private modules.
+	//
+	// For a module that has a resolver here, the resolver is asked for the
+	// credentials of each host that the module is downloaded from before
+	// the SecretResolver of the getter, which is still used for any host
+	// that the resolver has no credentials for. The resolvers are only
+	// used by this load, and only with storages that implement
+	// OptionsStorage, such as FolderStorage. Modules that share a source
+	// are only downloaded once, with the resolver of the first of them in
+	// the order of Modules.
+	Secrets map[string]SecretResolver
+
+	// MaxDownloadBytes, if positive, is the most bytes that the load may
+	// download across all of its modules, after which it stops with a
+	// DownloadBudgetError. This keeps a load from filling up a small disk.
+	MaxDownloadBytes int64
+
+	// CircuitBreakerFailures, if positive, is the number of consecutive
+	// failures to get modules from the same host after which the load
+	// gives up on that host. The modules from the host that remain fail
+	// right away with a HostDownError rather than each waiting to time
+	// out, which is slow when a whole host is unreachable. Any failure
+	// counts, including ones that aren't the fault of the host such as a
+	// missing ref.
+	CircuitBreakerFailures int
+
+	// CollectParseErrors, if true, keeps the load going when the
+	// configuration of a module can't be parsed, and reports every module
+	// that couldn't be parsed at the end in a single error, by the full
+	// path of each module. This shows all the broken modules at once, such
+	// as while migrating many modules to a new syntax. The modules
+	// imported by a module that can't be parsed aren't loaded, and the
+	// tree isn't loaded if there were any errors.
+	CollectParseErrors bool
+
+	// DeclaredDependencies, if true, imports the dependencies that modules
+	// declare in their DependenciesFile, including the tree itself.
+	DeclaredDependencies bool
+
+	// ForbidLocal, if true, fails the load for any module with a local
+	// file source, such as for production configurations where every
+	// module must come from a versioned remote source. Local sources
+	// within a remote module are part of that version of the module, so
+	// they are still allowed.
+	ForbidLocal bool
+
+	// RequireHTTPS, if true, fails the load for any module whose source is
+	// fetched over plain HTTP, which can be tampered with in transit. The
+	// scheme is checked after the source is detected, so both
+	// "http://example.com/vpc" and "git::http://example.com/vpc.git" are
+	// rejected, while HTTPS and every other scheme, such as SSH, are
+	// allowed.
+	RequireHTTPS bool
+
+	// Concurrency is the maximum number of modules that the load downloads
+	// at the same time, DefaultLoadConcurrency if it isn't positive. The
+	// modules imported by a single configuration are downloaded in
+	// parallel, and then the configurations of those modules are loaded
+	// in turn.
+	//
+	// Higher values are faster for configurations that import many
+	// modules, especially from slow remote sources. However, each download
+	// may use a network connection and run an external program such as
+	// git, so high values can overwhelm small machines and trip rate
+	// limits on shared hosts. Setting this to 1 downloads one module at a
+	// time.
+	Concurrency int
+
+	// Aliases maps alias names to the full source strings that they expand
+	// to. Aliases let a source that is used in many places be defined once
+	// and referenced with the syntax alias::name, example: alias::vpc.
+	//
+	// Aliases are expanded prior to detection, so the full source can use
+	// any syntax that a module source normally can.
+	Aliases map[string]string
+
+	// Pins maps module paths to the sources that should be used for them
+	// instead of the sources in the configuration. A module path is the
+	// module names from the root joined by ".", example: "vpc.subnets".
+	// Pins let the exact versions of every module be managed in one place,
+	// such as a generated lock file, rather than by editing the "ref" of
+	// each source within the configurations.
+	//
+	// Modules that aren't pinned use the source from their configuration.
+	// Pinned sources are resolved just like any other source, so they can
+	// be aliases and use any syntax that a module source normally can.
+	Pins map[string]string
+
+	// RegistryPrefix is what sources starting with "@registry/" are
+	// expanded with, so that the registry that modules come from can be
+	// set in one place, such as per environment. For example, with the
+	// prefix "registry.example.com", "@registry/hashicorp/vpc/aws" expands
+	// to "registry.example.com/hashicorp/vpc/aws". The prefix can also
+	// include a path.
+	RegistryPrefix string
+
+	// ProjectRoot is the directory that sources starting with "root::"
+	// are relative to, such as "root::modules/vpc" for the "modules/vpc"
+	// directory of the repository. Unlike relative paths, these don't
+	// break when the file that uses them is moved. If blank, the directory
+	// of the root configuration is used.
+	//
+	// Local modules share the root of whatever imports them. Remote
+	// modules have their own root instead: the top of what was downloaded
+	// for them, such as the repository that a "//subdir" module is within,
+	// so that a remote module finds its own modules and not those of the
+	// project that imports it.
+	ProjectRoot string
+
+	// Approved, if not nil, is the list of the exact module versions that
+	// the load is allowed to use, such as the approved modules from an
+	// SBOM. The load rejects any module whose source and version aren't in
+	// the list, after pins and aliases are applied. Local file modules are
+	// part of the configuration itself, so they are always allowed. If
+	// Approved is nil, every module is allowed.
+	Approved []ApprovedModule
+
+	// Constraints, if not nil, maps module sources to the version
+	// constraints that the load applies to them, such as "~> 1.2" or
+	// ">= 1.0, < 2.0", so that the allowed versions of shared modules can
+	// be managed in one place. Sources are matched like they are for
+	// Approved, without their version.
+	//
+	// Registry sources are resolved to the newest version that satisfies
+	// both their own "version" parameter and the constraint. Other sources
+	// that can be pinned, such as git, must already be pinned to a version
+	// within the constraint, such as "ref=v1.2.3".
+	Constraints map[string]string
+
+	// Hook, if set, is called with the configuration of every module right
+	// after it is loaded, along with the full path of the module (the
+	// module names from the root joined by "."). The hook can modify the
+	// configuration in place, for example to inject standard defaults. It
+	// is called before the modules the configuration imports are loaded,
+	// so any changes to the modules themselves are respected, and before
+	// Validate.
+	//
+	// The tree being loaded is given first, with an empty path. Its
+	// configuration is the one the tree was created with rather than one
+	// that was just loaded, so the hook is given it again, with the
+	// changes from before, every time the tree is loaded, and the hook
+	// should make the same change only once.
+	//
+	// The configuration is the one belonging to the tree, so changes
+	// affect everything that uses the tree afterwards. The hook is never
+	// called concurrently. An error returned by the hook stops the load.
+	Hook func(string, *config.Config) error
+}
+
+// LoadWithOptions loads the tree like Load, with the given options. opts
+// may be nil for the defaults.
+func (t *Tree) LoadWithOptions(s Storage, opts *LoadOptions) error {
+	defer startCaching()()
+	if opts == nil {
+		opts = new(LoadOptions)
+	}
+
+	return t.loadAll(s, opts)
+}
+
+// loadState is what every level of a single load shares: its options, how
+// much of the download budget is left, the failures of each host, and the
+// parse errors so far. If done isn't nil, it is called with each child
+// once the child is loaded, which is how LoadBounded releases subtrees.
+type loadState struct {
+	*LoadOptions
+
+	budget  *downloadBudget
+	breaker *hostBreaker
+	parse   parseErrors
+	done    func(*Tree) error
+}
+
+// newLoadState returns the state for a new load with the given options.
+func newLoadState(opts *LoadOptions) *loadState {
+	return &loadState{
+		LoadOptions: opts,
+		budget:      newDownloadBudget(opts.MaxDownloadBytes),
+		breaker:     newHostBreaker(opts.CircuitBreakerFailures),
+		parse:       newParseErrors(opts.CollectParseErrors),
+	}
+}
+
+// LoadBounded is like Load followed by Validate, except that each module
+// is validated as soon as it and the modules it imports are loaded, and
+// the modules beneath it are released right after. This lets very large
+// trees be checked without holding every configuration at once. Loading
+// stops at the first error instead of reporting every invalid module.
+//
+// Like Load, the modules that a module imports are all parsed before any
+// of them is loaded, since they're needed to validate how the module
+// imports them. So what is kept in memory is the configurations along the
+// path being loaded along with all the modules that each of them imports,
+// which is still a lot for trees where modules import many others.
+//
+// Since the modules are released, the tree isn't loaded afterwards. Every
+// module is in the storage by then, so Load with GetModeNone loads the
+// tree again without downloading anything, at the cost of parsing every
+// configuration a second time.
+func (t *Tree) LoadBounded(s Storage, mode GetMode) error {
+	return t.LoadBoundedWithOptions(s, &LoadOptions{Mode: mode})
+}
+
+// LoadBoundedWithOptions is like LoadBounded, with the given options. opts
+// may be nil for the defaults. Every module is loaded, so their Prefix is
+// ignored.
+func (t *Tree) LoadBoundedWithOptions(s Storage, opts *LoadOptions) error {
+	defer startCaching()()
+	if opts == nil {
+		opts = new(LoadOptions)
+	}
+
+	if err := t.hookRoot(opts.Hook); err != nil {
+		return err
+	}
+
+	sem := make(chan struct{}, 1)
+	done := func(c *Tree) error {
+		if err := c.validateBounded(sem); err != nil {
+			// Name the module by its full path like Validate does
+			if verr, ok := err.(*TreeError); ok {
+				for i := len(c.path) - 2; i >= len(t.path); i-- {
+					verr.Name = append(verr.Name, c.path[i])
+				}
+				verr.Name = append(verr.Name, t.Name())
+			}
+
+			return err
+		}
+
+		return nil
+	}
+
+	l := newLoadState(opts)
+	l.done = done
+	err := t.load(s, nil, l)
+	if err == nil {
+		err = t.validateBounded(sem)
+	}
+
+	t.lock.Lock()
+	t.children = nil
+	t.lock.Unlock()
+
+	return err
+}
+
+// validateBounded validates the configuration of the tree and how it
+// imports its children for LoadBounded, and then releases the children.
+func (t *Tree) validateBounded(sem chan struct{}) error {
+	if err := t.validateConfig(true, sem); err != nil {
+		return err
+	}
+	if err := t.validateImports(t.Children()); err != nil {
+		return err
+	}
+
+	t.lock.Lock()
+	t.children = nil
+	t.lock.Unlock()
+
+	return nil
+}
+
+// caching is implemented by the Detectors and Getters that cache what
+// they look up over the network during an operation on a tree.
+type caching interface {
+	resetCache()
+}
+
+// cachingOps counts the operations on trees, such as loads, that are in
+// progress. Getters only cache what they look up while there are any,
+// since what they look up, such as the commit of a branch, can change.
+var cachingOps int32
+
+// startCaching forgets whatever the Detectors and Getters have cached, so
+// that each operation on a tree starts fresh, and enables caching until
+// the returned function is called at the end of the operation.
+func startCaching() func() {
+	atomic.AddInt32(&cachingOps, 1)
+	for _, d := range Detectors {
+		if c, ok := d.(caching); ok {
+			c.resetCache()
+		}
+	}
+	for _, g := range Getters {
+		if c, ok := g.(caching); ok {
+			c.resetCache()
+		}
+	}
+
+	return func() {
+		atomic.AddInt32(&cachingOps, -1)
+	}
+}
+
+// cachesActive returns whether an operation on a tree is in progress.
+func cachesActive() bool {
+	return atomic.LoadInt32(&cachingOps) > 0
+}
+
+// loadAll loads the tree with load, with the state shared by the whole
+// load.
+func (t *Tree) loadAll(s Storage, opts *LoadOptions) error {
+	if err := t.hookRoot(opts.Hook); err != nil {
+		return err
+	}
+
+	l := newLoadState(opts)
+	err := t.load(s, opts.Prefix, l)
+	if perr := l.parse.error(); perr != nil {
+		t.lock.Lock()
+		t.children = nil
+		t.lock.Unlock()
+
+		if err != nil {
+			return multierror.ErrorAppend(perr, err)
+		}
+
+		return perr
+	}
+
+	return err
+}
+
+// load loads the tree as described by LoadSubtree, with the modules along
+// prefix, and the options and state of the load in l.
+func (t *Tree) load(s Storage, prefix []string, l *loadState) error {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
+	if canceled(l.Cancel) {
+		return fmt.Errorf("canceled")
+	}
+
 	// Reset the children if we have any
 	t.children = nil
+	t.opts = l.LoadOptions
+
+	if err := t.addDeclaredDependencies(l.DeclaredDependencies); err != nil {
+		return err
+	}
+
+	// Typos in the parameters are caught before anything is downloaded
+	for _, m := range t.config.Modules {
+		if len(prefix) > 0 && m.Name != prefix[0] {
+			continue
+		}
+		if err := checkParams(m); err != nil {
+			return fmt.Errorf("module %s: %s", m.Name, err)
+		}
+	}
 
 	modules := t.Modules()
 	children := make(map[string]*Tree)
 
-	// Go through all the modules and get the directory for them.
-	update := mode == GetModeUpdate
+	// Go through all the modules and find the source for them.
+	var loading []*Module
+	sources := make(map[string]string)
+	names := make(map[string]struct{})
 	for _, m := range modules {
-		if _, ok := children[m.Name]; ok {
+		if _, ok := names[m.Name]; ok {
 			return fmt.Errorf(
 				"module %s: duplicated. module names must be unique", m.Name)
 		}
+		names[m.Name] = struct{}{}
+
+		if err := checkModuleName(m.Name); err != nil {
+			return err
+		}
+
+		// A missing source would otherwise fall through to Detect and
+		// produce a confusing error, so catch it early.
+		if m.Source == "" {
+			return fmt.Errorf("module %s: source is required", m.Name)
+		}
+
+		// Skip any modules that aren't along the path we're loading
+		if len(prefix) > 0 && m.Name != prefix[0] {
+			continue
+		}
 
-		source, err := Detect(m.Source, t.config.Dir)
+		source, err := t.source(m)
 		if err != nil {
 			return fmt.Errorf("module %s: %s", m.Name, err)
 		}
+		if l.Lock != nil {
+			source, err = l.Lock.source(t.childPath(m.Name), source)
+			if err != nil {
+				return fmt.Errorf("module %s: %s", m.Name, err)
+			}
+		}
 
-		if mode > GetModeNone {
-			// Get the module since we specified we should
-			if err := s.Get(source, update); err != nil {
-				return err
+		// Importing our own directory would recurse forever
+		if t.importsSelf(source) {
+			return fmt.Errorf("module %s: module cannot import itself", m.Name)
+		}
+
+		if err := checkApproved(source, l.Approved); err != nil {
+			return fmt.Errorf("module %s: %s", m.Name, err)
+		}
+		if l.ForbidLocal {
+			if err := checkLocal(source, t.remote); err != nil {
+				return fmt.Errorf("module %s: %s", m.Name, err)
 			}
 		}
+		if err := checkExec(source, t.remote); err != nil {
+			return fmt.Errorf("module %s: %s", m.Name, err)
+		}
+		if l.RequireHTTPS {
+			if err := checkHTTPS(source); err != nil {
+				return fmt.Errorf("module %s: %s", m.Name, err)
+			}
+		}
+
+		source, err = applyConstraints(source, l.Constraints)
+		if err != nil {
+			return fmt.Errorf("module %s: %s", m.Name, err)
+		}
+
+		loading = append(loading, m)
+		sources[m.Name] = source
+	}
+
+	actions := make(map[string]ModuleAction)
+	if l.Mode > GetModeNone {
+		// Get the modules since we specified we should
+		var err error
+		actions, err = getSources(s, l, loading, sources,
+			t.sourceSecrets(l.Secrets, loading, sources))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Go through all the modules and get the directory for them.
+	fs := storageFileSystem(s)
+	for _, m := range loading {
+		source := sources[m.Name]
 
 		// Get the directory where this module is so we can load it
 		dir, ok, err := s.Dir(source)
@@ -152,19 +658,96 @@ func (t *Tree) Load(s Storage, mode GetMode) error {
 				"module %s: not found, may need to be downloaded", m.Name)
 		}
 
+		// A source, or the subdirectory of one, can point at a single
+		// file, which can't be loaded as a module. This is caught here
+		// since it would otherwise look like an empty module.
+		isFile, err := isFileFS(fs, dir)
+		if err != nil {
+			return fmt.Errorf("module %s: %s", m.Name, err)
+		}
+		if isFile {
+			return fmt.Errorf(
+				"module %s: source resolved to a file, expected a directory",
+				m.Name)
+		}
+
+		// Make sure there is something to load. A mistake in the source
+		// can result in a successful download of the wrong directory.
+		ok, err = hasConfigFilesFS(fs, dir)
+		if err != nil {
+			return fmt.Errorf("module %s: %s", m.Name, err)
+		}
+		if !ok {
+			return fmt.Errorf(
+				"module %s: no Terraform configuration found in %s",
+				m.Name, dir)
+		}
+
 		// Load the configuration
-		children[m.Name], err = NewTreeModule(m.Name, dir)
+		child, err := NewTreeModuleFS(m.Name, fs, dir)
 		if err != nil {
+			if l.parse.add(t.childPath(m.Name), err) {
+				continue
+			}
+
 			return fmt.Errorf(
 				"module %s: %s", m.Name, err)
 		}
+		children[m.Name] = child
+		children[m.Name].path = t.childPath(m.Name)
+		children[m.Name].origin = source
+		children[m.Name].action = actions[source]
+		children[m.Name].remote = t.remote || getScheme(source) != "file"
+
+		// Remote modules have their own root, local ones share ours
+		children[m.Name].root = t.rootDir()
+		if getScheme(source) != "file" {
+			children[m.Name].root = dir
+			if base, subDir := getDirSubdir(source); subDir != "" {
+				if top, ok, err := s.Dir(base); err == nil && ok {
+					children[m.Name].root = top
+				}
+			}
+		}
+
+		if l.Hook != nil {
+			path := strings.Join(children[m.Name].path, ".")
+			if err := l.Hook(path, children[m.Name].config); err != nil {
+				return fmt.Errorf("module %s: %s", m.Name, err)
+			}
+		}
 	}
 
-	// Go through all the children and load them.
-	for _, c := range children {
-		if err := c.Load(s, mode); err != nil {
+	// The rest of the path applies to the children
+	var childPrefix []string
+	if len(prefix) > 0 {
+		if len(children) == 0 {
+			if _, ok := l.parse[strings.Join(t.childPath(prefix[0]), ".")]; ok {
+				return nil
+			}
+
+			return fmt.Errorf("module %s: not found", prefix[0])
+		}
+
+		childPrefix = prefix[1:]
+	}
+
+	// Go through all the children and load them, in the order of Modules
+	// so that loads are the same every time.
+	for _, m := range loading {
+		c, ok := children[m.Name]
+		if !ok {
+			continue
+		}
+
+		if err := c.load(s, childPrefix, l); err != nil {
 			return err
 		}
+		if l.done != nil {
+			if err := l.done(c); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Set our tree up
@@ -173,85 +756,698 @@ func (t *Tree) Load(s Storage, mode GetMode) error {
 	return nil
 }
 
-// String gives a nice output to describe the tree.
-func (t *Tree) String() string {
-	var result bytes.Buffer
-	result.WriteString(t.Name() + "\n")
-
-	cs := t.Children()
-	if cs == nil {
-		result.WriteString("  not loaded")
-	} else {
-		// Go through each child and get its string value, then indent it
-		// by two.
-		for _, c := range cs {
-			r := strings.NewReader(c.String())
-			scanner := bufio.NewScanner(r)
-			for scanner.Scan() {
-				result.WriteString("  ")
-				result.WriteString(scanner.Text())
-				result.WriteString("\n")
-			}
-		}
+// hookRoot calls hook, if not nil, with the configuration of the tree that
+// is being loaded, which is the one it was created with. See
+// LoadOptions.Hook.
+func (t *Tree) hookRoot(hook func(string, *config.Config) error) error {
+	if hook == nil {
+		return nil
 	}
 
-	return result.String()
-}
+	t.lock.Lock()
+	defer t.lock.Unlock()
 
-// Validate does semantic checks on the entire tree of configurations.
-//
-// This will call the respective config.Config.Validate() functions as well
-// as verifying things such as parameters/outputs between the various modules.
-//
-// Load must be called prior to calling Validate or an error will be returned.
-func (t *Tree) Validate() error {
-	if !t.Loaded() {
-		return fmt.Errorf("tree must be loaded before calling Validate")
+	c := t.base
+	if c == nil {
+		c = t.config
+	}
+	if err := hook(strings.Join(t.path, "."), c); err != nil {
+		return fmt.Errorf("module %s: %s", t.Name(), err)
 	}
 
-	// If something goes wrong, here is our error template
-	newErr := &TreeError{Name: []string{t.Name()}}
+	return nil
+}
 
-	// Validate our configuration first.
-	if err := t.config.Validate(); err != nil {
-		newErr.Err = err
-		return newErr
+// DefaultLoadConcurrency is the number of modules that a load downloads at
+// the same time if LoadOptions.Concurrency isn't set.
+const DefaultLoadConcurrency = 4
+
+// concurrency returns the number of modules to download at once.
+func (l *loadState) concurrency() int {
+	if l.Concurrency < 1 {
+		return DefaultLoadConcurrency
 	}
 
-	// Get the child trees
-	children := t.Children()
+	return l.Concurrency
+}
 
-	// Validate all our children
-	for _, c := range children {
-		err := c.Validate()
-		if err == nil {
+// getSources gets the sources of the given modules from the storage in
+// parallel, limited by the concurrency of l. Modules that share a source are
+// only gotten once, so the same storage location is never written to
+// concurrently. The result maps each source to what getting it did. The
+// first error in module order is returned, unless the budget of l was
+// exceeded or its breaker gave up on a host, which are reported instead.
+// Both are shared by every level of the load. The sources in secrets are
+// gotten with their resolver, and with the RequireHTTPS of l, if s is an
+// OptionsStorage.
+//
+// Once the load is canceled or the budget is exceeded, downloads are
+// stopped if s supports it, and modules that haven't started downloading
+// are skipped.
+func getSources(
+	s Storage, l *loadState, modules []*Module, sources map[string]string,
+	secrets map[string]SecretResolver) (map[string]ModuleAction, error) {
+	update := l.Mode == GetModeUpdate
+	budget, breaker := l.budget, l.breaker
+	cancel, release := budget.cancel(l.Cancel)
+	defer release()
+
+	errs := make([]error, len(modules))
+	actions := make([]ModuleAction, len(modules))
+	seen := make(map[string]struct{})
+	sem := make(chan struct{}, l.concurrency())
+	var wg sync.WaitGroup
+	for i, m := range modules {
+		source := sources[m.Name]
+		if _, ok := seen[source]; ok {
 			continue
 		}
+		seen[source] = struct{}{}
 
-		verr, ok := err.(*TreeError)
-		if !ok {
-			// Unknown error, just return...
-			return err
-		}
+		// The slots are taken in module order, so that the modules are
+		// started in that order
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, source string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if canceled(cancel) || budget.error() != nil {
+				errs[i] = fmt.Errorf("canceled")
+				return
+			}
+
+			if !breaker.allow(source) {
+				errs[i] = fmt.Errorf("host is down: %s", source)
+				return
+			}
 
-		// Append ourselves to the error and then return
-		verr.Name = append(verr.Name, t.Name())
-		return verr
+			actions[i] = ModuleActionGot
+			if ost, ok := s.(OptionsStorage); ok {
+				actions[i], errs[i] = ost.GetWithOptions(source, &StorageGetOptions{
+					Update:       update,
+					Cancel:       cancel,
+					Secrets:      secrets[source],
+					Progress:     budget.progress(source),
+					RequireHTTPS: l.RequireHTTPS,
+				})
+				budget.done(source)
+			} else if as, ok := s.(ActionStorage); ok {
+				actions[i], errs[i] = as.GetAction(source, update, cancel)
+			} else if cs, ok := s.(CancelStorage); ok {
+				errs[i] = cs.GetCancel(source, update, cancel)
+			} else {
+				errs[i] = s.Get(source, update)
+			}
+			if errs[i] == nil {
+				errs[i] = budget.count(s, source, actions[i])
+			}
+			if !canceled(cancel) {
+				breaker.done(source, errs[i])
+			}
+		}(i, source)
 	}
+	wg.Wait()
 
-	// Go over all the modules and verify that any parameters are valid
-	// variables into the module in question.
-	for _, m := range t.config.Modules {
-		tree, ok := children[m.Name]
-		if !ok {
-			// This should never happen because Load watches us
-			panic("module not found in children: " + m.Name)
-		}
+	if err := budget.error(); err != nil {
+		return nil, err
+	}
+	if err := breaker.err(); err != nil {
+		return nil, err
+	}
 
-		// Build the variables that the module defines
-		varMap := make(map[string]struct{})
-		for _, v := range tree.config.Variables {
-			varMap[v.Name] = struct{}{}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := make(map[string]ModuleAction)
+	for i, m := range modules {
+		if _, ok := result[sources[m.Name]]; !ok {
+			result[sources[m.Name]] = actions[i]
+		}
+	}
+
+	return result, nil
+}
+
+// HasUpdates checks every module in the tree for available updates
+// without downloading anything. The result is keyed by the full path of
+// the module, which is the module names from the root joined by ".".
+// Modules that use the same git repository only list its refs once.
+//
+// Load must be called prior to calling HasUpdates or an error will be
+// returned.
+func (t *Tree) HasUpdates(s Storage) (map[string]bool, error) {
+	if !t.Loaded() {
+		return nil, fmt.Errorf("tree must be loaded before calling HasUpdates")
+	}
+	defer startCaching()()
+
+	result := make(map[string]bool)
+	err := t.walkModules(func(path []string, parent *Tree, m *Module) error {
+		key := strings.Join(path, ".")
+		source, err := parent.loadedSource(m)
+		if err != nil {
+			return fmt.Errorf("module %s: %s", key, err)
+		}
+
+		us, ok := s.(UpdateStorage)
+		if !ok {
+			result[key] = true
+			return nil
+		}
+
+		result[key], err = us.UpdateAvailable(source)
+		if err != nil {
+			return fmt.Errorf("module %s: %s", key, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Orphans returns the sources of the modules in the storage that aren't
+// imported anywhere in the tree, such as modules left behind after their
+// source was changed. Modules are matched by the source they were loaded
+// from, after the lock file and constraints were applied. Nothing is
+// removed from the storage.
+//
+// The storage must be a ListStorage, such as FolderStorage. Load must be
+// called prior to calling Orphans or an error will be returned, since
+// every module that is imported must be known.
+func (t *Tree) Orphans(s Storage) ([]string, error) {
+	if !t.Loaded() {
+		return nil, fmt.Errorf("tree must be loaded before calling Orphans")
+	}
+
+	used := make(map[string]struct{})
+	err := t.walkModules(func(path []string, parent *Tree, m *Module) error {
+		source, err := parent.loadedSource(m)
+		if err != nil {
+			return fmt.Errorf("module %s: %s", strings.Join(path, "."), err)
+		}
+
+		// The storage only knows the whole source that is downloaded
+		source, _ = getDirSubdir(source)
+		used[source] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ls, ok := s.(ListStorage)
+	if !ok {
+		return nil, fmt.Errorf("storage can't list the modules it has")
+	}
+	sources, err := ls.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for _, source := range sources {
+		if _, ok := used[source]; !ok {
+			result = append(result, source)
+		}
+	}
+	sort.Strings(result)
+
+	return result, nil
+}
+
+// PrunePlan returns the sources in the storage that pruning it for this
+// tree would remove, without removing anything, so that they can be
+// reviewed first. These are the sources that Orphans returns, found with
+// only the list of the storage and the sources that the tree imports.
+//
+// The storage must be a ListStorage, and the tree must be loaded.
+func (t *Tree) PrunePlan(s Storage) ([]string, error) {
+	return t.Orphans(s)
+}
+
+// CheckSources verifies that the source of every module in the tree could
+// be downloaded, without downloading any of them, so that dead sources
+// and authentication problems are found before a long load. Modules that
+// share a source are only checked once. All failures are returned
+// together.
+//
+// The tree doesn't have to be loaded. The modules that an unloaded module
+// imports aren't known yet, however, so they can't be checked.
+func (t *Tree) CheckSources(s Storage) error {
+	defer startCaching()()
+
+	var result error
+	checked := make(map[string]error)
+	t.walkModules(func(path []string, parent *Tree, m *Module) error {
+		key := strings.Join(path, ".")
+		source, err := parent.loadedSource(m)
+		if err == nil {
+			var ok bool
+			if err, ok = checked[source]; !ok {
+				if cs, ok := s.(CheckStorage); ok {
+					err = cs.Check(source)
+				} else {
+					err = Check(source)
+				}
+				checked[source] = err
+			}
+		}
+		if err != nil {
+			result = multierror.ErrorAppend(
+				result, fmt.Errorf("module %s: %s", key, err))
+		}
+
+		return nil
+	})
+
+	return result
+}
+
+// SourcesByHost groups the modules in the tree by the host that their
+// source is downloaded from. The result maps each host to the full paths
+// of the modules (the module names from the root joined by ".") that come
+// from it, sorted. Local file sources are grouped under "local".
+//
+// Load must be called prior to calling SourcesByHost or an error will be
+// returned.
+func (t *Tree) SourcesByHost() (map[string][]string, error) {
+	if !t.Loaded() {
+		return nil, fmt.Errorf(
+			"tree must be loaded before calling SourcesByHost")
+	}
+
+	result := make(map[string][]string)
+	err := t.walkModules(func(path []string, parent *Tree, m *Module) error {
+		key := strings.Join(path, ".")
+		source, err := parent.loadedSource(m)
+		if err != nil {
+			return fmt.Errorf("module %s: %s", key, err)
+		}
+
+		_, source = getForcedGetter(source)
+		u, err := url.Parse(source)
+		if err != nil {
+			return fmt.Errorf("module %s: %s", key, err)
+		}
+
+		host := u.Host
+		switch u.Scheme {
+		case "file":
+			host = "local"
+		case "ipfs":
+			// The "host" is the content identifier, and the content can
+			// come from any gateway.
+			host = "ipfs"
+		case "magnet":
+			// The content comes from the peers of the torrent.
+			host = "torrent"
+		}
+
+		result[host] = append(result[host], key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, paths := range result {
+		sort.Strings(paths)
+	}
+
+	return result, nil
+}
+
+// Dot returns the tree in the Graphviz DOT format. Each module is a node
+// named by its full path from the root, and each import is an edge labeled
+// with the scheme of the source that the module comes from.
+func (t *Tree) Dot() string {
+	buf := new(bytes.Buffer)
+	buf.WriteString("digraph {\n")
+	buf.WriteString(fmt.Sprintf("\t\"%s\";\n", t.Name()))
+	t.walkModules(func(path []string, parent *Tree, m *Module) error {
+		if _, ok := parent.Children()[m.Name]; !ok {
+			return nil
+		}
+
+		parentName := t.Name()
+		if len(path) > 1 {
+			parentName = strings.Join(path[:len(path)-1], ".")
+		}
+		name := strings.Join(path, ".")
+
+		var scheme string
+		if source, err := parent.loadedSource(m); err == nil {
+			scheme = getScheme(source)
+		}
+
+		buf.WriteString(fmt.Sprintf(
+			"\t\"%s\" -> \"%s\" [label=\"%s\"];\n",
+			parentName, name, scheme))
+		buf.WriteString(fmt.Sprintf("\t\"%s\";\n", name))
+		return nil
+	})
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// walkModules calls fn for every module imported anywhere in the tree,
+// depth first and in the order returned by Modules. fn is given
+// the full path of the module from this tree along with the tree that
+// imports it. Modules that haven't been loaded are visited, but not
+// descended into. Walking stops at the first error returned by fn.
+func (t *Tree) walkModules(fn func([]string, *Tree, *Module) error) error {
+	return t.walkModulesPrefix(nil, fn)
+}
+
+func (t *Tree) walkModulesPrefix(
+	prefix []string, fn func([]string, *Tree, *Module) error) error {
+	children := t.Children()
+	for _, m := range t.Modules() {
+		path := make([]string, len(prefix), len(prefix)+1)
+		copy(path, prefix)
+		path = append(path, m.Name)
+
+		if err := fn(path, t, m); err != nil {
+			return err
+		}
+
+		if c, ok := children[m.Name]; ok {
+			if err := c.walkModulesPrefix(path, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// importsSelf returns whether the detected source is a local path to the
+// directory of this tree's own configuration. Both sides are compared
+// with symlinks resolved, since downloaded local modules are symlinks.
+func (t *Tree) importsSelf(source string) bool {
+	if t.config.Dir == "" || getScheme(source) != "file" {
+		return false
+	}
+
+	_, source = getForcedGetter(source)
+	u, err := url.Parse(source)
+	if err != nil {
+		return false
+	}
+
+	dir, err := filepath.EvalSymlinks(t.config.Dir)
+	if err != nil {
+		return false
+	}
+	path, err := filepath.EvalSymlinks(u.Path)
+	if err != nil {
+		return false
+	}
+
+	return dir == path
+}
+
+// childPath returns the full path from the root of the module with the
+// given name that this tree imports.
+func (t *Tree) childPath(name string) []string {
+	path := make([]string, len(t.path), len(t.path)+1)
+	copy(path, t.path)
+	return append(path, name)
+}
+
+// source returns the fully detected source for a module imported by
+// this tree, using the pinned source if there is one. The options of the
+// last load of the tree are used, if it was loaded.
+func (t *Tree) source(m *Module) (string, error) {
+	opts := t.opts
+	if opts == nil {
+		opts = new(LoadOptions)
+	}
+
+	return resolveSource(
+		pinnedSource(t.childPath(m.Name), m.Source, opts.Pins),
+		t.config.Dir, t.rootDir(), opts)
+}
+
+// loadedSource returns the source that a module imported by this tree was
+// loaded from, after the lock file and constraints were applied. If the
+// module isn't loaded, the source is detected as by source.
+func (t *Tree) loadedSource(m *Module) (string, error) {
+	if c, ok := t.Children()[m.Name]; ok && c.origin != "" {
+		return c.origin, nil
+	}
+
+	return t.source(m)
+}
+
+// rootDir returns the directory that "root::" sources imported by this
+// tree are relative to. See LoadOptions.ProjectRoot.
+func (t *Tree) rootDir() string {
+	if t.root != "" {
+		return t.root
+	}
+	if t.opts != nil && t.opts.ProjectRoot != "" {
+		return t.opts.ProjectRoot
+	}
+
+	return t.config.Dir
+}
+
+// resolveSource expands any alias, project root, and registry prefix in
+// the source, with the aliases and prefix of opts, and then detects it
+// relative to pwd.
+func resolveSource(src, pwd, root string, opts *LoadOptions) (string, error) {
+	source, err := resolveAlias(src, opts.Aliases)
+	if err != nil {
+		return "", err
+	}
+
+	source, err = expandRoot(source, root)
+	if err != nil {
+		return "", err
+	}
+
+	source, err = expandRegistryPrefix(source, opts.RegistryPrefix)
+	if err != nil {
+		return "", err
+	}
+
+	return Detect(source, pwd)
+}
+
+// String gives a nice output to describe the tree.
+func (t *Tree) String() string {
+	var result bytes.Buffer
+	result.WriteString(t.Name() + "\n")
+
+	cs := t.Children()
+	if cs == nil {
+		result.WriteString("  not loaded")
+	} else {
+		// Go through each child and get its string value, then indent it
+		// by two.
+		for _, c := range cs {
+			r := strings.NewReader(c.String())
+			scanner := bufio.NewScanner(r)
+			for scanner.Scan() {
+				result.WriteString("  ")
+				result.WriteString(scanner.Text())
+				result.WriteString("\n")
+			}
+		}
+	}
+
+	return result.String()
+}
+
+// Validate does semantic checks on the entire tree of configurations.
+//
+// This will call the respective config.Config.Validate() functions as well
+// as verifying things such as parameters/outputs between the various modules.
+//
+// Load must be called prior to calling Validate or an error will be returned.
+func (t *Tree) Validate() error {
+	if !t.Loaded() {
+		return fmt.Errorf("tree must be loaded before calling Validate")
+	}
+
+	return t.validate(true, make(chan struct{}, validateConcurrency()))
+}
+
+// ValidateStrict is like Validate, except that the warnings of Lint are
+// errors as well, so that a tree that is valid but doesn't follow the
+// practices Lint checks for is rejected. The warnings are only checked
+// once the tree is otherwise valid.
+//
+// Load must be called prior to calling ValidateStrict or an error will be
+// returned.
+func (t *Tree) ValidateStrict() error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	return t.LintStrict()
+}
+
+// ValidateWiring is like Validate, except that only the wiring between
+// the modules is checked: that the parameters given to each module are
+// variables of the module, that the module outputs that are used exist,
+// and that the outputs only reference the variables, resources and modules
+// that their module declares. The rest of the configurations isn't
+// validated, which makes this faster when they are validated separately.
+//
+// Load must be called prior to calling ValidateWiring or an error will be
+// returned.
+func (t *Tree) ValidateWiring() error {
+	if !t.Loaded() {
+		return fmt.Errorf("tree must be loaded before calling ValidateWiring")
+	}
+
+	return t.validate(false, make(chan struct{}, validateConcurrency()))
+}
+
+// ValidateConcurrency is the maximum number of configurations that
+// Validate checks at the same time. The configurations of the modules in
+// a tree are independent of each other, so large trees are validated much
+// faster in parallel. Setting this to 1 validates one configuration at a
+// time.
+var ValidateConcurrency = runtime.NumCPU()
+
+// validateConcurrency returns the number of configurations to validate at
+// once.
+func validateConcurrency() int {
+	if ValidateConcurrency < 1 {
+		return 1
+	}
+
+	return ValidateConcurrency
+}
+
+// validate validates the tree, validating each configuration as well if
+// configs is true. The children are validated in parallel, with sem
+// limiting how many configurations are validated at once. The errors of
+// all the children are returned together, ordered by path so that they
+// are the same every time.
+func (t *Tree) validate(configs bool, sem chan struct{}) error {
+	// Validate our configuration first.
+	if err := t.validateConfig(configs, sem); err != nil {
+		return err
+	}
+
+	// Get the child trees
+	children := t.Children()
+	names := make([]string, 0, len(children))
+	for n := range children {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	// Validate all our children
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, n := range names {
+		wg.Add(1)
+		go func(i int, c *Tree) {
+			defer wg.Done()
+			errs[i] = c.validate(configs, sem)
+		}(i, children[n])
+	}
+	wg.Wait()
+
+	var result []error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		cerrs := []error{err}
+		if merr, ok := err.(*multierror.Error); ok {
+			cerrs = merr.Errors
+		}
+
+		// Append ourselves to the errors so they have the full path.
+		// Unknown errors are returned as they are.
+		for _, cerr := range cerrs {
+			if verr, ok := cerr.(*TreeError); ok {
+				verr.Name = append(verr.Name, t.Name())
+			}
+			result = append(result, cerr)
+		}
+	}
+	switch len(result) {
+	case 0:
+	case 1:
+		return result[0]
+	default:
+		return &multierror.Error{Errors: result}
+	}
+
+	return t.validateImports(children)
+}
+
+// validateConfig validates the configuration of the tree itself if configs
+// is true, with sem limiting how many configurations are validated at
+// once, and otherwise only the references of its outputs.
+func (t *Tree) validateConfig(configs bool, sem chan struct{}) error {
+	newErr := &TreeError{Name: []string{t.Name()}}
+	if configs {
+		sem <- struct{}{}
+		err := t.config.Validate()
+		if err == nil {
+			err = validateVariableTypes(t.config)
+		}
+		<-sem
+
+		if err != nil {
+			newErr.Err = err
+			return newErr
+		}
+	} else if err := validateOutputReferences(t.config); err != nil {
+		// The outputs are what the parent wires into the rest of the
+		// tree, so they're checked even when the configuration isn't.
+		newErr.Err = err
+		return newErr
+	}
+
+	return nil
+}
+
+// validateImports validates how the tree wires in the modules it imports,
+// which are the given children.
+func (t *Tree) validateImports(children map[string]*Tree) error {
+	// If something goes wrong, here is our error template
+	newErr := &TreeError{Name: []string{t.Name()}}
+
+	// Go over all the modules and verify that any parameters are valid
+	// variables into the module in question.
+	for _, m := range t.config.Modules {
+		if err := checkModuleName(m.Name); err != nil {
+			newErr.Err = err
+			return newErr
+		}
+
+		tree, ok := children[m.Name]
+		if !ok {
+			// Load always loads every module unless it fails or only a
+			// subtree was loaded, in which case the tree is incomplete.
+			newErr.Err = fmt.Errorf(
+				"module %s: not loaded, the tree must be fully loaded "+
+					"to be validated", m.Name)
+			return newErr
+		}
+
+		// Build the variables that the module defines
+		varMap := make(map[string]struct{})
+		for _, v := range tree.config.Variables {
+			varMap[v.Name] = struct{}{}
 		}
 
 		// Compare to the keys in our raw config for the module
@@ -263,6 +1459,21 @@ func (t *Tree) Validate() error {
 				return newErr
 			}
 		}
+
+		// A module can't be configured with its own outputs, since the
+		// outputs depend on the parameters.
+		for _, v := range m.RawConfig.Variables {
+			mv, ok := v.(*config.ModuleVariable)
+			if !ok || mv.Name != m.Name {
+				continue
+			}
+
+			newErr.Err = fmt.Errorf(
+				"module %s: parameters can't reference the module's "+
+					"own outputs: %s",
+				m.Name, mv.FullKey())
+			return newErr
+		}
 	}
 
 	// Go over all the variables used and make sure that any module
@@ -276,8 +1487,10 @@ func (t *Tree) Validate() error {
 
 			tree, ok := children[mv.Name]
 			if !ok {
-				// This should never happen because Load watches us
-				panic("module not found in children: " + mv.Name)
+				newErr.Err = fmt.Errorf(
+					"%s: module %s not loaded, the tree must be fully "+
+						"loaded to be validated", source, mv.Name)
+				return newErr
 			}
 
 			found := false
@@ -299,6 +1512,449 @@ func (t *Tree) Validate() error {
 	return nil
 }
 
+// validateOutputReferences checks that the outputs of the configuration
+// only reference the variables, resources and modules that it declares.
+// Every undefined reference is returned, sorted so that the errors are the
+// same every time.
+func validateOutputReferences(c *config.Config) error {
+	declared := make(map[string]struct{})
+	for _, v := range c.Variables {
+		declared["var."+v.Name] = struct{}{}
+	}
+	for _, r := range c.Resources {
+		declared[r.Id()] = struct{}{}
+	}
+	for _, m := range c.Modules {
+		declared["module."+m.Name] = struct{}{}
+	}
+
+	undefined := make(map[string]struct{})
+	for _, o := range c.Outputs {
+		for _, v := range o.RawConfig.Variables {
+			var key, kind string
+			switch v := v.(type) {
+			case *config.UserVariable:
+				key, kind = "var."+v.Name, "variable"
+			case *config.ResourceVariable:
+				key, kind = v.Type+"."+v.Name, "resource"
+			case *config.ModuleVariable:
+				key, kind = "module."+v.Name, "module"
+			default:
+				continue
+			}
+
+			if _, ok := declared[key]; !ok {
+				undefined[fmt.Sprintf(
+					"output %s: references undefined %s %s",
+					o.Name, kind, key)] = struct{}{}
+			}
+		}
+	}
+
+	msgs := make([]string, 0, len(undefined))
+	for msg := range undefined {
+		msgs = append(msgs, msg)
+	}
+	sort.Strings(msgs)
+
+	var result error
+	for _, msg := range msgs {
+		result = multierror.ErrorAppend(result, errors.New(msg))
+	}
+
+	return result
+}
+
+// variableTypes are the types that a variable can declare, by name.
+var variableTypes = map[string]config.VariableType{
+	"string": config.VariableTypeString,
+	"map":    config.VariableTypeMap,
+}
+
+// validateVariableTypes checks that the default of each variable that
+// declares a type is of that type. Variables without a declared type or
+// without a default are skipped.
+func validateVariableTypes(c *config.Config) error {
+	for _, v := range c.Variables {
+		if v.DeclaredType == "" {
+			continue
+		}
+
+		expected, ok := variableTypes[v.DeclaredType]
+		if !ok {
+			return fmt.Errorf(
+				"variable %s: unknown type %s, must be string or map",
+				v.Name, v.DeclaredType)
+		}
+		if v.Default == nil {
+			continue
+		}
+
+		if actual := v.Type(); actual != expected {
+			got := "string"
+			if actual == config.VariableTypeMap {
+				got = "map"
+			}
+
+			return fmt.Errorf(
+				"variable %s: default must be a %s, got a %s",
+				v.Name, v.DeclaredType, got)
+		}
+	}
+
+	return nil
+}
+
+// hasConfigFiles returns whether the directory contains at least one
+// Terraform configuration file.
+func hasConfigFiles(dir string) (bool, error) {
+	for _, pattern := range []string{"*.tf", "*.tf.json"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return false, err
+		}
+		if len(matches) > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// lintUndocumented returns a warning for each variable and output of the
+// configuration that has no description, sorted by name.
+func lintUndocumented(c *config.Config) []string {
+	var variables, outputs []string
+	for _, v := range c.Variables {
+		if strings.TrimSpace(v.Description) == "" {
+			variables = append(variables, v.Name)
+		}
+	}
+	for _, o := range c.Outputs {
+		if strings.TrimSpace(o.Description) == "" {
+			outputs = append(outputs, o.Name)
+		}
+	}
+	sort.Strings(variables)
+	sort.Strings(outputs)
+
+	warns := make([]string, 0, len(variables)+len(outputs))
+	for _, n := range variables {
+		warns = append(warns, fmt.Sprintf("variable %s has no description", n))
+	}
+	for _, n := range outputs {
+		warns = append(warns, fmt.Sprintf("output %s has no description", n))
+	}
+
+	return warns
+}
+
+// lintPinParams are the query parameters that pin a source to a specific
+// version, by the scheme of the source. Sources with schemes that aren't
+// listed here, such as local files, don't need to be pinned.
+var lintPinParams = map[string][]string{
+	"git":   []string{"ref"},
+	"hg":    []string{"rev"},
+	"http":  []string{"ref", "rev", "version"},
+	"https": []string{"ref", "rev", "version"},
+
+	"registry": []string{"version"},
+}
+
+// LintMaxDuplicates is the most times that the same source can be imported
+// within a tree before Lint warns about it. Each import of a source is
+// loaded separately, which is a lot of duplicated work for large modules.
+var LintMaxDuplicates = 3
+
+// LintDocumentation, if true, makes Lint warn about the variables and
+// outputs of imported modules that have no description, so that shared
+// modules are documented for the teams that use them. By default
+// documentation isn't checked.
+var LintDocumentation bool
+
+// Lint checks the tree for practices that are allowed but discouraged,
+// returning a warning for each problem found. Currently this reports:
+//
+//   - Remote sources that aren't pinned to a version, which means that the
+//     module can change underneath the configuration.
+//   - Sources that are imported more than LintMaxDuplicates times, which
+//     might be better shared.
+//   - Remote sources that are written in different ways that resolve to
+//     the same source, such as "github.com/foo/bar" and
+//     "git::https://github.com/foo/bar.git", which should be unified.
+//   - Remote sources that are pinned to different versions in different
+//     parts of the tree, as returned by VersionSkew.
+//   - Modules that are possibly dead: none of their outputs are used and
+//     neither they nor the modules they import declare any resources.
+//     Only loaded modules are checked for this.
+//   - Variables and outputs of modules that have no description, if
+//     LintDocumentation is enabled. Only loaded modules are checked for
+//     this, and the variables and outputs of the tree itself aren't.
+//
+// If the tree is loaded, all modules in the tree are checked. Otherwise,
+// only the modules imported by this tree are.
+func (t *Tree) Lint() []string {
+	var warns []string
+	imports := make(map[string][]string)
+	variants := make(map[string]map[string]struct{})
+	t.walkModules(func(path []string, parent *Tree, m *Module) error {
+		source, err := parent.source(m)
+		if err != nil {
+			// Load reports bad sources
+			return nil
+		}
+
+		key := strings.Join(path, ".")
+		imports[source] = append(imports[source], key)
+		if getScheme(source) != "file" {
+			if variants[source] == nil {
+				variants[source] = make(map[string]struct{})
+			}
+			variants[source][m.Source] = struct{}{}
+		}
+		if w := lintPinned(source); w != "" {
+			warns = append(warns, fmt.Sprintf(
+				"module %s: %s: %s", key, w, m.Source))
+		}
+
+		child, ok := parent.Children()[m.Name]
+		if !ok {
+			return nil
+		}
+		if _, ok := lintUsedModules(parent.config)[m.Name]; !ok && !child.hasResources() {
+			warns = append(warns, fmt.Sprintf(
+				"module %s: possibly unused, none of its outputs are used "+
+					"and it has no resources", key))
+		}
+		if LintDocumentation {
+			for _, w := range lintUndocumented(child.config) {
+				warns = append(warns, fmt.Sprintf("module %s: %s", key, w))
+			}
+		}
+
+		return nil
+	})
+
+	sources := make([]string, 0, len(imports))
+	for source, paths := range imports {
+		if len(paths) > LintMaxDuplicates {
+			sources = append(sources, source)
+		}
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		paths := imports[source]
+		warns = append(warns, fmt.Sprintf(
+			"source %s is imported %d times (%s), consider importing it "+
+				"once and sharing it",
+			source, len(paths), strings.Join(paths, ", ")))
+	}
+
+	// Relative file sources naturally differ between directories, so only
+	// remote sources are compared.
+	sources = sources[:0]
+	for source, raw := range variants {
+		if len(raw) > 1 {
+			sources = append(sources, source)
+		}
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		raw := make([]string, 0, len(variants[source]))
+		for v := range variants[source] {
+			raw = append(raw, v)
+		}
+		sort.Strings(raw)
+
+		warns = append(warns, fmt.Sprintf(
+			"source %s is written in different ways (%s), consider using "+
+				"the same source everywhere",
+			source, strings.Join(raw, ", ")))
+	}
+
+	for _, skew := range t.VersionSkew() {
+		versions := make([]string, 0, len(skew.Versions))
+		for v := range skew.Versions {
+			versions = append(versions, v)
+		}
+		sort.Strings(versions)
+
+		uses := make([]string, len(versions))
+		for i, v := range versions {
+			uses[i] = fmt.Sprintf(
+				"%s in %s", v, strings.Join(skew.Versions[v], ", "))
+		}
+		warns = append(warns, fmt.Sprintf(
+			"source %s is pinned to different versions (%s), consider "+
+				"using the same version everywhere",
+			skew.Source, strings.Join(uses, "; ")))
+	}
+
+	return warns
+}
+
+// SourceVersions are the versions that a source is pinned to within a
+// tree, as returned by VersionSkew.
+type SourceVersions struct {
+	// Source is the detected source without its version or subdirectory,
+	// example: "git::https://github.com/hashicorp/foo.git".
+	Source string
+
+	// Versions maps each version of the source to the full paths of the
+	// modules that are pinned to it, such as "foo.bar".
+	Versions map[string][]string
+}
+
+// VersionSkew returns the remote sources that are pinned to more than one
+// version within the tree, sorted by source. Sources are compared without
+// their subdirectory, so modules kept in the same repository are grouped
+// together, and sources that aren't pinned are ignored since Lint already
+// warns about them. Importing different versions can be intentional, such
+// as during a migration, so Lint only warns about these.
+//
+// If the tree is loaded, all modules in the tree are checked. Otherwise,
+// only the modules imported by this tree are.
+func (t *Tree) VersionSkew() []SourceVersions {
+	versions := make(map[string]map[string][]string)
+	t.walkModules(func(path []string, parent *Tree, m *Module) error {
+		source, err := parent.loadedSource(m)
+		if err != nil {
+			// Load reports bad sources
+			return nil
+		}
+
+		source, version := sourceVersion(source)
+		if version == "" {
+			return nil
+		}
+		source, _ = getDirSubdir(source)
+
+		if versions[source] == nil {
+			versions[source] = make(map[string][]string)
+		}
+		versions[source][version] = append(
+			versions[source][version], strings.Join(path, "."))
+		return nil
+	})
+
+	var result []SourceVersions
+	for source, vs := range versions {
+		if len(vs) > 1 {
+			result = append(result, SourceVersions{
+				Source:   source,
+				Versions: vs,
+			})
+		}
+	}
+	sort.Sort(sourceVersionsSort(result))
+
+	return result
+}
+
+// sourceVersionsSort implements sort.Interface to sort by source.
+type sourceVersionsSort []SourceVersions
+
+func (s sourceVersionsSort) Len() int           { return len(s) }
+func (s sourceVersionsSort) Less(i, j int) bool { return s[i].Source < s[j].Source }
+func (s sourceVersionsSort) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// LintStrict is like Lint, except that the warnings are returned as an
+// error, which is nil if there aren't any. This is for enforcing the
+// practices that Lint checks for, such as in CI, rather than only
+// advising them.
+func (t *Tree) LintStrict() error {
+	warns := t.Lint()
+
+	var result []error
+	for _, w := range warns {
+		result = append(result, fmt.Errorf("warning: %s", w))
+	}
+	switch len(result) {
+	case 0:
+		return nil
+	case 1:
+		return result[0]
+	default:
+		return &multierror.Error{Errors: result}
+	}
+}
+
+// lintUsedModules returns the names of the modules whose outputs are used
+// anywhere in the configuration.
+func lintUsedModules(c *config.Config) map[string]struct{} {
+	var raws []*config.RawConfig
+	for _, pc := range c.ProviderConfigs {
+		raws = append(raws, pc.RawConfig)
+	}
+	for _, m := range c.Modules {
+		raws = append(raws, m.RawConfig)
+	}
+	for _, r := range c.Resources {
+		raws = append(raws, r.RawConfig)
+		for _, p := range r.Provisioners {
+			raws = append(raws, p.RawConfig, p.ConnInfo)
+		}
+	}
+	for _, o := range c.Outputs {
+		raws = append(raws, o.RawConfig)
+	}
+
+	result := make(map[string]struct{})
+	for _, raw := range raws {
+		if raw == nil {
+			continue
+		}
+
+		for _, v := range raw.Variables {
+			if mv, ok := v.(*config.ModuleVariable); ok {
+				result[mv.Name] = struct{}{}
+			}
+		}
+	}
+
+	return result
+}
+
+// hasResources returns whether the tree or any loaded module within it
+// declares a resource.
+func (t *Tree) hasResources() bool {
+	if len(t.config.Resources) > 0 {
+		return true
+	}
+
+	for _, c := range t.Children() {
+		if c.hasResources() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lintPinned returns a warning if the detected source is a remote source
+// that isn't pinned to a version, and otherwise a blank string.
+func lintPinned(source string) string {
+	params, ok := lintPinParams[getScheme(source)]
+	if !ok {
+		return ""
+	}
+
+	_, source = getForcedGetter(source)
+	u, err := url.Parse(source)
+	if err != nil {
+		return ""
+	}
+
+	q := u.Query()
+	for _, p := range params {
+		if q.Get(p) != "" {
+			return ""
+		}
+	}
+
+	return fmt.Sprintf("source is not pinned to a version, set %q", params[0])
+}
+
 // TreeError is an error returned by Tree.Validate if an error occurs
 // with validation.
 type TreeError struct {
@@ -1,60 +1,940 @@
 package module
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
+
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/helper/multierror"
 )
 
-func TestTreeLoad(t *testing.T) {
-	storage := testStorage(t)
+func TestTreeLoad(t *testing.T) {
+	storage := testStorage(t)
+	tree := NewTree("", testConfig(t, "basic"))
+
+	if tree.Loaded() {
+		t.Fatal("should not be loaded")
+	}
+
+	// This should error because we haven't gotten things yet
+	if err := tree.Load(storage, GetModeNone); err == nil {
+		t.Fatal("should error")
+	}
+
+	if tree.Loaded() {
+		t.Fatal("should not be loaded")
+	}
+
+	// This should get things
+	if err := tree.Load(storage, GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !tree.Loaded() {
+		t.Fatal("should be loaded")
+	}
+
+	// This should no longer error
+	if err := tree.Load(storage, GetModeNone); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(tree.String())
+	expected := strings.TrimSpace(treeLoadStr)
+	if actual != expected {
+		t.Fatalf("bad: \n\n%s", actual)
+	}
+}
+
+func TestTreeLoad_alias(t *testing.T) {
+	storage := testStorage(t)
+	tree := NewTree("", testConfig(t, "alias"))
+
+	opts := &LoadOptions{
+		Mode:    GetModeGet,
+		Aliases: map[string]string{"foo": "./foo"},
+	}
+	if err := tree.LoadWithOptions(storage, opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(tree.String())
+	expected := strings.TrimSpace(treeLoadStr)
+	if actual != expected {
+		t.Fatalf("bad: \n\n%s", actual)
+	}
+
+	// Unknown aliases error
+	if err := tree.Load(storage, GetModeGet); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestTreeLoad_duplicate(t *testing.T) {
+	storage := testStorage(t)
+	tree := NewTree("", testConfig(t, "dup"))
+
+	if tree.Loaded() {
+		t.Fatal("should not be loaded")
+	}
+
+	// This should get things
+	if err := tree.Load(storage, GetModeGet); err == nil {
+		t.Fatalf("should error")
+	}
+}
+
+func TestTreeLoadCancel(t *testing.T) {
+	g := &testCancelGetter{Started: make(chan struct{})}
+	Getters["canceltest"] = g
+	defer delete(Getters, "canceltest")
+
+	storage := &FolderStorage{StorageDir: tempDir(t)}
+	tree := NewTree("", testConfig(t, "cancel"))
+
+	cancel := make(chan struct{})
+	go func() {
+		<-g.Started
+		close(cancel)
+	}()
+
+	err := tree.LoadCancel(storage, GetModeGet, cancel)
+	if err == nil || !strings.Contains(err.Error(), "canceled") {
+		t.Fatalf("bad: %v", err)
+	}
+	if tree.Loaded() {
+		t.Fatal("should not be loaded")
+	}
+
+	// Nothing but the lock file should be left in the storage
+	entries, err := ioutil.ReadDir(storage.StorageDir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".lock") {
+			t.Fatalf("bad: %s", e.Name())
+		}
+	}
+
+	// Nothing more is started once canceled
+	err = tree.LoadCancel(storage, GetModeGet, cancel)
+	if err == nil || !strings.Contains(err.Error(), "canceled") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestTreeLoadSubtree(t *testing.T) {
+	storage := testStorage(t)
+	tree := NewTree("", testConfig(t, "subtree"))
+
+	if err := tree.LoadSubtree(storage, GetModeGet, []string{"foo"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(tree.String())
+	expected := strings.TrimSpace(treeLoadSubtreeStr)
+	if actual != expected {
+		t.Fatalf("bad: \n\n%s", actual)
+	}
+
+	// The unrelated module shouldn't have been downloaded
+	source, err := Detect("./bar", tree.config.Dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, ok, err := storage.Dir(source); err != nil || ok {
+		t.Fatalf("bad: %#v %s", ok, err)
+	}
+
+	// Modules that don't exist error
+	err = tree.LoadSubtree(storage, GetModeGet, []string{"nope"})
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestTreeCheckSources(t *testing.T) {
+	tree := NewTree("", testConfig(t, "check-sources"))
+
+	err := tree.CheckSources(testStorage(t))
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	merr, ok := err.(*multierror.Error)
+	if !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+	if len(merr.Errors) != 2 {
+		t.Fatalf("bad: %s", err)
+	}
+	for i, name := range []string{"bar", "baz"} {
+		if !strings.HasPrefix(merr.Errors[i].Error(), "module "+name+":") {
+			t.Fatalf("%d: bad: %s", i, merr.Errors[i])
+		}
+	}
+}
+
+func TestTreeCheckSources_good(t *testing.T) {
+	tree := NewTree("", testConfig(t, "basic"))
+
+	if err := tree.CheckSources(testStorage(t)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestTreeOrphans(t *testing.T) {
+	storage := testStorage(t)
+	if err := storage.Get(testModule("pins/other"), false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	tree := NewTree("", testConfig(t, "basic"))
+	if _, err := tree.Orphans(storage); err == nil {
+		t.Fatal("should error when not loaded")
+	}
+	if err := tree.Load(storage, GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual, err := tree.Orphans(storage)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{testModule("pins/other")}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// The plan is the same, and nothing is removed
+	actual, err = tree.PrunePlan(storage)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if _, ok, err := storage.Dir(testModule("pins/other")); err != nil || !ok {
+		t.Fatalf("bad: %v %s", ok, err)
+	}
+}
+
+func TestTreeOrphans_subdir(t *testing.T) {
+	dir := tempDir(t)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testWriteFile(t, filepath.Join(dir, "main.tf"), fmt.Sprintf(`
+module "foo" {
+    source = "%s//foo"
+}
+`, testModule("basic")))
+
+	tree, err := NewTreeModule("", dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	storage := testStorage(t)
+	if err := tree.Load(storage, GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The module is stored without its subdirectory, and is still in use
+	actual, err := tree.Orphans(storage)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(actual) != 0 {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestTreeOrphans_lock(t *testing.T) {
+	old := Getters["http"]
+	defer func() { Getters["http"] = old }()
+	Getters["http"] = new(testCacheGetter)
+
+	tree := NewTree("", testTreeSourceConfig(t, "http://example.com/foo"))
+	lock := &Lockfile{Modules: map[string]string{
+		"foo": "http://example.com/foo?ref=v1.0.0",
+	}}
+	storage := &testSourcesStorage{Storage: testStorage(t)}
+	if err := tree.LoadFromLock(storage, lock); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	testTreeLoadedSources(t, tree, storage,
+		"http://example.com/foo?ref=v1.0.0", "example.com")
+}
+
+func TestTreeOrphans_constraints(t *testing.T) {
+	old := Getters["registry"]
+	defer func() { Getters["registry"] = old }()
+	Getters["registry"] = new(testCacheGetter)
+
+	tree := NewTree("", testTreeSourceConfig(t,
+		"registry::https://registry.example.com/hashicorp/vpc/aws"))
+	storage := &testSourcesStorage{Storage: testStorage(t)}
+	err := tree.LoadWithOptions(storage, &LoadOptions{
+		Mode: GetModeGet,
+		Constraints: map[string]string{
+			"registry.example.com/hashicorp/vpc/aws": ">= 2.0, < 3.0",
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	testTreeLoadedSources(t, tree, storage,
+		"registry::https://registry.example.com/hashicorp/vpc/aws?version=%3E%3D+2.0%2C+%3C+3.0",
+		"registry.example.com")
+}
+
+// testTreeSourceConfig returns the configuration of a tree that imports
+// the source as "foo".
+func testTreeSourceConfig(t *testing.T, source string) *config.Config {
+	dir := tempDir(t)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testWriteFile(t, filepath.Join(dir, "main.tf"), fmt.Sprintf(`
+module "foo" {
+    source = "%s"
+}
+`, source))
+
+	c, err := config.LoadDir(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return c
+}
+
+// testTreeLoadedSources checks that the tree, which imports "foo" from
+// source on host once it is loaded, is queried with that source.
+func testTreeLoadedSources(
+	t *testing.T, tree *Tree, storage *testSourcesStorage, source, host string) {
+	orphans, err := tree.Orphans(storage)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(orphans) != 0 {
+		t.Fatalf("bad: %#v", orphans)
+	}
+
+	storage.Sources = nil
+	if _, err := tree.HasUpdates(storage); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := tree.CheckSources(storage); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if expected := []string{source, source}; !reflect.DeepEqual(storage.Sources, expected) {
+		t.Fatalf("bad: %#v", storage.Sources)
+	}
+
+	hosts, err := tree.SourcesByHost()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(hosts, map[string][]string{host: []string{"foo"}}) {
+		t.Fatalf("bad: %#v", hosts)
+	}
+}
+
+// testSourcesStorage is a Storage that records the sources that it is
+// asked to check for updates and to check.
+type testSourcesStorage struct {
+	Storage
+
+	Sources []string
+}
+
+func (s *testSourcesStorage) List() ([]string, error) {
+	return s.Storage.(ListStorage).List()
+}
+
+func (s *testSourcesStorage) UpdateAvailable(source string) (bool, error) {
+	s.Sources = append(s.Sources, source)
+	return false, nil
+}
+
+func (s *testSourcesStorage) Check(source string) error {
+	s.Sources = append(s.Sources, source)
+	return nil
+}
+
+func TestTreeLoad_hook(t *testing.T) {
+	var paths []string
+	opts := &LoadOptions{Mode: GetModeGet}
+	opts.Hook = func(path string, c *config.Config) error {
+		paths = append(paths, path)
+
+		// Removing the modules means they're never loaded
+		if path != "" {
+			c.Modules = nil
+		}
+		return nil
+	}
+
+	tree := NewTree("", testConfig(t, "pins"))
+	if err := tree.LoadWithOptions(testStorage(t), opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual(paths, []string{"", "foo"}) {
+		t.Fatalf("bad: %#v", paths)
+	}
+	if len(tree.Children()["foo"].Children()) != 0 {
+		t.Fatalf("bad: %#v", tree.Children()["foo"].Children())
+	}
+
+	// The root can be changed as well
+	opts.Hook = func(path string, c *config.Config) error {
+		if path == "" {
+			c.Modules = nil
+		}
+		return nil
+	}
+	if err := tree.LoadWithOptions(testStorage(t), opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(tree.Children()) != 0 {
+		t.Fatalf("bad: %#v", tree.Children())
+	}
+}
+
+func TestTreeLoad_hookError(t *testing.T) {
+	opts := &LoadOptions{Mode: GetModeGet}
+	opts.Hook = func(path string, c *config.Config) error {
+		if path == "foo.bar" {
+			return fmt.Errorf("nope")
+		}
+
+		return nil
+	}
+
+	tree := NewTree("", testConfig(t, "pins"))
+	err := tree.LoadWithOptions(testStorage(t), opts)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if err.Error() != "module bar: nope" {
+		t.Fatalf("bad: %s", err)
+	}
+
+	opts.Hook = func(path string, c *config.Config) error {
+		return fmt.Errorf("nope")
+	}
+	err = tree.LoadWithOptions(testStorage(t), opts)
+	if err == nil || err.Error() != "module <root>: nope" {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestTreeLoad_importSelf(t *testing.T) {
+	tree := NewTree("", testConfig(t, "import-self/child"))
+
+	err := tree.Load(testStorage(t), GetModeGet)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if err.Error() != "module me: module cannot import itself" {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestTreeLoad_importSelfChild(t *testing.T) {
+	tree := NewTree("", testConfig(t, "import-self"))
+
+	err := tree.Load(testStorage(t), GetModeGet)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if err.Error() != "module me: module cannot import itself" {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestTreeLoad_mixedFormats(t *testing.T) {
+	tree := NewTree("", testConfig(t, "mixed-formats"))
+
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Both formats are merged within each module
+	if len(tree.config.Variables) != 1 || len(tree.config.Modules) != 1 {
+		t.Fatalf("bad: %#v", tree.config)
+	}
+	child := tree.Children()["child"]
+	if len(child.config.Variables) != 1 || len(child.config.Outputs) != 1 {
+		t.Fatalf("bad: %#v", child.config)
+	}
+
+	// And the modules can be wired together across formats
+	if err := tree.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestTreeLoad_concurrency(t *testing.T) {
+	for _, n := range []int{0, 1, 10} {
+		storage := testStorage(t)
+		tree := NewTree("", testConfig(t, "subtree"))
+		err := tree.LoadWithOptions(storage, &LoadOptions{
+			Mode:        GetModeGet,
+			Concurrency: n,
+		})
+		if err != nil {
+			t.Fatalf("%d: err: %s", n, err)
+		}
+
+		if len(tree.Children()) != 2 {
+			t.Fatalf("%d: bad: %#v", n, tree.Children())
+		}
+	}
+}
+
+func TestLoadStateConcurrency(t *testing.T) {
+	cases := []struct {
+		Concurrency int
+		Result      int
+	}{
+		{0, DefaultLoadConcurrency},
+		{-1, DefaultLoadConcurrency},
+		{1, 1},
+		{8, 8},
+	}
+
+	for i, tc := range cases {
+		l := newLoadState(&LoadOptions{Concurrency: tc.Concurrency})
+		if actual := l.concurrency(); actual != tc.Result {
+			t.Fatalf("%d: bad: %d", i, actual)
+		}
+	}
+}
+
+func TestTreeLoad_noConfig(t *testing.T) {
+	storage := testStorage(t)
+	tree := NewTree("", testConfig(t, "no-config"))
+
+	err := tree.Load(storage, GetModeGet)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "no Terraform configuration found") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestTreeLoad_sourceFile(t *testing.T) {
+	Getters["filetest"] = &testVersionGetter{Version: "1"}
+	defer delete(Getters, "filetest")
+
+	storage := testStorage(t)
+	tree := NewTree("", testConfig(t, "source-file"))
+
+	err := tree.Load(storage, GetModeGet)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	expected := "module foo: source resolved to a file, expected a directory"
+	if err.Error() != expected {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestTreeLoad_parseErrors(t *testing.T) {
+	// By default the load stops at the first module that can't be parsed
+	tree := NewTree("", testConfig(t, "parse-errors"))
+	err := tree.Load(testStorage(t), GetModeGet)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if _, ok := err.(*multierror.Error); ok {
+		t.Fatalf("bad: %s", err)
+	}
+
+	opts := &LoadOptions{Mode: GetModeGet, CollectParseErrors: true}
+	tree = NewTree("", testConfig(t, "parse-errors"))
+	err = tree.LoadWithOptions(testStorage(t), opts)
+	merr, ok := err.(*multierror.Error)
+	if !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+
+	var actual []string
+	for _, err := range merr.Errors {
+		actual = append(actual, strings.SplitN(err.Error(), ":", 2)[0])
+	}
+	expected := []string{"module a", "module b.c", "module d"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", merr.Errors)
+	}
+	if tree.Loaded() {
+		t.Fatal("should not be loaded")
+	}
+
+	// Only the modules along the path are loaded
+	opts.Prefix = []string{"b", "c"}
+	tree = NewTree("", testConfig(t, "parse-errors"))
+	err = tree.LoadWithOptions(testStorage(t), opts)
+	merr, ok = err.(*multierror.Error)
+	if !ok || len(merr.Errors) != 1 {
+		t.Fatalf("bad: %#v", err)
+	}
+	if !strings.HasPrefix(merr.Errors[0].Error(), "module b.c: ") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestTreeLoadBounded(t *testing.T) {
+	cases := []struct {
+		Fixture string
+		Err     bool
+	}{
+		{"validate-child-good", false},
+		{"validate-child-bad", true},
+		{"validate-bad-var", true},
+		{"validate-root-bad", true},
+		{"load-bounded-nested", true},
+	}
+
+	for _, tc := range cases {
+		storage := testStorage(t)
+		tree := NewTree("", testConfig(t, tc.Fixture))
+		err := tree.LoadBounded(storage, GetModeGet)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Fixture, err)
+		}
+		if tree.Loaded() {
+			t.Fatalf("%s: should not be loaded", tc.Fixture)
+		}
+
+		// The errors are the same as those of Validate
+		expected := NewTree("", testConfig(t, tc.Fixture))
+		if err := expected.Load(storage, GetModeNone); err != nil {
+			t.Fatalf("%s: err: %s", tc.Fixture, err)
+		}
+		if verr := expected.Validate(); fmt.Sprint(verr) != fmt.Sprint(err) {
+			t.Fatalf("%s: bad: %s\n\n%s", tc.Fixture, err, verr)
+		}
+	}
+}
+
+func TestTreeLoadBounded_wide(t *testing.T) {
+	var paths []string
+	opts := &LoadOptions{Mode: GetModeGet}
+	opts.Hook = func(path string, c *config.Config) error {
+		paths = append(paths, path)
+		return nil
+	}
+
+	tree := NewTree("", testConfig(t, "load-bounded-wide"))
+	if err := tree.LoadBoundedWithOptions(testStorage(t), opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Every module at a level is parsed before the level beneath it
+	expected := []string{"", "a", "b", "c", "a.x", "b.x", "c.x"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("bad: %#v", paths)
+	}
+}
+
+func TestTreeLoad_noSource(t *testing.T) {
+	storage := testStorage(t)
+	tree := NewTree("", testConfig(t, "no-source"))
+
+	err := tree.Load(storage, GetModeGet)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "source is required") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestTreeDot(t *testing.T) {
+	tree := NewTree("", testConfig(t, "basic"))
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(tree.Dot())
+	expected := strings.TrimSpace(treeDotStr)
+	if actual != expected {
+		t.Fatalf("bad: \n\n%s", actual)
+	}
+}
+
+func TestTreeHasUpdates(t *testing.T) {
+	storage := testStorage(t)
+	tree := NewTree("", testConfig(t, "basic"))
+
+	if _, err := tree.HasUpdates(storage); err == nil {
+		t.Fatal("should error")
+	}
+
+	if err := tree.Load(storage, GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual, err := tree.HasUpdates(storage)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]bool{"foo": false}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Storages that can't tell always have an update available
+	actual, err = tree.HasUpdates(&testBasicStorage{storage})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected = map[string]bool{"foo": true}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestTree_basicStorage(t *testing.T) {
+	storage := &testBasicStorage{testStorage(t)}
 	tree := NewTree("", testConfig(t, "basic"))
+	if err := tree.Load(storage, GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := tree.CheckSources(storage); err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-	if tree.Loaded() {
-		t.Fatal("should not be loaded")
+	// The orphans can't be known without listing the storage
+	if _, err := tree.Orphans(storage); err == nil {
+		t.Fatal("should error")
 	}
+}
 
-	// This should error because we haven't gotten things yet
-	if err := tree.Load(storage, GetModeNone); err == nil {
+// testBasicStorage is a Storage that only implements Dir and Get, like
+// Storages from outside this package that predate the optional interfaces.
+type testBasicStorage struct {
+	Storage
+}
+
+func TestTreeSourcesByHost(t *testing.T) {
+	tree := NewTree("", testConfig(t, "basic"))
+	if _, err := tree.SourcesByHost(); err == nil {
 		t.Fatal("should error")
 	}
 
-	if tree.Loaded() {
-		t.Fatal("should not be loaded")
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	// This should get things
-	if err := tree.Load(storage, GetModeGet); err != nil {
+	actual, err := tree.SourcesByHost()
+	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	if !tree.Loaded() {
-		t.Fatal("should be loaded")
+	expected := map[string][]string{"local": []string{"foo"}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
 	}
+}
 
-	// This should no longer error
-	if err := tree.Load(storage, GetModeNone); err != nil {
+func TestTreeLint(t *testing.T) {
+	tree := NewTree("", testConfig(t, "lint"))
+	actual := tree.Lint()
+	sort.Strings(actual)
+
+	if len(actual) != 2 {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if !strings.HasPrefix(actual[0], "module git:") {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if !strings.HasPrefix(actual[1], "module http:") {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestTreeLint_duplicates(t *testing.T) {
+	old := LintMaxDuplicates
+	defer func() { LintMaxDuplicates = old }()
+
+	tree := NewTree("", testConfig(t, "lint-duplicates"))
+
+	LintMaxDuplicates = 4
+	if actual := tree.Lint(); len(actual) != 0 {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	LintMaxDuplicates = 3
+	actual := tree.Lint()
+	if len(actual) != 1 {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if !strings.Contains(actual[0], "imported 4 times (a, b, c, d)") {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestTreeLint_variants(t *testing.T) {
+	tree := NewTree("", testConfig(t, "lint-variants"))
+	actual := tree.Lint()
+	if len(actual) != 1 {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	expected := "source git::https://github.com/hashicorp/foo.git?ref=v1.0 " +
+		"is written in different ways (" +
+		"git::https://github.com/hashicorp/foo.git?ref=v1.0, " +
+		"github.com/hashicorp/foo?ref=v1.0)"
+	if !strings.HasPrefix(actual[0], expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestTreeLint_skew(t *testing.T) {
+	tree := NewTree("", testConfig(t, "lint-skew"))
+	actual := tree.Lint()
+	if len(actual) != 1 {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	expected := "source git::https://example.com/foo.git is pinned to " +
+		"different versions (v1.0 in a, c; v1.1 in b)"
+	if !strings.HasPrefix(actual[0], expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestTreeVersionSkew(t *testing.T) {
+	tree := NewTree("", testConfig(t, "lint-skew"))
+	actual := tree.VersionSkew()
+	expected := []SourceVersions{
+		{
+			Source: "git::https://example.com/foo.git",
+			Versions: map[string][]string{
+				"v1.0": []string{"a", "c"},
+				"v1.1": []string{"b"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Sources pinned to one version have no skew
+	tree = NewTree("", testConfig(t, "lint-variants"))
+	if actual := tree.VersionSkew(); len(actual) != 0 {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestTreeLint_unused(t *testing.T) {
+	tree := NewTree("", testConfig(t, "lint-unused"))
+
+	// Unloaded modules can't be checked
+	if actual := tree.Lint(); len(actual) != 0 {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	actual := tree.Lint()
+	if len(actual) != 1 {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if !strings.HasPrefix(actual[0], "module unused: possibly unused") {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestTreeLint_documentation(t *testing.T) {
+	tree := NewTree("", testConfig(t, "lint-documentation"))
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(tree.String())
-	expected := strings.TrimSpace(treeLoadStr)
-	if actual != expected {
-		t.Fatalf("bad: \n\n%s", actual)
+	// Documentation isn't checked by default
+	if actual := tree.Lint(); len(actual) != 0 {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	defer func(v bool) { LintDocumentation = v }(LintDocumentation)
+	LintDocumentation = true
+
+	actual := tree.Lint()
+	expected := []string{
+		"module child: variable undocumented has no description",
+		"module child: output undocumented has no description",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
 	}
 }
 
-func TestTreeLoad_duplicate(t *testing.T) {
-	storage := testStorage(t)
-	tree := NewTree("", testConfig(t, "dup"))
+func TestTreeLintStrict(t *testing.T) {
+	tree := NewTree("", testConfig(t, "lint"))
+	err := tree.LintStrict()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "warning: module git:") {
+		t.Fatalf("bad: %s", err)
+	}
+	if !strings.Contains(err.Error(), "warning: module http:") {
+		t.Fatalf("bad: %s", err)
+	}
 
-	if tree.Loaded() {
-		t.Fatal("should not be loaded")
+	tree = NewTree("", testConfig(t, "basic"))
+	if err := tree.LintStrict(); err != nil {
+		t.Fatalf("err: %s", err)
 	}
+}
 
-	// This should get things
-	if err := tree.Load(storage, GetModeGet); err == nil {
-		t.Fatalf("should error")
+func TestTreeValidateStrict(t *testing.T) {
+	tree := NewTree("", testConfig(t, "lint-unused"))
+	if err := tree.ValidateStrict(); err == nil {
+		t.Fatal("should error")
+	}
+
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Warnings are only errors when strict
+	if err := tree.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	err := tree.ValidateStrict()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "module unused: possibly unused") {
+		t.Fatalf("bad: %s", err)
+	}
+
+	tree = NewTree("", testConfig(t, "validate-child-good"))
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := tree.ValidateStrict(); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 }
 
@@ -71,6 +951,29 @@ func TestTreeModules(t *testing.T) {
 	}
 }
 
+func TestTreeModules_sorted(t *testing.T) {
+	tree := NewTree("", testConfig(t, "check-sources"))
+
+	expected := []*Module{
+		&Module{Name: "bar", Source: "./bar"},
+		&Module{Name: "baz", Source: "./baz"},
+		&Module{Name: "foo", Source: "./foo"},
+	}
+
+	// The order is the same on every call and for every load
+	for i := 0; i < 3; i++ {
+		actual := NewTree("", testConfig(t, "check-sources")).Modules()
+		if !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("bad: %#v", actual)
+		}
+
+		actual = tree.Modules()
+		if !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("bad: %#v", actual)
+		}
+	}
+}
+
 func TestTreeName(t *testing.T) {
 	tree := NewTree("", testConfig(t, "basic"))
 	actual := tree.Name()
@@ -128,6 +1031,195 @@ func TestTreeValidate_badRoot(t *testing.T) {
 	}
 }
 
+func TestTreeValidate_selfReference(t *testing.T) {
+	tree := NewTree("", testConfig(t, "validate-self-ref"))
+
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err := tree.Validate()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if _, ok := err.(*TreeError); !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+	if !strings.Contains(err.Error(), "module.child.memory") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestTreeValidate_varType(t *testing.T) {
+	tree := NewTree("", testConfig(t, "validate-var-type"))
+
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err := tree.Validate()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if _, ok := err.(*TreeError); !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+	if !strings.Contains(err.Error(), "variable bad: default must be a string") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestTreeValidate_multiple(t *testing.T) {
+	old := ValidateConcurrency
+	defer func() { ValidateConcurrency = old }()
+
+	tree := NewTree("", testConfig(t, "validate-multi"))
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The errors of every child are returned, in the same order no matter
+	// how many are validated at once
+	for _, n := range []int{1, 2, 8} {
+		ValidateConcurrency = n
+
+		err := tree.Validate()
+		if err == nil {
+			t.Fatalf("%d: should error", n)
+		}
+		merr, ok := err.(*multierror.Error)
+		if !ok {
+			t.Fatalf("%d: bad: %#v", n, err)
+		}
+		if len(merr.Errors) != 2 {
+			t.Fatalf("%d: bad: %s", n, err)
+		}
+		for i, name := range []string{"a", "b"} {
+			verr, ok := merr.Errors[i].(*TreeError)
+			if !ok {
+				t.Fatalf("%d: bad: %#v", n, merr.Errors[i])
+			}
+			if verr.Name[0] != name {
+				t.Fatalf("%d: bad: %s", n, verr)
+			}
+		}
+	}
+}
+
+func TestValidateVariableTypes(t *testing.T) {
+	cases := []struct {
+		Type    string
+		Default interface{}
+		Err     bool
+	}{
+		{"", map[string]interface{}{"foo": "bar"}, false},
+		{"string", "foo", false},
+		{"string", nil, false},
+		{"map", map[string]interface{}{"foo": "bar"}, false},
+		{"map", nil, false},
+		{"string", map[string]interface{}{"foo": "bar"}, true},
+		{"map", "foo", true},
+		{"list", nil, true},
+	}
+
+	for i, tc := range cases {
+		c := &config.Config{
+			Variables: []*config.Variable{
+				&config.Variable{
+					Name:         "foo",
+					DeclaredType: tc.Type,
+					Default:      tc.Default,
+				},
+			},
+		}
+
+		err := validateVariableTypes(c)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+	}
+}
+
+func TestTreeValidate_partial(t *testing.T) {
+	tree := NewTree("", testConfig(t, "subtree"))
+
+	err := tree.LoadSubtree(testStorage(t), GetModeGet, []string{"foo"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = tree.Validate()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if _, ok := err.(*TreeError); !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+	if !strings.Contains(err.Error(), "module bar: not loaded") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestTreeValidateWiring(t *testing.T) {
+	// The child configuration is invalid, but the wiring is fine
+	tree := NewTree("", testConfig(t, "validate-child-bad"))
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := tree.ValidateWiring(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	tree = NewTree("", testConfig(t, "validate-bad-output"))
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := tree.ValidateWiring(); err == nil {
+		t.Fatal("should error")
+	}
+
+	tree = NewTree("", testConfig(t, "validate-bad-var"))
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := tree.ValidateWiring(); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestTreeValidateWiring_outputUndefined(t *testing.T) {
+	tree := NewTree("", testConfig(t, "validate-output-undefined"))
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err := tree.ValidateWiring()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "module child") {
+		t.Fatalf("bad: %s", err)
+	}
+	if !strings.Contains(err.Error(), "output ip: references undefined resource aws_instance.missing") {
+		t.Fatalf("bad: %s", err)
+	}
+	if !strings.Contains(err.Error(), "output name: references undefined variable var.missing") {
+		t.Fatalf("bad: %s", err)
+	}
+
+	if err := tree.Validate(); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestTreeValidateWiring_notLoaded(t *testing.T) {
+	tree := NewTree("", testConfig(t, "basic"))
+
+	if err := tree.ValidateWiring(); err == nil {
+		t.Fatal("should error")
+	}
+}
+
 func TestTreeValidate_good(t *testing.T) {
 	tree := NewTree("", testConfig(t, "validate-child-good"))
 
@@ -153,3 +1245,38 @@ const treeLoadStr = `
 <root>
   foo
 `
+
+const treeLoadSubtreeStr = `
+<root>
+  foo
+`
+
+const treeDotStr = `
+digraph {
+	"<root>";
+	"<root>" -> "foo" [label="file"];
+	"foo";
+}
+`
+
+// testCancelGetter is an OptionsGetter that writes part of a module and
+// then waits to be canceled.
+type testCancelGetter struct {
+	testGetter
+
+	Started chan struct{}
+}
+
+func (g *testCancelGetter) GetWithOptions(dst string, opts *GetOptions) error {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(
+		filepath.Join(dst, "main.tf"), []byte("# Partial"), 0644); err != nil {
+		return err
+	}
+
+	close(g.Started)
+	<-opts.Cancel
+	return fmt.Errorf("canceled")
+}
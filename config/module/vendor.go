@@ -0,0 +1,184 @@
+package module
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// VendorFile is the name of the file that Tree.Vendor writes into the
+// vendor directory to record which vendored copy each module uses.
+const VendorFile = "modules.json"
+
+// vendorUnsafeRegexp matches the characters that aren't kept in the names
+// of vendored copies.
+var vendorUnsafeRegexp = regexp.MustCompile(`[^A-Za-z0-9._=@+/-]`)
+
+// Vendor copies the downloaded directory of every module in the tree into
+// dir, so that the tree can later be loaded without the network, such as
+// with Vendored set. Each copy is named after its source, for example
+// "github.com/hashicorp/example.git@ref=v1.0.0", and modules that share a
+// source share a copy. Version control metadata such as ".git" isn't
+// copied, so dir can be committed along with the configuration.
+//
+// Local sources aren't copied since they are available offline already.
+// This includes the local modules within a vendored module, which are
+// found within its copy when it is loaded.
+//
+// The copy that each module uses is recorded in the file VendorFile in
+// dir, which LoadVendorFile reads as the LoadOptions.Pins of the later
+// load. Running Vendor again replaces the copies of the modules in the
+// tree and the record of them, but leaves anything else in dir alone.
+//
+// Load must be called prior to calling Vendor or an error will be
+// returned.
+func (t *Tree) Vendor(s Storage, dir string) error {
+	if !t.Loaded() {
+		return fmt.Errorf("tree must be loaded before calling Vendor")
+	}
+
+	copies := make(map[string]string)
+	names := make(map[string]struct{})
+	result := make(map[string]string)
+	err := t.walkModules(func(p []string, parent *Tree, m *Module) error {
+		key := strings.Join(p, ".")
+		c, ok := parent.Children()[m.Name]
+		if !ok {
+			return fmt.Errorf("module %s: not loaded", key)
+		}
+		if getScheme(c.origin) == "file" {
+			return nil
+		}
+
+		name, ok := copies[c.origin]
+		if !ok {
+			name = vendorName(c.origin, names)
+			if err := vendorCopy(s, c.origin, filepath.Join(dir, name)); err != nil {
+				return fmt.Errorf("module %s: %s", key, err)
+			}
+
+			copies[c.origin] = name
+			names[name] = struct{}{}
+		}
+
+		result[key] = name
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(result, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(
+		filepath.Join(dir, VendorFile), append(data, '\n'), 0644)
+}
+
+// LoadVendorFile reads the VendorFile that Vendor wrote into dir. The
+// result maps the path of each vendored module to the absolute path of its
+// copy within dir, and can be assigned to LoadOptions.Pins.
+func LoadVendorFile(dir string) (map[string]string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(abs, VendorFile)
+	result, err := LoadPinsFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, name := range result {
+		p := filepath.Join(abs, filepath.FromSlash(name))
+		if rel, err := filepath.Rel(abs, p); err != nil || strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf(
+				"error reading vendor file %s: %s is outside of %s", path, name, dir)
+		}
+
+		result[k] = p
+	}
+
+	return result, nil
+}
+
+// vendorName returns the slash separated name of the vendored copy of the
+// detected source, which is made unique among the names that are taken.
+func vendorName(source string, taken map[string]struct{}) string {
+	_, src := getForcedGetter(source)
+
+	name := src
+	if u, err := url.Parse(src); err == nil {
+		name = u.Host + u.Path
+		if u.RawQuery != "" {
+			name += "@" + u.RawQuery
+		}
+	}
+
+	// Nothing may escape the vendor directory or be hidden
+	var parts []string
+	for _, part := range strings.Split(name, "/") {
+		part = vendorUnsafeRegexp.ReplaceAllString(part, "_")
+		if part == "" {
+			continue
+		}
+		if strings.HasPrefix(part, ".") {
+			part = "_" + part
+		}
+
+		parts = append(parts, part)
+	}
+	name = path.Join(parts...)
+	if name == "" {
+		name = "module"
+	}
+
+	result := name
+	for i := 2; ; i++ {
+		if _, ok := taken[result]; !ok {
+			return result
+		}
+
+		result = name + "-" + strconv.Itoa(i)
+	}
+}
+
+// vendorCopy replaces dst with a copy of the downloaded directory of the
+// source, without version control metadata.
+func vendorCopy(s Storage, source, dst string) error {
+	dir, ok, err := s.Dir(source)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("not found, may need to be downloaded")
+	}
+
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := copyDir(dst, dir); err != nil {
+		return err
+	}
+
+	for _, n := range []string{".git", ".hg", ".svn"} {
+		if err := os.RemoveAll(filepath.Join(dst, n)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
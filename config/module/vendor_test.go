@@ -0,0 +1,132 @@
+package module
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTreeVendor(t *testing.T) {
+	Getters["vendortest"] = new(testVendorGetter)
+	defer delete(Getters, "vendortest")
+
+	tree := NewTree("", testConfig(t, "vendor"))
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dir := tempDir(t)
+	if err := tree.Vendor(testStorage(t), dir); err == nil {
+		t.Fatal("should error without the modules downloaded")
+	}
+
+	storage := testStorage(t)
+	if err := tree.Load(storage, GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := tree.Vendor(storage, dir); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Modules that share a source share a copy, and local modules aren't
+	// copied
+	pins, err := LoadVendorFile(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	copied := filepath.Join(dir, "example.com", "foo@ref=v1.0.0")
+	expected := map[string]string{"a": copied, "b": copied}
+	if !reflect.DeepEqual(pins, expected) {
+		t.Fatalf("bad: %#v", pins)
+	}
+	if _, err := os.Stat(filepath.Join(copied, "sub", "main.tf")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(copied, ".git")); err == nil {
+		t.Fatal(".git should not be copied")
+	}
+
+	// The vendored tree loads without the remote source
+	delete(Getters, "vendortest")
+	old := Vendored
+	defer func() { Vendored = old }()
+	Vendored = true
+
+	vendored := NewTree("", testConfig(t, "vendor"))
+	err = vendored.LoadWithOptions(testStorage(t), &LoadOptions{
+		Mode: GetModeGet,
+		Pins: pins,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, n := range []string{"a", "b"} {
+		c := vendored.Children()[n]
+		if c == nil || c.Children()["sub"] == nil {
+			t.Fatalf("%s: bad: \n\n%s", n, vendored)
+		}
+		actual, err := filepath.EvalSymlinks(c.config.Dir)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if expected, _ := filepath.EvalSymlinks(copied); actual != expected {
+			t.Fatalf("%s: bad: %s", n, actual)
+		}
+	}
+}
+
+func TestLoadVendorFile_outside(t *testing.T) {
+	dir := tempDir(t)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testWriteFile(t, filepath.Join(dir, VendorFile), `{"foo": "../evil"}`)
+
+	if _, err := LoadVendorFile(dir); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestVendorName(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output string
+	}{
+		{
+			"git::https://github.com/hashicorp/foo.git?ref=v1.0.0",
+			"github.com/hashicorp/foo.git@ref=v1.0.0",
+		},
+		{
+			"registry::registry.example.com/hashicorp/vpc/aws?version=1.2.3",
+			"registry.example.com/hashicorp/vpc/aws@version=1.2.3",
+		},
+		{
+			"https://example.com/../.hidden/foo bar.tar.gz",
+			"example.com/_../_.hidden/foo_bar.tar.gz",
+		},
+		{"taken://example.com/foo", "example.com/foo-2"},
+	}
+
+	taken := map[string]struct{}{"example.com/foo": struct{}{}}
+	for _, tc := range cases {
+		if actual := vendorName(tc.Input, taken); actual != tc.Output {
+			t.Fatalf("%s: bad: %s", tc.Input, actual)
+		}
+	}
+}
+
+// testVendorGetter is a Getter that "downloads" the vendor-remote fixture,
+// along with version control metadata.
+type testVendorGetter struct {
+	testGetter
+}
+
+func (g *testVendorGetter) Get(dst string, u *url.URL) error {
+	if err := copyDir(dst, filepath.Join(fixtureDir, "vendor-remote")); err != nil {
+		return err
+	}
+
+	return os.MkdirAll(filepath.Join(dst, ".git"), 0755)
+}
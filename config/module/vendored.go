@@ -0,0 +1,34 @@
+package module
+
+import (
+	"fmt"
+)
+
+// Vendored, if true, forbids modules from being downloaded over the
+// network, for fully offline and reproducible builds where every module
+// is vendored into the repository. Detect and Get return an error for any
+// source that isn't local, rather than just not downloading it like
+// GetModeNone, and detectors that look sources up over the network, such
+// as for BitBucket, aren't allowed to.
+//
+// Unlike the settings in LoadOptions, this is global, since Detect, Get,
+// and the Detectors and Getters within them are used outside of loads and
+// aren't given their options.
+var Vendored bool
+
+// checkVendored returns an error if only local sources can be used and
+// the detected source isn't local.
+func checkVendored(source string) error {
+	if !Vendored || getScheme(source) == "file" {
+		return nil
+	}
+
+	return vendoredError(source)
+}
+
+// vendoredError returns the error for using the source src, which isn't
+// local, when only vendored modules can be used.
+func vendoredError(src string) error {
+	return fmt.Errorf(
+		"source %s is not local, only vendored modules can be used", src)
+}
@@ -0,0 +1,75 @@
+package module
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetect_vendored(t *testing.T) {
+	old := Vendored
+	defer func() { Vendored = old }()
+	Vendored = true
+
+	cases := []struct {
+		Input string
+		Err   bool
+	}{
+		{"./foo", false},
+		{"/foo", false},
+		{"file::./foo", false},
+		{"github.com/hashicorp/foo", true},
+		{"git::https://example.com/foo.git", true},
+		{"https://example.com/foo.tar.gz", true},
+		{"bitbucket.org/hashicorp/foo", true},
+	}
+
+	for _, tc := range cases {
+		_, err := Detect(tc.Input, "/pwd")
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %v", tc.Input, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "only vendored modules") {
+			t.Fatalf("%s: bad: %s", tc.Input, err)
+		}
+	}
+}
+
+func TestGet_vendored(t *testing.T) {
+	old := Vendored
+	defer func() { Vendored = old }()
+	Vendored = true
+
+	if err := Get(tempDir(t), testModule("basic")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err := Get(tempDir(t), "git::https://example.com/foo.git")
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "only vendored modules") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestTreeLoad_vendored(t *testing.T) {
+	old := Vendored
+	defer func() { Vendored = old }()
+	Vendored = true
+
+	tree := NewTree("", testConfig(t, "basic"))
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Remote sources are an error even without downloading anything
+	tree = NewTree("", testConfig(t, "lint"))
+	err := tree.Load(testStorage(t), GetModeNone)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.HasPrefix(err.Error(), "module ") ||
+		!strings.Contains(err.Error(), "only vendored modules") {
+		t.Fatalf("bad: %s", err)
+	}
+}
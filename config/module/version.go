@@ -0,0 +1,170 @@
+package module
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// version is a parsed module version of the form MAJOR.MINOR.PATCH with
+// an optional "v" prefix and "-prerelease" suffix. Missing segments
+// are zero.
+type version struct {
+	Segments   []int
+	Prerelease string
+
+	// specified is the number of segments that were actually written,
+	// which matters for the "~>" operator.
+	specified int
+}
+
+func parseVersion(v string) (*version, error) {
+	raw := strings.TrimPrefix(strings.TrimSpace(v), "v")
+	result := &version{Segments: make([]int, 3)}
+	if idx := strings.Index(raw, "-"); idx >= 0 {
+		result.Prerelease = raw[idx+1:]
+		raw = raw[:idx]
+	}
+
+	parts := strings.Split(raw, ".")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid version: %s", v)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version: %s", v)
+		}
+
+		result.Segments[i] = n
+	}
+	result.specified = len(parts)
+
+	return result, nil
+}
+
+// Compare returns -1, 0, or 1 if this version is less than, equal to,
+// or greater than the other version. A prerelease is less than the
+// release that it precedes.
+func (v *version) Compare(other *version) int {
+	for i := range v.Segments {
+		if v.Segments[i] < other.Segments[i] {
+			return -1
+		} else if v.Segments[i] > other.Segments[i] {
+			return 1
+		}
+	}
+
+	switch {
+	case v.Prerelease == other.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case other.Prerelease == "":
+		return -1
+	case v.Prerelease < other.Prerelease:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// versionConstraint is a set of conditions that a version must all
+// satisfy, such as ">= 1.0, < 2.0".
+type versionConstraint []versionCondition
+
+type versionCondition struct {
+	Op      string
+	Version *version
+}
+
+// parseVersionConstraint parses a comma separated list of conditions.
+// A blank constraint allows any version that isn't a prerelease.
+func parseVersionConstraint(v string) (versionConstraint, error) {
+	var result versionConstraint
+	if strings.TrimSpace(v) == "" {
+		return result, nil
+	}
+
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+
+		op := "="
+		for _, candidate := range []string{"~>", ">=", "<=", "!=", ">", "<", "="} {
+			if strings.HasPrefix(part, candidate) {
+				op = candidate
+				part = strings.TrimSpace(part[len(candidate):])
+				break
+			}
+		}
+
+		ver, err := parseVersion(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint %q: %s", v, err)
+		}
+
+		result = append(result, versionCondition{Op: op, Version: ver})
+	}
+
+	return result, nil
+}
+
+// Check returns whether the version satisfies the constraint. Prereleases
+// only satisfy a constraint that explicitly asks for that exact version.
+func (c versionConstraint) Check(v *version) bool {
+	if v.Prerelease != "" {
+		for _, cond := range c {
+			if cond.Op == "=" && cond.Version.Compare(v) == 0 {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, cond := range c {
+		if !cond.check(v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *versionCondition) check(v *version) bool {
+	cmp := v.Compare(c.Version)
+	switch c.Op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case "~>":
+		// Only the last specified segment may increase: "~> 1.2" allows
+		// 1.x from 1.2 up, "~> 1.2.3" allows 1.2.x from 1.2.3 up.
+		if cmp < 0 {
+			return false
+		}
+
+		fixed := c.Version.specified - 1
+		if fixed < 1 {
+			fixed = 1
+		}
+		for i := 0; i < fixed; i++ {
+			if v.Segments[i] != c.Version.Segments[i] {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
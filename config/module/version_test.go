@@ -0,0 +1,101 @@
+package module
+
+import (
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	cases := []struct {
+		Input string
+		Err   bool
+	}{
+		{"1.2.3", false},
+		{"v1.2.3", false},
+		{"1.2", false},
+		{"1.2.3-beta1", false},
+		{"1.2.3.4", true},
+		{"foo", true},
+		{"", true},
+	}
+
+	for i, tc := range cases {
+		_, err := parseVersion(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%d: bad err: %s", i, err)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	cases := []struct {
+		A, B   string
+		Result int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2", "1.2.0", 0},
+		{"1.2.3", "1.2.4", -1},
+		{"2.0.0", "1.9.9", 1},
+		{"1.0.0-beta", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-beta", -1},
+	}
+
+	for i, tc := range cases {
+		a, err := parseVersion(tc.A)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		b, err := parseVersion(tc.B)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if actual := a.Compare(b); actual != tc.Result {
+			t.Fatalf("%d: bad: %d", i, actual)
+		}
+	}
+}
+
+func TestVersionConstraint(t *testing.T) {
+	cases := []struct {
+		Constraint string
+		Version    string
+		Result     bool
+	}{
+		{"", "1.0.0", true},
+		{"", "1.0.0-beta", false},
+		{"1.0.0", "1.0.0", true},
+		{"= 1.0.0", "1.0.1", false},
+		{"!= 1.0.0", "1.0.1", true},
+		{">= 1.0, < 2.0", "1.5.0", true},
+		{">= 1.0, < 2.0", "2.0.0", false},
+		{"> 1.0", "1.0.0", false},
+		{"<= 1.0", "1.0.0", true},
+		{"~> 1.2", "1.9.0", true},
+		{"~> 1.2", "2.0.0", false},
+		{"~> 1.2", "1.1.0", false},
+		{"~> 1.2.3", "1.2.9", true},
+		{"~> 1.2.3", "1.3.0", false},
+		{"1.0.0-beta", "1.0.0-beta", true},
+	}
+
+	for i, tc := range cases {
+		c, err := parseVersionConstraint(tc.Constraint)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		v, err := parseVersion(tc.Version)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+
+		if actual := c.Check(v); actual != tc.Result {
+			t.Fatalf("%d: bad: %#v", i, actual)
+		}
+	}
+}
+
+func TestVersionConstraint_invalid(t *testing.T) {
+	if _, err := parseVersionConstraint(">= foo"); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -0,0 +1,8 @@
+output "foo" {
+    value = "foo"
+    description = "The foo"
+}
+
+output "bar" {
+    value = "bar"
+}
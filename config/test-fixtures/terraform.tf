@@ -0,0 +1,13 @@
+terraform {
+    required_version = ">= 0.3.0"
+
+    required_providers {
+        aws = "~> 1.0"
+    }
+}
+
+terraform {
+    required_providers {
+        consul = ">= 0.1"
+    }
+}
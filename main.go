@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 
+	"github.com/hashicorp/terraform/config/module"
 	"github.com/hashicorp/terraform/plugin"
 	"github.com/mitchellh/cli"
 	"github.com/mitchellh/panicwrap"
@@ -91,6 +92,12 @@ func wrappedMain() int {
 	ContextOpts.Providers = config.ProviderFactories()
 	ContextOpts.Provisioners = config.ProvisionerFactories()
 
+	// Identify module downloads as coming from this version of Terraform
+	module.DefaultHttpUserAgent = "Terraform/" + Version
+	if VersionPrerelease != "" {
+		module.DefaultHttpUserAgent += "-" + VersionPrerelease
+	}
+
 	// Get the command line args. We shortcut "--version" and "-v" to
 	// just show the version.
 	args := os.Args[1:]